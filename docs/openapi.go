@@ -0,0 +1,418 @@
+package docs
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Operation describes one route of the API. Request and response bodies are given as
+// zero values of the DTO (e.g. utils.Task{}), the JSON schema is derived from them by reflection.
+type Operation struct {
+	Method      string
+	Path        string // fiber style path, e.g. /tasks/:id
+	Tag         string
+	Summary     string
+	Auth        bool
+	Admin       bool // implies Auth
+	Query       []Param
+	Headers     []Param
+	RequestBody any
+	Responses   map[int]Response
+}
+
+type Param struct {
+	Name        string
+	Description string
+	Schema      Schema
+	Required    bool
+}
+
+type Response struct {
+	Description string
+	Body        any // DTO value, slice of DTO, Object or Schema. nil means no body
+}
+
+// Schema is a raw JSON schema that is put into the document as is
+type Schema map[string]any
+
+// Object is an inline JSON object whose properties are DTO values or Schema (e.g. the fiber.Map responses)
+type Object map[string]any
+
+var (
+	String  = Schema{"type": "string"}
+	Integer = Schema{"type": "integer"}
+	Boolean = Schema{"type": "boolean"}
+)
+
+// Multipart is a multipart/form-data request body, its fields are DTO values or Schema
+type Multipart map[string]any
+
+// File is a file field of a Multipart body
+var File = Schema{"type": "string", "contentMediaType": "application/octet-stream"}
+
+// Binary is a response body of any media type, e.g. a downloaded file
+var Binary = Schema{"type": "string", "contentMediaType": "application/octet-stream"}
+
+// Message is the {"message": "..."} response body used by most handlers
+var Message = Object{"message": String}
+
+// Error is the {"error": "..."} response body
+var Error = Object{"error": String}
+
+// PlainText is the body of c.SendString(err.Error())
+var PlainText = Schema{"type": "string", "contentMediaType": "text/plain"}
+
+// HTML is the body of a page rendered for a browser
+var HTML = Schema{"type": "string", "contentMediaType": "text/html"}
+
+// Operations returns every registered operation sorted by path and method
+func Operations() []Operation {
+	ops := make([]Operation, len(operations))
+	copy(ops, operations)
+	sort.SliceStable(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// Spec builds the OpenAPI 3.1 document
+func Spec() fiber.Map {
+	g := &generator{components: fiber.Map{}}
+	paths := fiber.Map{}
+
+	for _, op := range Operations() {
+		path := openAPIPath(op.Path)
+		item, ok := paths[path].(fiber.Map)
+		if !ok {
+			item = fiber.Map{}
+			paths[path] = item
+		}
+
+		operation := fiber.Map{
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+		}
+
+		var params []fiber.Map
+		for _, name := range pathParams(op.Path) {
+			// ids are integers, tokens are the only other path params
+			schema := Integer
+			if name == "token" {
+				schema = String
+			}
+			params = append(params, fiber.Map{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   schema,
+			})
+		}
+		for _, q := range op.Query {
+			params = append(params, fiber.Map{
+				"name":        q.Name,
+				"in":          "query",
+				"description": q.Description,
+				"required":    q.Required,
+				"schema":      q.Schema,
+			})
+		}
+		headers := op.Headers
+		// the idempotency middleware applies to every POST route it allows
+		if op.Method == fiber.MethodPost && utils.IdempotentPath(op.Path) {
+			headers = append(headers[:len(headers):len(headers)], idempotencyKey)
+		}
+		for _, h := range headers {
+			params = append(params, fiber.Map{
+				"name":        h.Name,
+				"in":          "header",
+				"description": h.Description,
+				"required":    h.Required,
+				"schema":      h.Schema,
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if form, ok := op.RequestBody.(Multipart); ok {
+			operation["requestBody"] = fiber.Map{
+				"required": true,
+				"content": fiber.Map{
+					"multipart/form-data": fiber.Map{"schema": g.schemaOf(Object(form))},
+				},
+			}
+		} else if op.RequestBody != nil {
+			operation["requestBody"] = fiber.Map{
+				"required": true,
+				"content": fiber.Map{
+					"application/json": fiber.Map{"schema": g.schemaOf(op.RequestBody)},
+				},
+			}
+		}
+
+		responses := fiber.Map{}
+		for status, res := range op.Responses {
+			r := fiber.Map{"description": res.Description}
+			if res.Body != nil {
+				mediaType := "application/json"
+				if isPlainText(res.Body) {
+					mediaType = "text/plain"
+				} else if isHTML(res.Body) {
+					mediaType = "text/html"
+				} else if isBinary(res.Body) {
+					mediaType = "*/*"
+				}
+				r["content"] = fiber.Map{
+					mediaType: fiber.Map{"schema": g.schemaOf(res.Body)},
+				}
+			}
+			responses[strconv.Itoa(status)] = r
+		}
+		if op.Auth || op.Admin {
+			operation["security"] = []fiber.Map{{"cookieAuth": []string{}}, {"bearerAuth": []string{}}}
+			if _, ok := responses["401"]; !ok {
+				responses["401"] = fiber.Map{"description": "Missing or invalid JWT"}
+			}
+			if _, ok := responses["403"]; !ok {
+				description := "Account disabled, or email not verified and blocked by UNVERIFIED_USER_POLICY"
+				if op.Admin {
+					description = "Not an admin (impersonation tokens are never admins), or account disabled"
+				}
+				responses["403"] = fiber.Map{"description": description}
+			}
+		}
+		operation["responses"] = responses
+
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	g.components["ErrorMessage"] = PlainText
+
+	return fiber.Map{
+		"openapi": "3.1.0",
+		"info": fiber.Map{
+			"title":       "Task Management System",
+			"description": "Go REST API for task management system",
+			"version":     "1.0.0",
+		},
+		"paths": paths,
+		"components": fiber.Map{
+			"schemas": g.components,
+			"securitySchemes": fiber.Map{
+				"cookieAuth": fiber.Map{"type": "apiKey", "in": "cookie", "name": "jwt"},
+				"bearerAuth": fiber.Map{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+// MissingRoutes returns "METHOD /path" of every fiber route that has no operation in the document.
+// HEAD routes fiber adds for GET and paths in ignore are skipped.
+func MissingRoutes(routes []fiber.Route, ignore ...string) []string {
+	documented := map[string]bool{}
+	for _, op := range operations {
+		documented[op.Method+" "+op.Path] = true
+	}
+	ignored := map[string]bool{}
+	for _, path := range ignore {
+		ignored[path] = true
+	}
+
+	var missing []string
+	seen := map[string]bool{}
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		if route.Method == fiber.MethodHead || ignored[route.Path] || documented[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		missing = append(missing, key)
+	}
+	return missing
+}
+
+// /tasks/:id -> /tasks/{id}, /calendar/:token.ics -> /calendar/{token}.ics
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if name, suffix, ok := pathParam(part); ok {
+			parts[i] = "{" + name + "}" + suffix
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func pathParams(path string) []string {
+	var params []string
+	for _, part := range strings.Split(path, "/") {
+		if name, _, ok := pathParam(part); ok {
+			params = append(params, name)
+		}
+	}
+	return params
+}
+
+// pathParam splits a segment like :token.ics into the name of the param and the rest
+func pathParam(part string) (string, string, bool) {
+	if !strings.HasPrefix(part, ":") {
+		return "", "", false
+	}
+	name, suffix, found := strings.Cut(part[1:], ".")
+	if found {
+		suffix = "." + suffix
+	}
+	return name, suffix, true
+}
+
+// GET /tasks/:id -> getTasksId
+func operationID(op Operation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool { return r == '/' || r == ':' || r == '-' || r == '.' }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func isPlainText(body any) bool {
+	s, ok := body.(Schema)
+	return ok && s["contentMediaType"] == "text/plain"
+}
+
+func isHTML(body any) bool {
+	s, ok := body.(Schema)
+	return ok && s["contentMediaType"] == "text/html"
+}
+
+func isBinary(body any) bool {
+	s, ok := body.(Schema)
+	return ok && s["contentMediaType"] == "application/octet-stream"
+}
+
+type generator struct {
+	components fiber.Map
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (g *generator) schemaOf(v any) any {
+	switch body := v.(type) {
+	case Schema:
+		if isPlainText(body) {
+			return fiber.Map{"$ref": "#/components/schemas/ErrorMessage"}
+		}
+		return body
+	case Object:
+		props := fiber.Map{}
+		for name, value := range body {
+			props[name] = g.schemaOf(value)
+		}
+		return fiber.Map{"type": "object", "properties": props}
+	}
+	return g.schemaFor(reflect.TypeOf(v))
+}
+
+func (g *generator) schemaFor(t reflect.Type) any {
+	switch t {
+	case timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case deletedAtType:
+		return Schema{"type": []string{"string", "null"}, "format": "date-time"}
+	}
+
+	// *time.Time implements json.Marshaler too, look at the element first
+	if t.Kind() == reflect.Pointer {
+		return g.schemaFor(t.Elem())
+	}
+
+	// custom JSON like utils.JSONB can be anything
+	if t.Kind() != reflect.Struct && t.Implements(marshalerType) {
+		return fiber.Map{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return String
+	case reflect.Bool:
+		return Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Integer
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return fiber.Map{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return fiber.Map{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := g.components[name]; !ok {
+			// reserve the name first so self referencing structs don't recurse forever
+			g.components[name] = fiber.Map{}
+			g.components[name] = g.structSchema(t)
+		}
+		return fiber.Map{"$ref": "#/components/schemas/" + name}
+	}
+	return fiber.Map{}
+}
+
+// structSchema follows encoding/json rules: json tag names, "-" is skipped and
+// fields of embedded structs (gorm.Model) are promoted unless shadowed by a shallower field
+func (g *generator) structSchema(t reflect.Type) fiber.Map {
+	props := fiber.Map{}
+	var required []string
+	g.collectFields(t, props, &required, map[string]int{}, 0)
+
+	schema := fiber.Map{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *generator) collectFields(t reflect.Type, props fiber.Map, required *[]string, depths map[string]int, depth int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.collectFields(f.Type, props, required, depths, depth+1)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if d, ok := depths[name]; ok && d <= depth {
+			continue
+		}
+		depths[name] = depth
+
+		props[name] = g.schemaFor(f.Type)
+		if strings.Contains(f.Tag.Get("validate"), "required") && !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,1353 @@
+package docs
+
+import "github.com/Peeranut-Kit/go_backend_test/utils"
+
+// Every route registered in main.go has to be listed here, routes_test.go checks it with MissingRoutes
+var operations = []Operation{
+	// users
+	{
+		Method:      "POST",
+		Path:        "/register",
+		Tag:         "users",
+		Summary:     "Create a new user account",
+		RequestBody: utils.User{},
+		Responses: map[int]Response{
+			200: {Description: "User created", Body: Message},
+			400: {Description: "Invalid request body, or the password fails the policy or is breached", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/login",
+		Tag:         "users",
+		Summary:     "Log in and receive a JWT (also set as the jwt cookie)",
+		RequestBody: Object{"email": String, "password": String},
+		Responses: map[int]Response{
+			200: {Description: "Login success", Body: Object{"message": String, "token": String}},
+			400: {Description: "Invalid request body", Body: PlainText},
+			401: {Description: "Wrong email or password, unknown emails get the same response", Body: PlainText},
+			429: {Description: "Too many attempts from this IP or the account is locked, see Retry-After", Body: Object{"error": String, "unlock_at": Schema{"type": "string", "format": "date-time"}}},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/verify-email",
+		Tag:     "users",
+		Summary: "Page of the emailed link, it doesn't redeem the token but posts it to POST /verify-email as a form",
+		Query:   []Param{{Name: "token", Description: "Token from the verification email", Schema: String, Required: true}},
+		Responses: map[int]Response{
+			200: {Description: "Confirmation page", Body: HTML},
+			400: {Description: "Missing token", Body: HTML},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/verify-email",
+		Tag:         "users",
+		Summary:     "Verify the email address with the token from the verification email, a form body gets a page back",
+		RequestBody: utils.TokenRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Email verified", Body: Message},
+			400: {Description: "Missing, invalid, expired or used token", Body: Error},
+			409: {Description: "The new email of an email change was taken in the meantime", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/verify-email/resend",
+		Tag:         "users",
+		Summary:     "Send a new verification email, the response is the same for unknown emails",
+		RequestBody: utils.EmailRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Email sent if the account exists and is unverified", Body: Message},
+			400: {Description: "Invalid request body", Body: Error},
+			500: {Description: "Database or mailer error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/password/forgot",
+		Tag:         "users",
+		Summary:     "Email a single use password reset token, the response is the same for unknown emails",
+		RequestBody: utils.EmailRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Email sent if the account exists", Body: Message},
+			400: {Description: "Invalid request body", Body: Error},
+			500: {Description: "Database or mailer error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/password/reset",
+		Tag:     "users",
+		Summary: "Page of the emailed link, its form posts the token and the new password to POST /password/reset",
+		Query:   []Param{{Name: "token", Description: "Token from the password reset email", Schema: String, Required: true}},
+		Responses: map[int]Response{
+			200: {Description: "Password form", Body: HTML},
+			400: {Description: "Missing token", Body: HTML},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/password/reset",
+		Tag:         "users",
+		Summary:     "Set a new password with the token from the password reset email, a form body gets a page back",
+		RequestBody: utils.ResetPasswordRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Password changed", Body: Message},
+			400: {Description: "Invalid request body, invalid, expired or used token, or the password fails the policy", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/getme",
+		Tag:     "users",
+		Summary: "Get the user of the JWT",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Current user", Body: Object{"userID": String, "name": String}},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/me",
+		Tag:     "users",
+		Summary: "Get the profile of the current user",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Current user", Body: utils.UserProfile{}},
+		},
+	},
+	{
+		Method:      "PATCH",
+		Path:        "/me",
+		Tag:         "users",
+		Summary:     "Update the profile of the current user, use POST /me/email to change the email",
+		Auth:        true,
+		RequestBody: utils.UpdateProfileRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Profile updated", Body: Object{"message": String, "user": utils.UserProfile{}}},
+			400: {Description: "Invalid request body", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/me",
+		Tag:         "users",
+		Summary:     "Delete the account, its tasks are soft deleted and its personal data anonymized",
+		Auth:        true,
+		RequestBody: utils.DeleteAccountRequest{},
+		Responses: map[int]Response{
+			204: {Description: "Account deleted, the jwt cookie is cleared"},
+			400: {Description: "Invalid request body", Body: Error},
+			401: {Description: "Wrong password", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/me/email",
+		Tag:         "users",
+		Summary:     "Change the email, it is replaced once the new address is verified with POST /verify-email",
+		Auth:        true,
+		RequestBody: utils.ChangeEmailRequest{},
+		Responses: map[int]Response{
+			202: {Description: "Verification email sent to the new address", Body: Message},
+			400: {Description: "Invalid request body", Body: Error},
+			401: {Description: "Wrong password", Body: Error},
+			409: {Description: "Email already used", Body: Error},
+			500: {Description: "Database or mailer error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/me/password",
+		Tag:         "users",
+		Summary:     "Change the password, every other session is logged out",
+		Auth:        true,
+		RequestBody: utils.ChangePasswordRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Password changed, the new token is also set as the jwt cookie", Body: Object{"message": String, "token": String}},
+			400: {Description: "Invalid request body or the password fails the policy", Body: Error},
+			401: {Description: "Wrong current password", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/me/calendar",
+		Tag:     "calendar",
+		Summary: "Turn the calendar feed on or give it a new secret URL, the previous URL stops working",
+		Auth:    true,
+		Responses: map[int]Response{
+			201: {Description: "The feed URL, shown only this once", Body: Object{"message": String, "url": String, "webcal_url": String}},
+			403: {Description: "Not allowed while impersonating", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/me/calendar",
+		Tag:     "calendar",
+		Summary: "Turn the calendar feed off",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "The feed URL no longer works"},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/calendar/:token.ics",
+		Tag:     "calendar",
+		Summary: "iCalendar feed of your tasks with a due date as VTODO, no JWT needed, the token of the URL is the authorization",
+		Query: append([]Param{
+			{Name: "events", Description: "Add a VEVENT on the due date of each task, for calendars that don't show VTODO", Schema: Boolean},
+		}, withoutParam(taskFilterParams, "sort")...),
+		Headers: []Param{ifNoneMatch, {Name: "If-Modified-Since", Description: "Last-Modified of a previous response", Schema: String}},
+		Responses: map[int]Response{
+			200: {Description: "RFC 5545 text/calendar document, with ETag and Last-Modified", Body: Binary},
+			304: {Description: "No task of the feed changed"},
+			400: {Description: "Invalid filter", Body: PlainText},
+			404: {Description: "Unknown token, the feed was turned off or given a new URL", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+
+	// admin
+	{
+		Method:  "GET",
+		Path:    "/admin/users",
+		Tag:     "admin",
+		Summary: "List users",
+		Admin:   true,
+		Query: []Param{
+			{Name: "q", Description: "Search in email and name", Schema: String},
+			{Name: "page", Description: "Page number, from 1", Schema: Integer},
+			{Name: "page_size", Description: "Users per page, default 20, at most 100", Schema: Integer},
+		},
+		Responses: map[int]Response{
+			200: {Description: "A page of users", Body: utils.AdminUserList{}},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/admin/users/:id",
+		Tag:     "admin",
+		Summary: "Get a user with their task counts",
+		Admin:   true,
+		Responses: map[int]Response{
+			200: {Description: "The user", Body: utils.AdminUserDetail{}},
+			400: {Description: "Invalid user id", Body: PlainText},
+			404: {Description: "User not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/admin/users/:id/disable",
+		Tag:     "admin",
+		Summary: "Disable a user, their tokens stop working and they can't log in",
+		Admin:   true,
+		Responses: map[int]Response{
+			200: {Description: "User disabled", Body: Object{"message": String, "user": utils.AdminUser{}}},
+			400: {Description: "Invalid user id or own account", Body: PlainText},
+			404: {Description: "User not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/admin/users/:id/enable",
+		Tag:     "admin",
+		Summary: "Enable a disabled user",
+		Admin:   true,
+		Responses: map[int]Response{
+			200: {Description: "User enabled", Body: Object{"message": String, "user": utils.AdminUser{}}},
+			400: {Description: "Invalid user id", Body: PlainText},
+			404: {Description: "User not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/admin/users/:id/force-password-reset",
+		Tag:     "admin",
+		Summary: "Invalidate the password and sessions of a user and email them a reset token",
+		Admin:   true,
+		Responses: map[int]Response{
+			200: {Description: "Reset email sent", Body: Message},
+			400: {Description: "Invalid user id", Body: PlainText},
+			404: {Description: "User not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/admin/users/:id/impersonate",
+		Tag:     "admin",
+		Summary: "Get a one hour token of the user for support, send it as a bearer token",
+		Admin:   true,
+		Responses: map[int]Response{
+			200: {Description: "Impersonation token", Body: Object{"message": String, "token": String, "expires_at": Schema{"type": "string", "format": "date-time"}}},
+			400: {Description: "Invalid user id or user disabled", Body: PlainText},
+			404: {Description: "User not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/audit",
+		Tag:     "admin",
+		Summary: "Search the audit log, newest first",
+		Admin:   true,
+		Query: []Param{
+			{Name: "actor_id", Description: "User who did the action", Schema: Integer},
+			{Name: "action", Description: "e.g. task.update, user.login_failed", Schema: String},
+			{Name: "target_type", Description: "task or user", Schema: String},
+			{Name: "target_id", Description: "ID of the target, the email for failed logins", Schema: String},
+			{Name: "request_id", Description: "X-Request-Id of the request", Schema: String},
+			{Name: "from", Description: "Entries at or after this time (RFC 3339)", Schema: Schema{"type": "string", "format": "date-time"}},
+			{Name: "to", Description: "Entries before this time (RFC 3339)", Schema: Schema{"type": "string", "format": "date-time"}},
+			{Name: "page", Description: "Page number, from 1", Schema: Integer},
+			{Name: "page_size", Description: "Entries per page, default 20, at most 100", Schema: Integer},
+		},
+		Responses: map[int]Response{
+			200: {Description: "A page of audit entries", Body: utils.AuditEntryList{}},
+			400: {Description: "Invalid filter", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+
+	// tasks
+	{
+		Method:  "GET",
+		Path:    "/tasks",
+		Tag:     "tasks",
+		Summary: "List tasks",
+		Auth:    true,
+		Query:   taskFilterParams,
+		Headers: []Param{ifNoneMatch},
+		Responses: map[int]Response{
+			200: {Description: "The matching tasks, the ETag header covers the whole list", Body: []utils.Task{}},
+			304: {Description: "The list did not change since If-None-Match"},
+			400: {Description: "Invalid filter or sort", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks",
+		Tag:         "tasks",
+		Summary:     "Create a task, in your personal project unless project_id is given. Status defaults to todo and priority to medium",
+		Auth:        true,
+		RequestBody: utils.Task{},
+		Responses: map[int]Response{
+			200: {Description: "Task created", Body: Object{"message": String, "createdTask": utils.Task{}}},
+			400: {Description: "Invalid request body, priority, reminder offsets, parent or project", Body: PlainText},
+			403: {Description: "You are a viewer of the project", Body: PlainText},
+			409: {Description: "The parent is already at SUBTASK_MAX_DEPTH", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/overdue",
+		Tag:     "tasks",
+		Summary: "List the open tasks past their due date, sorted by due date unless ?sort= is given",
+		Auth:    true,
+		Query:   taskFilterParams,
+		Headers: []Param{ifNoneMatch},
+		Responses: map[int]Response{
+			200: {Description: "Overdue tasks", Body: []utils.Task{}},
+			304: {Description: "The list did not change since If-None-Match"},
+			400: {Description: "Invalid filter or sort", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/next",
+		Tag:     "dependencies",
+		Summary: "List the open tasks assigned to the current user in the order they can be worked on, blockers first",
+		Auth:    true,
+		Query: []Param{
+			{Name: "ready", Description: "Only the tasks without open blockers", Schema: Boolean},
+			{Name: "limit", Description: "Default 20, at most 100", Schema: Integer},
+		},
+		Responses: map[int]Response{
+			200: {Description: "Tasks in work order", Body: []utils.Task{}},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks/bulk",
+		Tag:         "tasks",
+		Summary:     "Create, update and delete up to BULK_MAX_OPERATIONS tasks, creates are inserted first in one batch",
+		Auth:        true,
+		RequestBody: utils.BulkRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Every operation succeeded", Body: utils.BulkResponse{}},
+			207: {Description: "best_effort mode, some operations failed, see their status", Body: utils.BulkResponse{}},
+			400: {Description: "Invalid request body or mode, or no operations", Body: PlainText},
+			413: {Description: "Too many operations", Body: PlainText},
+			422: {Description: "atomic mode, an operation failed and nothing was applied", Body: utils.BulkResponse{}},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/export",
+		Tag:     "tasks",
+		Summary: "Download your tasks as CSV, a JSON array or NDJSON, streamed in id order",
+		Auth:    true,
+		Query:   exportParams,
+		Responses: map[int]Response{
+			200: {Description: "The tasks as a file, CSV columns are the fields of the JSON items", Body: []utils.TaskRecord{}},
+			400: {Description: "Invalid format or filter", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks/import",
+		Tag:         "tasks",
+		Summary:     "Create tasks from a CSV, JSON array or NDJSON body in the export format, up to IMPORT_MAX_ROWS rows",
+		Auth:        true,
+		Query:       importParams,
+		RequestBody: []utils.TaskRecord{},
+		Responses: map[int]Response{
+			200: {Description: "Every row was created, skipped as a duplicate external_id or is valid (dry run)", Body: utils.ImportResponse{}},
+			207: {Description: "Some rows failed, see their error", Body: utils.ImportResponse{}},
+			400: {Description: "Unknown format, unreadable body or CSV header, or no rows", Body: PlainText},
+			413: {Description: "Too many rows", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/search",
+		Tag:     "tasks",
+		Summary: "Full text search in the titles and descriptions of your tasks, best match first",
+		Auth:    true,
+		Query:   searchParams,
+		Responses: map[int]Response{
+			200: {Description: "A page of results, the snippets are HTML escaped with the matches in <mark> tags", Body: utils.TaskSearchList{}},
+			400: {Description: "Missing or too long q, or invalid filter", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id",
+		Tag:     "tasks",
+		Summary: "Get a task",
+		Auth:    true,
+		Headers: []Param{ifNoneMatch},
+		Responses: map[int]Response{
+			200: {Description: "The task, its version is in the ETag header", Body: utils.Task{}},
+			304: {Description: "The task did not change since If-None-Match"},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/tasks/:id",
+		Tag:         "tasks",
+		Summary:     "Update the non empty fields of a task",
+		Auth:        true,
+		Query:       []Param{force},
+		Headers:     []Param{ifMatch},
+		RequestBody: utils.Task{},
+		Responses:   updateTaskResponses,
+	},
+	{
+		Method:      "PATCH",
+		Path:        "/tasks/:id",
+		Tag:         "tasks",
+		Summary:     "JSON merge patch of the editable fields, only the sent ones change and null clears due_at, reminder_offsets, title and description",
+		Auth:        true,
+		Query:       []Param{force},
+		Headers:     []Param{ifMatch},
+		RequestBody: utils.TaskFields{},
+		Responses:   updateTaskResponses,
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id",
+		Tag:     "tasks",
+		Summary: "Soft delete a task",
+		Auth:    true,
+		Headers: []Param{ifMatch},
+		Responses: map[int]Response{
+			204: {Description: "Task deleted"},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			412: {Description: "If-Match is not the current ETag", Body: PlainText},
+			428: {Description: "If-Match is missing and IF_MATCH_POLICY=require", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/history",
+		Tag:     "tasks",
+		Summary: "List the revisions of a task, oldest first (deleted tasks included)",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Revisions", Body: []utils.TaskRevision{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/tasks/:id/revert/:rev",
+		Tag:     "tasks",
+		Summary: "Restore the editable fields of a revision, recorded as a new revision. A different status has to be allowed by the workflow",
+		Auth:    true,
+		Query:   []Param{force},
+		Responses: map[int]Response{
+			200: {Description: "Task reverted", Body: Object{"message": String, "revertedTask": utils.Task{}}},
+			400: {Description: "Invalid task id or revision", Body: PlainText},
+			404: {Description: "Task or revision not found", Body: PlainText},
+			409: {Description: "The workflow doesn't allow the status of the revision, or open blockers prevent done without force", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks/:id/transitions",
+		Tag:         "tasks",
+		Summary:     "Move the task to another status allowed by the workflow (TASK_TRANSITIONS)",
+		Auth:        true,
+		Query:       []Param{force},
+		Headers:     []Param{ifMatch},
+		RequestBody: utils.TransitionRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Task moved, allowed lists the statuses it can move to next", Body: Object{"message": String, "updatedTask": utils.Task{}, "allowed": []string{}}},
+			400: {Description: "Invalid task id, request body or status", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			409: {Description: "The workflow doesn't allow this transition, or the task has open blockers", Body: PlainText},
+			412: {Description: "If-Match is not the current ETag", Body: PlainText},
+			428: {Description: "If-Match is missing and IF_MATCH_POLICY=require", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/subtasks",
+		Tag:     "subtasks",
+		Summary: "List the direct subtasks of a task with their progress",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Subtasks", Body: []utils.Task{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/tasks/:id/parent",
+		Tag:         "subtasks",
+		Summary:     "Move a task under another one, a null parent_id makes it a top level task",
+		Auth:        true,
+		RequestBody: utils.MoveTaskRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Task moved", Body: Object{"message": String, "updatedTask": utils.Task{}}},
+			400: {Description: "Invalid task id, request body or parent", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			409: {Description: "The move would make a cycle or go deeper than SUBTASK_MAX_DEPTH", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/tasks/:id/project",
+		Tag:         "projects",
+		Summary:     "Move a top level task and its subtasks to another project where you are an editor",
+		Auth:        true,
+		RequestBody: utils.MoveProjectRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Task moved, dependencies with tasks left behind are removed", Body: Object{"message": String, "updatedTask": utils.Task{}}},
+			400: {Description: "Invalid task id, request body or project, or the task is a subtask", Body: PlainText},
+			403: {Description: "You are a viewer of one of the projects", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/tasks/:id/recurrence",
+		Tag:         "tasks",
+		Summary:     "Make a task with a due date recur, closing it creates the next occurrence",
+		Auth:        true,
+		RequestBody: utils.RecurrenceRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Recurrence set", Body: Object{"message": String, "updatedTask": utils.Task{}}},
+			400: {Description: "Invalid task id, rule or time zone, or the task has no due date", Body: PlainText},
+			403: {Description: "You aren't allowed to edit the task", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id/recurrence",
+		Tag:     "tasks",
+		Summary: "Stop a task from recurring, occurrences created already stay",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Recurrence stopped", Body: Object{"message": String, "updatedTask": utils.Task{}}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			403: {Description: "You aren't allowed to edit the task", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/tasks/:id/assignee",
+		Tag:         "assignees",
+		Summary:     "Assign a task to a member of its project, allowed to its author and the editors",
+		Auth:        true,
+		RequestBody: utils.AssignRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Task assigned, the assignee is notified", Body: Object{"message": String, "updatedTask": utils.Task{}}},
+			400: {Description: "Invalid task id or request body, or the assignee isn't an editor of the project", Body: PlainText},
+			403: {Description: "You are a viewer and not the author of the task", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id/assignee",
+		Tag:     "assignees",
+		Summary: "Unassign a task",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Task unassigned", Body: Object{"message": String, "updatedTask": utils.Task{}}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			403: {Description: "You are a viewer and not the author of the task", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/watchers",
+		Tag:     "assignees",
+		Summary: "List the users watching a task",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Watchers", Body: []utils.TaskWatcher{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/tasks/:id/watchers",
+		Tag:     "assignees",
+		Summary: "Watch a task to be notified of its changes, viewers included",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "You are watching the task"},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id/watchers",
+		Tag:     "assignees",
+		Summary: "Stop watching a task",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "You aren't watching the task anymore"},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found or not watched", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/comments",
+		Tag:     "comments",
+		Summary: "List the comments of a task, oldest first",
+		Auth:    true,
+		Query: []Param{
+			{Name: "page", Description: "Page number, from 1", Schema: Integer},
+			{Name: "page_size", Description: "Comments per page, default 20, at most 100", Schema: Integer},
+		},
+		Responses: map[int]Response{
+			200: {Description: "A page of comments, body_html is the sanitized rendering of the Markdown body", Body: utils.CommentList{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks/:id/comments",
+		Tag:         "comments",
+		Summary:     "Comment on a task in Markdown, the members mentioned as @email are notified",
+		Auth:        true,
+		RequestBody: utils.CommentRequest{},
+		Responses: map[int]Response{
+			201: {Description: "Comment created", Body: utils.Comment{}},
+			400: {Description: "Invalid task id or request body", Body: Error},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/tasks/:id/comments/:commentId",
+		Tag:         "comments",
+		Summary:     "Edit your comment, only the newly mentioned members are notified",
+		Auth:        true,
+		RequestBody: utils.CommentRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Comment edited", Body: utils.Comment{}},
+			400: {Description: "Invalid id or request body", Body: Error},
+			403: {Description: "You are not the author", Body: PlainText},
+			404: {Description: "Task or comment not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id/comments/:commentId",
+		Tag:     "comments",
+		Summary: "Delete a comment, allowed to its author and the owners of the project",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "Comment deleted"},
+			400: {Description: "Invalid id", Body: PlainText},
+			403: {Description: "You are neither the author nor an owner", Body: PlainText},
+			404: {Description: "Task or comment not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/attachments",
+		Tag:     "attachments",
+		Summary: "List the files attached to a task, with download links signed for ATTACHMENT_URL_TTL",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Attachments", Body: []utils.Attachment{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks/:id/attachments",
+		Tag:         "attachments",
+		Summary:     "Attach a file, its type is sniffed from the content and must be one of ATTACHMENT_TYPES",
+		Auth:        true,
+		RequestBody: Multipart{"file": File},
+		Responses: map[int]Response{
+			201: {Description: "File attached", Body: utils.Attachment{}},
+			400: {Description: "Invalid task id or no file field", Body: Error},
+			404: {Description: "Task not found", Body: PlainText},
+			413: {Description: "The file is larger than ATTACHMENT_MAX_SIZE", Body: Object{"error": String, "max_size": Integer}},
+			415: {Description: "This type of file is not accepted", Body: Error},
+			500: {Description: "Database or blob store error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/attachments/:attachmentId",
+		Tag:     "attachments",
+		Summary: "Get an attachment with a fresh download link",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Attachment", Body: utils.Attachment{}},
+			400: {Description: "Invalid id", Body: PlainText},
+			404: {Description: "Task or attachment not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id/attachments/:attachmentId",
+		Tag:     "attachments",
+		Summary: "Delete an attachment and its file",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "Attachment deleted"},
+			400: {Description: "Invalid id", Body: PlainText},
+			404: {Description: "Task or attachment not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/attachments/:id/download",
+		Tag:     "attachments",
+		Summary: "Download an attachment with the download_url of the attachment, no token needed",
+		Query: []Param{
+			{Name: "expires", Description: "Unix time the link expires at", Schema: Integer, Required: true},
+			{Name: "signature", Description: "Signature of the link", Schema: String, Required: true},
+		},
+		Responses: map[int]Response{
+			200: {Description: "The file, images are inline and other files are downloads", Body: Binary},
+			400: {Description: "Invalid id or expires", Body: PlainText},
+			404: {Description: "The link is invalid or expired, or the attachment was deleted", Body: PlainText},
+			500: {Description: "Database or blob store error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/tasks/:id/restore",
+		Tag:     "subtasks",
+		Summary: "Undo the delete of a task and of the subtasks deleted with it",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Task restored", Body: Object{"message": String, "restoredTask": utils.Task{}}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "No deleted task with this id", Body: PlainText},
+			409: {Description: "The parent task is still deleted", Body: PlainText},
+			410: {Description: "The task was deleted longer than TASK_RESTORE_WINDOW ago", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/dependencies",
+		Tag:     "dependencies",
+		Summary: "List the tasks blocking a task, closed ones included",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Blocking tasks", Body: []utils.Task{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks/:id/dependencies",
+		Tag:         "dependencies",
+		Summary:     "Make a task blocked by another one, adding an existing dependency changes nothing",
+		Auth:        true,
+		RequestBody: utils.DependencyRequest{},
+		Responses: map[int]Response{
+			200: {Description: "The blocked task", Body: utils.Task{}},
+			400: {Description: "Invalid task id, request body or blocking task", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			409: {Description: "The dependency would make a cycle", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id/dependencies/:blockerId",
+		Tag:     "dependencies",
+		Summary: "Remove a dependency",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "The task that was blocked", Body: utils.Task{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "The task isn't blocked by this task", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/dependents",
+		Tag:     "dependencies",
+		Summary: "List the tasks blocked by a task",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Blocked tasks", Body: []utils.Task{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/tasks/:id/checklist",
+		Tag:     "subtasks",
+		Summary: "List the checklist items of a task by position",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Checklist items", Body: []utils.ChecklistItem{}},
+			400: {Description: "Invalid task id", Body: PlainText},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks/:id/checklist",
+		Tag:         "subtasks",
+		Summary:     "Add a checklist item, it goes last unless position is given",
+		Auth:        true,
+		RequestBody: utils.ChecklistItemRequest{},
+		Responses: map[int]Response{
+			201: {Description: "Item created", Body: utils.ChecklistItem{}},
+			400: {Description: "Invalid task id or request body", Body: Error},
+			404: {Description: "Task not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PATCH",
+		Path:        "/tasks/:id/checklist/:itemId",
+		Tag:         "subtasks",
+		Summary:     "Change the title, done flag or position of a checklist item",
+		Auth:        true,
+		RequestBody: utils.ChecklistItemRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Item updated", Body: utils.ChecklistItem{}},
+			400: {Description: "Invalid id or request body", Body: Error},
+			404: {Description: "Item not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id/checklist/:itemId",
+		Tag:     "subtasks",
+		Summary: "Delete a checklist item",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "Item deleted"},
+			400: {Description: "Invalid id", Body: PlainText},
+			404: {Description: "Item not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tasks/:id/labels",
+		Tag:         "labels",
+		Summary:     "Attach labels of the current user to a task, already attached ones are skipped",
+		Auth:        true,
+		RequestBody: utils.AttachLabelsRequest{},
+		Responses: map[int]Response{
+			200: {Description: "The task with its labels", Body: utils.Task{}},
+			400: {Description: "Invalid task id or request body", Body: Error},
+			404: {Description: "Task or label not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/tasks/:id/labels/:labelId",
+		Tag:     "labels",
+		Summary: "Detach a label of the current user from a task",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "The task with its labels", Body: utils.Task{}},
+			400: {Description: "Invalid task or label id", Body: PlainText},
+			404: {Description: "The label is not attached to the task", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+
+	// projects
+	{
+		Method:  "GET",
+		Path:    "/projects",
+		Tag:     "projects",
+		Summary: "List your projects with your role, the personal project first",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Projects", Body: []utils.Project{}},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/projects",
+		Tag:         "projects",
+		Summary:     "Create a project, you are its owner",
+		Auth:        true,
+		RequestBody: utils.ProjectRequest{},
+		Responses: map[int]Response{
+			201: {Description: "Project created", Body: utils.Project{}},
+			400: {Description: "Invalid request body", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/projects/:id",
+		Tag:     "projects",
+		Summary: "Get a project you are a member of",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "The project with your role", Body: utils.Project{}},
+			400: {Description: "Invalid project id", Body: PlainText},
+			404: {Description: "Project not found or you are not a member", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/projects/:id",
+		Tag:         "projects",
+		Summary:     "Rename a project (owners)",
+		Auth:        true,
+		RequestBody: utils.ProjectRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Project updated", Body: utils.Project{}},
+			400: {Description: "Invalid project id or request body", Body: Error},
+			403: {Description: "You are not an owner", Body: Error},
+			404: {Description: "Project not found or you are not a member", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/projects/:id",
+		Tag:     "projects",
+		Summary: "Delete a project and its tasks (owners), personal projects can't be deleted",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "Project deleted"},
+			400: {Description: "Invalid project id", Body: PlainText},
+			403: {Description: "You are not an owner", Body: Error},
+			404: {Description: "Project not found or you are not a member", Body: PlainText},
+			409: {Description: "Personal project", Body: Error},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/projects/:id/members",
+		Tag:     "projects",
+		Summary: "List the members of a project",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Members", Body: []utils.ProjectMember{}},
+			400: {Description: "Invalid project id", Body: PlainText},
+			404: {Description: "Project not found or you are not a member", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/projects/:id/members/:userId",
+		Tag:         "projects",
+		Summary:     "Change the role of a member (owners)",
+		Auth:        true,
+		RequestBody: utils.MemberRoleRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Role changed", Body: Object{"message": String}},
+			400: {Description: "Invalid id or request body", Body: Error},
+			403: {Description: "You are not an owner", Body: Error},
+			404: {Description: "Project or member not found", Body: PlainText},
+			409: {Description: "The project would be left without owner", Body: Error},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/projects/:id/members/:userId",
+		Tag:     "projects",
+		Summary: "Remove a member (owners), or leave the project with your own user id",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "Member removed"},
+			400: {Description: "Invalid id", Body: PlainText},
+			403: {Description: "You are not an owner", Body: Error},
+			404: {Description: "Project or member not found", Body: PlainText},
+			409: {Description: "The project would be left without owner", Body: Error},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/projects/:id/invitations",
+		Tag:     "projects",
+		Summary: "List the pending invitations of a project (owners)",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Invitations", Body: []utils.ProjectInvitation{}},
+			400: {Description: "Invalid project id", Body: PlainText},
+			403: {Description: "You are not an owner", Body: Error},
+			404: {Description: "Project not found or you are not a member", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/projects/:id/invitations",
+		Tag:         "projects",
+		Summary:     "Invite an email to a project with a role (owners), the invitation is emailed and expires after 7 days",
+		Auth:        true,
+		RequestBody: utils.InvitationRequest{},
+		Responses: map[int]Response{
+			201: {Description: "Invitation sent", Body: utils.ProjectInvitation{}},
+			400: {Description: "Invalid project id or request body", Body: Error},
+			403: {Description: "You are not an owner", Body: Error},
+			404: {Description: "Project not found or you are not a member", Body: PlainText},
+			409: {Description: "Personal project, or the email is already a member", Body: Error},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/projects/:id/invitations/:invitationId",
+		Tag:     "projects",
+		Summary: "Revoke an invitation (owners)",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "Invitation revoked"},
+			400: {Description: "Invalid id", Body: PlainText},
+			403: {Description: "You are not an owner", Body: Error},
+			404: {Description: "Project or invitation not found", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/invitations",
+		Tag:     "projects",
+		Summary: "List the pending invitations sent to your verified email",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Invitations with the project names", Body: []utils.ProjectInvitation{}},
+			403: {Description: "Your email is not verified", Body: Error},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/invitations/:id/accept",
+		Tag:     "projects",
+		Summary: "Join the project of an invitation sent to your verified email",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "You are a member", Body: Object{"message": String, "project_id": Integer, "role": String}},
+			400: {Description: "Invalid invitation id", Body: PlainText},
+			403: {Description: "Your email is not verified", Body: Error},
+			404: {Description: "Invitation not found", Body: PlainText},
+			409: {Description: "Already answered, expired, or you are already a member", Body: Error},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/invitations/:id/decline",
+		Tag:     "projects",
+		Summary: "Decline an invitation sent to your verified email",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Invitation declined", Body: Object{"message": String}},
+			400: {Description: "Invalid invitation id", Body: PlainText},
+			403: {Description: "Your email is not verified", Body: Error},
+			404: {Description: "Invitation not found", Body: PlainText},
+			409: {Description: "Already answered or expired", Body: Error},
+		},
+	},
+
+	// webhooks
+	{
+		Method:  "GET",
+		Path:    "/webhooks",
+		Tag:     "webhooks",
+		Summary: "List the webhooks of the current user",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Webhooks sorted by id", Body: []utils.Webhook{}},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/webhooks",
+		Tag:         "webhooks",
+		Summary:     "Subscribe a URL to task events of a project, or of all your projects without project_id. The secret signing the payloads is only returned here.",
+		Auth:        true,
+		RequestBody: utils.WebhookRequest{},
+		Responses: map[int]Response{
+			201: {Description: "Webhook created", Body: Object{"webhook": utils.Webhook{}, "secret": String}},
+			400: {Description: "Invalid URL, events or project", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/webhooks/:id",
+		Tag:     "webhooks",
+		Summary: "Get a webhook",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Webhook found", Body: utils.Webhook{}},
+			400: {Description: "Invalid webhook id", Body: PlainText},
+			404: {Description: "Webhook not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/webhooks/:id",
+		Tag:         "webhooks",
+		Summary:     "Change the URL, project, events or active flag of a webhook, inactive webhooks hold their deliveries",
+		Auth:        true,
+		RequestBody: utils.WebhookRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Webhook updated", Body: utils.Webhook{}},
+			400: {Description: "Invalid webhook id, URL, events or project", Body: Error},
+			404: {Description: "Webhook not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/webhooks/:id",
+		Tag:     "webhooks",
+		Summary: "Delete a webhook with its pending deliveries and delivery log",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "Webhook deleted"},
+			400: {Description: "Invalid webhook id", Body: PlainText},
+			404: {Description: "Webhook not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "GET",
+		Path:    "/webhooks/:id/deliveries",
+		Tag:     "webhooks",
+		Summary: "Delivery log of a webhook, newest first",
+		Auth:    true,
+		Query: []Param{
+			{Name: "status", Description: "pending, delivered or failed", Schema: String},
+			{Name: "page", Description: "Page number, from 1", Schema: Integer},
+			{Name: "page_size", Description: "Deliveries per page, default 20, at most 100", Schema: Integer},
+		},
+		Responses: map[int]Response{
+			200: {Description: "A page of deliveries", Body: utils.WebhookDeliveryList{}},
+			400: {Description: "Invalid webhook id or status", Body: PlainText},
+			404: {Description: "Webhook not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "POST",
+		Path:    "/webhooks/:id/test",
+		Tag:     "webhooks",
+		Summary: "Send a ping event to the webhook right away, it is attempted once",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "The delivery of the ping, delivered or failed", Body: utils.WebhookDelivery{}},
+			400: {Description: "Invalid webhook id", Body: PlainText},
+			404: {Description: "Webhook not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+
+	// labels
+	{
+		Method:  "GET",
+		Path:    "/labels",
+		Tag:     "labels",
+		Summary: "List the labels of the current user",
+		Auth:    true,
+		Responses: map[int]Response{
+			200: {Description: "Labels sorted by name", Body: []utils.Label{}},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "POST",
+		Path:        "/labels",
+		Tag:         "labels",
+		Summary:     "Create a label, the color defaults to #808080",
+		Auth:        true,
+		RequestBody: utils.LabelRequest{},
+		Responses: map[int]Response{
+			201: {Description: "Label created", Body: utils.Label{}},
+			400: {Description: "Invalid name or color", Body: Error},
+			409: {Description: "A label with this name exists", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/labels/:id",
+		Tag:         "labels",
+		Summary:     "Rename a label or change its color",
+		Auth:        true,
+		RequestBody: utils.LabelRequest{},
+		Responses: map[int]Response{
+			200: {Description: "Label updated", Body: utils.Label{}},
+			400: {Description: "Invalid label id, name or color", Body: Error},
+			404: {Description: "Label not found", Body: PlainText},
+			409: {Description: "A label with this name exists", Body: Error},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+	{
+		Method:  "DELETE",
+		Path:    "/labels/:id",
+		Tag:     "labels",
+		Summary: "Delete a label, it is detached from every task",
+		Auth:    true,
+		Responses: map[int]Response{
+			204: {Description: "Label deleted"},
+			400: {Description: "Invalid label id", Body: PlainText},
+			404: {Description: "Label not found", Body: PlainText},
+			500: {Description: "Database error", Body: PlainText},
+		},
+	},
+}
+
+var ifNoneMatch = Param{Name: "If-None-Match", Description: "ETag from a previous response, 304 when it is still current", Schema: String}
+
+var ifMatch = Param{Name: "If-Match", Description: "ETag of the task being changed, required when IF_MATCH_POLICY=require. Weak W/ tags never match", Schema: String}
+
+var idempotencyKey = Param{Name: "Idempotency-Key", Description: "Unique key of the request, a retry with the same key and body replays the first response (Idempotent-Replayed: true), another body gets 422 and a retry while the first one runs gets 409", Schema: String}
+
+var force = Param{Name: "force", Description: "Complete the task even though tasks blocking it are still open", Schema: Boolean}
+
+var updateTaskResponses = map[int]Response{
+	200: {Description: "Task updated", Body: Object{"message": String, "updatedTask": utils.Task{}}},
+	400: {Description: "Invalid task id, request body, priority or reminder offsets", Body: PlainText},
+	403: {Description: "You are a viewer of the project of the task", Body: PlainText},
+	404: {Description: "Task not found", Body: PlainText},
+	409: {Description: "The status change isn't allowed by the workflow for the task or one of the open subtasks it closes, or they have open blockers", Body: PlainText},
+	412: {Description: "If-Match is not the current ETag, the ETag header has the current one", Body: PlainText},
+	428: {Description: "If-Match is missing and IF_MATCH_POLICY=require", Body: PlainText},
+}
+
+var dateTime = Schema{"type": "string", "format": "date-time"}
+
+var taskFilterParams = []Param{
+	{Name: "project_id", Description: "Tasks of this project, by default the tasks of all your projects", Schema: Integer},
+	{Name: "assigned_to", Description: "me, none for unassigned tasks, or a user id", Schema: String},
+	{Name: "parent_id", Description: "Subtasks of this task, none for top level tasks only", Schema: String},
+	{Name: "status", Description: "Comma separated statuses: todo, in_progress, blocked, done, cancelled", Schema: String},
+	{Name: "priority", Description: "Comma separated priorities: low, medium, high, urgent", Schema: String},
+	{Name: "label", Description: "Comma separated names of your labels", Schema: String},
+	{Name: "label_match", Description: "any (default) or all of the labels", Schema: String},
+	{Name: "completed", Description: "true or false", Schema: Boolean},
+	{Name: "due_before", Description: "Due strictly before this time (RFC 3339)", Schema: dateTime},
+	{Name: "due_after", Description: "Due at or after this time (RFC 3339)", Schema: dateTime},
+	{Name: "overdue", Description: "Only open tasks past their due date", Schema: Boolean},
+	{Name: "sort", Description: "created_at, due_at, priority or title, prefix with - for descending", Schema: String},
+}
+
+// searchParams are the filters of GET /tasks without sort, results are sorted by rank
+var searchParams = append([]Param{
+	{Name: "q", Description: "Words to find, \"quoted phrases\", or between alternatives and -word to exclude one", Schema: String, Required: true},
+	{Name: "page", Description: "Page number, from 1", Schema: Integer},
+	{Name: "page_size", Description: "Results per page, default 20, at most 100", Schema: Integer},
+}, withoutParam(taskFilterParams, "sort")...)
+
+// exportParams are the filters of GET /tasks without sort, exports are in id order
+var exportParams = append([]Param{
+	{Name: "format", Description: "csv (default), json or ndjson", Schema: String},
+}, withoutParam(taskFilterParams, "sort")...)
+
+var importParams = []Param{
+	{Name: "format", Description: "csv, json or ndjson, by default taken from the Content-Type (text/csv, application/json, application/x-ndjson)", Schema: String},
+	{Name: "project_id", Description: "Project of every row, by default the project_id of the row or your personal project", Schema: Integer},
+	{Name: "dry_run", Description: "Only check the rows and report what would be created", Schema: Boolean},
+}
+
+func withoutParam(params []Param, name string) []Param {
+	var kept []Param
+	for _, p := range params {
+		if p.Name != name {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
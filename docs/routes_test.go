@@ -0,0 +1,114 @@
+package docs
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// learning note routes of main.go, they are not part of the API
+var undocumented = []string{"/view-tasks", "/config", "/openapi.json", "/docs"}
+
+// registeredRoutes registers the routes of main.go on an empty app. They are read from the source,
+// main needs a database to build its handlers. Groups made with app.Group("/prefix") are followed.
+func registeredRoutes(t *testing.T) []fiber.Route {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "../main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	noop := func(c *fiber.Ctx) error { return nil }
+	prefixes := map[string]string{"app": ""}
+	methods := map[string]string{"Get": fiber.MethodGet, "Post": fiber.MethodPost, "Put": fiber.MethodPut, "Patch": fiber.MethodPatch, "Delete": fiber.MethodDelete}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			// adminRoute := app.Group("/admin", ...)
+			if len(n.Lhs) != 1 || len(n.Rhs) != 1 {
+				return true
+			}
+			name, ok := n.Lhs[0].(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if receiver, method, path, ok := routeCall(n.Rhs[0]); ok && method == "Group" {
+				if prefix, ok := prefixes[receiver]; ok {
+					prefixes[name.Name] = prefix + path
+				}
+			}
+		case *ast.CallExpr:
+			receiver, method, path, ok := routeCall(n)
+			if !ok || methods[method] == "" {
+				return true
+			}
+			if prefix, ok := prefixes[receiver]; ok {
+				app.Add(methods[method], prefix+path, noop)
+			}
+		}
+		return true
+	})
+
+	return app.GetRoutes(true)
+}
+
+// routeCall matches receiver.Method("path", ...)
+func routeCall(expr ast.Expr) (receiver string, method string, path string, ok bool) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return "", "", "", false
+	}
+	selector, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", "", "", false
+	}
+	ident, ok := selector.X.(*ast.Ident)
+	if !ok {
+		return "", "", "", false
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", "", "", false
+	}
+	path, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", "", "", false
+	}
+	return ident.Name, selector.Sel.Name, path, true
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	routes := registeredRoutes(t)
+	if len(routes) < len(operations) {
+		t.Fatalf("only %d routes found in main.go, the parser missed some", len(routes))
+	}
+	if missing := MissingRoutes(routes, undocumented...); len(missing) > 0 {
+		t.Errorf("routes missing from docs/routes.go: %v", missing)
+	}
+}
+
+func TestEveryOperationIsRegistered(t *testing.T) {
+	registered := map[string]bool{}
+	for _, route := range registeredRoutes(t) {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for _, op := range operations {
+		if !registered[op.Method+" "+op.Path] {
+			t.Errorf("%s %s is documented but not registered in main.go", op.Method, op.Path)
+		}
+	}
+}
+
+func TestSpecBuilds(t *testing.T) {
+	spec := Spec()
+	paths, ok := spec["paths"].(fiber.Map)
+	if !ok || len(paths) == 0 {
+		t.Fatal("the document has no paths")
+	}
+}
@@ -0,0 +1,9 @@
+package docs
+
+import _ "embed"
+
+// UI is a page that renders /openapi.json and sends requests from it. The script and styles are part
+// of the page, so the docs work offline and nothing is loaded from a CDN.
+//
+//go:embed ui.html
+var UI []byte
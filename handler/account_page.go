@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The emailed links open these pages. Opening a link never redeems its token, mail scanners prefetch links,
+// the page posts the token back as a form and the POST handler answers the form with a page as well.
+var accountPage = template.Must(template.New("account").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1" />
+  <title>{{.Title}}</title>
+  <style>
+    body { font-family: system-ui, sans-serif; margin: 3rem auto; max-width: 28rem; padding: 0 1rem; color: #222; }
+    input, button { font-size: 1rem; padding: .4rem; margin-top: .4rem; }
+    input { width: 100%; box-sizing: border-box; }
+  </style>
+</head>
+<body>
+  <h1>{{.Title}}</h1>
+  {{with .Message}}<p>{{.}}</p>{{end}}
+  {{if .Action}}
+  <form method="post" action="{{.Action}}">
+    <input type="hidden" name="token" value="{{.Token}}" />
+    {{if .Password}}
+    <label for="password">New password</label>
+    <input type="password" id="password" name="password" autocomplete="new-password" required />
+    {{end}}
+    <button type="submit">{{.Button}}</button>
+  </form>
+  {{end}}
+</body>
+</html>
+`))
+
+type accountPageData struct {
+	Title    string
+	Message  string
+	Action   string // the form posts to it, no form when empty
+	Token    string
+	Password bool // ask for a new password
+	Button   string
+}
+
+func renderAccountPage(c *fiber.Ctx, status int, data accountPageData) error {
+	var buf bytes.Buffer
+	if err := accountPage.Execute(&buf, data); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	// the token is in the URL of the page, it must not be cached or sent on as a referrer
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderReferrerPolicy, "no-referrer")
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(status).Send(buf.Bytes())
+}
+
+// isFormPost is true for the submissions of the account pages, they get a page back instead of JSON
+func isFormPost(c *fiber.Ctx) bool {
+	return strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEApplicationForm)
+}
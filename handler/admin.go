@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const impersonationTTL = time.Hour
+
+type AdminHandlerInterface interface {
+	ListUsers(c *fiber.Ctx) error
+	GetUser(c *fiber.Ctx) error
+	DisableUser(c *fiber.Ctx) error
+	EnableUser(c *fiber.Ctx) error
+	ForcePasswordReset(c *fiber.Ctx) error
+	ImpersonateUser(c *fiber.Ctx) error
+}
+
+// Primary adapter, every route is behind adminRequiredMiddleware
+type HttpAdminHandler struct {
+	UserRepo       repo.UserRepositoryInterface
+	TaskRepo       repo.TaskRepositoryInterface
+	accountService *service.AccountService
+	auditor        *service.Auditor
+}
+
+// Initiate primary adapter
+func NewHttpAdminHandler(userRepo repo.UserRepositoryInterface, taskRepo repo.TaskRepositoryInterface, accountService *service.AccountService, auditor *service.Auditor) *HttpAdminHandler {
+	return &HttpAdminHandler{UserRepo: userRepo, TaskRepo: taskRepo, accountService: accountService, auditor: auditor}
+}
+
+// pagination reads ?page= (from 1) and ?page_size= (default 20, at most 100)
+func pagination(c *fiber.Ctx) (page int, pageSize int) {
+	page = c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize = c.QueryInt("page_size", 20)
+	if pageSize < 1 {
+		pageSize = 20
+	} else if pageSize > 100 {
+		pageSize = 100
+	}
+	return page, pageSize
+}
+
+func (h *HttpAdminHandler) ListUsers(c *fiber.Ctx) error {
+	page, pageSize := pagination(c)
+
+	users, total, err := h.UserRepo.ListUsers(c.Query("q"), (page-1)*pageSize, pageSize)
+	if err != nil {
+		log.Println("Error listing users:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	list := utils.AdminUserList{Users: []utils.AdminUser{}, Total: total, Page: page, PageSize: pageSize}
+	for i := range users {
+		list.Users = append(list.Users, utils.NewAdminUser(&users[i]))
+	}
+
+	return c.JSON(list)
+}
+
+// targetUser reads the user of the :id param, it writes the error response when it returns nil
+func (h *HttpAdminHandler) targetUser(c *fiber.Ctx) (*utils.User, error) {
+	userId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	user, err := h.UserRepo.GetUserByID(uint(userId))
+	if err != nil {
+		if err == utils.ErrNotFound {
+			return nil, c.Status(fiber.StatusNotFound).SendString(err.Error())
+		} else {
+			return nil, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+
+	return user, nil
+}
+
+func (h *HttpAdminHandler) GetUser(c *fiber.Ctx) error {
+	user, err := h.targetUser(c)
+	if user == nil {
+		return err
+	}
+
+	counts, err := h.TaskRepo.CountTasksByUser(user.ID)
+	if err != nil {
+		log.Println("Error counting tasks:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(utils.AdminUserDetail{AdminUser: utils.NewAdminUser(user), Tasks: *counts})
+}
+
+func (h *HttpAdminHandler) DisableUser(c *fiber.Ctx) error {
+	user, err := h.targetUser(c)
+	if user == nil {
+		return err
+	}
+
+	admin := c.Locals("user").(*utils.User)
+	if user.ID == admin.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You can't disable your own account"})
+	}
+
+	if user.DisabledAt == nil {
+		now := time.Now()
+		user.DisabledAt = &now
+		if _, err := h.UserRepo.UpdateUser(user); err != nil {
+			log.Println("Error disabling user:", err)
+			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditUserDisable, "user", user.ID, nil))
+
+	return c.JSON(fiber.Map{
+		"message": "Disable User Successful",
+		"user":    utils.NewAdminUser(user),
+	})
+}
+
+func (h *HttpAdminHandler) EnableUser(c *fiber.Ctx) error {
+	user, err := h.targetUser(c)
+	if user == nil {
+		return err
+	}
+
+	if user.DisabledAt != nil {
+		user.DisabledAt = nil
+		if _, err := h.UserRepo.UpdateUser(user); err != nil {
+			log.Println("Error enabling user:", err)
+			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditUserEnable, "user", user.ID, nil))
+
+	return c.JSON(fiber.Map{
+		"message": "Enable User Successful",
+		"user":    utils.NewAdminUser(user),
+	})
+}
+
+func (h *HttpAdminHandler) ForcePasswordReset(c *fiber.Ctx) error {
+	user, err := h.targetUser(c)
+	if user == nil {
+		return err
+	}
+
+	if err := h.accountService.ForcePasswordReset(user); err != nil {
+		log.Println("Error forcing password reset:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditUserForceReset, "user", user.ID, nil))
+
+	return c.JSON(fiber.Map{
+		"message": "Password reset email sent, the user's sessions are revoked",
+	})
+}
+
+// ImpersonateUser returns a short lived token of the user for support. The token carries impersonator_id,
+// it is not set as a cookie so the admin session is kept; send it as "Authorization: Bearer <token>".
+func (h *HttpAdminHandler) ImpersonateUser(c *fiber.Ctx) error {
+	user, err := h.targetUser(c)
+	if user == nil {
+		return err
+	}
+
+	admin := c.Locals("user").(*utils.User)
+	if user.IsAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Admins can't be impersonated"})
+	}
+	if user.DisabledAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": utils.ErrUserDisabled.Error()})
+	}
+
+	t, err := signJWT(user, impersonationTTL, jwt.MapClaims{"impersonator_id": admin.ID})
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	// the requests made with the token are audited with the admin as impersonator_id
+	expiresAt := time.Now().Add(impersonationTTL).UTC().Format(time.RFC3339)
+	h.auditor.Record(newAuditEntry(c, utils.AuditUserImpersonate, "user", user.ID, utils.Snapshot(fiber.Map{"expires_at": expiresAt})))
+
+	return c.JSON(fiber.Map{
+		"message":    "Impersonation token issued",
+		"token":      t,
+		"expires_at": expiresAt,
+	})
+}
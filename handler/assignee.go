@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// checkAssignee returns utils.ErrAssigneeNotEditor when the user can't change the tasks of the project,
+// a viewer couldn't work on the task
+func (h *HttpTaskHandler) checkAssignee(projectID uint, assigneeID uint) error {
+	if _, err := h.projects.Authorize(projectID, assigneeID, utils.ProjectRoleEditor); err == utils.ErrNotFound || err == utils.ErrForbidden {
+		return utils.ErrAssigneeNotEditor
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// assignableTask reads the :id task when the current user may change its assignee: its author or an editor
+// of the project. It writes the error response when it returns nil.
+func (h *HttpTaskHandler) assignableTask(c *fiber.Ctx) (*utils.Task, error) {
+	task, err := h.currentTask(c)
+	if task == nil {
+		return nil, err
+	}
+
+	role, _ := c.Locals("project_role").(string)
+	if uint(task.UserID) != *currentUserID(c) && utils.ProjectRoleRank(role) < utils.ProjectRoleRank(utils.ProjectRoleEditor) {
+		return nil, c.Status(fiber.StatusForbidden).SendString("only the author of the task or the editors of the project can assign it")
+	}
+
+	return task, nil
+}
+
+func (h *HttpTaskHandler) AssignTaskHandler(c *fiber.Ctx) error {
+	req := new(utils.AssignRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if req.AssigneeID == 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("assignee_id is required, use DELETE to unassign")
+	}
+
+	before, err := h.assignableTask(c)
+	if before == nil {
+		return err
+	}
+	if err := h.checkAssignee(before.ProjectID, req.AssigneeID); err != nil {
+		return updateFailed(c, err)
+	}
+
+	updatedTask, err := tasksOf(c, h.tasks).Assign(before, &req.AssigneeID, currentUserID(c))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskAssign, "task", before.ID, utils.Diff(
+		fiber.Map{"assignee_id": before.AssigneeID}, fiber.Map{"assignee_id": updatedTask.AssigneeID},
+	)))
+
+	c.Set(fiber.HeaderETag, updatedTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":     "Assign Task Successful",
+		"updatedTask": updatedTask,
+	})
+}
+
+func (h *HttpTaskHandler) UnassignTaskHandler(c *fiber.Ctx) error {
+	before, err := h.assignableTask(c)
+	if before == nil {
+		return err
+	}
+
+	updatedTask, err := tasksOf(c, h.tasks).Assign(before, nil, currentUserID(c))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskUnassign, "task", before.ID, utils.Diff(
+		fiber.Map{"assignee_id": before.AssigneeID}, fiber.Map{"assignee_id": updatedTask.AssigneeID},
+	)))
+
+	c.Set(fiber.HeaderETag, updatedTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":     "Unassign Task Successful",
+		"updatedTask": updatedTask,
+	})
+}
+
+func (h *HttpTaskHandler) GetWatchersHandler(c *fiber.Ctx) error {
+	task, err := h.currentTask(c)
+	if task == nil {
+		return err
+	}
+
+	watchers, err := tasksOf(c, h.tasks).GetWatchers(task.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(watchers)
+}
+
+// WatchTaskHandler makes the current user a watcher, viewers can watch too
+func (h *HttpTaskHandler) WatchTaskHandler(c *fiber.Ctx) error {
+	task, err := h.currentTask(c)
+	if task == nil {
+		return err
+	}
+
+	if err := tasksOf(c, h.tasks).Watch(task.ID, *currentUserID(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskWatch, "task", task.ID, nil))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *HttpTaskHandler) UnwatchTaskHandler(c *fiber.Ctx) error {
+	task, err := h.currentTask(c)
+	if task == nil {
+		return err
+	}
+
+	if err := tasksOf(c, h.tasks).Unwatch(task.ID, *currentUserID(c)); err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString("you are not watching this task")
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskUnwatch, "task", task.ID, nil))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
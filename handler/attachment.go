@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AttachmentHandlerInterface interface {
+	GetAttachmentsHandler(c *fiber.Ctx) error
+	GetAttachmentHandler(c *fiber.Ctx) error
+	PostAttachmentHandler(c *fiber.Ctx) error
+	DeleteAttachmentHandler(c *fiber.Ctx) error
+	DownloadAttachmentHandler(c *fiber.Ctx) error
+}
+
+// Primary adapter for /tasks/:id/attachments and the signed download links
+type HttpAttachmentHandler struct {
+	attachments *service.AttachmentService
+	auditor     *service.Auditor
+}
+
+// Initiate primary adapter
+func NewHttpAttachmentHandler(attachments *service.AttachmentService, auditor *service.Auditor) *HttpAttachmentHandler {
+	return &HttpAttachmentHandler{attachments: attachments, auditor: auditor}
+}
+
+// taskID reads the :id param, it writes the error response when it returns 0. TaskAccessMiddleware found the
+// task already, the attachment service answers utils.ErrNotFound when it is deleted.
+func (h *HttpAttachmentHandler) taskID(c *fiber.Ctx) (uint, error) {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil || taskId <= 0 {
+		return 0, c.Status(fiber.StatusBadRequest).SendString("invalid task id")
+	}
+
+	return uint(taskId), nil
+}
+
+// currentAttachment reads the attachment of the :attachmentId param, it writes the error response when it returns nil
+func (h *HttpAttachmentHandler) currentAttachment(c *fiber.Ctx) (*utils.Attachment, error) {
+	taskID, err := h.taskID(c)
+	if taskID == 0 {
+		return nil, err
+	}
+	attachmentId, err := strconv.Atoi(c.Params("attachmentId"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	attachment, err := h.attachments.GetAttachment(taskID, uint(attachmentId))
+	if err != nil {
+		if err == utils.ErrNotFound {
+			return nil, c.Status(fiber.StatusNotFound).SendString(err.Error())
+		} else {
+			return nil, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+
+	return attachment, nil
+}
+
+func (h *HttpAttachmentHandler) GetAttachmentsHandler(c *fiber.Ctx) error {
+	taskID, err := h.taskID(c)
+	if taskID == 0 {
+		return err
+	}
+
+	attachments, err := h.attachments.GetAttachments(taskID)
+	if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(attachments)
+}
+
+// GetAttachmentHandler is also how clients get a fresh download link once the previous one expired
+func (h *HttpAttachmentHandler) GetAttachmentHandler(c *fiber.Ctx) error {
+	attachment, err := h.currentAttachment(c)
+	if attachment == nil {
+		return err
+	}
+
+	return c.JSON(attachment)
+}
+
+// PostAttachmentHandler takes the file in the "file" field of a multipart/form-data body
+func (h *HttpAttachmentHandler) PostAttachmentHandler(c *fiber.Ctx) error {
+	taskID, err := h.taskID(c)
+	if taskID == 0 {
+		return err
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "the file is required in the file field of a multipart/form-data body"})
+	}
+	file, err := header.Open()
+	if err != nil {
+		log.Println("Error opening uploaded file:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	defer file.Close()
+
+	attachment, err := h.attachments.Upload(taskID, *currentUserID(c), header.Filename, header.Size, file)
+	if err == utils.ErrAttachmentTooLarge {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error(), "max_size": h.attachments.MaxSize()})
+	} else if errors.Is(err, utils.ErrAttachmentType) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": err.Error()})
+	} else if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditAttachmentCreate, "task", taskID, utils.Snapshot(attachment)))
+
+	return c.Status(fiber.StatusCreated).JSON(attachment)
+}
+
+func (h *HttpAttachmentHandler) DeleteAttachmentHandler(c *fiber.Ctx) error {
+	attachment, err := h.currentAttachment(c)
+	if attachment == nil {
+		return err
+	}
+
+	if err := h.attachments.DeleteAttachment(attachment); err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditAttachmentDelete, "task", attachment.TaskID, utils.Snapshot(attachment)))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// DownloadAttachmentHandler serves the link of download_url, it works without a token until ?expires= so
+// it can be used in <img> tags. Images are shown inline, every other file is downloaded.
+func (h *HttpAttachmentHandler) DownloadAttachmentHandler(c *fiber.Ctx) error {
+	attachmentId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid expires")
+	}
+
+	attachment, content, err := h.attachments.Open(uint(attachmentId), expires, c.Query("signature"))
+	if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString("the link is invalid or expired")
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+
+	// the stream is closed once it is sent
+	return c.SendStream(content, int(attachment.Size))
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newAuditEntry fills the actor, IP, user agent and request ID of the entry from the request.
+// The personal data of a user target is redacted from changes.
+func newAuditEntry(c *fiber.Ctx, action string, targetType string, targetID interface{}, changes utils.JSONB) *utils.AuditEntry {
+	if targetType == "user" {
+		changes = utils.RedactPersonal(changes)
+	}
+	entry := &utils.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   toString(targetID),
+		Changes:    changes,
+		IP:         c.IP(),
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+	}
+	if requestID, ok := c.Locals("requestid").(string); ok {
+		entry.RequestID = requestID
+	}
+	if user, ok := c.Locals("user").(*utils.User); ok {
+		entry.ActorID = &user.ID
+	}
+	if impersonatorID, ok := c.Locals("impersonator_id").(uint); ok {
+		entry.ImpersonatorID = &impersonatorID
+	}
+	return entry
+}
+
+func toString(id interface{}) string {
+	switch v := id.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	}
+	return ""
+}
+
+type AuditHandlerInterface interface {
+	GetAuditHandler(c *fiber.Ctx) error
+}
+
+// Primary adapter
+type HttpAuditHandler struct {
+	AuditRepo repo.AuditQueryInterface
+}
+
+// Initiate primary adapter
+func NewHttpAuditHandler(repo repo.AuditQueryInterface) *HttpAuditHandler {
+	return &HttpAuditHandler{AuditRepo: repo}
+}
+
+// GetAuditHandler filters with ?actor_id= &action= &target_type= &target_id= &request_id= &from= &to= (RFC 3339)
+func (h *HttpAuditHandler) GetAuditHandler(c *fiber.Ctx) error {
+	page, pageSize := pagination(c)
+	filter := utils.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+		Offset:     (page - 1) * pageSize,
+		Limit:      pageSize,
+	}
+
+	if actorID := c.Query("actor_id"); actorID != "" {
+		id, err := strconv.ParseUint(actorID, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		actor := uint(id)
+		filter.ActorID = &actor
+	}
+	for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+			}
+			*target = t
+		}
+	}
+
+	entries, total, err := h.AuditRepo.QueryAudit(filter)
+	if err != nil {
+		log.Println("Error querying audit log:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	if entries == nil {
+		entries = []utils.AuditEntry{}
+	}
+
+	return c.JSON(utils.AuditEntryList{Entries: entries, Total: total, Page: page, PageSize: pageSize})
+}
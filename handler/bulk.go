@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errNotApplied = errors.New("not applied, another operation of the atomic request failed")
+
+// BulkTasksHandler applies up to BULK_MAX_OPERATIONS creates, updates and deletes. Every operation is checked
+// like its single request first. In atomic mode one failure rolls everything back (422), in best_effort
+// mode the failures are reported next to the successes (207).
+func (h *HttpTaskHandler) BulkTasksHandler(c *fiber.Ctx) error {
+	req := new(utils.BulkRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if req.Mode == "" {
+		req.Mode = utils.BulkAtomic
+	} else if req.Mode != utils.BulkAtomic && req.Mode != utils.BulkBestEffort {
+		return c.Status(fiber.StatusBadRequest).SendString("mode must be atomic or best_effort")
+	}
+	if len(req.Operations) == 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("operations is required")
+	} else if len(req.Operations) > h.bulkMax {
+		return c.Status(fiber.StatusRequestEntityTooLarge).SendString(fmt.Sprintf("at most %d operations per request", h.bulkMax))
+	}
+	atomic := req.Mode == utils.BulkAtomic
+	userID := *currentUserID(c)
+
+	results := make([]utils.BulkResult, len(req.Operations))
+	var ops []utils.BulkOperation
+	var indexes []int
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		results[i] = utils.BulkResult{Index: i, Op: op.Op, ID: op.ID}
+		if status, err := h.checkBulkOperation(op, userID); err != nil {
+			results[i].Status, results[i].Error = status, err.Error()
+			continue
+		}
+		ops = append(ops, *op)
+		indexes = append(indexes, i)
+	}
+
+	if atomic && len(ops) < len(req.Operations) {
+		for _, i := range indexes {
+			results[i].Status, results[i].Error = fiber.StatusFailedDependency, errNotApplied.Error()
+		}
+		return h.sendBulk(c, req.Mode, results)
+	}
+
+	outcomes, err := tasksOf(c, h.tasks).Bulk(ops, atomic, currentUserID(c))
+	if err != nil && !failedOperation(outcomes) {
+		log.Println("Error running bulk operations:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	for n, outcome := range outcomes {
+		i := indexes[n]
+		switch {
+		case outcome.Err != nil:
+			results[i].Status, results[i].Error = updateStatus(outcome.Err), outcome.Err.Error()
+		case err != nil:
+			results[i].Status, results[i].Error = fiber.StatusFailedDependency, errNotApplied.Error()
+		case ops[n].Op == utils.BulkCreate:
+			results[i].Status, results[i].ID, results[i].Task = fiber.StatusCreated, outcome.Task.ID, outcome.Task
+			h.auditor.Record(newAuditEntry(c, utils.AuditTaskCreate, "task", outcome.Task.ID, utils.Snapshot(outcome.Task)))
+		case ops[n].Op == utils.BulkUpdate:
+			results[i].Status, results[i].Task = fiber.StatusOK, outcome.Task
+			h.auditor.Record(newAuditEntry(c, utils.AuditTaskUpdate, "task", outcome.Before.ID, utils.Diff(outcome.Before, outcome.Task)))
+			h.recordNextOccurrence(c, outcome.Task)
+		default:
+			results[i].Status = fiber.StatusNoContent
+			h.auditor.Record(newAuditEntry(c, utils.AuditTaskDelete, "task", outcome.Before.ID, utils.Snapshot(outcome.Before)))
+		}
+	}
+
+	return h.sendBulk(c, req.Mode, results)
+}
+
+// failedOperation tells an operation that failed from an error of the transaction itself
+func failedOperation(outcomes []service.BulkOutcome) bool {
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HttpTaskHandler) sendBulk(c *fiber.Ctx, mode string, results []utils.BulkResult) error {
+	response := utils.BulkResponse{Mode: mode, Results: results}
+	for _, result := range results {
+		if result.Error == "" {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	status := fiber.StatusOK
+	if response.Failed > 0 && mode == utils.BulkAtomic {
+		status = fiber.StatusUnprocessableEntity
+		response.Succeeded = 0
+	} else if response.Failed > 0 {
+		status = fiber.StatusMultiStatus
+	}
+	response.Applied = status != fiber.StatusUnprocessableEntity
+
+	return c.Status(status).JSON(response)
+}
+
+// checkBulkOperation validates and authorizes the operation like its single request would,
+// it returns the status of the response with the error
+func (h *HttpTaskHandler) checkBulkOperation(op *utils.BulkOperation, userID uint) (int, error) {
+	switch op.Op {
+	case utils.BulkCreate:
+		if op.Task == nil {
+			return fiber.StatusBadRequest, errors.New("task is required")
+		}
+		if err := validateTask(op.Task); err != nil {
+			return fiber.StatusBadRequest, err
+		}
+		op.ID = 0
+		op.Task.ID = 0
+		op.Task.UserID = int(userID)
+		return h.prepareNewTask(op.Task, userID)
+	case utils.BulkUpdate, utils.BulkDelete:
+		if op.ID == 0 {
+			return fiber.StatusBadRequest, errors.New("id is required")
+		}
+		if op.Op == utils.BulkUpdate {
+			if op.Task == nil {
+				return fiber.StatusBadRequest, errors.New("task is required")
+			}
+			if err := validateTask(op.Task); err != nil {
+				return fiber.StatusBadRequest, err
+			}
+		}
+		if h.requireIfMatch && op.Version == 0 {
+			return fiber.StatusPreconditionRequired, errors.New("version is required")
+		}
+		// same answers as the task access middleware, non members can't tell the task exists
+		if _, err := h.projects.AuthorizeTask(op.ID, userID, utils.ProjectRoleEditor); err == utils.ErrNotFound {
+			return fiber.StatusNotFound, err
+		} else if err == utils.ErrForbidden {
+			return fiber.StatusForbidden, err
+		} else if err != nil {
+			return fiber.StatusInternalServerError, err
+		}
+		return 0, nil
+	default:
+		return fiber.StatusBadRequest, errors.New("op must be create, update or delete")
+	}
+}
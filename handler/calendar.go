@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CalendarHandlerInterface interface {
+	GetFeedHandler(c *fiber.Ctx) error
+	PostCalendarTokenHandler(c *fiber.Ctx) error
+	DeleteCalendarTokenHandler(c *fiber.Ctx) error
+}
+
+// Primary adapter, the feed is read with a secret token in the URL because calendar apps can't log in
+type HttpCalendarHandler struct {
+	users   repo.UserRepositoryInterface
+	tasks   *service.TaskService
+	auditor *service.Auditor
+	// the feed URLs start with it
+	baseURL string
+}
+
+// Initiate primary adapter
+func NewHttpCalendarHandler(users repo.UserRepositoryInterface, tasks *service.TaskService, auditor *service.Auditor, baseURL string) *HttpCalendarHandler {
+	return &HttpCalendarHandler{users: users, tasks: tasks, auditor: auditor, baseURL: baseURL}
+}
+
+// GetFeedHandler serves the tasks with a due date of the token's user as VTODO, ?events=true adds a VEVENT
+// on the due date of each. The filters of GET /tasks work too, e.g. ?assigned_to=me.
+// The ETag and Last-Modified come from one aggregate query, unchanged feeds are a 304 without reading the tasks.
+func (h *HttpCalendarHandler) GetFeedHandler(c *fiber.Ctx) error {
+	user, err := h.users.GetUserByCalendarToken(service.HashToken(c.Params("token")))
+	if err == utils.ErrNotFound || (err == nil && user.DisabledAt != nil) {
+		return c.Status(fiber.StatusNotFound).SendString("calendar feed not found")
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	// taskFilter reads the user like on the routes with a JWT
+	c.Locals("user", user)
+
+	filter, err := taskFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	filter.HasDue = true
+	events := c.QueryBool("events")
+
+	stats, err := h.tasks.GetTaskListStats(filter)
+	if err != nil {
+		log.Println("Error reading calendar feed:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	// the URL is a secret, shared caches keep out of it
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	c.Set(fiber.HeaderETag, feedETag(user, stats))
+	if !stats.LastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, stats.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if c.Fresh() {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	calendar := utils.NewCalendar("Tasks of "+user.Name, c.Hostname())
+	err = h.tasks.StreamTasks(filter, func(task *utils.Task) error {
+		calendar.AddTodo(task)
+		if events {
+			calendar.AddEvent(task)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Error reading calendar feed:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="tasks.ics"`)
+	return c.Send(calendar.Bytes())
+}
+
+// feedETag changes with the tasks of the feed, with the projects they come from and with the name of the user
+// in the title of the calendar. The versions catch label and dependency changes, they leave updated_at alone
+func feedETag(user *utils.User, stats *utils.TaskListStats) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d\x00%d\x00%d\x00%s\x00%s", stats.Count, stats.LastModified.UnixNano(), stats.Versions, stats.Projects, user.Name)
+	return fmt.Sprintf(`W/"%x"`, hash.Sum64())
+}
+
+// PostCalendarTokenHandler turns the feed on, or gives it a new URL. The previous URL stops working,
+// only the hash of the token is stored so the URL is shown this once.
+func (h *HttpCalendarHandler) PostCalendarTokenHandler(c *fiber.Ctx) error {
+	if impersonated(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed while impersonating"})
+	}
+	user := c.Locals("user").(*utils.User)
+
+	token, hash, err := service.NewToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	if err := h.users.SetCalendarToken(user.ID, &hash); err != nil {
+		log.Println("Error setting calendar token:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditUserCalendarToken, "user", user.ID, utils.Diff(
+		fiber.Map{"calendar_feed": user.CalendarTokenHash != nil}, fiber.Map{"calendar_feed": true},
+	)))
+
+	url := h.baseURL + "/calendar/" + token + ".ics"
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Calendar feed URL created, the previous one no longer works",
+		"url":     url,
+		// opens the subscribe dialog of most calendar apps
+		"webcal_url": "webcal://" + strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://"),
+	})
+}
+
+// DeleteCalendarTokenHandler turns the feed off
+func (h *HttpCalendarHandler) DeleteCalendarTokenHandler(c *fiber.Ctx) error {
+	user := c.Locals("user").(*utils.User)
+	if user.CalendarTokenHash == nil {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	if err := h.users.SetCalendarToken(user.ID, nil); err != nil {
+		log.Println("Error removing calendar token:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditUserCalendarToken, "user", user.ID, utils.Diff(
+		fiber.Map{"calendar_feed": true}, fiber.Map{"calendar_feed": false},
+	)))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
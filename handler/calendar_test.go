@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+func TestFeedETag(t *testing.T) {
+	user := &utils.User{Name: "Ann"}
+	stats := utils.TaskListStats{Count: 3, LastModified: time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC), Versions: 7, Projects: "1,2"}
+	etag := feedETag(user, &stats)
+	if again := feedETag(&utils.User{Name: "Ann"}, &stats); again != etag {
+		t.Errorf("feedETag of the same feed = %s, then %s", etag, again)
+	}
+
+	tests := []struct {
+		name   string
+		change func(user *utils.User, stats *utils.TaskListStats)
+	}{
+		{"a task added or deleted", func(_ *utils.User, s *utils.TaskListStats) { s.Count++ }},
+		{"a task edited", func(_ *utils.User, s *utils.TaskListStats) { s.LastModified = s.LastModified.Add(time.Second) }},
+		// labels and dependencies bump the version only
+		{"a version bumped", func(_ *utils.User, s *utils.TaskListStats) { s.Versions++ }},
+		{"a project joined", func(_ *utils.User, s *utils.TaskListStats) { s.Projects = "1,2,3" }},
+		{"the user renamed", func(u *utils.User, _ *utils.TaskListStats) { u.Name = "Anne" }},
+	}
+	for _, tt := range tests {
+		changedUser, changedStats := *user, stats
+		tt.change(&changedUser, &changedStats)
+		if got := feedETag(&changedUser, &changedStats); got == etag {
+			t.Errorf("%s: the ETag stayed %s", tt.name, got)
+		}
+	}
+}
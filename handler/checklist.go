@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ChecklistHandlerInterface interface {
+	GetChecklistHandler(c *fiber.Ctx) error
+	PostChecklistItemHandler(c *fiber.Ctx) error
+	PatchChecklistItemHandler(c *fiber.Ctx) error
+	DeleteChecklistItemHandler(c *fiber.Ctx) error
+}
+
+// Primary adapter for the checklist items of /tasks/:id/checklist
+type HttpChecklistHandler struct {
+	ChecklistRepo repo.ChecklistRepositoryInterface
+	tasks         *service.TaskService
+	validate      *validator.Validate
+	auditor       *service.Auditor
+}
+
+// Initiate primary adapter
+func NewHttpChecklistHandler(checklistRepo repo.ChecklistRepositoryInterface, tasks *service.TaskService, validate *validator.Validate, auditor *service.Auditor) *HttpChecklistHandler {
+	return &HttpChecklistHandler{ChecklistRepo: checklistRepo, tasks: tasks, validate: validate, auditor: auditor}
+}
+
+// taskID reads the :id param of a task that exists, it writes the error response when it returns 0
+func (h *HttpChecklistHandler) taskID(c *fiber.Ctx) (uint, error) {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return 0, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	if _, err := tasksOf(c, h.tasks).GetTask(taskId); err != nil {
+		if err == utils.ErrNotFound {
+			return 0, c.Status(fiber.StatusNotFound).SendString(err.Error())
+		} else {
+			return 0, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+
+	return uint(taskId), nil
+}
+
+func (h *HttpChecklistHandler) checklistRequest(c *fiber.Ctx) (*utils.ChecklistItemRequest, error) {
+	req := new(utils.ChecklistItemRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := h.validate.Struct(req); err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return req, nil
+}
+
+func (h *HttpChecklistHandler) GetChecklistHandler(c *fiber.Ctx) error {
+	taskID, err := h.taskID(c)
+	if taskID == 0 {
+		return err
+	}
+
+	items, err := h.ChecklistRepo.GetChecklist(taskID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(items)
+}
+
+func (h *HttpChecklistHandler) PostChecklistItemHandler(c *fiber.Ctx) error {
+	req, err := h.checklistRequest(c)
+	if req == nil {
+		return err
+	}
+	if req.Title == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "title is required"})
+	}
+
+	taskID, err := h.taskID(c)
+	if taskID == 0 {
+		return err
+	}
+
+	item := &utils.ChecklistItem{TaskID: taskID, Title: *req.Title}
+	if req.Done != nil {
+		item.Done = *req.Done
+	}
+	if req.Position != nil {
+		item.Position = *req.Position
+	}
+
+	if err := h.ChecklistRepo.CreateChecklistItem(item); err != nil {
+		if err == utils.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditChecklistCreate, "task", taskID, utils.Snapshot(item)))
+
+	return c.Status(fiber.StatusCreated).JSON(item)
+}
+
+// currentItem reads the item of the :itemId param, it writes the error response when it returns nil
+func (h *HttpChecklistHandler) currentItem(c *fiber.Ctx) (*utils.ChecklistItem, error) {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	itemId, err := strconv.Atoi(c.Params("itemId"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	item, err := h.ChecklistRepo.GetChecklistItem(uint(taskId), uint(itemId))
+	if err != nil {
+		if err == utils.ErrNotFound {
+			return nil, c.Status(fiber.StatusNotFound).SendString(err.Error())
+		} else {
+			return nil, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+
+	return item, nil
+}
+
+// PatchChecklistItemHandler changes the given fields, e.g. {"done": true} to tick the item
+func (h *HttpChecklistHandler) PatchChecklistItemHandler(c *fiber.Ctx) error {
+	req, err := h.checklistRequest(c)
+	if req == nil {
+		return err
+	}
+
+	item, err := h.currentItem(c)
+	if item == nil {
+		return err
+	}
+	before := *item
+
+	if req.Title != nil {
+		item.Title = *req.Title
+	}
+	if req.Done != nil {
+		item.Done = *req.Done
+	}
+	if req.Position != nil {
+		item.Position = *req.Position
+	}
+
+	if err := h.ChecklistRepo.UpdateChecklistItem(item); err != nil {
+		if err == utils.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditChecklistUpdate, "task", item.TaskID, utils.Diff(before, item)))
+
+	return c.JSON(item)
+}
+
+func (h *HttpChecklistHandler) DeleteChecklistItemHandler(c *fiber.Ctx) error {
+	item, err := h.currentItem(c)
+	if item == nil {
+		return err
+	}
+
+	if err := h.ChecklistRepo.DeleteChecklistItem(item.TaskID, item.ID); err != nil {
+		if err == utils.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditChecklistDelete, "task", item.TaskID, utils.Snapshot(item)))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CommentHandlerInterface interface {
+	GetCommentsHandler(c *fiber.Ctx) error
+	PostCommentHandler(c *fiber.Ctx) error
+	PutCommentHandler(c *fiber.Ctx) error
+	DeleteCommentHandler(c *fiber.Ctx) error
+}
+
+// Primary adapter for /tasks/:id/comments. Every member of the project can comment, viewers included,
+// comments are edited by their author and deleted by their author or an owner of the project.
+type HttpCommentHandler struct {
+	comments *service.CommentService
+	tasks    *service.TaskService
+	validate *validator.Validate
+	auditor  *service.Auditor
+}
+
+// Initiate primary adapter
+func NewHttpCommentHandler(comments *service.CommentService, tasks *service.TaskService, validate *validator.Validate, auditor *service.Auditor) *HttpCommentHandler {
+	return &HttpCommentHandler{comments: comments, tasks: tasks, validate: validate, auditor: auditor}
+}
+
+// currentComment reads the comment of the :commentId param, it writes the error response when it returns nil
+func (h *HttpCommentHandler) currentComment(c *fiber.Ctx, task *utils.Task) (*utils.Comment, error) {
+	commentId, err := strconv.Atoi(c.Params("commentId"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	comment, err := h.comments.GetComment(task.ID, uint(commentId))
+	if err != nil {
+		if err == utils.ErrNotFound {
+			return nil, c.Status(fiber.StatusNotFound).SendString(err.Error())
+		} else {
+			return nil, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+
+	return comment, nil
+}
+
+func (h *HttpCommentHandler) commentRequest(c *fiber.Ctx) (*utils.CommentRequest, error) {
+	req := new(utils.CommentRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if err := h.validate.Struct(req); err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return req, nil
+}
+
+// GetCommentsHandler pages with ?page= and ?page_size=, oldest comments first
+func (h *HttpCommentHandler) GetCommentsHandler(c *fiber.Ctx) error {
+	task, err := paramTask(c, h.tasks)
+	if task == nil {
+		return err
+	}
+	page, pageSize := pagination(c)
+
+	comments, total, err := h.comments.GetComments(task.ID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(utils.CommentList{Comments: comments, Total: total, Page: page, PageSize: pageSize})
+}
+
+func (h *HttpCommentHandler) PostCommentHandler(c *fiber.Ctx) error {
+	req, err := h.commentRequest(c)
+	if req == nil {
+		return err
+	}
+
+	task, err := paramTask(c, h.tasks)
+	if task == nil {
+		return err
+	}
+
+	comment, err := h.comments.CreateComment(task, *currentUserID(c), req.Body)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditCommentCreate, "task", task.ID, utils.Snapshot(fiber.Map{"comment_id": comment.ID})))
+
+	return c.Status(fiber.StatusCreated).JSON(comment)
+}
+
+func (h *HttpCommentHandler) PutCommentHandler(c *fiber.Ctx) error {
+	req, err := h.commentRequest(c)
+	if req == nil {
+		return err
+	}
+
+	task, err := paramTask(c, h.tasks)
+	if task == nil {
+		return err
+	}
+	comment, err := h.currentComment(c, task)
+	if comment == nil {
+		return err
+	}
+	if comment.AuthorID != *currentUserID(c) {
+		return c.Status(fiber.StatusForbidden).SendString("only the author can edit a comment")
+	}
+
+	updated, err := h.comments.UpdateComment(task, comment, req.Body)
+	if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditCommentUpdate, "task", task.ID, utils.Snapshot(fiber.Map{"comment_id": comment.ID})))
+
+	return c.JSON(updated)
+}
+
+func (h *HttpCommentHandler) DeleteCommentHandler(c *fiber.Ctx) error {
+	task, err := paramTask(c, h.tasks)
+	if task == nil {
+		return err
+	}
+	comment, err := h.currentComment(c, task)
+	if comment == nil {
+		return err
+	}
+	role, _ := c.Locals("project_role").(string)
+	if comment.AuthorID != *currentUserID(c) && role != utils.ProjectRoleOwner {
+		return c.Status(fiber.StatusForbidden).SendString("only the author or an owner of the project can delete a comment")
+	}
+
+	if err := h.comments.DeleteComment(task.ID, comment.ID); err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditCommentDelete, "task", task.ID, utils.Snapshot(fiber.Map{"comment_id": comment.ID})))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
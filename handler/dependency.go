@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetDependenciesHandler lists the tasks blocking the task
+func (h *HttpTaskHandler) GetDependenciesHandler(c *fiber.Ctx) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	tasks, err := tasksOf(c, h.tasks).GetBlockers(taskId)
+	if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(tasks)
+}
+
+// GetDependentsHandler lists the tasks blocked by the task
+func (h *HttpTaskHandler) GetDependentsHandler(c *fiber.Ctx) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	tasks, err := tasksOf(c, h.tasks).GetDependents(taskId)
+	if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(tasks)
+}
+
+func (h *HttpTaskHandler) AddDependencyHandler(c *fiber.Ctx) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	req := new(utils.DependencyRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if req.BlockedByID == 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("blocked_by_id is required")
+	}
+
+	task, err := tasksOf(c, h.tasks).AddDependency(taskId, req.BlockedByID)
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskDepend, "task", task.ID, utils.Snapshot(fiber.Map{"blocked_by_id": req.BlockedByID})))
+
+	c.Set(fiber.HeaderETag, task.ETag)
+
+	return c.JSON(task)
+}
+
+func (h *HttpTaskHandler) RemoveDependencyHandler(c *fiber.Ctx) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	blockerId, err := strconv.Atoi(c.Params("blockerId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	task, err := tasksOf(c, h.tasks).RemoveDependency(taskId, uint(blockerId))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskUndepend, "task", task.ID, utils.Snapshot(fiber.Map{"blocked_by_id": blockerId})))
+
+	c.Set(fiber.HeaderETag, task.ETag)
+
+	return c.JSON(task)
+}
+
+// GetNextTasksHandler lists the open tasks of the current user in the order they can be worked on,
+// ?ready=true keeps the ones that are not blocked and ?limit= (default 20, at most 100) cuts the list
+func (h *HttpTaskHandler) GetNextTasksHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	if userID == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 {
+		limit = 20
+	} else if limit > 100 {
+		limit = 100
+	}
+
+	tasks, err := tasksOf(c, h.tasks).NextTasks(*userID, c.QueryBool("ready"), limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(tasks)
+}
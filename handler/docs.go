@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"encoding/json"
+
+	"github.com/Peeranut-Kit/go_backend_test/docs"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Primary adapter
+type HttpDocsHandler struct {
+	spec []byte
+}
+
+// Initiate primary adapter. The document never changes at runtime so it is encoded once.
+func NewHttpDocsHandler() (*HttpDocsHandler, error) {
+	spec, err := json.Marshal(docs.Spec())
+	if err != nil {
+		return nil, err
+	}
+	return &HttpDocsHandler{spec: spec}, nil
+}
+
+func (h *HttpDocsHandler) GetOpenAPIHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Send(h.spec)
+}
+
+func (h *HttpDocsHandler) GetDocsUIHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(docs.UI)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// a request in flight holds its key this long, so a crash mid request doesn't lock the key until the TTL.
+// The lock is extended every half of it while the request runs, slow imports and exports included.
+const idempotencyLockTimeout = time.Minute
+
+// NewIdempotencyMiddleware replays the stored response of a POST retried with the same Idempotency-Key.
+// The key is scoped to the credentials of the request and bound to a hash of the method, URL and body:
+// reusing it with another request is a 422, a duplicate sent while the first one is running gets a 409.
+// 5xx and 429 responses and responses setting a cookie aren't stored, the key can be retried then.
+func NewIdempotencyMiddleware(r repo.IdempotencyRepositoryInterface, ttl time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if c.Method() != fiber.MethodPost || key == "" || !utils.IdempotentPath(c.Path()) {
+			return c.Next()
+		}
+		if len(key) > utils.MaxIdempotencyKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Idempotency-Key is too long"})
+		}
+
+		record := &utils.IdempotencyRecord{
+			Scope:       idempotencyScope(c),
+			Key:         key,
+			RequestHash: idempotencyRequestHash(c),
+			ExpiresAt:   time.Now().Add(idempotencyLockTimeout),
+		}
+		stored, created, err := r.Begin(record)
+		if err == utils.ErrIdempotencyInFlight {
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check Idempotency-Key"})
+		}
+
+		if !created {
+			if stored.RequestHash != record.RequestHash {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": utils.ErrIdempotencyMismatch.Error()})
+			}
+			if stored.CompletedAt == nil {
+				c.Set(fiber.HeaderRetryAfter, "1")
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": utils.ErrIdempotencyInFlight.Error()})
+			}
+			return replayResponse(c, stored)
+		}
+
+		stop := holdIdempotencyLock(r, record)
+		err = c.Next()
+		stop()
+		if err != nil {
+			// the error handler writes the response after us, it isn't known here
+			r.Release(record.Scope, record.Key)
+			return err
+		}
+
+		res := c.Response()
+		status := res.StatusCode()
+		if status >= fiber.StatusInternalServerError || status == fiber.StatusTooManyRequests || len(res.Header.PeekCookie("jwt")) > 0 {
+			r.Release(record.Scope, record.Key)
+			return nil
+		}
+
+		record.Status = status
+		record.Body = append([]byte(nil), res.Body()...)
+		record.ContentType = string(res.Header.ContentType())
+		record.ETag = c.GetRespHeader(fiber.HeaderETag)
+		record.Location = c.GetRespHeader(fiber.HeaderLocation)
+		// on error the response is sent anyway, a retry runs the request again once the lock times out
+		r.Complete(record, time.Now().Add(ttl))
+		return nil
+	}
+}
+
+// holdIdempotencyLock extends the lock of the record until the returned func is called
+func holdIdempotencyLock(r repo.IdempotencyRepositoryInterface, record *utils.IdempotencyRecord) func() {
+	done := make(chan struct{})
+	scope, key := record.Scope, record.Key
+	go func() {
+		ticker := time.NewTicker(idempotencyLockTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r.Extend(scope, key, time.Now().Add(idempotencyLockTimeout))
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func replayResponse(c *fiber.Ctx, record *utils.IdempotencyRecord) error {
+	c.Set("Idempotent-Replayed", "true")
+	if record.ContentType != "" {
+		c.Set(fiber.HeaderContentType, record.ContentType)
+	}
+	if record.ETag != "" {
+		c.Set(fiber.HeaderETag, record.ETag)
+	}
+	if record.Location != "" {
+		c.Set(fiber.HeaderLocation, record.Location)
+	}
+	return c.Status(record.Status).Send(record.Body)
+}
+
+// idempotencyScope hashes the token of the request. Requests without one (e.g. /register) are scoped to the
+// client IP and the route instead, so two clients sending the same key never see each other's response.
+func idempotencyScope(c *fiber.Ctx) string {
+	scope := "token\x00" + c.Get(fiber.HeaderAuthorization) + "\x00" + c.Cookies("jwt")
+	if c.Get(fiber.HeaderAuthorization) == "" && c.Cookies("jwt") == "" {
+		scope = "anonymous\x00" + c.IP() + "\x00" + c.Path()
+	}
+	sum := sha256.Sum256([]byte(scope))
+	return hex.EncodeToString(sum[:])
+}
+
+func idempotencyRequestHash(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.OriginalURL() + "\x00"))
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeIdempotencyRepo keeps the records in memory
+type fakeIdempotencyRepo struct {
+	repo.IdempotencyRepositoryInterface
+	mu      sync.Mutex
+	records map[string]utils.IdempotencyRecord
+}
+
+func (r *fakeIdempotencyRepo) Begin(record *utils.IdempotencyRecord) (*utils.IdempotencyRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.records[record.Scope+"\x00"+record.Key]; ok {
+		return &stored, false, nil
+	}
+	r.records[record.Scope+"\x00"+record.Key] = *record
+	return record, true, nil
+}
+
+func (r *fakeIdempotencyRepo) Complete(record *utils.IdempotencyRecord, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	completed := *record
+	completed.CompletedAt, completed.ExpiresAt = &now, expiresAt
+	r.records[record.Scope+"\x00"+record.Key] = completed
+	return nil
+}
+
+func (r *fakeIdempotencyRepo) Release(scope string, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, scope+"\x00"+key)
+	return nil
+}
+
+func TestIdempotencyAnonymousCallersDontShareKeys(t *testing.T) {
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	app.Use(NewIdempotencyMiddleware(&fakeIdempotencyRepo{records: map[string]utils.IdempotencyRecord{}}, time.Hour))
+	registered := 0
+	register := func(c *fiber.Ctx) error {
+		registered++
+		return c.Status(fiber.StatusCreated).SendString("user " + strconv.Itoa(registered) + " " + string(c.Body()))
+	}
+	app.Post("/register", register)
+	app.Post("/password/forgot", register)
+
+	send := func(path string, ip string, body string) (int, string, bool) {
+		req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "same-key")
+		req.Header.Set(fiber.HeaderXForwardedFor, ip)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b), res.Header.Get("Idempotent-Replayed") == "true"
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		ip         string
+		body       string
+		wantStatus int
+		wantBody   string
+		replayed   bool
+	}{
+		{"first caller", "/register", "203.0.113.1", "alice", fiber.StatusCreated, "user 1 alice", false},
+		{"another caller with the same key runs its own request", "/register", "203.0.113.2", "bob", fiber.StatusCreated, "user 2 bob", false},
+		{"the first caller retrying gets its own response", "/register", "203.0.113.1", "alice", fiber.StatusCreated, "user 1 alice", true},
+		{"the first caller reusing the key with another body", "/register", "203.0.113.1", "mallory", fiber.StatusUnprocessableEntity, "", false},
+		{"the same key on another route is another request", "/password/forgot", "203.0.113.1", "alice", fiber.StatusCreated, "user 3 alice", false},
+	}
+	for _, tt := range tests {
+		status, body, replayed := send(tt.path, tt.ip, tt.body)
+		if status != tt.wantStatus || (tt.wantBody != "" && body != tt.wantBody) || replayed != tt.replayed {
+			t.Errorf("%s: got %d %q (replayed %v), want %d %q (replayed %v)", tt.name, status, body, replayed, tt.wantStatus, tt.wantBody, tt.replayed)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type LabelHandlerInterface interface {
+	GetLabelsHandler(c *fiber.Ctx) error
+	PostLabelHandler(c *fiber.Ctx) error
+	PutLabelHandler(c *fiber.Ctx) error
+	DeleteLabelHandler(c *fiber.Ctx) error
+	AttachLabelsHandler(c *fiber.Ctx) error
+	DetachLabelHandler(c *fiber.Ctx) error
+}
+
+// Primary adapter, users only see and attach their own labels
+type HttpLabelHandler struct {
+	LabelRepo repo.LabelRepositoryInterface
+	tasks     *service.TaskService
+	validate  *validator.Validate
+	auditor   *service.Auditor
+}
+
+// Initiate primary adapter
+func NewHttpLabelHandler(labelRepo repo.LabelRepositoryInterface, tasks *service.TaskService, validate *validator.Validate, auditor *service.Auditor) *HttpLabelHandler {
+	return &HttpLabelHandler{LabelRepo: labelRepo, tasks: tasks, validate: validate, auditor: auditor}
+}
+
+func (h *HttpLabelHandler) GetLabelsHandler(c *fiber.Ctx) error {
+	labels, err := h.LabelRepo.GetLabels(*currentUserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(labels)
+}
+
+// labelRequest parses and validates the body, it writes the error response when it returns nil
+func (h *HttpLabelHandler) labelRequest(c *fiber.Ctx) (*utils.LabelRequest, error) {
+	req := new(utils.LabelRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := h.validate.Struct(req); err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	// ?label= takes a comma separated list
+	if strings.Contains(req.Name, ",") {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Label names can't contain a comma"})
+	}
+	return req, nil
+}
+
+func (h *HttpLabelHandler) PostLabelHandler(c *fiber.Ctx) error {
+	req, err := h.labelRequest(c)
+	if req == nil {
+		return err
+	}
+
+	label := &utils.Label{UserID: *currentUserID(c), Name: req.Name, Color: req.Color}
+	if label.Color == "" {
+		label.Color = utils.DefaultLabelColor
+	}
+
+	if err := h.LabelRepo.CreateLabel(label); err != nil {
+		if err == utils.ErrLabelExists {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditLabelCreate, "label", label.ID, utils.Snapshot(label)))
+
+	return c.Status(fiber.StatusCreated).JSON(label)
+}
+
+// currentLabel reads the label of the :id param, it writes the error response when it returns nil
+func (h *HttpLabelHandler) currentLabel(c *fiber.Ctx) (*utils.Label, error) {
+	labelId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	label, err := h.LabelRepo.GetLabel(*currentUserID(c), uint(labelId))
+	if err != nil {
+		if err == utils.ErrNotFound {
+			return nil, c.Status(fiber.StatusNotFound).SendString(err.Error())
+		} else {
+			return nil, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+
+	return label, nil
+}
+
+func (h *HttpLabelHandler) PutLabelHandler(c *fiber.Ctx) error {
+	req, err := h.labelRequest(c)
+	if req == nil {
+		return err
+	}
+
+	label, err := h.currentLabel(c)
+	if label == nil {
+		return err
+	}
+	before := *label
+
+	label.Name = req.Name
+	if req.Color != "" {
+		label.Color = req.Color
+	}
+
+	if err := h.LabelRepo.UpdateLabel(label); err != nil {
+		if err == utils.ErrLabelExists {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditLabelUpdate, "label", label.ID, utils.Diff(before, label)))
+
+	return c.JSON(label)
+}
+
+func (h *HttpLabelHandler) DeleteLabelHandler(c *fiber.Ctx) error {
+	label, err := h.currentLabel(c)
+	if label == nil {
+		return err
+	}
+
+	if err := h.LabelRepo.DeleteLabel(label.UserID, label.ID); err != nil {
+		if err == utils.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditLabelDelete, "label", label.ID, utils.Snapshot(label)))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// AttachLabelsHandler returns the task with its labels, 404 when the task or one of the labels doesn't exist
+func (h *HttpLabelHandler) AttachLabelsHandler(c *fiber.Ctx) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	req := new(utils.AttachLabelsRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.LabelRepo.AttachLabels(*currentUserID(c), uint(taskId), req.LabelIDs); err != nil {
+		if err == utils.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskLabel, "task", taskId, utils.Snapshot(fiber.Map{"label_ids": req.LabelIDs})))
+
+	return h.sendTask(c, taskId)
+}
+
+func (h *HttpLabelHandler) DetachLabelHandler(c *fiber.Ctx) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	labelId, err := strconv.Atoi(c.Params("labelId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	if err := h.LabelRepo.DetachLabel(*currentUserID(c), uint(taskId), uint(labelId)); err != nil {
+		if err == utils.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskUnlabel, "task", taskId, utils.Snapshot(fiber.Map{"label_id": labelId})))
+
+	return h.sendTask(c, taskId)
+}
+
+func (h *HttpLabelHandler) sendTask(c *fiber.Ctx, taskId int) error {
+	task, err := tasksOf(c, h.tasks).GetTask(taskId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	c.Set(fiber.HeaderETag, task.ETag)
+	return c.JSON(task)
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Profile endpoints of HttpUserHandler. authRequiredMiddleware puts the user read from the database in c.Locals("user")
+
+func (u HttpUserHandler) GetMe(c *fiber.Ctx) error {
+	user := c.Locals("user").(*utils.User)
+
+	return c.JSON(utils.NewUserProfile(user))
+}
+
+func (u HttpUserHandler) UpdateMe(c *fiber.Ctx) error {
+	req := new(utils.UpdateProfileRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := u.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user := c.Locals("user").(*utils.User)
+	before := utils.NewUserProfile(user)
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+
+	updatedUser, err := u.UserRepo.UpdateUser(user)
+	if err != nil {
+		log.Println("Error updating user:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	u.auditor.Record(newAuditEntry(c, utils.AuditUserUpdate, "user", user.ID, utils.Diff(before, utils.NewUserProfile(updatedUser))))
+
+	return c.JSON(fiber.Map{
+		"message": "Update Profile Successful",
+		"user":    utils.NewUserProfile(updatedUser),
+	})
+}
+
+// ChangeEmail sends a verification email to the new address, the email changes once it is verified
+func (u HttpUserHandler) ChangeEmail(c *fiber.Ctx) error {
+	if impersonated(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed while impersonating"})
+	}
+
+	req := new(utils.ChangeEmailRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := u.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user := c.Locals("user").(*utils.User)
+	if err := u.accountService.CheckPassword(user, req.Password); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := u.accountService.RequestEmailChange(user, req.Email); err != nil {
+		if err == utils.ErrEmailTaken {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Println("Error requesting email change:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	u.auditor.Record(newAuditEntry(c, utils.AuditUserEmailChange, "user", user.ID, utils.Diff(
+		fiber.Map{"pending_email": ""}, fiber.Map{"pending_email": req.Email},
+	)))
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Verification email sent to the new address",
+	})
+}
+
+// ChangePassword revokes every other session, the current one gets a new token
+func (u HttpUserHandler) ChangePassword(c *fiber.Ctx) error {
+	if impersonated(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed while impersonating"})
+	}
+
+	req := new(utils.ChangePasswordRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := u.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user := c.Locals("user").(*utils.User)
+	if err := u.accountService.ChangePassword(user, req.CurrentPassword, req.NewPassword); err != nil {
+		if err == utils.ErrInvalidCredentials {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		} else if err == utils.ErrBreachedPassword || errors.Is(err, utils.ErrWeakPassword) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Println("Error changing password:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	u.auditor.Record(newAuditEntry(c, utils.AuditUserPasswordChange, "user", user.ID, nil))
+
+	t, err := issueJWT(c, user)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password changed, other sessions are logged out",
+		"token":   t,
+	})
+}
+
+// DeleteMe soft deletes the account and the user's tasks, the personal data of the user row is anonymized
+func (u HttpUserHandler) DeleteMe(c *fiber.Ctx) error {
+	if impersonated(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed while impersonating"})
+	}
+
+	req := new(utils.DeleteAccountRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := u.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user := c.Locals("user").(*utils.User)
+	if err := u.accountService.DeleteAccount(user, req.Password); err != nil {
+		if err == utils.ErrInvalidCredentials {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Println("Error deleting user:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	// only the id, the anonymized data must not outlive the account in the audit log
+	u.auditor.Record(newAuditEntry(c, utils.AuditUserDelete, "user", user.ID, nil))
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+	})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// impersonated is true when an admin uses an impersonation token, credentials can't be changed with it
+func impersonated(c *fiber.Ctx) bool {
+	return c.Locals("impersonator_id") != nil
+}
@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ProjectHandlerInterface interface {
+	GetProjectsHandler(c *fiber.Ctx) error
+	PostProjectHandler(c *fiber.Ctx) error
+	GetProjectHandler(c *fiber.Ctx) error
+	PutProjectHandler(c *fiber.Ctx) error
+	DeleteProjectHandler(c *fiber.Ctx) error
+	GetMembersHandler(c *fiber.Ctx) error
+	PutMemberHandler(c *fiber.Ctx) error
+	DeleteMemberHandler(c *fiber.Ctx) error
+	PostInvitationHandler(c *fiber.Ctx) error
+	GetProjectInvitationsHandler(c *fiber.Ctx) error
+	DeleteInvitationHandler(c *fiber.Ctx) error
+	GetMyInvitationsHandler(c *fiber.Ctx) error
+	AcceptInvitationHandler(c *fiber.Ctx) error
+	DeclineInvitationHandler(c *fiber.Ctx) error
+}
+
+// Primary adapter, viewers see the project and its members, owners manage them
+type HttpProjectHandler struct {
+	projects *service.ProjectService
+	validate *validator.Validate
+	auditor  *service.Auditor
+}
+
+// Initiate primary adapter
+func NewHttpProjectHandler(projects *service.ProjectService, validate *validator.Validate, auditor *service.Auditor) *HttpProjectHandler {
+	return &HttpProjectHandler{projects: projects, validate: validate, auditor: auditor}
+}
+
+// projectFailed maps the errors of the project service
+func projectFailed(c *fiber.Ctx, err error) error {
+	switch err {
+	case utils.ErrNotFound:
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	case utils.ErrForbidden, utils.ErrEmailUnverified:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case utils.ErrLastOwner, utils.ErrPersonalProject, utils.ErrAlreadyMember, utils.ErrInvitationClosed:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+}
+
+// parseBody parses and validates the body into req, it writes the error response when it returns false
+func (h *HttpProjectHandler) parseBody(c *fiber.Ctx, req interface{}) (bool, error) {
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return false, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := h.validate.Struct(req); err != nil {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return true, nil
+}
+
+// currentProject reads the project of the :id param when the user has at least the need role,
+// it writes the error response when it returns nil
+func (h *HttpProjectHandler) currentProject(c *fiber.Ctx, need string) (*utils.Project, error) {
+	projectId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	project, err := h.projects.GetProject(uint(projectId), *currentUserID(c))
+	if err != nil {
+		return nil, projectFailed(c, err)
+	}
+	if utils.ProjectRoleRank(project.Role) < utils.ProjectRoleRank(need) {
+		return nil, projectFailed(c, utils.ErrForbidden)
+	}
+
+	return project, nil
+}
+
+func (h *HttpProjectHandler) GetProjectsHandler(c *fiber.Ctx) error {
+	projects, err := h.projects.GetProjects(*currentUserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(projects)
+}
+
+func (h *HttpProjectHandler) PostProjectHandler(c *fiber.Ctx) error {
+	req := new(utils.ProjectRequest)
+	if ok, err := h.parseBody(c, req); !ok {
+		return err
+	}
+
+	project := &utils.Project{Name: strings.TrimSpace(req.Name), Description: req.Description, OwnerID: *currentUserID(c)}
+	if err := h.projects.CreateProject(project); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectCreate, "project", project.ID, utils.Snapshot(project)))
+
+	return c.Status(fiber.StatusCreated).JSON(project)
+}
+
+func (h *HttpProjectHandler) GetProjectHandler(c *fiber.Ctx) error {
+	project, err := h.currentProject(c, utils.ProjectRoleViewer)
+	if project == nil {
+		return err
+	}
+
+	return c.JSON(project)
+}
+
+func (h *HttpProjectHandler) PutProjectHandler(c *fiber.Ctx) error {
+	req := new(utils.ProjectRequest)
+	if ok, err := h.parseBody(c, req); !ok {
+		return err
+	}
+
+	project, err := h.currentProject(c, utils.ProjectRoleOwner)
+	if project == nil {
+		return err
+	}
+	before := *project
+
+	project.Name = strings.TrimSpace(req.Name)
+	project.Description = req.Description
+	if err := h.projects.UpdateProject(project); err != nil {
+		return projectFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectUpdate, "project", project.ID, utils.Diff(before, project)))
+
+	return c.JSON(project)
+}
+
+// DeleteProjectHandler deletes the project with its tasks
+func (h *HttpProjectHandler) DeleteProjectHandler(c *fiber.Ctx) error {
+	project, err := h.currentProject(c, utils.ProjectRoleOwner)
+	if project == nil {
+		return err
+	}
+
+	if err := h.projects.DeleteProject(project, currentUserID(c)); err != nil {
+		return projectFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectDelete, "project", project.ID, utils.Snapshot(project)))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *HttpProjectHandler) GetMembersHandler(c *fiber.Ctx) error {
+	project, err := h.currentProject(c, utils.ProjectRoleViewer)
+	if project == nil {
+		return err
+	}
+
+	members, err := h.projects.GetMembers(project.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(members)
+}
+
+func (h *HttpProjectHandler) PutMemberHandler(c *fiber.Ctx) error {
+	req := new(utils.MemberRoleRequest)
+	if ok, err := h.parseBody(c, req); !ok {
+		return err
+	}
+	userId, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	project, err := h.currentProject(c, utils.ProjectRoleOwner)
+	if project == nil {
+		return err
+	}
+
+	if err := h.projects.SetMemberRole(project.ID, uint(userId), req.Role); err != nil {
+		return projectFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectMemberRole, "project", project.ID, utils.Snapshot(fiber.Map{"user_id": userId, "role": req.Role})))
+
+	return c.JSON(fiber.Map{
+		"message": "Update Member Successful",
+	})
+}
+
+// DeleteMemberHandler removes a member, owners remove anyone and the other members can leave
+func (h *HttpProjectHandler) DeleteMemberHandler(c *fiber.Ctx) error {
+	userId, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	need := utils.ProjectRoleOwner
+	if uint(userId) == *currentUserID(c) {
+		need = utils.ProjectRoleViewer
+	}
+	project, err := h.currentProject(c, need)
+	if project == nil {
+		return err
+	}
+
+	if err := h.projects.RemoveMember(project.ID, uint(userId)); err != nil {
+		return projectFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectMemberLeave, "project", project.ID, utils.Snapshot(fiber.Map{"user_id": userId})))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *HttpProjectHandler) PostInvitationHandler(c *fiber.Ctx) error {
+	req := new(utils.InvitationRequest)
+	if ok, err := h.parseBody(c, req); !ok {
+		return err
+	}
+
+	project, err := h.currentProject(c, utils.ProjectRoleOwner)
+	if project == nil {
+		return err
+	}
+
+	invitation, err := h.projects.Invite(project, c.Locals("user").(*utils.User), strings.TrimSpace(req.Email), req.Role)
+	if err != nil {
+		return projectFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectInvite, "project", project.ID, utils.Snapshot(invitation)))
+
+	return c.Status(fiber.StatusCreated).JSON(invitation)
+}
+
+func (h *HttpProjectHandler) GetProjectInvitationsHandler(c *fiber.Ctx) error {
+	project, err := h.currentProject(c, utils.ProjectRoleOwner)
+	if project == nil {
+		return err
+	}
+
+	invitations, err := h.projects.GetInvitations(project.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(invitations)
+}
+
+func (h *HttpProjectHandler) DeleteInvitationHandler(c *fiber.Ctx) error {
+	invitationId, err := strconv.Atoi(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	project, err := h.currentProject(c, utils.ProjectRoleOwner)
+	if project == nil {
+		return err
+	}
+
+	if err := h.projects.RevokeInvitation(project.ID, uint(invitationId)); err != nil {
+		return projectFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectUninvite, "project", project.ID, utils.Snapshot(fiber.Map{"invitation_id": invitationId})))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetMyInvitationsHandler lists the pending invitations sent to the email of the current user
+func (h *HttpProjectHandler) GetMyInvitationsHandler(c *fiber.Ctx) error {
+	invitations, err := h.projects.MyInvitations(c.Locals("user").(*utils.User))
+	if err != nil {
+		return projectFailed(c, err)
+	}
+
+	return c.JSON(invitations)
+}
+
+func (h *HttpProjectHandler) AcceptInvitationHandler(c *fiber.Ctx) error {
+	invitationId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	invitation, err := h.projects.AcceptInvitation(uint(invitationId), c.Locals("user").(*utils.User))
+	if err != nil {
+		return projectFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectJoin, "project", invitation.ProjectID, utils.Snapshot(fiber.Map{"invitation_id": invitation.ID, "role": invitation.Role})))
+
+	return c.JSON(fiber.Map{
+		"message":    "Invitation Accepted",
+		"project_id": invitation.ProjectID,
+		"role":       invitation.Role,
+	})
+}
+
+func (h *HttpProjectHandler) DeclineInvitationHandler(c *fiber.Ctx) error {
+	invitationId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	invitation, err := h.projects.DeclineInvitation(uint(invitationId), c.Locals("user").(*utils.User))
+	if err != nil {
+		return projectFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditProjectDecline, "project", invitation.ProjectID, utils.Snapshot(fiber.Map{"invitation_id": invitation.ID})))
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation Declined",
+	})
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeProjectRepo keeps the roles of one project, RemoveMember and SetMemberRole refuse to leave it
+// without owner like the database does
+type fakeProjectRepo struct {
+	repo.ProjectRepositoryInterface
+	roles map[uint]string
+}
+
+func (r *fakeProjectRepo) GetRole(projectID uint, userID uint) (string, error) {
+	if projectID != 1 {
+		return "", nil
+	}
+	return r.roles[userID], nil
+}
+
+func (r *fakeProjectRepo) GetProject(id uint) (*utils.Project, error) {
+	return &utils.Project{ID: id, Name: "Launch"}, nil
+}
+
+func (r *fakeProjectRepo) UpdateProject(project *utils.Project) error {
+	return nil
+}
+
+func (r *fakeProjectRepo) setRole(userID uint, role string) error {
+	current, ok := r.roles[userID]
+	if !ok {
+		return utils.ErrNotFound
+	}
+	owners := 0
+	for _, memberRole := range r.roles {
+		if memberRole == utils.ProjectRoleOwner {
+			owners++
+		}
+	}
+	if current == utils.ProjectRoleOwner && role != utils.ProjectRoleOwner && owners <= 1 {
+		return utils.ErrLastOwner
+	}
+	if role == "" {
+		delete(r.roles, userID)
+	} else {
+		r.roles[userID] = role
+	}
+	return nil
+}
+
+func (r *fakeProjectRepo) SetMemberRole(projectID uint, userID uint, role string) error {
+	return r.setRole(userID, role)
+}
+
+func (r *fakeProjectRepo) RemoveMember(projectID uint, userID uint) error {
+	return r.setRole(userID, "")
+}
+
+func TestProjectRoles(t *testing.T) {
+	const owner, editor, viewer, stranger = 1, 2, 3, 4
+	projects := &fakeProjectRepo{roles: map[uint]string{
+		owner: utils.ProjectRoleOwner, editor: utils.ProjectRoleEditor, viewer: utils.ProjectRoleViewer,
+	}}
+	h := NewHttpProjectHandler(service.NewProjectService(projects, nil, nil), validator.New(), nil)
+
+	app := fiber.New()
+	// X-User stands in for the token
+	app.Use(func(c *fiber.Ctx) error {
+		id, _ := strconv.Atoi(c.Get("X-User"))
+		user := &utils.User{}
+		user.ID = uint(id)
+		c.Locals("user", user)
+		return c.Next()
+	})
+	app.Get("/projects/:id", h.GetProjectHandler)
+	app.Put("/projects/:id", h.PutProjectHandler)
+	app.Put("/projects/:id/members/:userId", h.PutMemberHandler)
+	app.Delete("/projects/:id/members/:userId", h.DeleteMemberHandler)
+
+	// in order, the members change along the way
+	steps := []struct {
+		name   string
+		user   int
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"viewer reads", viewer, "GET", "/projects/1", "", fiber.StatusOK},
+		{"stranger reads", stranger, "GET", "/projects/1", "", fiber.StatusNotFound},
+		{"stranger renames", stranger, "PUT", "/projects/1", `{"name":"Mine"}`, fiber.StatusNotFound},
+		{"viewer renames", viewer, "PUT", "/projects/1", `{"name":"Mine"}`, fiber.StatusForbidden},
+		{"editor renames", editor, "PUT", "/projects/1", `{"name":"Mine"}`, fiber.StatusForbidden},
+		{"viewer promotes itself", viewer, "PUT", "/projects/1/members/3", `{"role":"owner"}`, fiber.StatusForbidden},
+		{"viewer removes the editor", viewer, "DELETE", "/projects/1/members/2", "", fiber.StatusForbidden},
+		{"owner renames", owner, "PUT", "/projects/1", `{"name":"Mine"}`, fiber.StatusOK},
+		{"last owner leaves", owner, "DELETE", "/projects/1/members/1", "", fiber.StatusConflict},
+		{"last owner steps down", owner, "PUT", "/projects/1/members/1", `{"role":"editor"}`, fiber.StatusConflict},
+		{"viewer leaves", viewer, "DELETE", "/projects/1/members/3", "", fiber.StatusNoContent},
+		{"viewer that left reads", viewer, "GET", "/projects/1", "", fiber.StatusNotFound},
+		{"owner promotes the editor", owner, "PUT", "/projects/1/members/2", `{"role":"owner"}`, fiber.StatusOK},
+		{"one of two owners leaves", owner, "DELETE", "/projects/1/members/1", "", fiber.StatusNoContent},
+		{"the other owner leaves", editor, "DELETE", "/projects/1/members/2", "", fiber.StatusConflict},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		req.Header.Set("X-User", strconv.Itoa(step.user))
+		if step.body != "" {
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != step.want {
+			t.Errorf("%s: %s %s = %d, want %d", step.name, step.method, step.path, resp.StatusCode, step.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// recordNextOccurrence audits the occurrence the task service created when a recurring task was closed,
+// the service recorded its event
+func (h *HttpTaskHandler) recordNextOccurrence(c *fiber.Ctx, task *utils.Task) {
+	if task != nil && task.NextOccurrence != nil {
+		h.auditor.Record(newAuditEntry(c, utils.AuditTaskCreate, "task", task.NextOccurrence.ID, utils.Snapshot(task.NextOccurrence)))
+	}
+}
+
+// SetRecurrenceHandler makes the task recur, or changes the rule from this occurrence on
+func (h *HttpTaskHandler) SetRecurrenceHandler(c *fiber.Ctx) error {
+	req := new(utils.RecurrenceRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if req.Recurrence == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("recurrence is required, use DELETE to stop it")
+	}
+	if _, _, err := utils.ParseRecurrence(req.Recurrence, req.Timezone); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	before, err := h.currentTask(c)
+	if before == nil {
+		return err
+	}
+
+	updatedTask, err := tasksOf(c, h.tasks).SetRecurrence(before, req.Recurrence, req.Timezone, currentUserID(c))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskRecurrence, "task", before.ID, utils.Diff(
+		fiber.Map{"recurrence": before.Recurrence, "timezone": before.Timezone},
+		fiber.Map{"recurrence": updatedTask.Recurrence, "timezone": updatedTask.Timezone},
+	)))
+
+	c.Set(fiber.HeaderETag, updatedTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":     "Set Recurrence Successful",
+		"updatedTask": updatedTask,
+	})
+}
+
+// StopRecurrenceHandler keeps the task from creating a next occurrence when it is closed
+func (h *HttpTaskHandler) StopRecurrenceHandler(c *fiber.Ctx) error {
+	before, err := h.currentTask(c)
+	if before == nil {
+		return err
+	}
+
+	updatedTask, err := tasksOf(c, h.tasks).StopRecurrence(before, currentUserID(c))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	if updatedTask != before {
+		h.auditor.Record(newAuditEntry(c, utils.AuditTaskRecurrence, "task", before.ID, utils.Diff(
+			fiber.Map{"recurrence": before.Recurrence, "timezone": before.Timezone},
+			fiber.Map{"recurrence": updatedTask.Recurrence, "timezone": updatedTask.Timezone},
+		)))
+	}
+
+	c.Set(fiber.HeaderETag, updatedTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":     "Stop Recurrence Successful",
+		"updatedTask": updatedTask,
+	})
+}
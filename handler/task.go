@@ -1,57 +1,206 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/service"
 	"github.com/Peeranut-Kit/go_backend_test/utils"
 	"github.com/gofiber/fiber/v2"
 )
 
 type TaskHandlerInterface interface {
 	GetTasksHandler(c *fiber.Ctx) error
+	GetOverdueTasksHandler(c *fiber.Ctx) error
 	GetTaskHandler(c *fiber.Ctx) error
 	PostTaskHandler(c *fiber.Ctx) error
 	PutTaskHandler(c *fiber.Ctx) error
+	PatchTaskHandler(c *fiber.Ctx) error
 	DeleteTaskHandler(c *fiber.Ctx) error
+	GetTaskHistoryHandler(c *fiber.Ctx) error
+	RevertTaskHandler(c *fiber.Ctx) error
+	TransitionTaskHandler(c *fiber.Ctx) error
+	GetSubtasksHandler(c *fiber.Ctx) error
+	MoveTaskHandler(c *fiber.Ctx) error
+	RestoreTaskHandler(c *fiber.Ctx) error
+	GetDependenciesHandler(c *fiber.Ctx) error
+	GetDependentsHandler(c *fiber.Ctx) error
+	AddDependencyHandler(c *fiber.Ctx) error
+	RemoveDependencyHandler(c *fiber.Ctx) error
+	GetNextTasksHandler(c *fiber.Ctx) error
+	MoveProjectHandler(c *fiber.Ctx) error
+	SearchTasksHandler(c *fiber.Ctx) error
+	BulkTasksHandler(c *fiber.Ctx) error
+	ExportTasksHandler(c *fiber.Ctx) error
+	ImportTasksHandler(c *fiber.Ctx) error
+	AssignTaskHandler(c *fiber.Ctx) error
+	SetRecurrenceHandler(c *fiber.Ctx) error
+	StopRecurrenceHandler(c *fiber.Ctx) error
+	UnassignTaskHandler(c *fiber.Ctx) error
+	GetWatchersHandler(c *fiber.Ctx) error
+	WatchTaskHandler(c *fiber.Ctx) error
+	UnwatchTaskHandler(c *fiber.Ctx) error
+	TaskAccessMiddleware(c *fiber.Ctx) error
+	TaskMemberMiddleware(c *fiber.Ctx) error
 }
 
-// Primary adapter
+var errIfMatchRequired = errors.New("If-Match header is required, send the ETag of the task")
+
+// Primary adapter, TaskAccessMiddleware checks the project role on every /tasks/:id route
 type HttpTaskHandler struct {
-	TaskRepo repo.TaskRepositoryInterface
+	tasks    *service.TaskService
+	projects *service.ProjectService
+	auditor  *service.Auditor
+	// when false a write without If-Match overwrites whatever version is stored
+	requireIfMatch bool
+	// most operations of one POST /tasks/bulk
+	bulkMax int
+	// most rows of one POST /tasks/import
+	importMax int
 }
 
 // Initiate primary adapter
-func NewHttpTaskHandler(repo repo.TaskRepositoryInterface) *HttpTaskHandler {
-	return &HttpTaskHandler{TaskRepo: repo}
+func NewHttpTaskHandler(tasks *service.TaskService, projects *service.ProjectService, auditor *service.Auditor, requireIfMatch bool, bulkMax int, importMax int) *HttpTaskHandler {
+	return &HttpTaskHandler{tasks: tasks, projects: projects, auditor: auditor, requireIfMatch: requireIfMatch, bulkMax: bulkMax, importMax: importMax}
+}
+
+// TaskAccessMiddleware lets the members of the project of the :id task through, viewers only for GET.
+// Tasks of other projects are answered with 404 like tasks that don't exist.
+func (h *HttpTaskHandler) TaskAccessMiddleware(c *fiber.Ctx) error {
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+		return h.taskAccess(c, utils.ProjectRoleViewer)
+	}
+	return h.taskAccess(c, utils.ProjectRoleEditor)
+}
+
+// TaskMemberMiddleware lets every member through, for the routes that check more themselves (assignments, watching)
+func (h *HttpTaskHandler) TaskMemberMiddleware(c *fiber.Ctx) error {
+	return h.taskAccess(c, utils.ProjectRoleViewer)
+}
+
+func (h *HttpTaskHandler) taskAccess(c *fiber.Ctx, need string) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	role, err := h.projects.AuthorizeTask(uint(taskId), *currentUserID(c), need)
+	if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err == utils.ErrForbidden {
+		return c.Status(fiber.StatusForbidden).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	c.Locals("project_role", role)
+
+	return c.Next()
 }
 
 func (h *HttpTaskHandler) GetTasksHandler(c *fiber.Ctx) error {
-	tasks, err := h.TaskRepo.GetTasks()
+	filter, err := taskFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	return h.sendTasks(c, filter)
+}
+
+// GetOverdueTasksHandler lists the open tasks past their due date, the most overdue first
+func (h *HttpTaskHandler) GetOverdueTasksHandler(c *fiber.Ctx) error {
+	filter, err := taskFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	filter.Overdue = true
+	if filter.Sort == "" {
+		filter.Sort = "due_at"
+	}
+
+	return h.sendTasks(c, filter)
+}
+
+// SearchTasksHandler takes the filters of GET /tasks, ?sort= aside, and pages with ?page= and ?page_size=
+func (h *HttpTaskHandler) SearchTasksHandler(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("q is required")
+	} else if len(q) > utils.MaxSearchLength {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("q is limited to %d characters", utils.MaxSearchLength))
+	}
+	filter, err := taskFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	page, pageSize := pagination(c)
+
+	results, total, err := tasksOf(c, h.tasks).SearchTasks(filter, q, (page-1)*pageSize, pageSize)
+	if err != nil {
+		log.Println("Error searching tasks:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(utils.TaskSearchList{Results: results, Total: total, Page: page, PageSize: pageSize})
+}
+
+func (h *HttpTaskHandler) sendTasks(c *fiber.Ctx, filter utils.TaskFilter) error {
+	tasks, err := tasksOf(c, h.tasks).GetTasks(filter)
 	if err != nil {
 		log.Println("Error getting tasks:", err)
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
 
+	c.Set(fiber.HeaderETag, listETag(tasks))
+	if c.Fresh() {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	return c.JSON(tasks)
 }
 
-func (h *HttpTaskHandler) GetTaskHandler(c *fiber.Ctx) error {
+// currentTask reads the task of the :id param, it writes the error response when it returns nil
+func (h *HttpTaskHandler) currentTask(c *fiber.Ctx) (*utils.Task, error) {
+	return paramTask(c, h.tasks)
+}
+
+// paramTask reads the task of the :id param as the current user sees it, it writes the error response
+// when it returns nil. The handlers of the task routes share it.
+func paramTask(c *fiber.Ctx, tasks *service.TaskService) (*utils.Task, error) {
 	taskId, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
 
-	task, err := h.TaskRepo.GetTaskById(taskId)
+	task, err := tasksOf(c, tasks).GetTask(taskId)
 	if err != nil {
 		if err == utils.ErrNotFound {
-			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+			return nil, c.Status(fiber.StatusNotFound).SendString(err.Error())
 		} else {
-			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+			return nil, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 		}
 	}
 
+	return task, nil
+}
+
+func (h *HttpTaskHandler) GetTaskHandler(c *fiber.Ctx) error {
+	task, err := h.currentTask(c)
+	if task == nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderETag, task.ETag)
+	if c.Fresh() {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	return c.JSON(task)
 }
 
@@ -63,6 +212,10 @@ func (h *HttpTaskHandler) PostTaskHandler(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
 
+	if err := validateTask(task); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
 	// Core Logic
 	userIdString := c.Locals("user_id").(string)
 	userIDInt, err := strconv.Atoi(userIdString)
@@ -71,11 +224,25 @@ func (h *HttpTaskHandler) PostTaskHandler(c *fiber.Ctx) error {
 	}
 	task.UserID = userIDInt
 
-	createdTask, err := h.TaskRepo.CreateTask(task)
+	if status, err := h.prepareNewTask(task, uint(userIDInt)); err != nil {
+		return c.Status(status).SendString(err.Error())
+	}
+
+	createdTask, err := tasksOf(c, h.tasks).CreateTask(task)
 	if err != nil {
+		if err == utils.ErrParentNotFound || err == utils.ErrProjectMismatch {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		} else if err == utils.ErrRecurrenceNeedsDue {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		} else if err == utils.ErrMaxDepth || err == utils.ErrExternalIDTaken {
+			return c.Status(fiber.StatusConflict).SendString(err.Error())
+		}
 		log.Println("Error creating task:", err)
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskCreate, "task", createdTask.ID, utils.Snapshot(createdTask)))
+
+	c.Set(fiber.HeaderETag, createdTask.ETag)
 
 	return c.JSON(fiber.Map{
 		"message":     "Create Task Successful",
@@ -83,27 +250,116 @@ func (h *HttpTaskHandler) PostTaskHandler(c *fiber.Ctx) error {
 	})
 }
 
-func (h *HttpTaskHandler) PutTaskHandler(c *fiber.Ctx) error {
-	taskId, err := strconv.Atoi(c.Params("id"))
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+// prepareNewTask picks the project of a new task and checks that the user can create tasks in it.
+// Without project_id the task goes to the project of its parent, or to the personal project.
+// It returns the status of the response with the error.
+func (h *HttpTaskHandler) prepareNewTask(task *utils.Task, userID uint) (int, error) {
+	// the series of a recurring task is kept by the task service
+	task.ScheduledAt, task.Occurrence, task.PreviousOccurrenceID, task.NextOccurrence = nil, 0, nil, nil
+
+	var err error
+	if task.ProjectID == 0 && task.ParentID != nil {
+		task.ProjectID, err = h.projects.GetTaskProjectID(*task.ParentID)
+		if err == utils.ErrNotFound {
+			return fiber.StatusBadRequest, utils.ErrParentNotFound
+		} else if err != nil {
+			return fiber.StatusInternalServerError, err
+		}
+	} else if task.ProjectID == 0 {
+		personal, err := h.projects.PersonalProject(userID)
+		if err != nil {
+			return fiber.StatusInternalServerError, err
+		}
+		task.ProjectID = personal.ID
+	}
+	if _, err := h.projects.Authorize(task.ProjectID, userID, utils.ProjectRoleEditor); err == utils.ErrNotFound {
+		return fiber.StatusBadRequest, errors.New("project not found")
+	} else if err == utils.ErrForbidden {
+		return fiber.StatusForbidden, err
+	} else if err != nil {
+		return fiber.StatusInternalServerError, err
 	}
+	if task.AssigneeID != nil {
+		if err := h.checkAssignee(task.ProjectID, *task.AssigneeID); err != nil {
+			return updateStatus(err), err
+		}
+	}
+	return 0, nil
+}
 
+func (h *HttpTaskHandler) PutTaskHandler(c *fiber.Ctx) error {
 	task := new(utils.Task)
 	if err := c.BodyParser(task); err != nil {
 		log.Println("Error decoding request body:", err)
 		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
+	if err := validateTask(task); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
 
-	updatedTask, err := h.TaskRepo.UpdateTask(taskId, task)
+	// kept for the audit log
+	before, err := h.currentTask(c)
+	if before == nil {
+		return err
+	}
+
+	// the version in the body is ignored, only If-Match counts
+	task.Version, err = h.expectedVersion(c, before)
 	if err != nil {
-		if err == utils.ErrNotFound {
-			return c.Status(fiber.StatusNotFound).SendString(err.Error())
-		} else {
-			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
-		}
+		return preconditionFailed(c, err)
+	}
+
+	updatedTask, err := tasksOf(c, h.tasks).UpdateTask(before, task, currentUserID(c), c.QueryBool("force"))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+
+	return h.sendUpdatedTask(c, before, updatedTask)
+}
+
+// PatchTaskHandler takes a JSON merge patch of the editable fields, null clears due_at and reminder_offsets
+func (h *HttpTaskHandler) PatchTaskHandler(c *fiber.Ctx) error {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	before, err := h.currentTask(c)
+	if before == nil {
+		return err
+	}
+
+	fields := before.Fields()
+	if err := fields.ApplyPatch(patch); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	patched := &utils.Task{}
+	patched.ApplyFields(fields)
+	if err := validateTask(patched); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	version, err := h.expectedVersion(c, before)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	updatedTask, err := tasksOf(c, h.tasks).PatchTask(before, fields, version, currentUserID(c), c.QueryBool("force"))
+	if err != nil {
+		return updateFailed(c, err)
 	}
 
+	return h.sendUpdatedTask(c, before, updatedTask)
+}
+
+// sendUpdatedTask audits the update of PUT and PATCH and sends the task with its new ETag
+func (h *HttpTaskHandler) sendUpdatedTask(c *fiber.Ctx, before *utils.Task, updatedTask *utils.Task) error {
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskUpdate, "task", before.ID, utils.Diff(before, updatedTask)))
+	h.recordNextOccurrence(c, updatedTask)
+
+	c.Set(fiber.HeaderETag, updatedTask.ETag)
+
 	return c.JSON(fiber.Map{
 		"message":     "Update Task Successful",
 		"updatedTask": updatedTask,
@@ -111,19 +367,425 @@ func (h *HttpTaskHandler) PutTaskHandler(c *fiber.Ctx) error {
 }
 
 func (h *HttpTaskHandler) DeleteTaskHandler(c *fiber.Ctx) error {
+	task, err := h.currentTask(c)
+	if task == nil {
+		return err
+	}
+
+	version, err := h.expectedVersion(c, task)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	err = tasksOf(c, h.tasks).DeleteTask(task, version, currentUserID(c))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskDelete, "task", task.ID, utils.Snapshot(task)))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *HttpTaskHandler) GetTaskHistoryHandler(c *fiber.Ctx) error {
 	taskId, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
 
-	err = h.TaskRepo.DeleteTask(taskId)
+	revisions, err := tasksOf(c, h.tasks).GetTaskHistory(taskId)
+	if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(revisions)
+}
+
+func (h *HttpTaskHandler) RevertTaskHandler(c *fiber.Ctx) error {
+	revision, err := strconv.Atoi(c.Params("rev"))
 	if err != nil {
-		if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	before, err := h.currentTask(c)
+	if before == nil {
+		return err
+	}
+	taskId := before.ID
+
+	revertedTask, err := tasksOf(c, h.tasks).RevertTask(before, revision, currentUserID(c), c.QueryBool("force"))
+	if err != nil {
+		if err == utils.ErrRevisionNotFound {
 			return c.Status(fiber.StatusNotFound).SendString(err.Error())
-		} else {
-			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 		}
+		return updateFailed(c, err)
 	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskRevert, "task", taskId, utils.Diff(before, revertedTask)))
+	h.recordNextOccurrence(c, revertedTask)
 
-	return c.SendStatus(fiber.StatusNoContent)
+	c.Set(fiber.HeaderETag, revertedTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":      "Revert Task Successful",
+		"revertedTask": revertedTask,
+	})
+}
+
+// TransitionTaskHandler moves the task to another status of the workflow, If-Match works like on PUT
+func (h *HttpTaskHandler) TransitionTaskHandler(c *fiber.Ctx) error {
+	req := new(utils.TransitionRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if !utils.ValidStatus(req.Status) {
+		return c.Status(fiber.StatusBadRequest).SendString("status must be one of " + strings.Join(utils.Statuses, ", "))
+	}
+
+	before, err := h.currentTask(c)
+	if before == nil {
+		return err
+	}
+
+	version, err := h.expectedVersion(c, before)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	updatedTask, err := tasksOf(c, h.tasks).Transition(before, req.Status, version, currentUserID(c), c.QueryBool("force"))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	if updatedTask != before {
+		h.auditor.Record(newAuditEntry(c, utils.AuditTaskTransition, "task", before.ID, utils.Diff(before, updatedTask)))
+		h.recordNextOccurrence(c, updatedTask)
+	}
+
+	c.Set(fiber.HeaderETag, updatedTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":     "Transition Task Successful",
+		"updatedTask": updatedTask,
+		"allowed":     tasksOf(c, h.tasks).AllowedTransitions(updatedTask),
+	})
+}
+
+func (h *HttpTaskHandler) GetSubtasksHandler(c *fiber.Ctx) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	tasks, err := tasksOf(c, h.tasks).GetSubtasks(taskId)
+	if err == utils.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).SendString(err.Error())
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(tasks)
+}
+
+// MoveTaskHandler changes the parent of the task, {"parent_id": null} makes it a top level task
+func (h *HttpTaskHandler) MoveTaskHandler(c *fiber.Ctx) error {
+	req := new(utils.MoveTaskRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	before, err := h.currentTask(c)
+	if before == nil {
+		return err
+	}
+
+	movedTask, err := tasksOf(c, h.tasks).MoveTask(before, req.ParentID, currentUserID(c))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskMove, "task", before.ID, utils.Diff(
+		fiber.Map{"parent_id": before.ParentID}, fiber.Map{"parent_id": movedTask.ParentID},
+	)))
+
+	c.Set(fiber.HeaderETag, movedTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":     "Move Task Successful",
+		"updatedTask": movedTask,
+	})
+}
+
+// MoveProjectHandler moves a top level task and its subtasks to another project where the user is an editor
+func (h *HttpTaskHandler) MoveProjectHandler(c *fiber.Ctx) error {
+	req := new(utils.MoveProjectRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if req.ProjectID == 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("project_id is required")
+	}
+
+	before, err := h.currentTask(c)
+	if before == nil {
+		return err
+	}
+
+	if _, err := h.projects.Authorize(req.ProjectID, *currentUserID(c), utils.ProjectRoleEditor); err == utils.ErrNotFound {
+		return c.Status(fiber.StatusBadRequest).SendString("project not found")
+	} else if err != nil {
+		return updateFailed(c, err)
+	}
+
+	movedTask, err := tasksOf(c, h.tasks).MoveToProject(before, req.ProjectID, currentUserID(c))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskProject, "task", before.ID, utils.Diff(
+		fiber.Map{"project_id": before.ProjectID}, fiber.Map{"project_id": movedTask.ProjectID},
+	)))
+
+	c.Set(fiber.HeaderETag, movedTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":     "Move Task Successful",
+		"updatedTask": movedTask,
+	})
+}
+
+// RestoreTaskHandler undoes the delete of a task and of the subtasks deleted with it
+func (h *HttpTaskHandler) RestoreTaskHandler(c *fiber.Ctx) error {
+	taskId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	restoredTask, err := tasksOf(c, h.tasks).RestoreTask(taskId, currentUserID(c))
+	if err != nil {
+		return updateFailed(c, err)
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditTaskRestore, "task", taskId, utils.Snapshot(restoredTask)))
+
+	c.Set(fiber.HeaderETag, restoredTask.ETag)
+
+	return c.JSON(fiber.Map{
+		"message":      "Restore Task Successful",
+		"restoredTask": restoredTask,
+	})
+}
+
+// updateFailed maps the errors of the task service writes
+func updateFailed(c *fiber.Ctx, err error) error {
+	if err == utils.ErrVersionMismatch {
+		return preconditionFailed(c, err)
+	}
+	return c.Status(updateStatus(err)).SendString(err.Error())
+}
+
+// updateStatus is the response status of an error of the task service
+func updateStatus(err error) int {
+	if err == utils.ErrNotFound {
+		return fiber.StatusNotFound
+	} else if err == utils.ErrVersionMismatch {
+		return fiber.StatusPreconditionFailed
+	} else if err == utils.ErrForbidden {
+		return fiber.StatusForbidden
+	} else if err == utils.ErrRestoreExpired {
+		return fiber.StatusGone
+	} else if errors.Is(err, utils.ErrInvalidTransition) || err == utils.ErrTaskCycle || err == utils.ErrMaxDepth || err == utils.ErrParentDeleted ||
+		errors.Is(err, utils.ErrTaskBlocked) || err == utils.ErrDependencyCycle || err == utils.ErrExternalIDTaken {
+		return fiber.StatusConflict
+	} else if err == utils.ErrParentNotFound || err == utils.ErrBlockerNotFound || err == utils.ErrProjectMismatch || err == utils.ErrSubtaskProject ||
+		err == utils.ErrAssigneeNotEditor || err == utils.ErrRecurrenceNeedsDue {
+		return fiber.StatusBadRequest
+	} else {
+		return fiber.StatusInternalServerError
+	}
+}
+
+// tasksOf binds the task service to the current user, the tasks it loads come with the labels of that user only
+func tasksOf(c *fiber.Ctx, tasks *service.TaskService) *service.TaskService {
+	if userID := currentUserID(c); userID != nil {
+		return tasks.ForViewer(*userID)
+	}
+	return tasks
+}
+
+// currentUserID is the author of changes, set by authRequiredMiddleware
+func currentUserID(c *fiber.Ctx) *uint {
+	if user, ok := c.Locals("user").(*utils.User); ok {
+		return &user.ID
+	}
+	return nil
+}
+
+// expectedVersion reads If-Match against the current task. It returns 0 (no check) for "*" or a missing
+// header when If-Match is optional, the version of current when one of the tags is its ETag and
+// utils.ErrVersionMismatch otherwise. The repository checks the version again inside its transaction.
+func (h *HttpTaskHandler) expectedVersion(c *fiber.Ctx, current *utils.Task) (int, error) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		if h.requireIfMatch {
+			return 0, errIfMatchRequired
+		}
+		return 0, nil
+	}
+	if header == "*" {
+		return 0, nil
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if version, ok := utils.ParseTaskETag(tag); ok && version == current.Version {
+			return version, nil
+		}
+	}
+	c.Set(fiber.HeaderETag, current.ETag)
+	return 0, utils.ErrVersionMismatch
+}
+
+func preconditionFailed(c *fiber.Ctx, err error) error {
+	if err == errIfMatchRequired {
+		return c.Status(fiber.StatusPreconditionRequired).SendString(err.Error())
+	}
+	return c.Status(fiber.StatusPreconditionFailed).SendString(err.Error())
+}
+
+// listETag is a weak tag of the ids and versions in the list, it changes when any task is added, edited or deleted
+func listETag(tasks []utils.Task) string {
+	hash := fnv.New64a()
+	for _, task := range tasks {
+		fmt.Fprintf(hash, "%d:%d,", task.ID, task.Version)
+	}
+	return fmt.Sprintf(`W/"%x"`, hash.Sum64())
+}
+
+// validateTask checks the status, priority, external id, recurrence and reminder offsets, empty values keep the default or current ones
+func validateTask(task *utils.Task) error {
+	if task.Status != "" && !utils.ValidStatus(task.Status) {
+		return fmt.Errorf("status must be one of %s", strings.Join(utils.Statuses, ", "))
+	}
+	if task.Priority != "" && !utils.ValidPriority(task.Priority) {
+		return fmt.Errorf("priority must be one of %s", strings.Join(utils.Priorities, ", "))
+	}
+	if task.ExternalID != nil && len(*task.ExternalID) > utils.MaxExternalIDLength {
+		return fmt.Errorf("external_id is limited to %d characters", utils.MaxExternalIDLength)
+	}
+	if task.Recurrence != "" {
+		if _, _, err := utils.ParseRecurrence(task.Recurrence, task.Timezone); err != nil {
+			return err
+		}
+	} else if _, err := utils.ParseTimezone(task.Timezone); err != nil {
+		return err
+	}
+	if len(task.ReminderOffsets) > utils.MaxReminders {
+		return fmt.Errorf("at most %d reminders", utils.MaxReminders)
+	}
+	for _, offset := range task.ReminderOffsets {
+		if offset < 0 || offset > utils.MaxReminderOffset {
+			return fmt.Errorf("reminder offsets are minutes before the due date, from 0 to %d", utils.MaxReminderOffset)
+		}
+	}
+	return nil
+}
+
+// taskFilter reads ?project_id=&assigned_to=me|none|<user id>&parent_id=none|<id>&status=todo,in_progress&priority=high,urgent&label=work,home&label_match=all&completed=false&due_before=&due_after= (RFC3339)&overdue=true&sort=-due_at
+func taskFilter(c *fiber.Ctx) (utils.TaskFilter, error) {
+	var filter utils.TaskFilter
+
+	// only the tasks of the projects of the current user
+	if userID := currentUserID(c); userID != nil {
+		filter.MemberID = *userID
+	}
+	if project := c.Query("project_id"); project != "" {
+		id, err := strconv.ParseUint(project, 10, 0)
+		if err != nil {
+			return filter, fmt.Errorf("project_id must be a project id")
+		}
+		projectID := uint(id)
+		filter.ProjectID = &projectID
+	}
+	if assignee := c.Query("assigned_to"); assignee == "none" {
+		filter.Unassigned = true
+	} else if assignee == "me" {
+		filter.AssigneeID = currentUserID(c)
+	} else if assignee != "" {
+		id, err := strconv.ParseUint(assignee, 10, 0)
+		if err != nil {
+			return filter, fmt.Errorf("assigned_to must be me, none or a user id")
+		}
+		assigneeID := uint(id)
+		filter.AssigneeID = &assigneeID
+	}
+	if parent := c.Query("parent_id"); parent == "none" {
+		filter.TopLevel = true
+	} else if parent != "" {
+		id, err := strconv.ParseUint(parent, 10, 0)
+		if err != nil {
+			return filter, fmt.Errorf("parent_id must be a task id or none")
+		}
+		parentID := uint(id)
+		filter.ParentID = &parentID
+	}
+	if statuses := c.Query("status"); statuses != "" {
+		for _, status := range strings.Split(statuses, ",") {
+			status = strings.TrimSpace(status)
+			if !utils.ValidStatus(status) {
+				return filter, fmt.Errorf("status must be one of %s", strings.Join(utils.Statuses, ", "))
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	if priorities := c.Query("priority"); priorities != "" {
+		for _, p := range strings.Split(priorities, ",") {
+			p = strings.TrimSpace(p)
+			if !utils.ValidPriority(p) {
+				return filter, fmt.Errorf("priority must be one of %s", strings.Join(utils.Priorities, ", "))
+			}
+			filter.Priorities = append(filter.Priorities, p)
+		}
+	}
+	if completed := c.Query("completed"); completed != "" {
+		b, err := strconv.ParseBool(completed)
+		if err != nil {
+			return filter, fmt.Errorf("invalid completed: %w", err)
+		}
+		filter.Completed = &b
+	}
+	for param, target := range map[string]**time.Time{"due_before": &filter.DueBefore, "due_after": &filter.DueAfter} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, expected RFC3339: %w", param, err)
+			}
+			*target = &t
+		}
+	}
+	filter.Overdue = c.QueryBool("overdue")
+
+	// label names are those of the current user
+	if labels := c.Query("label"); labels != "" {
+		for _, name := range strings.Split(labels, ",") {
+			// label_match=all counts the distinct names, a repeated name would never match
+			if name = strings.TrimSpace(name); name != "" && !slices.Contains(filter.Labels, name) {
+				filter.Labels = append(filter.Labels, name)
+			}
+		}
+		switch c.Query("label_match", "any") {
+		case "any":
+		case "all":
+			filter.LabelMatchAll = true
+		default:
+			return filter, fmt.Errorf("label_match must be any or all")
+		}
+		if userID := currentUserID(c); userID != nil {
+			filter.LabelOwnerID = *userID
+		}
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		if !slices.Contains(utils.TaskSorts, strings.TrimPrefix(sort, "-")) {
+			return filter, fmt.Errorf("sort must be one of %s, with a - prefix for descending", strings.Join(utils.TaskSorts, ", "))
+		}
+		filter.Sort = sort
+	}
+
+	return filter, nil
 }
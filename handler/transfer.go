@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errImportFormat = errors.New("format must be csv, json or ndjson, send ?format= or a Content-Type of text/csv, application/json or application/x-ndjson")
+
+// tasks written to the client at once by an export
+const exportFlushEvery = 100
+
+// ExportTasksHandler streams the tasks matching the filters of GET /tasks as ?format=csv (default), json or ndjson.
+// Rows are read and written one by one, the whole export is never in memory.
+func (h *HttpTaskHandler) ExportTasksHandler(c *fiber.Ctx) error {
+	format := c.Query("format", utils.FormatCSV)
+	switch format {
+	case utils.FormatCSV:
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	case utils.FormatJSON:
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	case utils.FormatNDJSON:
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	default:
+		return c.Status(fiber.StatusBadRequest).SendString("format must be csv, json or ndjson")
+	}
+	filter, err := taskFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="tasks.%s"`, format))
+
+	// runs after the handler returned, while the response is sent
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.writeExport(w, format, filter); err != nil {
+			// the status line is gone already, the client gets a truncated file
+			log.Println("Error exporting tasks:", err)
+		}
+	})
+	return nil
+}
+
+func (h *HttpTaskHandler) writeExport(w *bufio.Writer, format string, filter utils.TaskFilter) error {
+	var csvWriter *csv.Writer
+	encoder := json.NewEncoder(w)
+	switch format {
+	case utils.FormatCSV:
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(utils.TaskColumns); err != nil {
+			return err
+		}
+	case utils.FormatJSON:
+		w.WriteString("[")
+	}
+
+	flush := func() error {
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		// fails when the client went away, which stops the export
+		return w.Flush()
+	}
+
+	n := 0
+	err := h.tasks.StreamTasks(filter, func(task *utils.Task) error {
+		record := utils.NewTaskRecord(task)
+		var err error
+		switch format {
+		case utils.FormatCSV:
+			err = csvWriter.Write(record.CSV())
+		case utils.FormatJSON:
+			if n > 0 {
+				w.WriteString(",")
+			}
+			err = encoder.Encode(record)
+		default:
+			err = encoder.Encode(record)
+		}
+		if err != nil {
+			return err
+		}
+		n++
+		if n%exportFlushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if format == utils.FormatJSON {
+		w.WriteString("]\n")
+	}
+	return flush()
+}
+
+// importRow is a parsed row of an import, Err when it couldn't be read
+type importRow struct {
+	Line   int
+	Record utils.TaskRecord
+	Err    error
+}
+
+// ImportTasksHandler creates tasks from a CSV, JSON array or NDJSON body in the format of the export.
+// Every row is checked like POST /tasks and reported on its own, rows whose external_id is already used
+// in the project are skipped. ?dry_run=true only reports, ?project_id= puts every row in that project.
+func (h *HttpTaskHandler) ImportTasksHandler(c *fiber.Ctx) error {
+	format := c.Query("format")
+	if format == "" {
+		format = importFormat(c.Get(fiber.HeaderContentType))
+	}
+	var projectID uint
+	if project := c.Query("project_id"); project != "" {
+		id, err := strconv.ParseUint(project, 10, 0)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("project_id must be a project id")
+		}
+		projectID = uint(id)
+	}
+	dryRun := c.QueryBool("dry_run")
+
+	rows, err := readImport(c.Body(), format)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if len(rows) == 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("the import has no rows")
+	} else if len(rows) > h.importMax {
+		return c.Status(fiber.StatusRequestEntityTooLarge).SendString(fmt.Sprintf("at most %d rows per import", h.importMax))
+	}
+	userID := *currentUserID(c)
+
+	response := utils.ImportResponse{DryRun: dryRun, Total: len(rows), Rows: make([]utils.ImportRowResult, len(rows))}
+	var tasks []*utils.Task
+	var indexes []int
+	// first row of every project and external id, a file can't have the same task twice
+	firstRows := map[string]int{}
+	for i, row := range rows {
+		result := &response.Rows[i]
+		result.Row, result.ExternalID = row.Line, row.Record.ExternalID
+		if row.Err != nil {
+			result.Result, result.Error = utils.ImportFailed, row.Err.Error()
+			continue
+		}
+
+		task, err := h.importTask(row.Record, projectID, userID)
+		if err != nil {
+			result.Result, result.Error = utils.ImportFailed, err.Error()
+			continue
+		}
+		if task.ExternalID != nil {
+			key := fmt.Sprintf("%d/%s", task.ProjectID, *task.ExternalID)
+			if first, ok := firstRows[key]; ok {
+				result.Result, result.Error = utils.ImportFailed, fmt.Sprintf("external_id is repeated, it is in row %d already", first)
+				continue
+			}
+			firstRows[key] = row.Line
+		}
+		tasks = append(tasks, task)
+		indexes = append(indexes, i)
+	}
+
+	outcomes, err := tasksOf(c, h.tasks).ImportTasks(tasks, dryRun)
+	if err != nil {
+		log.Println("Error importing tasks:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	for n, outcome := range outcomes {
+		result := &response.Rows[indexes[n]]
+		switch {
+		case outcome.Existing != 0:
+			result.Result, result.ID = utils.ImportSkipped, outcome.Existing
+		case outcome.Err != nil:
+			result.Result, result.Error = utils.ImportFailed, outcome.Err.Error()
+		case dryRun:
+			result.Result = utils.ImportValid
+		default:
+			result.Result, result.ID = utils.ImportCreated, outcome.Task.ID
+			h.auditor.Record(newAuditEntry(c, utils.AuditTaskCreate, "task", outcome.Task.ID, utils.Snapshot(outcome.Task)))
+		}
+	}
+
+	for _, result := range response.Rows {
+		switch result.Result {
+		case utils.ImportCreated:
+			response.Created++
+		case utils.ImportSkipped:
+			response.Skipped++
+		case utils.ImportValid:
+			response.Valid++
+		default:
+			response.Failed++
+		}
+	}
+
+	status := fiber.StatusOK
+	if response.Failed > 0 {
+		status = fiber.StatusMultiStatus
+	}
+	return c.Status(status).JSON(response)
+}
+
+// importTask is the new task of the record, checked and authorized like POST /tasks
+func (h *HttpTaskHandler) importTask(record utils.TaskRecord, projectID uint, userID uint) (*utils.Task, error) {
+	record.Title = strings.TrimSpace(record.Title)
+	record.ExternalID = strings.TrimSpace(record.ExternalID)
+	if record.Title == "" {
+		return nil, errors.New("title is required")
+	}
+
+	task := record.Task()
+	if projectID != 0 {
+		task.ProjectID = projectID
+	}
+	task.UserID = int(userID)
+	if err := validateTask(task); err != nil {
+		return nil, err
+	}
+	if _, err := h.prepareNewTask(task, userID); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// importFormat is the format of a Content-Type, "" when it isn't one
+func importFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return utils.FormatCSV
+	case fiber.MIMEApplicationJSON:
+		return utils.FormatJSON
+	case "application/x-ndjson", "application/jsonl":
+		return utils.FormatNDJSON
+	}
+	return ""
+}
+
+// readImport parses the body, errors of a single row are kept in the row. It fails for an unknown format
+// and for bodies that can't be read at all (invalid CSV quoting or header, not a JSON array).
+func readImport(body []byte, format string) ([]importRow, error) {
+	// spreadsheets like to start their CSV with a byte order mark
+	body = bytes.TrimPrefix(body, []byte("\ufeff"))
+
+	var rows []importRow
+	switch format {
+	case utils.FormatCSV:
+		reader := csv.NewReader(bytes.NewReader(body))
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV header: %w", err)
+		}
+		for i := range header {
+			header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		}
+		if err := utils.CheckTaskHeader(header); err != nil {
+			return nil, err
+		}
+
+		for {
+			record, err := reader.Read()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("invalid CSV: %w", err)
+			}
+			line, _ := reader.FieldPos(0)
+			row := importRow{Line: line}
+			if len(record) != len(header) {
+				row.Err = fmt.Errorf("the row has %d columns, the header %d", len(record), len(header))
+			} else {
+				row.Record, row.Err = utils.ParseTaskCSV(header, record)
+			}
+			rows = append(rows, row)
+		}
+	case utils.FormatJSON:
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, fmt.Errorf("the body must be a JSON array of tasks: %w", err)
+		}
+		for i, item := range items {
+			row := importRow{Line: i + 1}
+			row.Record, row.Err = decodeTaskRecord(item)
+			rows = append(rows, row)
+		}
+	case utils.FormatNDJSON:
+		for i, line := range bytes.Split(body, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			row := importRow{Line: i + 1}
+			row.Record, row.Err = decodeTaskRecord(line)
+			rows = append(rows, row)
+		}
+	default:
+		return nil, errImportFormat
+	}
+	return rows, nil
+}
+
+// decodeTaskRecord refuses unknown fields like the CSV header does, a typo doesn't silently drop a column
+func decodeTaskRecord(data []byte) (utils.TaskRecord, error) {
+	var record utils.TaskRecord
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&record); err != nil {
+		return record, fmt.Errorf("invalid task: %w", err)
+	}
+	return record, nil
+}
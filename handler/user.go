@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"log"
+	"math"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/service"
 	"github.com/Peeranut-Kit/go_backend_test/utils"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -17,17 +21,46 @@ type UserHandlerInterface interface {
 	Register(c *fiber.Ctx) error
 	Login(c *fiber.Ctx) error
 	GetCurrentUser(c *fiber.Ctx) error
+	VerifyEmailPage(c *fiber.Ctx) error
+	VerifyEmail(c *fiber.Ctx) error
+	ResendVerification(c *fiber.Ctx) error
+	ForgotPassword(c *fiber.Ctx) error
+	ResetPasswordPage(c *fiber.Ctx) error
+	ResetPassword(c *fiber.Ctx) error
+	GetMe(c *fiber.Ctx) error
+	UpdateMe(c *fiber.Ctx) error
+	ChangeEmail(c *fiber.Ctx) error
+	ChangePassword(c *fiber.Ctx) error
+	DeleteMe(c *fiber.Ctx) error
 }
 
 // Primary adapter
 type HttpUserHandler struct {
-	UserRepo repo.UserRepositoryInterface
-	validate *validator.Validate
+	UserRepo       repo.UserRepositoryInterface
+	validate       *validator.Validate
+	loginGuard     *service.LoginGuard
+	accountService *service.AccountService
+	passwords      *service.PasswordService
+	auditor        *service.Auditor
+	// dummyHash is compared against when the email is unknown so the response takes as long as a wrong password
+	dummyHash []byte
 }
 
 // Initiate primary adapter
-func NewHttpUserHandler(repo repo.UserRepositoryInterface, validate *validator.Validate) *HttpUserHandler {
-	return &HttpUserHandler{UserRepo: repo, validate: validate}
+func NewHttpUserHandler(repo repo.UserRepositoryInterface, validate *validator.Validate, loginGuard *service.LoginGuard, accountService *service.AccountService, passwords *service.PasswordService, auditor *service.Auditor) *HttpUserHandler {
+	dummyHash, err := passwords.Hash("dummy password")
+	if err != nil {
+		log.Println("Error hashing dummy password:", err)
+	}
+	return &HttpUserHandler{
+		UserRepo:       repo,
+		validate:       validate,
+		loginGuard:     loginGuard,
+		accountService: accountService,
+		passwords:      passwords,
+		auditor:        auditor,
+		dummyHash:      []byte(dummyHash),
+	}
 }
 
 func (u HttpUserHandler) Register(c *fiber.Ctx) error {
@@ -42,15 +75,26 @@ func (u HttpUserHandler) Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// password policy and breached password list
+	if err := u.passwords.Validate(user.Password, user.Email, user.Name); err != nil {
+		if errors.Is(err, utils.ErrWeakPassword) || err == utils.ErrBreachedPassword {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return err
+	}
+
 	// hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := u.passwords.Hash(user.Password)
 
 	if err != nil {
 		return err
 	}
 
 	// re-assign user password before saving in database
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
+
+	// the account starts unverified, whatever the client sent
+	user.EmailVerifiedAt = nil
 
 	err = u.UserRepo.CreateUser(user)
 	if err != nil {
@@ -58,6 +102,13 @@ func (u HttpUserHandler) Register(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
 
+	u.auditor.Record(newAuditEntry(c, utils.AuditUserRegister, "user", user.ID, utils.Snapshot(utils.NewUserProfile(user))))
+
+	// the user can ask for another email with POST /verify-email/resend, so this doesn't fail the registration
+	if err := u.accountService.SendVerification(user); err != nil {
+		log.Println("Error sending verification email:", err)
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "Create User Successful",
 	})
@@ -70,39 +121,79 @@ func (u HttpUserHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 	}
 
+	ip, userAgent := c.IP(), c.Get(fiber.HeaderUserAgent)
+
+	// rate limit per IP and reject locked accounts before touching the database
+	retryAt, err := u.loginGuard.Allow(ip, user.Email)
+	if err != nil {
+		return loginRejected(c, retryAt, err)
+	}
+
 	// get user from email
 	selectedUserByEmail, err := u.UserRepo.GetUserFromEmail(user)
-	if err != nil {
-		if err == utils.ErrNotFound {
-			return c.Status(fiber.StatusUnauthorized).SendString(err.Error())
-		} else {
-			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	if err != nil && err != utils.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	// compare password, unknown emails are compared against a dummy hash to keep the timing similar
+	hash, reason := u.dummyHash, "unknown email"
+	if selectedUserByEmail != nil {
+		hash, reason = []byte(selectedUserByEmail.Password), "wrong password"
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(user.Password)); err != nil || selectedUserByEmail == nil {
+		attempt, unlockAt, err := u.loginGuard.Fail(ip, user.Email, userAgent, reason)
+		// the email and reason stay in the login attempt, the audit log only references it
+		var attemptID interface{}
+		if attempt != nil {
+			attemptID = attempt.ID
 		}
+		u.auditor.Record(newAuditEntry(c, utils.AuditUserLoginFailed, "login_attempt", attemptID, nil))
+		if err != nil {
+			return loginRejected(c, unlockAt, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).SendString(utils.ErrInvalidCredentials.Error())
 	}
 
-	// compare password
-	err = bcrypt.CompareHashAndPassword([]byte(selectedUserByEmail.Password), []byte(user.Password))
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).SendString(err.Error())
+	// only told after the right password, so it doesn't reveal whether the email exists
+	if selectedUserByEmail.DisabledAt != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": utils.ErrUserDisabled.Error()})
 	}
 
-	// JWT part: Create the Claims
-	claims := jwt.MapClaims{
-		"user_id": selectedUserByEmail.ID,
-		"name":    selectedUserByEmail.Name,
-		"admin":   true,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+	if err := u.loginGuard.Success(ip, user.Email, userAgent); err != nil {
+		log.Println("Error resetting login failures:", err)
 	}
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// BCRYPT_COST was raised since the password was hashed, we have the plain password only now
+	if u.passwords.NeedsRehash(selectedUserByEmail.Password) {
+		if hashedPassword, err := u.passwords.Hash(user.Password); err != nil {
+			log.Println("Error rehashing password:", err)
+		} else if err := u.UserRepo.UpdatePassword(selectedUserByEmail.ID, hashedPassword); err != nil {
+			log.Println("Error saving rehashed password:", err)
+		}
+	}
 
-	// Generate encoded token and send it as response. (t is token)
-	t, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	t, err := issueJWT(c, selectedUserByEmail)
 	if err != nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
+	entry := newAuditEntry(c, utils.AuditUserLogin, "user", selectedUserByEmail.ID, nil)
+	entry.ActorID = &selectedUserByEmail.ID
+	u.auditor.Record(entry)
+
+	return c.JSON(fiber.Map{
+		"message": "Login success",
+		"token":   t,
+	})
+}
+
+// issueJWT signs a token for the user and sets it as the jwt cookie
+func issueJWT(c *fiber.Ctx, user *utils.User) (string, error) {
+	t, err := signJWT(user, time.Hour*72, nil)
+	if err != nil {
+		return "", err
+	}
+
 	// Insert JWT token into Fiber Cookie
 	c.Cookie(&fiber.Cookie{
 		Name:     "jwt",
@@ -111,18 +202,203 @@ func (u HttpUserHandler) Login(c *fiber.Ctx) error {
 		HTTPOnly: true,
 	})
 
-	return c.JSON(fiber.Map{
-		"message": "Login success",
-		"token":   t,
+	return t, nil
+}
+
+// signJWT creates the token of the user, extra claims are added on top (e.g. impersonator_id)
+func signJWT(user *utils.User, ttl time.Duration, extra jwt.MapClaims) (string, error) {
+	// JWT part: Create the Claims
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"name":    user.Name,
+		// informative only, authRequiredMiddleware reads the role from the database
+		"admin": user.IsAdmin,
+		// authRequiredMiddleware rejects the token once the user's token version is bumped
+		"token_version": user.TokenVersion,
+		"exp":           time.Now().Add(ttl).Unix(),
+	}
+	for key, value := range extra {
+		claims[key] = value
+	}
+
+	// Create token
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	// Generate encoded token and send it as response. (t is token)
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// loginRejected responds 429 with Retry-After for rate limited and locked logins.
+// Errors of the store itself are 500.
+func loginRejected(c *fiber.Ctx, retryAt time.Time, err error) error {
+	if err != utils.ErrTooManyRequests && err != utils.ErrAccountLocked {
+		log.Println("Error checking login rate limit:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	retryAfter := int(math.Ceil(time.Until(retryAt).Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":     err.Error(),
+		"unlock_at": retryAt.UTC().Format(time.RFC3339),
 	})
 }
 
+// GetCurrentUser keeps the response of /getme, GET /me returns the whole profile
 func (u HttpUserHandler) GetCurrentUser(c *fiber.Ctx) error {
-	userID := c.Locals("user_id").(string)
-	name := c.Locals("name").(string)
+	user := c.Locals("user").(*utils.User)
+
+	return c.JSON(fiber.Map{
+		"userID": strconv.FormatUint(uint64(user.ID), 10),
+		"name":   user.Name,
+	})
+}
+
+// VerifyEmailPage is the page of the emailed link. It doesn't redeem the token, its form posts it to VerifyEmail.
+func (u HttpUserHandler) VerifyEmailPage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return renderAccountPage(c, fiber.StatusBadRequest, accountPageData{Title: "Verify your email", Message: "The link has no token, open the link of the email again."})
+	}
 
+	return renderAccountPage(c, fiber.StatusOK, accountPageData{
+		Title:   "Verify your email",
+		Message: "Confirm that this email address belongs to you.",
+		Action:  "/verify-email",
+		Token:   token,
+		Button:  "Verify email",
+	})
+}
+
+// VerifyEmail redeems the token of a JSON body, or of the form of VerifyEmailPage which gets a page back
+func (u HttpUserHandler) VerifyEmail(c *fiber.Ctx) error {
+	req := new(utils.TokenRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := u.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := u.accountService.VerifyEmail(req.Token); err != nil {
+		status := fiber.StatusInternalServerError
+		if err == utils.ErrInvalidToken {
+			status = fiber.StatusBadRequest
+		} else if err == utils.ErrEmailTaken {
+			status = fiber.StatusConflict
+		}
+		if isFormPost(c) {
+			return renderAccountPage(c, status, accountPageData{Title: "Email not verified", Message: err.Error()})
+		}
+		if status == fiber.StatusInternalServerError {
+			return c.Status(status).SendString(err.Error())
+		}
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if isFormPost(c) {
+		return renderAccountPage(c, fiber.StatusOK, accountPageData{Title: "Email verified", Message: "Your email address is verified, you can close this page."})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Email verified",
+	})
+}
+
+func (u HttpUserHandler) ResendVerification(c *fiber.Ctx) error {
+	req := new(utils.EmailRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := u.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := u.accountService.ResendVerification(req.Email); err != nil {
+		log.Println("Error resending verification email:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	// same response whether the email exists or not
+	return c.JSON(fiber.Map{
+		"message": "If the email belongs to an unverified account, a verification email has been sent",
+	})
+}
+
+func (u HttpUserHandler) ForgotPassword(c *fiber.Ctx) error {
+	req := new(utils.EmailRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := u.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := u.accountService.ForgotPassword(req.Email); err != nil {
+		log.Println("Error sending password reset email:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	// same response whether the email exists or not
+	return c.JSON(fiber.Map{
+		"message": "If the email belongs to an account, a password reset email has been sent",
+	})
+}
+
+// ResetPasswordPage is the page of the emailed link, its form posts the token and the new password to ResetPassword
+func (u HttpUserHandler) ResetPasswordPage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return renderAccountPage(c, fiber.StatusBadRequest, accountPageData{Title: "Reset your password", Message: "The link has no token, open the link of the email again."})
+	}
+
+	return renderAccountPage(c, fiber.StatusOK, accountPageData{
+		Title:    "Reset your password",
+		Action:   "/password/reset",
+		Token:    token,
+		Password: true,
+		Button:   "Set password",
+	})
+}
+
+// ResetPassword takes a JSON body, or the form of ResetPasswordPage which gets a page back
+func (u HttpUserHandler) ResetPassword(c *fiber.Ctx) error {
+	req := new(utils.ResetPasswordRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := u.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user, err := u.accountService.ResetPassword(req.Token, req.Password)
+	if err != nil {
+		if err == utils.ErrInvalidToken || err == utils.ErrBreachedPassword || errors.Is(err, utils.ErrWeakPassword) {
+			if isFormPost(c) {
+				// a weak password can be fixed on the same page, the token is still valid
+				data := accountPageData{Title: "Reset your password", Message: err.Error()}
+				if err != utils.ErrInvalidToken {
+					data.Action, data.Token, data.Password, data.Button = "/password/reset", req.Token, true, "Set password"
+				}
+				return renderAccountPage(c, fiber.StatusBadRequest, data)
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Println("Error resetting password:", err)
+		if isFormPost(c) {
+			return renderAccountPage(c, fiber.StatusInternalServerError, accountPageData{Title: "Password not changed", Message: err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	u.auditor.Record(newAuditEntry(c, utils.AuditUserPasswordReset, "user", user.ID, nil))
+
+	if isFormPost(c) {
+		return renderAccountPage(c, fiber.StatusOK, accountPageData{Title: "Password changed", Message: "Your password is changed, you can log in with it now."})
+	}
 	return c.JSON(fiber.Map{
-		"userID": userID,
-		"name":   name,
+		"message": "Password reset successful",
 	})
 }
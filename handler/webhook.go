@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/service"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type WebhookHandlerInterface interface {
+	GetWebhooksHandler(c *fiber.Ctx) error
+	PostWebhookHandler(c *fiber.Ctx) error
+	GetWebhookHandler(c *fiber.Ctx) error
+	PutWebhookHandler(c *fiber.Ctx) error
+	DeleteWebhookHandler(c *fiber.Ctx) error
+	GetDeliveriesHandler(c *fiber.Ctx) error
+	TestWebhookHandler(c *fiber.Ctx) error
+}
+
+// Primary adapter, users only see and manage their own webhooks
+type HttpWebhookHandler struct {
+	webhooks *service.WebhookService
+	projects *service.ProjectService
+	validate *validator.Validate
+	auditor  *service.Auditor
+}
+
+// Initiate primary adapter
+func NewHttpWebhookHandler(webhooks *service.WebhookService, projects *service.ProjectService, validate *validator.Validate, auditor *service.Auditor) *HttpWebhookHandler {
+	return &HttpWebhookHandler{webhooks: webhooks, projects: projects, validate: validate, auditor: auditor}
+}
+
+func (h *HttpWebhookHandler) GetWebhooksHandler(c *fiber.Ctx) error {
+	webhooks, err := h.webhooks.GetWebhooks(*currentUserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(webhooks)
+}
+
+// webhookRequest parses and validates the body, it writes the error response when it returns nil
+func (h *HttpWebhookHandler) webhookRequest(c *fiber.Ctx) (*utils.WebhookRequest, error) {
+	req := new(utils.WebhookRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Println("Error decoding request body:", err)
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if err := h.validate.Struct(req); err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !strings.HasPrefix(req.URL, "https://") && !strings.HasPrefix(req.URL, "http://") {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Webhook URLs have to be http or https"})
+	}
+
+	// any member may subscribe, viewers read the tasks anyway
+	if req.ProjectID != nil {
+		if _, err := h.projects.Authorize(*req.ProjectID, *currentUserID(c), utils.ProjectRoleViewer); err == utils.ErrNotFound {
+			return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "project not found"})
+		} else if err != nil {
+			return nil, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+	return req, nil
+}
+
+// applyWebhookRequest copies the request to the webhook, an empty event list subscribes to all events
+func applyWebhookRequest(webhook *utils.Webhook, req *utils.WebhookRequest) {
+	webhook.URL = req.URL
+	webhook.ProjectID = req.ProjectID
+	webhook.Events = nil
+	for _, event := range req.Events {
+		if !slices.Contains(webhook.Events, event) {
+			webhook.Events = append(webhook.Events, event)
+		}
+	}
+	webhook.Active = req.Active == nil || *req.Active
+}
+
+// PostWebhookHandler returns the webhook with its secret, which is never shown again
+func (h *HttpWebhookHandler) PostWebhookHandler(c *fiber.Ctx) error {
+	req, err := h.webhookRequest(c)
+	if req == nil {
+		return err
+	}
+
+	webhook := &utils.Webhook{UserID: *currentUserID(c)}
+	applyWebhookRequest(webhook, req)
+
+	secret, err := h.webhooks.CreateWebhook(webhook)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditWebhookCreate, "webhook", webhook.ID, utils.Snapshot(webhook)))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+// currentWebhook reads the webhook of the :id param, it writes the error response when it returns nil
+func (h *HttpWebhookHandler) currentWebhook(c *fiber.Ctx) (*utils.Webhook, error) {
+	webhookId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	webhook, err := h.webhooks.GetWebhook(*currentUserID(c), uint(webhookId))
+	if err != nil {
+		if err == utils.ErrNotFound {
+			return nil, c.Status(fiber.StatusNotFound).SendString(err.Error())
+		} else {
+			return nil, c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+	}
+
+	return webhook, nil
+}
+
+func (h *HttpWebhookHandler) GetWebhookHandler(c *fiber.Ctx) error {
+	webhook, err := h.currentWebhook(c)
+	if webhook == nil {
+		return err
+	}
+
+	return c.JSON(webhook)
+}
+
+// PutWebhookHandler replaces the URL, project, events and active flag, the secret stays
+func (h *HttpWebhookHandler) PutWebhookHandler(c *fiber.Ctx) error {
+	req, err := h.webhookRequest(c)
+	if req == nil {
+		return err
+	}
+
+	webhook, err := h.currentWebhook(c)
+	if webhook == nil {
+		return err
+	}
+	before := *webhook
+
+	applyWebhookRequest(webhook, req)
+	if err := h.webhooks.UpdateWebhook(webhook); err != nil {
+		if err == utils.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditWebhookUpdate, "webhook", webhook.ID, utils.Diff(before, webhook)))
+
+	return c.JSON(webhook)
+}
+
+// DeleteWebhookHandler deletes the webhook with its pending deliveries and delivery log
+func (h *HttpWebhookHandler) DeleteWebhookHandler(c *fiber.Ctx) error {
+	webhook, err := h.currentWebhook(c)
+	if webhook == nil {
+		return err
+	}
+
+	if err := h.webhooks.DeleteWebhook(webhook); err != nil {
+		if err == utils.ErrNotFound {
+			return c.Status(fiber.StatusNotFound).SendString(err.Error())
+		}
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.auditor.Record(newAuditEntry(c, utils.AuditWebhookDelete, "webhook", webhook.ID, utils.Snapshot(webhook)))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetDeliveriesHandler is the delivery log of the webhook, newest first, ?status=pending|delivered|failed filters
+func (h *HttpWebhookHandler) GetDeliveriesHandler(c *fiber.Ctx) error {
+	webhook, err := h.currentWebhook(c)
+	if webhook == nil {
+		return err
+	}
+
+	page, pageSize := pagination(c)
+	filter := utils.WebhookDeliveryFilter{
+		WebhookID: webhook.ID,
+		Status:    c.Query("status"),
+		Offset:    (page - 1) * pageSize,
+		Limit:     pageSize,
+	}
+	switch filter.Status {
+	case "", utils.DeliveryPending, utils.DeliveryDelivered, utils.DeliveryFailed:
+	default:
+		return c.Status(fiber.StatusBadRequest).SendString("status is one of pending, delivered, failed")
+	}
+
+	deliveries, total, err := h.webhooks.GetDeliveries(filter)
+	if err != nil {
+		log.Println("Error reading webhook deliveries:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	if deliveries == nil {
+		deliveries = []utils.WebhookDelivery{}
+	}
+
+	return c.JSON(utils.WebhookDeliveryList{Deliveries: deliveries, Total: total, Page: page, PageSize: pageSize})
+}
+
+// TestWebhookHandler sends a ping event and returns its delivery, 200 even when the receiver failed it
+func (h *HttpWebhookHandler) TestWebhookHandler(c *fiber.Ctx) error {
+	webhook, err := h.currentWebhook(c)
+	if webhook == nil {
+		return err
+	}
+
+	delivery, err := h.webhooks.Test(webhook, currentUserID(c))
+	if err != nil {
+		log.Println("Error testing webhook:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.JSON(delivery)
+}
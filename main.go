@@ -3,12 +3,16 @@ package main
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	// recurring tasks are scheduled in IANA time zones, the zone database is built in for images without one
+	_ "time/tzdata"
 
 	"github.com/Peeranut-Kit/go_backend_test/handler"
 	"github.com/Peeranut-Kit/go_backend_test/repo"
@@ -19,6 +23,7 @@ import (
 	//jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/template/html/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
@@ -52,7 +57,20 @@ func main() {
 	fmt.Println("Database connected successfully")
 
 	// AutoMigration to create task table in database. create but never delete column, so it is not practical. we preferred Migrator()
-	db.AutoMigrate(&utils.Task{}, &utils.User{})
+	db.AutoMigrate(&utils.Task{}, &utils.User{}, &utils.LoginAttempt{}, &utils.UserToken{}, &utils.AuditEntry{}, &utils.TaskRevision{}, &utils.TaskReminder{}, &utils.Label{}, &utils.ChecklistItem{}, &utils.TaskDependency{}, &utils.Project{}, &utils.ProjectMember{}, &utils.ProjectInvitation{}, &utils.TaskWatcher{}, &utils.Comment{}, &utils.Attachment{}, &utils.IdempotencyRecord{}, &utils.Webhook{}, &utils.WebhookDelivery{})
+
+	if err := repo.MigrateTaskStatus(db); err != nil {
+		panic(fmt.Sprintf("Failed to migrate task statuses: %v", err))
+	}
+	if err := repo.MigrateTaskSearch(db); err != nil {
+		panic(fmt.Sprintf("Failed to migrate task search: %v", err))
+	}
+	if err := repo.MigrateTaskExternalID(db); err != nil {
+		panic(fmt.Sprintf("Failed to migrate task external ids: %v", err))
+	}
+	if err := repo.MigrateDefaultProjects(db); err != nil {
+		panic(fmt.Sprintf("Failed to migrate tasks to personal projects: %v", err))
+	}
 
 	// Initialize validator
 	validate := validator.New()
@@ -62,24 +80,112 @@ func main() {
 	// Initialize secondary adapter
 	taskRepo := repo.NewTaskGormRepo(db)
 	userRepo := repo.NewUserGormRepo(db)
+	// ADMIN_EMAILS is a comma separated list of users that are made admins on startup
+	promoteAdmins(userRepo, os.Getenv("ADMIN_EMAILS"))
+	loginAttemptRepo := repo.NewLoginAttemptGormRepo(db)
+	userTokenRepo := repo.NewUserTokenGormRepo(db)
+	labelRepo := repo.NewLabelGormRepo(db)
+	checklistRepo := repo.NewChecklistGormRepo(db)
+	commentRepo := repo.NewCommentGormRepo(db)
+	attachmentRepo := repo.NewAttachmentGormRepo(db)
+	idempotencyRepo := repo.NewIdempotencyGormRepo(db)
+	webhookRepo := repo.NewWebhookGormRepo(db)
+	projectRepo := repo.NewProjectGormRepo(db)
+	auditRepo := repo.NewAuditGormRepo(db)
+	if err := auditRepo.MigrateAppendOnly(); err != nil {
+		panic(fmt.Sprintf("Failed to make audit log append only: %v", err))
+	}
+	auditSinks, err := initAuditSinks(auditRepo)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize audit log: %v", err))
+	}
+	// in-memory rate limit counters, swap for a Redis adapter when running more than one instance
+	rateLimitStore := repo.NewMemoryRateLimitStore()
+
+	mailer, err := service.NewMailerFromEnv()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize mailer: %v", err))
+	}
+
+	passwordService, err := service.NewPasswordServiceFromEnv()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load breached password list: %v", err))
+	}
+
+	notifier, err := service.NewNotifierFromEnv()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize notifier: %v", err))
+	}
+
+	blobStore, err := service.NewBlobStoreFromEnv()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize blob store: %v", err))
+	}
+	attachmentConfig := service.AttachmentConfigFromEnv()
+
+	workflow, err := service.WorkflowFromEnv()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load task workflow: %v", err))
+	}
+
+	auditor := service.NewAuditor(auditSinks...)
+	loginGuard := service.NewLoginGuard(rateLimitStore, loginAttemptRepo, service.LoginGuardConfigFromEnv())
+	accountService := service.NewAccountService(userRepo, userTokenRepo, mailer, passwordService)
+	webhookService := service.NewWebhookService(webhookRepo, service.WebhookConfigFromEnv())
+	events := service.NewEventDispatcher(webhookService)
+	projectService := service.NewProjectService(projectRepo, mailer, events)
+	commentService := service.NewCommentService(commentRepo, projectRepo, notifier)
+	attachmentService := service.NewAttachmentService(attachmentRepo, blobStore, attachmentConfig)
+	taskService := service.NewTaskService(taskRepo, workflow, service.SubtaskMaxDepthFromEnv(), notifier, events)
+
 	// Initialize primary adapter
-	taskHandler := handler.NewHttpTaskHandler(taskRepo)
-	userHandler := handler.NewHttpUserHandler(userRepo, validate)
+	taskHandler := handler.NewHttpTaskHandler(taskService, projectService, auditor, os.Getenv("IF_MATCH_POLICY") == "require", service.BulkMaxOperationsFromEnv(), service.ImportMaxRowsFromEnv())
+	userHandler := handler.NewHttpUserHandler(userRepo, validate, loginGuard, accountService, passwordService, auditor)
+	labelHandler := handler.NewHttpLabelHandler(labelRepo, taskService, validate, auditor)
+	checklistHandler := handler.NewHttpChecklistHandler(checklistRepo, taskService, validate, auditor)
+	commentHandler := handler.NewHttpCommentHandler(commentService, taskService, validate, auditor)
+	attachmentHandler := handler.NewHttpAttachmentHandler(attachmentService, auditor)
+	projectHandler := handler.NewHttpProjectHandler(projectService, validate, auditor)
+	adminHandler := handler.NewHttpAdminHandler(userRepo, taskRepo, accountService, auditor)
+	auditHandler := handler.NewHttpAuditHandler(auditRepo)
+	webhookHandler := handler.NewHttpWebhookHandler(webhookService, projectService, validate, auditor)
+	calendarHandler := handler.NewHttpCalendarHandler(userRepo, taskService, auditor, accountService.BaseURL)
+	docsHandler, err := handler.NewHttpDocsHandler()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to build OpenAPI document: %v", err))
+	}
 
 	engine := html.New("./views", ".html")
 
 	// Fiber
 	app := fiber.New(fiber.Config{
 		Views: engine,
+		// room for an attachment of the largest size and the rest of the multipart body,
+		// bodyLimitMiddleware keeps the default limit on the other routes
+		BodyLimit: int(attachmentConfig.MaxSize) + 1<<20,
 	})
 
 	// Enable CORS with default settings
 	app.Use(cors.New())
 
+	// X-Request-Id is generated when the client doesn't send one, it ends up in the audit log
+	app.Use(requestid.New())
+
 	app.Use(simpleLogMiddleware)
 
+	app.Use(bodyLimitMiddleware)
+
+	// POST requests retried with the same Idempotency-Key get the first response back instead of running twice
+	app.Use(handler.NewIdempotencyMiddleware(idempotencyRepo, service.IdempotencyTTLFromEnv()))
+
 	app.Post("/register", userHandler.Register)
 	app.Post("/login", userHandler.Login)
+	app.Get("/verify-email", userHandler.VerifyEmailPage)
+	app.Post("/verify-email", userHandler.VerifyEmail)
+	app.Post("/verify-email/resend", userHandler.ResendVerification)
+	app.Post("/password/forgot", userHandler.ForgotPassword)
+	app.Get("/password/reset", userHandler.ResetPasswordPage)
+	app.Post("/password/reset", userHandler.ResetPassword)
 
 	/*// JWT Middleware is applied globally
 	app.Use(jwtware.New(jwtware.Config{
@@ -91,16 +197,113 @@ func main() {
 	// taskRoute.Use(checkMiddleware) this only applies in one group
 	// then taskRoute.Get("/", handler.GetTasks)
 
+	authRequiredMiddleware := newAuthRequiredMiddleware(userRepo)
+
 	taskRoute := app.Group("/tasks")
 	taskRoute.Use(authRequiredMiddleware)
 
 	app.Get("/getme", authRequiredMiddleware, userHandler.GetCurrentUser)
 
+	app.Get("/me", authRequiredMiddleware, userHandler.GetMe)
+	app.Patch("/me", authRequiredMiddleware, userHandler.UpdateMe)
+	app.Delete("/me", authRequiredMiddleware, userHandler.DeleteMe)
+	app.Post("/me/email", authRequiredMiddleware, userHandler.ChangeEmail)
+	app.Post("/me/password", authRequiredMiddleware, userHandler.ChangePassword)
+	app.Post("/me/calendar", authRequiredMiddleware, calendarHandler.PostCalendarTokenHandler)
+	app.Delete("/me/calendar", authRequiredMiddleware, calendarHandler.DeleteCalendarTokenHandler)
+
+	adminRoute := app.Group("/admin", authRequiredMiddleware, adminRequiredMiddleware)
+	adminRoute.Get("/users", adminHandler.ListUsers)
+	adminRoute.Get("/users/:id", adminHandler.GetUser)
+	adminRoute.Post("/users/:id/disable", adminHandler.DisableUser)
+	adminRoute.Post("/users/:id/enable", adminHandler.EnableUser)
+	adminRoute.Post("/users/:id/force-password-reset", adminHandler.ForcePasswordReset)
+	adminRoute.Post("/users/:id/impersonate", adminHandler.ImpersonateUser)
+
+	app.Get("/audit", authRequiredMiddleware, adminRequiredMiddleware, auditHandler.GetAuditHandler)
+
+	// the project role of the current user is checked on every route of a task
+	taskAccess := taskHandler.TaskAccessMiddleware
+	taskMember := taskHandler.TaskMemberMiddleware
+
 	app.Get("/tasks", taskHandler.GetTasksHandler)
 	app.Post("/tasks", taskHandler.PostTaskHandler)
-	app.Get("/tasks/:id", taskHandler.GetTaskHandler)
-	app.Put("/tasks/:id", taskHandler.PutTaskHandler)
-	app.Delete("/tasks/:id", taskHandler.DeleteTaskHandler)
+	app.Post("/tasks/bulk", taskHandler.BulkTasksHandler)
+	app.Post("/tasks/import", taskHandler.ImportTasksHandler)
+	// before /tasks/:id so "overdue" isn't taken as an id
+	app.Get("/tasks/overdue", taskHandler.GetOverdueTasksHandler)
+	app.Get("/tasks/next", taskHandler.GetNextTasksHandler)
+	app.Get("/tasks/search", taskHandler.SearchTasksHandler)
+	app.Get("/tasks/export", taskHandler.ExportTasksHandler)
+	app.Get("/tasks/:id", taskAccess, taskHandler.GetTaskHandler)
+	app.Put("/tasks/:id", taskAccess, taskHandler.PutTaskHandler)
+	app.Patch("/tasks/:id", taskAccess, taskHandler.PatchTaskHandler)
+	app.Delete("/tasks/:id", taskAccess, taskHandler.DeleteTaskHandler)
+	app.Get("/tasks/:id/history", taskAccess, taskHandler.GetTaskHistoryHandler)
+	app.Post("/tasks/:id/revert/:rev", taskAccess, taskHandler.RevertTaskHandler)
+	app.Post("/tasks/:id/transitions", taskAccess, taskHandler.TransitionTaskHandler)
+	app.Get("/tasks/:id/subtasks", taskAccess, taskHandler.GetSubtasksHandler)
+	app.Put("/tasks/:id/parent", taskAccess, taskHandler.MoveTaskHandler)
+	app.Post("/tasks/:id/restore", taskAccess, taskHandler.RestoreTaskHandler)
+	app.Put("/tasks/:id/project", taskAccess, taskHandler.MoveProjectHandler)
+	app.Put("/tasks/:id/recurrence", taskAccess, taskHandler.SetRecurrenceHandler)
+	app.Delete("/tasks/:id/recurrence", taskAccess, taskHandler.StopRecurrenceHandler)
+	app.Put("/tasks/:id/assignee", taskMember, taskHandler.AssignTaskHandler)
+	app.Delete("/tasks/:id/assignee", taskMember, taskHandler.UnassignTaskHandler)
+	app.Get("/tasks/:id/watchers", taskMember, taskHandler.GetWatchersHandler)
+	app.Post("/tasks/:id/watchers", taskMember, taskHandler.WatchTaskHandler)
+	app.Delete("/tasks/:id/watchers", taskMember, taskHandler.UnwatchTaskHandler)
+	app.Get("/tasks/:id/comments", taskMember, commentHandler.GetCommentsHandler)
+	app.Post("/tasks/:id/comments", taskMember, commentHandler.PostCommentHandler)
+	app.Put("/tasks/:id/comments/:commentId", taskMember, commentHandler.PutCommentHandler)
+	app.Delete("/tasks/:id/comments/:commentId", taskMember, commentHandler.DeleteCommentHandler)
+	app.Get("/tasks/:id/attachments", taskAccess, attachmentHandler.GetAttachmentsHandler)
+	app.Post("/tasks/:id/attachments", taskAccess, attachmentHandler.PostAttachmentHandler)
+	app.Get("/tasks/:id/attachments/:attachmentId", taskAccess, attachmentHandler.GetAttachmentHandler)
+	app.Delete("/tasks/:id/attachments/:attachmentId", taskAccess, attachmentHandler.DeleteAttachmentHandler)
+	app.Get("/tasks/:id/dependencies", taskAccess, taskHandler.GetDependenciesHandler)
+	app.Post("/tasks/:id/dependencies", taskAccess, taskHandler.AddDependencyHandler)
+	app.Delete("/tasks/:id/dependencies/:blockerId", taskAccess, taskHandler.RemoveDependencyHandler)
+	app.Get("/tasks/:id/dependents", taskAccess, taskHandler.GetDependentsHandler)
+	app.Get("/tasks/:id/checklist", taskAccess, checklistHandler.GetChecklistHandler)
+	app.Post("/tasks/:id/checklist", taskAccess, checklistHandler.PostChecklistItemHandler)
+	app.Patch("/tasks/:id/checklist/:itemId", taskAccess, checklistHandler.PatchChecklistItemHandler)
+	app.Delete("/tasks/:id/checklist/:itemId", taskAccess, checklistHandler.DeleteChecklistItemHandler)
+	app.Post("/tasks/:id/labels", taskAccess, labelHandler.AttachLabelsHandler)
+	app.Delete("/tasks/:id/labels/:labelId", taskAccess, labelHandler.DetachLabelHandler)
+
+	app.Get("/projects", authRequiredMiddleware, projectHandler.GetProjectsHandler)
+	app.Post("/projects", authRequiredMiddleware, projectHandler.PostProjectHandler)
+	app.Get("/projects/:id", authRequiredMiddleware, projectHandler.GetProjectHandler)
+	app.Put("/projects/:id", authRequiredMiddleware, projectHandler.PutProjectHandler)
+	app.Delete("/projects/:id", authRequiredMiddleware, projectHandler.DeleteProjectHandler)
+	app.Get("/projects/:id/members", authRequiredMiddleware, projectHandler.GetMembersHandler)
+	app.Put("/projects/:id/members/:userId", authRequiredMiddleware, projectHandler.PutMemberHandler)
+	app.Delete("/projects/:id/members/:userId", authRequiredMiddleware, projectHandler.DeleteMemberHandler)
+	app.Get("/projects/:id/invitations", authRequiredMiddleware, projectHandler.GetProjectInvitationsHandler)
+	app.Post("/projects/:id/invitations", authRequiredMiddleware, projectHandler.PostInvitationHandler)
+	app.Delete("/projects/:id/invitations/:invitationId", authRequiredMiddleware, projectHandler.DeleteInvitationHandler)
+	app.Get("/invitations", authRequiredMiddleware, projectHandler.GetMyInvitationsHandler)
+	app.Post("/invitations/:id/accept", authRequiredMiddleware, projectHandler.AcceptInvitationHandler)
+	app.Post("/invitations/:id/decline", authRequiredMiddleware, projectHandler.DeclineInvitationHandler)
+
+	// no token, the signature of the link is the authorization
+	app.Get("/attachments/:id/download", attachmentHandler.DownloadAttachmentHandler)
+	// no token either, the secret in the URL is the authorization
+	app.Get("/calendar/:token.ics", calendarHandler.GetFeedHandler)
+
+	app.Get("/webhooks", authRequiredMiddleware, webhookHandler.GetWebhooksHandler)
+	app.Post("/webhooks", authRequiredMiddleware, webhookHandler.PostWebhookHandler)
+	app.Get("/webhooks/:id", authRequiredMiddleware, webhookHandler.GetWebhookHandler)
+	app.Put("/webhooks/:id", authRequiredMiddleware, webhookHandler.PutWebhookHandler)
+	app.Delete("/webhooks/:id", authRequiredMiddleware, webhookHandler.DeleteWebhookHandler)
+	app.Get("/webhooks/:id/deliveries", authRequiredMiddleware, webhookHandler.GetDeliveriesHandler)
+	app.Post("/webhooks/:id/test", authRequiredMiddleware, webhookHandler.TestWebhookHandler)
+
+	app.Get("/labels", authRequiredMiddleware, labelHandler.GetLabelsHandler)
+	app.Post("/labels", authRequiredMiddleware, labelHandler.PostLabelHandler)
+	app.Put("/labels/:id", authRequiredMiddleware, labelHandler.PutLabelHandler)
+	app.Delete("/labels/:id", authRequiredMiddleware, labelHandler.DeleteLabelHandler)
 
 	// additional paths that are just learning note
 	// View Template -> render webpage without using frontend framework (no more usage)
@@ -113,13 +316,25 @@ func main() {
 
 	app.Get("/config", getEnv)
 
+	// API documentation
+	app.Get("/openapi.json", docsHandler.GetOpenAPIHandler)
+	app.Get("/docs", docsHandler.GetDocsUIHandler)
+
+	// Start reminder job, it sends task reminders through the notifier
+	go service.ReminderJob(taskRepo, notifier, service.ReminderIntervalFromEnv())
+
+	go service.IdempotencyCleanupJob(idempotencyRepo)
+
+	// Start webhook delivery job, it sends the outbox with retries
+	go service.WebhookDeliveryJob(webhookService)
+
+	// Start background task for periodic cleanup, before Listen which only returns on shutdown
+	go service.BackgroundTask(taskRepo, attachmentService, auditor, events, taskService.RestoreWindow)
+
 	// Start HTTP server
 	port := os.Getenv("PORT")
 	fmt.Printf("Starting server on port %s...\n", port)
 	app.Listen(":" + port)
-
-	// Start background task for periodic cleanup
-	go service.BackgroundTask(taskRepo)
 }
 
 func initDatabase() (*gorm.DB, error) {
@@ -163,47 +378,210 @@ func simpleLogMiddleware(c *fiber.Ctx) error {
 	start := time.Now()
 	fmt.Printf(
 		"URL = %s, Method = %s, Time = %s\n",
-		c.OriginalURL(), c.Method(), start,
+		redactedURL(c), c.Method(), start,
 	)
 
 	return c.Next()
 }
 
-func authRequiredMiddleware(c *fiber.Ctx) error {
-	cookie := c.Cookies("jwt")
-	secretKey := os.Getenv("JWT_SECRET")
-
-	token, err := jwt.ParseWithClaims(cookie, jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
+// redactedURL is the URL of the request without the secrets of the links that work without login:
+// the token of a calendar feed and the token and signature parameters of the email and download links
+func redactedURL(c *fiber.Ctx) string {
+	path := c.Path()
+	if strings.HasPrefix(path, "/calendar/") {
+		path = "/calendar/REDACTED.ics"
+	}
 
-	if err != nil || !token.Valid {
-		return c.SendStatus(fiber.StatusUnauthorized)
+	query := string(c.Request().URI().QueryString())
+	if query == "" {
+		return path
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return path + "?REDACTED"
 	}
+	for _, key := range []string{"token", "signature"} {
+		if values.Has(key) {
+			values.Set(key, "REDACTED")
+		}
+	}
+	return path + "?" + values.Encode()
+}
 
-	claim := token.Claims.(jwt.MapClaims)
-	/*fmt.Println(claim)
-	result is map[admin:true exp:1.731768743e+09 name:max@gmail.com user_id:0]*/
+// bodyLimitMiddleware answers 413 to bodies over fiber's default limit, only the attachment uploads get the
+// larger limit of the server
+func bodyLimitMiddleware(c *fiber.Ctx) error {
+	upload := c.Method() == fiber.MethodPost && strings.HasPrefix(c.Path(), "/tasks/") && strings.HasSuffix(c.Path(), "/attachments")
+	if !upload && len(c.Request().Body()) > fiber.DefaultBodyLimit {
+		return fiber.ErrRequestEntityTooLarge
+	}
+	return c.Next()
+}
 
-	// store user_id and name and pass to the next handler
-	var userID string
-	if id, ok := claim["user_id"].(string); ok {
-		userID = id
-	} else if idFloat, ok := claim["user_id"].(float64); ok {
-		userID = strconv.FormatFloat(idFloat, 'f', 0, 64) // Convert float64 to string
-	} else {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Invalid User ID conversion in token",
+// newAuthRequiredMiddleware checks the JWT cookie and loads the user, so deleted users and revoked tokens are rejected
+func newAuthRequiredMiddleware(userRepo repo.UserRepositoryInterface) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cookie := c.Cookies("jwt")
+		// API clients and impersonation tokens send the token in the Authorization header instead
+		if bearer, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok {
+			cookie = bearer
+		}
+		secretKey := os.Getenv("JWT_SECRET")
+
+		token, err := jwt.ParseWithClaims(cookie, jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
+			return []byte(secretKey), nil
 		})
+
+		if err != nil || !token.Valid {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		claim := token.Claims.(jwt.MapClaims)
+		/*fmt.Println(claim)
+		result is map[admin:true exp:1.731768743e+09 name:max@gmail.com user_id:0]*/
+
+		// store user_id and name and pass to the next handler
+		var userID string
+		if id, ok := claim["user_id"].(string); ok {
+			userID = id
+		} else if idFloat, ok := claim["user_id"].(float64); ok {
+			userID = strconv.FormatFloat(idFloat, 'f', 0, 64) // Convert float64 to string
+		} else {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Invalid User ID conversion in token",
+			})
+		}
+		name, _ := claim["name"].(string)
+
+		id, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		user, err := userRepo.GetUserByID(uint(id))
+		if err == utils.ErrNotFound {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+		}
+
+		// password change and reset bump the version, tokens issued before it are revoked
+		tokenVersion, _ := claim["token_version"].(float64)
+		if int(tokenVersion) != user.TokenVersion {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		if user.DisabledAt != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": utils.ErrUserDisabled.Error(),
+			})
+		}
+
+		if user.EmailVerifiedAt == nil && !unverifiedUserAllowed(c) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Email address is not verified",
+			})
+		}
+
+		c.Locals("user_id", userID)
+		c.Locals("name", name)
+		c.Locals("user", user)
+		// set when an admin acts as the user with an impersonation token, the token stops working as soon as
+		// the admin is deleted, disabled or loses the admin role
+		if impersonatorID, ok := claim["impersonator_id"].(float64); ok {
+			impersonator, err := userRepo.GetUserByID(uint(impersonatorID))
+			if err == utils.ErrNotFound {
+				return c.SendStatus(fiber.StatusUnauthorized)
+			} else if err != nil {
+				return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+			}
+			if impersonator.DisabledAt != nil || !impersonator.IsAdmin {
+				return c.SendStatus(fiber.StatusUnauthorized)
+			}
+			c.Locals("impersonator_id", impersonator.ID)
+		}
+
+		return c.Next()
 	}
-	name, _ := claim["name"].(string)
+}
 
-	c.Locals("user_id", userID)
-	c.Locals("name", name)
+// adminRequiredMiddleware runs after authRequiredMiddleware, the role comes from the database not from the admin claim.
+// Impersonation tokens never pass even if an admin impersonated another admin.
+func adminRequiredMiddleware(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(*utils.User)
+	if !ok || !user.IsAdmin || c.Locals("impersonator_id") != nil {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
 
 	return c.Next()
 }
 
+// unverifiedUserAllowed applies UNVERIFIED_USER_POLICY to users that have not verified their email:
+// "read_only" (default) only allows GET requests, "allow" lets them do everything and "deny" blocks every authenticated route.
+// The profile routes stay open so a user can fix a mistyped email.
+func unverifiedUserAllowed(c *fiber.Ctx) bool {
+	if c.Path() == "/getme" || c.Path() == "/me" || strings.HasPrefix(c.Path(), "/me/") {
+		return true
+	}
+	switch os.Getenv("UNVERIFIED_USER_POLICY") {
+	case "deny":
+		return false
+	case "allow":
+		return true
+	default:
+		return c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead
+	}
+}
+
+// initAuditSinks reads AUDIT_SINKS, a comma separated list of "postgres" (default) and "file" (NDJSON lines in AUDIT_FILE)
+func initAuditSinks(auditRepo *repo.AuditGormRepo) ([]repo.AuditSink, error) {
+	sinks := os.Getenv("AUDIT_SINKS")
+	if sinks == "" {
+		sinks = "postgres"
+	}
+
+	var auditSinks []repo.AuditSink
+	for _, sink := range strings.Split(sinks, ",") {
+		switch strings.TrimSpace(sink) {
+		case "postgres":
+			auditSinks = append(auditSinks, auditRepo)
+		case "file":
+			path := os.Getenv("AUDIT_FILE")
+			if path == "" {
+				path = "service/audit.ndjson"
+			}
+			fileSink, err := repo.NewNDJSONAuditSink(path)
+			if err != nil {
+				return nil, err
+			}
+			auditSinks = append(auditSinks, fileSink)
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", sink)
+		}
+	}
+	return auditSinks, nil
+}
+
+func promoteAdmins(userRepo repo.UserRepositoryInterface, emails string) {
+	for _, email := range strings.Split(emails, ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		user, err := userRepo.GetUserFromEmail(&utils.User{Email: email})
+		if err != nil {
+			log.Printf("Admin %s not promoted: %v\n", email, err)
+			continue
+		}
+		if user.IsAdmin {
+			continue
+		}
+		user.IsAdmin = true
+		if _, err := userRepo.UpdateUser(user); err != nil {
+			log.Printf("Admin %s not promoted: %v\n", email, err)
+		}
+	}
+}
+
 // validateFullname checks if the value contains only alphabets and spaces.
 func validateFullname(fl validator.FieldLevel) bool {
 	return regexp.MustCompile(`^[a-zA-Z\s]+$`).MatchString(fl.Field().String())
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeUserRepo finds the users by id, the methods the tests don't need panic
+type fakeUserRepo struct {
+	repo.UserRepositoryInterface
+	users map[uint]*utils.User
+}
+
+func (r *fakeUserRepo) GetUserByID(id uint) (*utils.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, utils.ErrNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func newTestUser(id uint, admin bool) *utils.User {
+	now := time.Now()
+	user := &utils.User{IsAdmin: admin, EmailVerifiedAt: &now}
+	user.ID = id
+	return user
+}
+
+func TestAuthRequiredImpersonation(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	users := &fakeUserRepo{users: map[uint]*utils.User{1: newTestUser(1, true), 2: newTestUser(2, false)}}
+
+	app := fiber.New()
+	app.Get("/tasks", newAuthRequiredMiddleware(users), func(c *fiber.Ctx) error {
+		if c.Locals("impersonator_id") != uint(1) {
+			t.Errorf("impersonator_id = %v, want 1", c.Locals("impersonator_id"))
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":         2,
+		"token_version":   0,
+		"impersonator_id": 1,
+		"exp":             time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disabledAt := time.Now()
+	// in order, the admin changes along the way
+	steps := []struct {
+		name   string
+		change func(admin *utils.User)
+		want   int
+	}{
+		{"admin", func(admin *utils.User) {}, fiber.StatusOK},
+		{"admin disabled", func(admin *utils.User) { admin.DisabledAt = &disabledAt }, fiber.StatusUnauthorized},
+		{"admin enabled again", func(admin *utils.User) { admin.DisabledAt = nil }, fiber.StatusOK},
+		{"admin role removed", func(admin *utils.User) { admin.IsAdmin = false }, fiber.StatusUnauthorized},
+		{"admin role given back", func(admin *utils.User) { admin.IsAdmin = true }, fiber.StatusOK},
+		{"admin deleted", func(admin *utils.User) { delete(users.users, 1) }, fiber.StatusUnauthorized},
+	}
+	for _, step := range steps {
+		step.change(users.users[1])
+		req := httptest.NewRequest(fiber.MethodGet, "/tasks", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != step.want {
+			t.Errorf("%s: GET /tasks = %d, want %d", step.name, resp.StatusCode, step.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SetAssignee assigns the task to assigneeID, nil unassigns it. The change is recorded as a revision.
+func (r *TaskGormRepo) SetAssignee(id uint, assigneeID *uint, authorID *uint) (*utils.Task, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		task := new(utils.Task)
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(task, id).Error; err != nil {
+			return err
+		}
+		before := task.AssigneeID
+
+		task.AssigneeID = assigneeID
+		task.Version++
+		if err := tx.Model(task).Select("assignee_id", "version").Updates(task).Error; err != nil {
+			return err
+		}
+
+		changes := utils.Diff(map[string]*uint{"assignee_id": before}, map[string]*uint{"assignee_id": assigneeID})
+		return addTaskRevision(tx, task.ID, utils.RevisionUpdate, authorID, task.Fields(), changes)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return r.GetTaskById(int(id))
+}
+
+func (r *TaskGormRepo) GetWatchers(taskID uint) ([]utils.TaskWatcher, error) {
+	watchers := []utils.TaskWatcher{}
+
+	result := r.db.Where("task_id = ?", taskID).Preload("User").Order("created_at, user_id").Find(&watchers)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+	for i := range watchers {
+		watchers[i].Name = watchers[i].User.Name
+	}
+
+	return watchers, nil
+}
+
+// AddWatcher changes nothing when the user already watches the task
+func (r *TaskGormRepo) AddWatcher(taskID uint, userID uint) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&utils.TaskWatcher{TaskID: taskID, UserID: userID})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *TaskGormRepo) RemoveWatcher(taskID uint, userID uint) error {
+	result := r.db.Where("task_id = ? AND user_id = ?", taskID, userID).Delete(&utils.TaskWatcher{})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
+
+// unassignMember runs when the user leaves the project, or every project with projectID 0
+func unassignMember(tx *gorm.DB, projectID uint, userID uint) error {
+	tasks := tx.Unscoped().Model(&utils.Task{}).Where("assignee_id = ?", userID)
+	watchers := tx.Where("user_id = ?", userID)
+	if projectID != 0 {
+		tasks = tasks.Where("project_id = ?", projectID)
+		watchers = watchers.Where("task_id IN (SELECT id FROM tasks WHERE project_id = ?)", projectID)
+	}
+
+	if err := tasks.Updates(map[string]interface{}{"assignee_id": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return err
+	}
+	return watchers.Delete(&utils.TaskWatcher{}).Error
+}
@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Secondary port for the attachment records, the files themselves are in the blob store.
+// The attachments of a deleted task are kept for its restore but can't be read, so they all get utils.ErrNotFound.
+type AttachmentRepositoryInterface interface {
+	GetAttachments(taskID uint) ([]utils.Attachment, error)
+	GetAttachment(taskID uint, id uint) (*utils.Attachment, error)
+	// GetAttachmentByID is for the signed download links, they don't carry the task
+	GetAttachmentByID(id uint) (*utils.Attachment, error)
+	CreateAttachment(attachment *utils.Attachment) error
+	DeleteAttachment(taskID uint, id uint) error
+
+	// GetPurgeableAttachments returns up to limit attachments of the tasks deleted before deletedBefore
+	GetPurgeableAttachments(deletedBefore time.Time, limit int) ([]utils.Attachment, error)
+	DeleteAttachments(ids []uint) error
+}
+
+// Secondary adapter
+type AttachmentGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewAttachmentGormRepo(db *gorm.DB) AttachmentRepositoryInterface {
+	return &AttachmentGormRepo{db: db}
+}
+
+// liveTask is the task of the attachment when it isn't deleted
+func liveTask(tx *gorm.DB) *gorm.DB {
+	return tx.Where("attachments.task_id IN (SELECT id FROM tasks WHERE deleted_at IS NULL)")
+}
+
+func (r *AttachmentGormRepo) GetAttachments(taskID uint) ([]utils.Attachment, error) {
+	attachments := []utils.Attachment{}
+
+	var count int64
+	if err := r.db.Model(&utils.Task{}).Where("id = ?", taskID).Count(&count).Error; err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if count == 0 {
+		return nil, utils.ErrNotFound
+	}
+
+	result := r.db.Where("task_id = ?", taskID).Order("created_at, id").Find(&attachments)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return attachments, nil
+}
+
+func (r *AttachmentGormRepo) GetAttachment(taskID uint, id uint) (*utils.Attachment, error) {
+	return r.getAttachment(r.db.Where("task_id = ?", taskID), id)
+}
+
+func (r *AttachmentGormRepo) GetAttachmentByID(id uint) (*utils.Attachment, error) {
+	return r.getAttachment(r.db, id)
+}
+
+func (r *AttachmentGormRepo) getAttachment(query *gorm.DB, id uint) (*utils.Attachment, error) {
+	attachment := new(utils.Attachment)
+
+	result := liveTask(query).First(attachment, id)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return attachment, nil
+}
+
+func (r *AttachmentGormRepo) CreateAttachment(attachment *utils.Attachment) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// the task can't be deleted before the attachment is in
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id").First(&utils.Task{}, attachment.TaskID).Error; err != nil {
+			return err
+		}
+		return tx.Create(attachment).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *AttachmentGormRepo) DeleteAttachment(taskID uint, id uint) error {
+	result := r.db.Where("task_id = ?", taskID).Delete(&utils.Attachment{}, id)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *AttachmentGormRepo) GetPurgeableAttachments(deletedBefore time.Time, limit int) ([]utils.Attachment, error) {
+	attachments := []utils.Attachment{}
+
+	result := r.db.Where("task_id IN (?)", r.db.Unscoped().Model(&utils.Task{}).Select("id").Where("deleted_at < ?", deletedBefore)).
+		Order("id").Limit(limit).Find(&attachments)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return attachments, nil
+}
+
+func (r *AttachmentGormRepo) DeleteAttachments(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := r.db.Where("id IN ?", ids).Delete(&utils.Attachment{}).Error; err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
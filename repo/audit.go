@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+)
+
+// Secondary port, the audit log is append only so there is nothing but a write
+type AuditSink interface {
+	WriteAudit(entry *utils.AuditEntry) error
+}
+
+// Secondary port for sinks that can be searched (GET /audit)
+type AuditQueryInterface interface {
+	QueryAudit(filter utils.AuditFilter) ([]utils.AuditEntry, int64, error)
+}
+
+// Secondary adapter
+type AuditGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewAuditGormRepo(db *gorm.DB) *AuditGormRepo {
+	return &AuditGormRepo{db: db}
+}
+
+// MigrateAppendOnly adds a trigger that makes Postgres refuse UPDATE and DELETE on the audit table
+func (r *AuditGormRepo) MigrateAppendOnly() error {
+	return r.db.Exec(`
+CREATE OR REPLACE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_entries is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_entries_append_only ON audit_entries;
+CREATE TRIGGER audit_entries_append_only BEFORE UPDATE OR DELETE ON audit_entries
+	FOR EACH ROW EXECUTE FUNCTION audit_entries_append_only();
+`).Error
+}
+
+func (r *AuditGormRepo) WriteAudit(entry *utils.AuditEntry) error {
+	result := r.db.Create(entry)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *AuditGormRepo) QueryAudit(filter utils.AuditFilter) ([]utils.AuditEntry, int64, error) {
+	var entries []utils.AuditEntry
+	var total int64
+
+	query := r.db.Model(&utils.AuditEntry{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	result := query.Order("created_at DESC, id DESC").Offset(filter.Offset).Limit(filter.Limit).Find(&entries)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, 0, result.Error
+	}
+
+	return entries, total, nil
+}
+
+// Secondary adapter writing one JSON object per line, for shipping to a log pipeline
+type NDJSONAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Initiate secondary adapter, the file is opened in append mode
+func NewNDJSONAuditSink(path string) (*NDJSONAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONAuditSink{file: file}, nil
+}
+
+func (s *NDJSONAuditSink) WriteAudit(entry *utils.AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.file.Write(line)
+	return err
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rows per INSERT statement of CreateTasks
+const bulkBatchSize = 100
+
+// Transaction gives fn a repository whose methods all run in one transaction, it is rolled back when fn
+// returns an error. The methods that open their own transaction get a savepoint inside it.
+func (r *TaskGormRepo) Transaction(fn func(tx TaskRepositoryInterface) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&TaskGormRepo{db: tx, viewerID: r.viewerID})
+	})
+}
+
+func (r *TaskGormRepo) Webhooks() WebhookRepositoryInterface {
+	return &WebhookGormRepo{db: r.db}
+}
+
+// CreateTasks is CreateTask for many tasks with batched inserts of the tasks, their reminders and their
+// first revisions. All of them are created or none.
+func (r *TaskGormRepo) CreateTasks(tasks []*utils.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, task := range tasks {
+			task.Version = 1
+			task.Labels = []utils.Label{}
+		}
+		if err := tx.Omit(clause.Associations).CreateInBatches(tasks, bulkBatchSize).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var reminders []utils.TaskReminder
+		var revisions []utils.TaskRevision
+		var parentIDs []uint
+		for _, task := range tasks {
+			reminders = append(reminders, taskReminders(task, now)...)
+
+			author := uint(task.UserID)
+			revisions = append(revisions, utils.TaskRevision{
+				TaskID:   task.ID,
+				Revision: 1,
+				Action:   utils.RevisionCreate,
+				AuthorID: &author,
+				Snapshot: utils.Snapshot(task.Fields()),
+				Changes:  utils.Snapshot(task.Fields()),
+			})
+
+			if task.ParentID != nil {
+				parentIDs = append(parentIDs, *task.ParentID)
+			}
+		}
+
+		if len(reminders) > 0 {
+			if err := tx.Omit(clause.Associations).CreateInBatches(reminders, bulkBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.CreateInBatches(revisions, bulkBatchSize).Error; err != nil {
+			return err
+		}
+		if len(parentIDs) > 0 {
+			return tx.Model(&utils.Task{}).Where("id IN ?", uniqueIDs(parentIDs)).
+				UpdateColumn("version", gorm.Expr("version + 1")).Error
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// GetTaskListStats is one aggregate query, calendar clients polling an unchanged feed don't load any task
+func (r *TaskGormRepo) GetTaskListStats(filter utils.TaskFilter) (*utils.TaskListStats, error) {
+	var row struct {
+		Count        int64
+		LastModified *time.Time
+		Versions     int64
+		Projects     *string
+	}
+	result := r.filterTasks(r.db.Model(&utils.Task{}), filter).
+		Select("COUNT(*) AS count, MAX(updated_at) AS last_modified, COALESCE(SUM(version), 0) AS versions, "+
+			"(SELECT string_agg(project_id::text, ',' ORDER BY project_id) FROM project_members WHERE user_id = ?) AS projects", filter.MemberID).
+		Scan(&row)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	stats := &utils.TaskListStats{Count: row.Count, Versions: row.Versions}
+	if row.LastModified != nil {
+		stats.LastModified = *row.LastModified
+	}
+	if row.Projects != nil {
+		stats.Projects = *row.Projects
+	}
+	return stats, nil
+}
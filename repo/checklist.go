@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+)
+
+// Secondary port. Items change the progress in the JSON of their task, every write bumps the task version.
+type ChecklistRepositoryInterface interface {
+	GetChecklist(taskID uint) ([]utils.ChecklistItem, error)
+	GetChecklistItem(taskID uint, id uint) (*utils.ChecklistItem, error)
+	CreateChecklistItem(item *utils.ChecklistItem) error
+	UpdateChecklistItem(item *utils.ChecklistItem) error
+	DeleteChecklistItem(taskID uint, id uint) error
+}
+
+// Secondary adapter
+type ChecklistGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewChecklistGormRepo(db *gorm.DB) ChecklistRepositoryInterface {
+	return &ChecklistGormRepo{db: db}
+}
+
+func (r *ChecklistGormRepo) GetChecklist(taskID uint) ([]utils.ChecklistItem, error) {
+	items := []utils.ChecklistItem{}
+
+	result := r.db.Where("task_id = ?", taskID).Order("position, id").Find(&items)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return items, nil
+}
+
+func (r *ChecklistGormRepo) GetChecklistItem(taskID uint, id uint) (*utils.ChecklistItem, error) {
+	item := new(utils.ChecklistItem)
+
+	result := r.db.Where("task_id = ?", taskID).First(item, id)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return item, nil
+}
+
+// CreateChecklistItem appends the item at the end of the list when it has no position
+func (r *ChecklistGormRepo) CreateChecklistItem(item *utils.ChecklistItem) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := touchTask(tx, item.TaskID); err != nil {
+			return err
+		}
+		if item.Position == 0 {
+			if err := tx.Model(&utils.ChecklistItem{}).Where("task_id = ?", item.TaskID).
+				Select("COALESCE(MAX(position), 0) + 1").Scan(&item.Position).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(item).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *ChecklistGormRepo) UpdateChecklistItem(item *utils.ChecklistItem) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := touchTask(tx, item.TaskID); err != nil {
+			return err
+		}
+		return tx.Model(item).Select("title", "done", "position").Updates(item).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *ChecklistGormRepo) DeleteChecklistItem(taskID uint, id uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("task_id = ?", taskID).Delete(&utils.ChecklistItem{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return touchTask(tx, taskID)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+)
+
+// Secondary port for the comments of tasks, they are read with the name of their author
+type CommentRepositoryInterface interface {
+	// GetComments returns a page of the comments of the task, oldest first, and their total
+	GetComments(taskID uint, offset int, limit int) ([]utils.Comment, int64, error)
+	GetComment(taskID uint, id uint) (*utils.Comment, error)
+	CreateComment(comment *utils.Comment) error
+	// UpdateComment saves the body and sets EditedAt
+	UpdateComment(comment *utils.Comment) error
+	DeleteComment(taskID uint, id uint) error
+}
+
+// Secondary adapter
+type CommentGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewCommentGormRepo(db *gorm.DB) CommentRepositoryInterface {
+	return &CommentGormRepo{db: db}
+}
+
+// withAuthor joins users without the soft delete scope, deleted authors keep their anonymized name
+func (r *CommentGormRepo) withAuthor() *gorm.DB {
+	return r.db.Model(&utils.Comment{}).
+		Select("comments.*, users.name AS author_name").
+		Joins("LEFT JOIN users ON users.id = comments.author_id")
+}
+
+func (r *CommentGormRepo) GetComments(taskID uint, offset int, limit int) ([]utils.Comment, int64, error) {
+	comments := []utils.Comment{}
+	var total int64
+
+	if err := r.db.Model(&utils.Comment{}).Where("task_id = ?", taskID).Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	result := r.withAuthor().Where("comments.task_id = ?", taskID).
+		Order("comments.created_at, comments.id").Offset(offset).Limit(limit).Find(&comments)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, 0, result.Error
+	}
+
+	return comments, total, nil
+}
+
+func (r *CommentGormRepo) GetComment(taskID uint, id uint) (*utils.Comment, error) {
+	comment := new(utils.Comment)
+
+	result := r.withAuthor().Where("comments.task_id = ? AND comments.id = ?", taskID, id).Take(comment)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return comment, nil
+}
+
+func (r *CommentGormRepo) CreateComment(comment *utils.Comment) error {
+	result := r.db.Create(comment)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return r.db.Model(&utils.User{}).Unscoped().Where("id = ?", comment.AuthorID).Select("name").Scan(&comment.AuthorName).Error
+}
+
+func (r *CommentGormRepo) UpdateComment(comment *utils.Comment) error {
+	now := time.Now()
+
+	result := r.db.Model(comment).Updates(map[string]interface{}{"body": comment.Body, "edited_at": now})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+	comment.EditedAt = &now
+
+	return nil
+}
+
+func (r *CommentGormRepo) DeleteComment(taskID uint, id uint) error {
+	result := r.db.Where("task_id = ?", taskID).Delete(&utils.Comment{}, id)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dependencies are the edges of task_dependencies, task_id is blocked by blocked_by_id.
+// Only open (not done or cancelled) and not deleted blockers count.
+
+// dependencyLock serializes the new dependencies like hierarchyLock does for moves
+const dependencyLock = 4243
+
+func (r *TaskGormRepo) GetBlockers(id uint) ([]utils.Task, error) {
+	tasks := []utils.Task{}
+
+	result := r.db.Where("id IN (SELECT blocked_by_id FROM task_dependencies WHERE task_id = ?)", id).
+		Order("id").Preload("Labels", r.viewerLabels).Find(&tasks)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return tasks, nil
+}
+
+func (r *TaskGormRepo) GetDependents(id uint) ([]utils.Task, error) {
+	tasks := []utils.Task{}
+
+	result := r.db.Where("id IN (SELECT task_id FROM task_dependencies WHERE blocked_by_id = ?)", id).
+		Order("id").Preload("Labels", r.viewerLabels).Find(&tasks)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return tasks, nil
+}
+
+func (r *TaskGormRepo) GetOpenBlockerIDs(id uint) ([]uint, error) {
+	var ids []uint
+
+	result := r.db.Model(&utils.Task{}).
+		Where("id IN (SELECT blocked_by_id FROM task_dependencies WHERE task_id = ?) AND status NOT IN ?", id, utils.ClosedStatuses).
+		Order("id").Pluck("id", &ids)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return ids, nil
+}
+
+// AddDependency makes id blocked by blockedByID, both have to be in the same project. Adding an existing dependency changes nothing.
+// It returns utils.ErrDependencyCycle when blockedByID already waits on id, directly or not.
+func (r *TaskGormRepo) AddDependency(id uint, blockedByID uint) error {
+	if id == blockedByID {
+		return utils.ErrDependencyCycle
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", dependencyLock).Error; err != nil {
+			return err
+		}
+
+		task, blocker := new(utils.Task), new(utils.Task)
+		if err := tx.Select("id", "project_id").First(task, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("id", "project_id").First(blocker, blockedByID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.ErrBlockerNotFound
+		} else if err != nil {
+			return err
+		}
+		if task.ProjectID != blocker.ProjectID {
+			return utils.ErrProjectMismatch
+		}
+
+		// UNION drops the rows already seen, so the walk ends even on a graph made into a cycle by hand
+		var cycle bool
+		err := tx.Raw(`
+WITH RECURSIVE up (id) AS (
+	SELECT blocked_by_id FROM task_dependencies WHERE task_id = ?
+	UNION
+	SELECT d.blocked_by_id FROM task_dependencies d JOIN up ON d.task_id = up.id
+)
+SELECT EXISTS (SELECT 1 FROM up WHERE id = ?)`, blockedByID, id).Scan(&cycle).Error
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return utils.ErrDependencyCycle
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&utils.TaskDependency{TaskID: id, BlockedByID: blockedByID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		return touchTask(tx, id)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrDependencyCycle && err != utils.ErrBlockerNotFound && err != utils.ErrProjectMismatch {
+			log.Println(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *TaskGormRepo) RemoveDependency(id uint, blockedByID uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("task_id = ? AND blocked_by_id = ?", id, blockedByID).Delete(&utils.TaskDependency{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return touchTask(tx, id)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *TaskGormRepo) GetOpenTaskGraph(userID uint) ([]utils.Task, map[uint][]uint, error) {
+	tasks := []utils.Task{}
+
+	// tasks left behind in projects the user isn't a member of anymore are not theirs to do
+	mine := r.db.Where("assignee_id = ? AND status NOT IN ?", userID, utils.ClosedStatuses).
+		Where("project_id IN (SELECT project_id FROM project_members WHERE user_id = ?)", userID)
+
+	result := mine.Session(&gorm.Session{}).
+		Order("id").Preload("Labels", r.viewerLabels).Find(&tasks)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, nil, result.Error
+	}
+
+	var edges []utils.TaskDependency
+	result = r.db.Joins("JOIN tasks blocker ON blocker.id = task_dependencies.blocked_by_id").
+		Where("blocker.deleted_at IS NULL AND blocker.status NOT IN ?", utils.ClosedStatuses).
+		Where("task_dependencies.task_id IN (?)", mine.Session(&gorm.Session{}).Model(&utils.Task{}).Select("id")).
+		Find(&edges)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, nil, result.Error
+	}
+
+	blockers := map[uint][]uint{}
+	for _, edge := range edges {
+		blockers[edge.TaskID] = append(blockers[edge.TaskID], edge.BlockedByID)
+	}
+
+	return tasks, blockers, nil
+}
@@ -0,0 +1,15 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// the walk over longer cycles is a recursive query, this covers the check made before it
+func TestAddDependencyOnItself(t *testing.T) {
+	// no database, the check can't reach it
+	if err := (&TaskGormRepo{}).AddDependency(3, 3); err != utils.ErrDependencyCycle {
+		t.Errorf("AddDependency(3, 3) = %v, want %v", err, utils.ErrDependencyCycle)
+	}
+}
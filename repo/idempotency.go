@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Secondary port
+type IdempotencyRepositoryInterface interface {
+	// Begin stores record as in flight, or returns the record already stored under its key (created is false then)
+	Begin(record *utils.IdempotencyRecord) (stored *utils.IdempotencyRecord, created bool, err error)
+	// Complete saves the response of the record and keeps it until expiresAt
+	Complete(record *utils.IdempotencyRecord, expiresAt time.Time) error
+	// Release frees the key of a record still in flight so the request can be retried
+	Release(scope string, key string) error
+	// Extend keeps the key of a record still in flight until until
+	Extend(scope string, key string, until time.Time) error
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// Secondary adapter
+type IdempotencyGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewIdempotencyGormRepo(db *gorm.DB) IdempotencyRepositoryInterface {
+	return &IdempotencyGormRepo{db: db}
+}
+
+// Begin relies on the primary key, of two concurrent requests with the same key only one insert goes through
+func (r *IdempotencyGormRepo) Begin(record *utils.IdempotencyRecord) (*utils.IdempotencyRecord, bool, error) {
+	// an expired record doesn't hold its key anymore
+	if err := r.db.Where("scope = ? AND key = ? AND expires_at < ?", record.Scope, record.Key, time.Now()).
+		Delete(&utils.IdempotencyRecord{}).Error; err != nil {
+		log.Println(err)
+		return nil, false, err
+	}
+
+	// the stored record may be released between the insert and the read, try again once then
+	for attempt := 0; attempt < 2; attempt++ {
+		result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			log.Println(result.Error)
+			return nil, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return record, true, nil
+		}
+
+		stored := &utils.IdempotencyRecord{}
+		err := r.db.Where("scope = ? AND key = ?", record.Scope, record.Key).First(stored).Error
+		if err == nil {
+			return stored, false, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println(err)
+			return nil, false, err
+		}
+	}
+
+	return nil, false, utils.ErrIdempotencyInFlight
+}
+
+func (r *IdempotencyGormRepo) Complete(record *utils.IdempotencyRecord, expiresAt time.Time) error {
+	now := time.Now()
+	result := r.db.Model(&utils.IdempotencyRecord{}).
+		Where("scope = ? AND key = ?", record.Scope, record.Key).
+		Updates(&utils.IdempotencyRecord{
+			Status:      record.Status,
+			Body:        record.Body,
+			ContentType: record.ContentType,
+			ETag:        record.ETag,
+			Location:    record.Location,
+			CompletedAt: &now,
+			ExpiresAt:   expiresAt,
+		})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *IdempotencyGormRepo) Release(scope string, key string) error {
+	result := r.db.Where("scope = ? AND key = ? AND completed_at IS NULL", scope, key).Delete(&utils.IdempotencyRecord{})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *IdempotencyGormRepo) Extend(scope string, key string, until time.Time) error {
+	result := r.db.Model(&utils.IdempotencyRecord{}).Where("scope = ? AND key = ? AND completed_at IS NULL", scope, key).
+		Update("expires_at", until)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *IdempotencyGormRepo) DeleteExpired(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", now).Delete(&utils.IdempotencyRecord{})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
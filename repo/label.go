@@ -0,0 +1,221 @@
+package repo
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Secondary port, every method is scoped to the labels of userID
+type LabelRepositoryInterface interface {
+	GetLabels(userID uint) ([]utils.Label, error)
+	GetLabel(userID uint, id uint) (*utils.Label, error)
+	CreateLabel(label *utils.Label) error
+	UpdateLabel(label *utils.Label) error
+	DeleteLabel(userID uint, id uint) error
+
+	// AttachLabels adds the labels to the task, the ones already attached are skipped
+	AttachLabels(userID uint, taskID uint, labelIDs []uint) error
+	DetachLabel(userID uint, taskID uint, labelID uint) error
+}
+
+// Secondary adapter
+type LabelGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewLabelGormRepo(db *gorm.DB) LabelRepositoryInterface {
+	return &LabelGormRepo{db: db}
+}
+
+func (r *LabelGormRepo) GetLabels(userID uint) ([]utils.Label, error) {
+	labels := []utils.Label{}
+
+	result := r.db.Where("user_id = ?", userID).Order("name").Find(&labels)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return labels, nil
+}
+
+func (r *LabelGormRepo) GetLabel(userID uint, id uint) (*utils.Label, error) {
+	label := new(utils.Label)
+
+	result := r.db.Where("user_id = ?", userID).First(label, id)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return label, nil
+}
+
+// nameTaken looks for another label of the user with the name, the unique index catches the races
+func nameTaken(tx *gorm.DB, label *utils.Label) (bool, error) {
+	var count int64
+	err := tx.Model(&utils.Label{}).Where("user_id = ? AND name = ? AND id <> ?", label.UserID, label.Name, label.ID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *LabelGormRepo) CreateLabel(label *utils.Label) error {
+	if taken, err := nameTaken(r.db, label); err != nil {
+		log.Println(err)
+		return err
+	} else if taken {
+		return utils.ErrLabelExists
+	}
+
+	result := r.db.Create(label)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+// UpdateLabel saves the name and color. The tasks carrying the label get a new version since their JSON changes.
+func (r *LabelGormRepo) UpdateLabel(label *utils.Label) error {
+	if taken, err := nameTaken(r.db, label); err != nil {
+		log.Println(err)
+		return err
+	} else if taken {
+		return utils.ErrLabelExists
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(label).Select("name", "color").Updates(label).Error; err != nil {
+			return err
+		}
+		return touchTasksWithLabel(tx, label.ID)
+	})
+
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *LabelGormRepo) DeleteLabel(userID uint, id uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		label := new(utils.Label)
+		if err := tx.Where("user_id = ?", userID).First(label, id).Error; err != nil {
+			return err
+		}
+
+		if err := touchTasksWithLabel(tx, label.ID); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM task_labels WHERE label_id = ?", label.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(label).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *LabelGormRepo) AttachLabels(userID uint, taskID uint, labelIDs []uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&utils.Label{}).Where("user_id = ? AND id IN ?", userID, labelIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		// duplicated ids count once
+		if int(count) != len(uniqueIDs(labelIDs)) {
+			return utils.ErrNotFound
+		}
+
+		if err := touchTask(tx, taskID); err != nil {
+			return err
+		}
+
+		rows := make([]map[string]interface{}, 0, len(labelIDs))
+		for _, labelID := range uniqueIDs(labelIDs) {
+			rows = append(rows, map[string]interface{}{"task_id": taskID, "label_id": labelID})
+		}
+		return tx.Table("task_labels").Clauses(clause.OnConflict{DoNothing: true}).Create(rows).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == utils.ErrNotFound {
+		return utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *LabelGormRepo) DetachLabel(userID uint, taskID uint, labelID uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`DELETE FROM task_labels WHERE task_id = ? AND label_id = ?
+			AND label_id IN (SELECT id FROM labels WHERE user_id = ?)`, taskID, labelID, userID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return utils.ErrNotFound
+		}
+		return touchTask(tx, taskID)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == utils.ErrNotFound {
+		return utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// touchTask bumps the version of an existing task, gorm.ErrRecordNotFound when there is none
+func touchTask(tx *gorm.DB, taskID uint) error {
+	result := tx.Model(&utils.Task{}).Where("id = ?", taskID).UpdateColumn("version", gorm.Expr("version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func touchTasksWithLabel(tx *gorm.DB, labelID uint) error {
+	return tx.Model(&utils.Task{}).
+		Where("id IN (SELECT task_id FROM task_labels WHERE label_id = ?)", labelID).
+		UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	var unique []uint
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"log"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+)
+
+// Secondary port
+type LoginAttemptRepositoryInterface interface {
+	CreateLoginAttempt(attempt *utils.LoginAttempt) error
+}
+
+// Secondary adapter
+type LoginAttemptGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewLoginAttemptGormRepo(db *gorm.DB) LoginAttemptRepositoryInterface {
+	return &LoginAttemptGormRepo{db: db}
+}
+
+func (r *LoginAttemptGormRepo) CreateLoginAttempt(attempt *utils.LoginAttempt) error {
+	result := r.db.Create(attempt)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
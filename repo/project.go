@@ -0,0 +1,637 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Secondary port
+type ProjectRepositoryInterface interface {
+	// GetProjects lists the projects of the user with the user's role
+	GetProjects(userID uint) ([]utils.Project, error)
+	GetProject(id uint) (*utils.Project, error)
+	// CreateProject makes project.OwnerID its owner
+	CreateProject(project *utils.Project) error
+	UpdateProject(project *utils.Project) error
+	// DeleteProjectTasks soft deletes the tasks of the project with a delete revision each and returns them
+	DeleteProjectTasks(id uint, authorID *uint) ([]utils.Task, error)
+	// DeleteProject removes the project with its members and invitations, delete the tasks first
+	DeleteProject(id uint) error
+	// GetPersonalProject creates the personal project of the user the first time
+	GetPersonalProject(userID uint) (*utils.Project, error)
+
+	// GetRole is "" when the user is not a member
+	GetRole(projectID uint, userID uint) (string, error)
+	// GetTaskProjectID finds deleted tasks too
+	GetTaskProjectID(taskID uint) (uint, error)
+
+	GetMembers(projectID uint) ([]utils.ProjectMember, error)
+	// SetMemberRole and RemoveMember return utils.ErrLastOwner instead of leaving the project without owner.
+	// A removed member is unassigned from the tasks of the project and stops watching them, a member made
+	// viewer is unassigned.
+	SetMemberRole(projectID uint, userID uint, role string) error
+	RemoveMember(projectID uint, userID uint) error
+
+	CreateInvitation(invitation *utils.ProjectInvitation) error
+	GetInvitation(id uint) (*utils.ProjectInvitation, error)
+	// GetInvitations lists the pending invitations of the project
+	GetInvitations(projectID uint, now time.Time) ([]utils.ProjectInvitation, error)
+	// GetInvitationsForEmail lists the pending invitations sent to email, with the project names
+	GetInvitationsForEmail(email string, now time.Time) ([]utils.ProjectInvitation, error)
+	DeleteInvitation(projectID uint, id uint) error
+	// AcceptInvitation adds the user to the project with the role of the invitation
+	AcceptInvitation(id uint, userID uint, now time.Time) error
+	DeclineInvitation(id uint, now time.Time) error
+
+	// Transaction runs fn with a repository bound to one transaction, Webhooks writes the event deliveries in it
+	Transaction(fn func(tx ProjectRepositoryInterface) error) error
+	Webhooks() WebhookRepositoryInterface
+}
+
+// Secondary adapter
+type ProjectGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewProjectGormRepo(db *gorm.DB) ProjectRepositoryInterface {
+	return &ProjectGormRepo{db: db}
+}
+
+// personalProjectName is the name personal projects start with, users can rename them
+const personalProjectName = "Personal"
+
+// MigrateDefaultProjects gives every user a personal project and puts the tasks from before projects in the
+// personal project of their author. It runs after AutoMigrate, running it again changes nothing.
+func MigrateDefaultProjects(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_projects_personal_owner ON projects (owner_id) WHERE personal`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`
+INSERT INTO projects (name, personal, owner_id, created_at, updated_at)
+SELECT ?, true, u.id, NOW(), NOW() FROM users u
+WHERE u.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM projects p WHERE p.owner_id = u.id AND p.personal)`, personalProjectName).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`
+INSERT INTO project_members (project_id, user_id, role, created_at)
+SELECT p.id, p.owner_id, ?, NOW() FROM projects p WHERE p.personal
+ON CONFLICT DO NOTHING`, utils.ProjectRoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+UPDATE tasks SET project_id = p.id FROM projects p
+WHERE p.personal AND p.owner_id = tasks.user_id AND (tasks.project_id IS NULL OR tasks.project_id = 0)`).Error
+	})
+}
+
+func (r *ProjectGormRepo) GetProjects(userID uint) ([]utils.Project, error) {
+	projects := []utils.Project{}
+
+	result := r.db.Model(&utils.Project{}).
+		Select("projects.*, project_members.role").
+		Joins("JOIN project_members ON project_members.project_id = projects.id AND project_members.user_id = ?", userID).
+		Order("projects.personal DESC, projects.name, projects.id").
+		Find(&projects)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return projects, nil
+}
+
+func (r *ProjectGormRepo) GetProject(id uint) (*utils.Project, error) {
+	project := new(utils.Project)
+
+	result := r.db.First(project, id)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return project, nil
+}
+
+func createProject(tx *gorm.DB, project *utils.Project) error {
+	if err := tx.Create(project).Error; err != nil {
+		return err
+	}
+	project.Role = utils.ProjectRoleOwner
+	return tx.Create(&utils.ProjectMember{ProjectID: project.ID, UserID: project.OwnerID, Role: utils.ProjectRoleOwner}).Error
+}
+
+func (r *ProjectGormRepo) CreateProject(project *utils.Project) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		return createProject(tx, project)
+	})
+
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *ProjectGormRepo) UpdateProject(project *utils.Project) error {
+	result := r.db.Model(project).Select("name", "description").Updates(project)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *ProjectGormRepo) Transaction(fn func(tx ProjectRepositoryInterface) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&ProjectGormRepo{db: tx})
+	})
+}
+
+func (r *ProjectGormRepo) Webhooks() WebhookRepositoryInterface {
+	return &WebhookGormRepo{db: r.db}
+}
+
+func (r *ProjectGormRepo) DeleteProjectTasks(id uint, authorID *uint) ([]utils.Task, error) {
+	var tasks []utils.Task
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("project_id = ?", id).Order("id").Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+		if err := tx.Where("project_id = ?", id).Delete(&utils.Task{}).Error; err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			if err := addTaskRevision(tx, task.ID, utils.RevisionDelete, authorID, task.Fields(), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+func (r *ProjectGormRepo) DeleteProject(id uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", id).Delete(&utils.ProjectInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id = ?", id).Delete(&utils.ProjectMember{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&utils.Project{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return utils.ErrNotFound
+		}
+		return nil
+	})
+
+	if err != nil {
+		if err != utils.ErrNotFound {
+			log.Println(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *ProjectGormRepo) GetPersonalProject(userID uint) (*utils.Project, error) {
+	find := func(tx *gorm.DB) (*utils.Project, error) {
+		var projects []utils.Project
+		if err := tx.Where("owner_id = ? AND personal", userID).Limit(1).Find(&projects).Error; err != nil {
+			return nil, err
+		}
+		if len(projects) == 0 {
+			return nil, nil
+		}
+		projects[0].Role = utils.ProjectRoleOwner
+		return &projects[0], nil
+	}
+
+	project, err := find(r.db)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if project != nil {
+		return project, nil
+	}
+
+	project = &utils.Project{Name: personalProjectName, Personal: true, OwnerID: userID}
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		return createProject(tx, project)
+	})
+	if err != nil {
+		// another request created it first, the unique index refused this one
+		if existing, findErr := find(r.db); findErr == nil && existing != nil {
+			return existing, nil
+		}
+		log.Println(err)
+		return nil, err
+	}
+
+	return project, nil
+}
+
+func (r *ProjectGormRepo) GetRole(projectID uint, userID uint) (string, error) {
+	var roles []string
+
+	result := r.db.Model(&utils.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectID, userID).Pluck("role", &roles)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return "", result.Error
+	}
+	if len(roles) == 0 {
+		return "", nil
+	}
+
+	return roles[0], nil
+}
+
+func (r *ProjectGormRepo) GetTaskProjectID(taskID uint) (uint, error) {
+	var ids []uint
+
+	result := r.db.Unscoped().Model(&utils.Task{}).Where("id = ?", taskID).Pluck("project_id", &ids)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return 0, result.Error
+	}
+	if len(ids) == 0 {
+		return 0, utils.ErrNotFound
+	}
+
+	return ids[0], nil
+}
+
+func (r *ProjectGormRepo) GetMembers(projectID uint) ([]utils.ProjectMember, error) {
+	members := []utils.ProjectMember{}
+
+	result := r.db.Where("project_id = ?", projectID).Preload("User").Order("created_at, user_id").Find(&members)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+	for i := range members {
+		members[i].Name = members[i].User.Name
+		members[i].Email = members[i].User.Email
+	}
+
+	return members, nil
+}
+
+// lockMember locks the member row, the owners of the project are locked too so two owners can't
+// demote each other at the same time
+func lockMember(tx *gorm.DB, projectID uint, userID uint) (*utils.ProjectMember, int64, error) {
+	var owners []utils.ProjectMember
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("project_id = ? AND role = ?", projectID, utils.ProjectRoleOwner).Find(&owners).Error; err != nil {
+		return nil, 0, err
+	}
+
+	member := new(utils.ProjectMember)
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("project_id = ? AND user_id = ?", projectID, userID).First(member).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return member, int64(len(owners)), nil
+}
+
+// leavesNoOwner tells when giving member the role, "" for removing it, would leave the project without owner
+func leavesNoOwner(member *utils.ProjectMember, role string, owners int64) bool {
+	return member.Role == utils.ProjectRoleOwner && role != utils.ProjectRoleOwner && owners <= 1
+}
+
+func (r *ProjectGormRepo) SetMemberRole(projectID uint, userID uint, role string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		member, owners, err := lockMember(tx, projectID, userID)
+		if err != nil {
+			return err
+		}
+		if leavesNoOwner(member, role, owners) {
+			return utils.ErrLastOwner
+		}
+		// only editors are assignees, a viewer keeps watching
+		if role == utils.ProjectRoleViewer {
+			if err := tx.Unscoped().Model(&utils.Task{}).Where("project_id = ? AND assignee_id = ?", projectID, userID).
+				Updates(map[string]interface{}{"assignee_id": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&utils.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectID, userID).
+			Update("role", role).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrLastOwner {
+			log.Println(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *ProjectGormRepo) RemoveMember(projectID uint, userID uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		member, owners, err := lockMember(tx, projectID, userID)
+		if err != nil {
+			return err
+		}
+		if leavesNoOwner(member, "", owners) {
+			return utils.ErrLastOwner
+		}
+		if err := unassignMember(tx, projectID, userID); err != nil {
+			return err
+		}
+		return tx.Where("project_id = ? AND user_id = ?", projectID, userID).Delete(&utils.ProjectMember{}).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrLastOwner {
+			log.Println(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *ProjectGormRepo) CreateInvitation(invitation *utils.ProjectInvitation) error {
+	result := r.db.Create(invitation)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *ProjectGormRepo) GetInvitation(id uint) (*utils.ProjectInvitation, error) {
+	invitation := new(utils.ProjectInvitation)
+
+	result := r.db.First(invitation, id)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return invitation, nil
+}
+
+func pendingInvitations(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Where("project_invitations.accepted_at IS NULL AND project_invitations.declined_at IS NULL AND project_invitations.expires_at > ?", now)
+}
+
+func (r *ProjectGormRepo) GetInvitations(projectID uint, now time.Time) ([]utils.ProjectInvitation, error) {
+	invitations := []utils.ProjectInvitation{}
+
+	result := pendingInvitations(r.db, now).Where("project_id = ?", projectID).Order("id").Find(&invitations)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return invitations, nil
+}
+
+func (r *ProjectGormRepo) GetInvitationsForEmail(email string, now time.Time) ([]utils.ProjectInvitation, error) {
+	invitations := []utils.ProjectInvitation{}
+
+	result := pendingInvitations(r.db, now).Where("LOWER(email) = LOWER(?)", email).Preload("Project").Order("id").Find(&invitations)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+	for i := range invitations {
+		invitations[i].ProjectName = invitations[i].Project.Name
+	}
+
+	return invitations, nil
+}
+
+func (r *ProjectGormRepo) DeleteInvitation(projectID uint, id uint) error {
+	result := r.db.Where("project_id = ? AND id = ?", projectID, id).Delete(&utils.ProjectInvitation{})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
+
+// answerInvitation locks the invitation and checks it is still pending
+func answerInvitation(tx *gorm.DB, id uint, now time.Time) (*utils.ProjectInvitation, error) {
+	invitation := new(utils.ProjectInvitation)
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(invitation, id).Error; err != nil {
+		return nil, err
+	}
+	if invitation.AcceptedAt != nil || invitation.DeclinedAt != nil || !invitation.ExpiresAt.After(now) {
+		return nil, utils.ErrInvitationClosed
+	}
+	return invitation, nil
+}
+
+func (r *ProjectGormRepo) AcceptInvitation(id uint, userID uint, now time.Time) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		invitation, err := answerInvitation(tx, id, now)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&utils.ProjectMember{ProjectID: invitation.ProjectID, UserID: userID, Role: invitation.Role})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return utils.ErrAlreadyMember
+		}
+
+		return tx.Model(invitation).Update("accepted_at", now).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrInvitationClosed && err != utils.ErrAlreadyMember {
+			log.Println(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *ProjectGormRepo) DeclineInvitation(id uint, now time.Time) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		invitation, err := answerInvitation(tx, id, now)
+		if err != nil {
+			return err
+		}
+		return tx.Model(invitation).Update("declined_at", now).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrInvitationClosed {
+			log.Println(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// SetProject moves the task and all its subtasks, deleted ones included, to projectID.
+// Subtasks can't be moved alone and the dependencies between the moved tasks and the others are removed.
+func (r *TaskGormRepo) SetProject(id uint, projectID uint, authorID *uint) (*utils.Task, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// subtasks can't be added under the task while it moves
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", hierarchyLock).Error; err != nil {
+			return err
+		}
+		task := new(utils.Task)
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(task, id).Error; err != nil {
+			return err
+		}
+		if task.ParentID != nil {
+			return utils.ErrSubtaskProject
+		}
+		if task.ProjectID == projectID {
+			return nil
+		}
+		before := task.ProjectID
+
+		var ids []uint
+		err := tx.Raw(`
+WITH RECURSIVE down (id) AS (
+	SELECT ?::bigint
+	UNION
+	SELECT t.id FROM tasks t JOIN down ON t.parent_id = down.id
+)
+SELECT id FROM down`, id).Scan(&ids).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Model(&utils.Task{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"project_id": projectID, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("(task_id IN ?) <> (blocked_by_id IN ?)", ids, ids).Delete(&utils.TaskDependency{}).Error; err != nil {
+			return err
+		}
+
+		task.ProjectID = projectID
+		changes := utils.Diff(map[string]uint{"project_id": before}, map[string]uint{"project_id": projectID})
+		return addTaskRevision(tx, task.ID, utils.RevisionMove, authorID, task.Fields(), changes)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrSubtaskProject {
+			log.Println(err)
+		}
+		return nil, err
+	}
+
+	return r.GetTaskById(int(id))
+}
+
+// deleteUserProjects runs in the DeleteUser transaction. Projects where the user was the only owner get
+// the oldest remaining member as owner, the ones left without members are deleted like personal projects.
+func deleteUserProjects(tx *gorm.DB, userID uint) error {
+	if err := tx.Exec(`
+UPDATE project_members m SET role = ?
+FROM (
+	SELECT DISTINCT ON (o.project_id) o.project_id, o.user_id FROM project_members o
+	JOIN project_members me ON me.project_id = o.project_id AND me.user_id = ? AND me.role = ?
+	WHERE o.user_id <> ?
+		AND NOT EXISTS (SELECT 1 FROM project_members x WHERE x.project_id = o.project_id AND x.user_id <> ? AND x.role = ?)
+	ORDER BY o.project_id, o.created_at, o.user_id
+) heir
+WHERE m.project_id = heir.project_id AND m.user_id = heir.user_id`,
+		utils.ProjectRoleOwner, userID, utils.ProjectRoleOwner, userID, userID, utils.ProjectRoleOwner).Error; err != nil {
+		return err
+	}
+	if err := unassignMember(tx, 0, userID); err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&utils.ProjectMember{}).Error; err != nil {
+		return err
+	}
+
+	var orphans []uint
+	if err := tx.Model(&utils.Project{}).
+		Where("(owner_id = ? AND personal) OR NOT EXISTS (SELECT 1 FROM project_members m WHERE m.project_id = projects.id)", userID).
+		Pluck("id", &orphans).Error; err != nil {
+		return err
+	}
+	if len(orphans) > 0 {
+		if err := tx.Where("project_id IN ?", orphans).Delete(&utils.Task{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id IN ?", orphans).Delete(&utils.ProjectInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id IN ?", orphans).Delete(&utils.ProjectMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&utils.Project{}, orphans).Error; err != nil {
+			return err
+		}
+	}
+
+	// owner_id only tells who made the project, the members table has the roles
+	return tx.Model(&utils.Project{}).Where("owner_id = ?", userID).
+		Update("owner_id", gorm.Expr("(SELECT m.user_id FROM project_members m WHERE m.project_id = projects.id AND m.role = ? ORDER BY m.created_at, m.user_id LIMIT 1)", utils.ProjectRoleOwner)).Error
+}
@@ -0,0 +1,33 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+func TestLeavesNoOwner(t *testing.T) {
+	tests := []struct {
+		name   string
+		member string
+		role   string
+		owners int64
+		want   bool
+	}{
+		{"last owner leaves", utils.ProjectRoleOwner, "", 1, true},
+		{"last owner made editor", utils.ProjectRoleOwner, utils.ProjectRoleEditor, 1, true},
+		{"last owner made viewer", utils.ProjectRoleOwner, utils.ProjectRoleViewer, 1, true},
+		{"last owner stays owner", utils.ProjectRoleOwner, utils.ProjectRoleOwner, 1, false},
+		{"one of two owners leaves", utils.ProjectRoleOwner, "", 2, false},
+		{"one of two owners made viewer", utils.ProjectRoleOwner, utils.ProjectRoleViewer, 2, false},
+		{"editor leaves", utils.ProjectRoleEditor, "", 1, false},
+		{"viewer leaves", utils.ProjectRoleViewer, "", 1, false},
+		{"viewer made owner", utils.ProjectRoleViewer, utils.ProjectRoleOwner, 1, false},
+	}
+	for _, tt := range tests {
+		member := &utils.ProjectMember{Role: tt.member}
+		if got := leavesNoOwner(member, tt.role, tt.owners); got != tt.want {
+			t.Errorf("%s: leavesNoOwner = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
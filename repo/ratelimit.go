@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"sync"
+	"time"
+)
+
+// Secondary port
+// The methods follow Redis semantics (INCR + EXPIRE NX, SET EX, GET, TTL, DEL) so a Redis adapter can implement it one to one
+type RateLimitStoreInterface interface {
+	// Incr increments the counter and returns the new value. ttl is only applied when the key is created.
+	Incr(key string, ttl time.Duration) (int64, error)
+	Get(key string) (int64, error)
+	Set(key string, value int64, ttl time.Duration) error
+	// TTL returns the remaining time to live of the key, 0 if the key does not exist
+	TTL(key string) (time.Duration, error)
+	Del(key string) error
+}
+
+type memoryEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// Secondary adapter, state is lost on restart and not shared between instances
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+// Initiate secondary adapter
+func NewMemoryRateLimitStore() RateLimitStoreInterface {
+	return NewMemoryRateLimitStoreWithClock(time.Now)
+}
+
+// NewMemoryRateLimitStoreWithClock reads the time from now, tests move it forward to expire keys
+func NewMemoryRateLimitStoreWithClock(now func() time.Time) RateLimitStoreInterface {
+	return &MemoryRateLimitStore{entries: map[string]memoryEntry{}, now: now}
+}
+
+// get returns the live entry, expired entries are removed lazily. caller must hold the lock
+func (s *MemoryRateLimitStore) get(key string) (memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if !entry.expiresAt.IsZero() && !s.now().Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func (s *MemoryRateLimitStore) Incr(key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok && ttl > 0 {
+		entry.expiresAt = s.now().Add(ttl)
+	}
+	entry.value++
+	s.entries[key] = entry
+
+	return entry.value, nil
+}
+
+func (s *MemoryRateLimitStore) Get(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.get(key)
+	return entry.value, nil
+}
+
+func (s *MemoryRateLimitStore) Set(key string, value int64, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = s.now().Add(ttl)
+	}
+	s.entries[key] = entry
+
+	return nil
+}
+
+func (s *MemoryRateLimitStore) TTL(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok || entry.expiresAt.IsZero() {
+		return 0, nil
+	}
+	return entry.expiresAt.Sub(s.now()), nil
+}
+
+func (s *MemoryRateLimitStore) Del(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	now := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	s := NewMemoryRateLimitStoreWithClock(func() time.Time { return now })
+
+	// the ttl is set by the first Incr only, like INCR + EXPIRE NX
+	for i, want := range []int64{1, 2, 3} {
+		got, _ := s.Incr("k", time.Minute)
+		if got != want {
+			t.Fatalf("Incr #%d = %d, want %d", i+1, got, want)
+		}
+		now = now.Add(10 * time.Second)
+	}
+	if ttl, _ := s.TTL("k"); ttl != 30*time.Second {
+		t.Errorf("TTL = %v, want 30s", ttl)
+	}
+
+	now = now.Add(30 * time.Second)
+	if got, _ := s.Get("k"); got != 0 {
+		t.Errorf("Get after expiry = %d, want 0", got)
+	}
+	if got, _ := s.Incr("k", time.Minute); got != 1 {
+		t.Errorf("Incr after expiry = %d, want 1", got)
+	}
+
+	s.Set("lock", 5, time.Hour)
+	if got, _ := s.Get("lock"); got != 5 {
+		t.Errorf("Get = %d, want 5", got)
+	}
+	s.Del("lock")
+	if ttl, _ := s.TTL("lock"); ttl != 0 {
+		t.Errorf("TTL after Del = %v, want 0", ttl)
+	}
+
+	// without a ttl the key never expires
+	s.Incr("forever", 0)
+	now = now.Add(24 * 365 * time.Hour)
+	if got, _ := s.Get("forever"); got != 1 {
+		t.Errorf("Get of a key without ttl = %d, want 1", got)
+	}
+	if ttl, _ := s.TTL("forever"); ttl != 0 {
+		t.Errorf("TTL of a key without ttl = %v, want 0", ttl)
+	}
+}
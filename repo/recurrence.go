@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SetRecurrence replaces the rule of the task, an empty recurrence stops it. The change is recorded as a revision.
+func (r *TaskGormRepo) SetRecurrence(id uint, recurrence string, timezone string, scheduledAt *time.Time, authorID *uint) (*utils.Task, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		task := new(utils.Task)
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(task, id).Error; err != nil {
+			return err
+		}
+		before := map[string]string{"recurrence": task.Recurrence, "timezone": task.Timezone}
+
+		task.Recurrence = recurrence
+		task.Timezone = timezone
+		task.ScheduledAt = scheduledAt
+		task.Version++
+		if err := tx.Model(task).Select("recurrence", "timezone", "scheduled_at", "version").Updates(task).Error; err != nil {
+			return err
+		}
+
+		changes := utils.Diff(before, map[string]string{"recurrence": recurrence, "timezone": timezone})
+		return addTaskRevision(tx, task.ID, utils.RevisionUpdate, authorID, task.Fields(), changes)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return r.GetTaskById(int(id))
+}
+
+// HasNextOccurrence counts deleted occurrences too, deleting the next occurrence ends the series
+func (r *TaskGormRepo) HasNextOccurrence(id uint) (bool, error) {
+	var count int64
+	result := r.db.Model(&utils.Task{}).Unscoped().Where("previous_occurrence_id = ?", id).Count(&count)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false, result.Error
+	}
+
+	return count > 0, nil
+}
+
+// CopyOccurrenceDetails copies the labels of every user and the checklist items, unchecked, from the task fromID to toID
+func (r *TaskGormRepo) CopyOccurrenceDetails(fromID uint, toID uint) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO task_labels (task_id, label_id) SELECT ?, label_id FROM task_labels WHERE task_id = ? ON CONFLICT DO NOTHING", toID, fromID).Error; err != nil {
+			return err
+		}
+
+		var items []utils.ChecklistItem
+		if err := tx.Where("task_id = ?", fromID).Order("position, id").Find(&items).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		for i := range items {
+			items[i] = utils.ChecklistItem{TaskID: toID, Title: items[i].Title, Position: items[i].Position}
+		}
+		return tx.Create(&items).Error
+	})
+
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package repo
+
+import (
+	"html"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+)
+
+// searchConfig is the text search configuration of the search_vector column and of the queries,
+// changing it means dropping the column so MigrateTaskSearch builds it again
+const searchConfig = "english"
+
+// MigrateTaskSearch adds the search_vector column, kept up to date by Postgres from the title (weight A)
+// and the description (weight B), and its GIN index. It runs after AutoMigrate, which leaves the column alone.
+func MigrateTaskSearch(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('` + searchConfig + `', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('` + searchConfig + `', coalesce(description, '')), 'B')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_search_vector ON tasks USING GIN (search_vector)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeHTML is the SQL of html.EscapeString for the text given to ts_headline, only the <mark> tags it adds are markup
+func escapeHTML(column string) string {
+	return `replace(replace(replace(replace(coalesce(` + column + `, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;')`
+}
+
+type searchHit struct {
+	ID                 uint
+	Rank               float64
+	TitleSnippet       string
+	DescriptionSnippet string
+}
+
+// SearchTasks matches q as a web search (words, "quoted phrases", or, -excluded) against the tasks of filter,
+// best rank first. The snippets are HTML escaped with the matches in <mark> tags.
+func (r *TaskGormRepo) SearchTasks(filter utils.TaskFilter, q string, offset int, limit int) ([]utils.TaskSearchResult, int64, error) {
+	results := []utils.TaskSearchResult{}
+	tsquery := "websearch_to_tsquery('" + searchConfig + "', ?)"
+
+	query := r.filterTasks(r.db.Model(&utils.Task{}), filter).Where("search_vector @@ "+tsquery, q)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	if total == 0 {
+		return results, 0, nil
+	}
+
+	var hits []searchHit
+	err := query.Select(
+		"id, ts_rank_cd(search_vector, "+tsquery+") AS rank, "+
+			"ts_headline('"+searchConfig+"', "+escapeHTML("title")+", "+tsquery+", 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS title_snippet, "+
+			"ts_headline('"+searchConfig+"', "+escapeHTML("description")+", "+tsquery+", 'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2') AS description_snippet",
+		q, q, q,
+	).Order("rank DESC, id DESC").Offset(offset).Limit(limit).Scan(&hits).Error
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	ids := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	var tasks []utils.Task
+	if err := r.db.Preload("Labels", r.viewerLabels).Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	byID := map[uint]utils.Task{}
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	// in rank order, a task deleted between the two queries is left out
+	for _, hit := range hits {
+		task, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, utils.TaskSearchResult{
+			Task:               task,
+			Rank:               hit.Rank,
+			TitleSnippet:       hit.TitleSnippet,
+			DescriptionSnippet: hit.DescriptionSnippet,
+		})
+	}
+
+	return results, total, nil
+}
+
+// SearchTasksInMemory is the tokenized fallback of SearchTasks for repositories without Postgres, the fakes of
+// the tests use it. It takes q the same way and keeps the order and the snippets of SearchTasks, but words are
+// only lower cased, without stemming, and the description snippet is the whole description.
+func SearchTasksInMemory(tasks []utils.Task, q string, offset int, limit int) ([]utils.TaskSearchResult, int64) {
+	query := parseSearch(q)
+
+	results := []utils.TaskSearchResult{}
+	for _, task := range tasks {
+		title, description := searchTokens(task.Title), searchTokens(task.Description)
+		rank, ok := query.rank(title, description)
+		if !ok {
+			continue
+		}
+		results = append(results, utils.TaskSearchResult{
+			Task:               task,
+			Rank:               rank,
+			TitleSnippet:       query.highlight(task.Title),
+			DescriptionSnippet: query.highlight(task.Description),
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Task.ID > results[j].Task.ID
+	})
+
+	total := int64(len(results))
+	if offset >= len(results) {
+		return []utils.TaskSearchResult{}, total
+	}
+	results = results[offset:]
+	if limit < len(results) {
+		results = results[:limit]
+	}
+	return results, total
+}
+
+var searchWord = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+func searchTokens(text string) []string {
+	return searchWord.FindAllString(strings.ToLower(text), -1)
+}
+
+// searchQuery is q parsed like websearch_to_tsquery: every group has to match with one of its phrases,
+// a phrase being one word or the words of a quoted phrase, and no excluded phrase may match
+type searchQuery struct {
+	groups   [][][]string
+	excluded [][]string
+}
+
+func parseSearch(q string) searchQuery {
+	var query searchQuery
+	or := false
+	for i, part := range strings.Split(q, `"`) {
+		var terms []string
+		if i%2 == 1 {
+			// inside quotes, the words are one phrase
+			terms = []string{part}
+		} else {
+			terms = strings.Fields(part)
+		}
+		for _, term := range terms {
+			if i%2 == 0 && strings.EqualFold(term, "or") {
+				or = len(query.groups) > 0
+				continue
+			}
+			exclude := i%2 == 0 && strings.HasPrefix(term, "-")
+			phrase := searchTokens(term)
+			if len(phrase) == 0 {
+				continue
+			}
+			switch {
+			case exclude:
+				query.excluded = append(query.excluded, phrase)
+			case or:
+				last := len(query.groups) - 1
+				query.groups[last] = append(query.groups[last], phrase)
+			default:
+				query.groups = append(query.groups, [][]string{phrase})
+			}
+			or = false
+		}
+	}
+	return query
+}
+
+// rank is like ts_rank_cd with its default weights, a title match counts 1 and a description match 0.4.
+// ok is false when the task doesn't match.
+func (q searchQuery) rank(title, description []string) (float64, bool) {
+	if len(q.groups) == 0 {
+		return 0, false
+	}
+	for _, phrase := range q.excluded {
+		if countPhrase(title, phrase)+countPhrase(description, phrase) > 0 {
+			return 0, false
+		}
+	}
+
+	rank := 0.0
+	for _, group := range q.groups {
+		matched := false
+		for _, phrase := range group {
+			inTitle, inDescription := countPhrase(title, phrase), countPhrase(description, phrase)
+			if inTitle+inDescription > 0 {
+				matched = true
+				rank += float64(inTitle) + 0.4*float64(inDescription)
+			}
+		}
+		if !matched {
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+func countPhrase(tokens, phrase []string) int {
+	count := 0
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		if slices.Equal(tokens[i:i+len(phrase)], phrase) {
+			count++
+		}
+	}
+	return count
+}
+
+// highlight HTML escapes text and puts the words of the phrases in <mark> tags
+func (q searchQuery) highlight(text string) string {
+	words := map[string]bool{}
+	for _, group := range q.groups {
+		for _, phrase := range group {
+			for _, word := range phrase {
+				words[word] = true
+			}
+		}
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range searchWord.FindAllStringIndex(text, -1) {
+		word := text[loc[0]:loc[1]]
+		if !words[strings.ToLower(word)] {
+			continue
+		}
+		out.WriteString(html.EscapeString(text[last:loc[0]]))
+		out.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		last = loc[1]
+	}
+	out.WriteString(html.EscapeString(text[last:]))
+	return out.String()
+}
@@ -0,0 +1,311 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Subtasks are tasks with a parent_id. The hierarchy queries use recursive CTEs,
+// the depth guard only protects against rows that were made into a cycle by hand.
+
+const hierarchyGuard = 100
+
+// hierarchyLock serializes the moves of tasks inside their transactions so two concurrent moves can't make a cycle
+const hierarchyLock = 4242
+
+// ancestorIDs returns the parent, grand parent... of the task up to the top level task
+func ancestorIDs(tx *gorm.DB, id uint) ([]uint, error) {
+	var ids []uint
+	err := tx.Raw(`
+WITH RECURSIVE up (id, parent_id, depth) AS (
+	SELECT id, parent_id, 0 FROM tasks WHERE id = ?
+	UNION ALL
+	SELECT t.id, t.parent_id, up.depth + 1 FROM tasks t JOIN up ON t.id = up.parent_id WHERE up.depth < ?
+)
+SELECT id FROM up WHERE depth > 0 ORDER BY depth`, id, hierarchyGuard).Scan(&ids).Error
+	return ids, err
+}
+
+type descendant struct {
+	ID    uint
+	Depth int
+}
+
+// descendants of the task whose deleted_at matches, nil deletedAt for the ones that are not deleted
+func descendants(tx *gorm.DB, id uint, deletedAt *gorm.DeletedAt) ([]descendant, error) {
+	condition, args := "deleted_at IS NULL", []interface{}{}
+	if deletedAt != nil {
+		condition, args = "deleted_at = ?", []interface{}{deletedAt.Time}
+	}
+
+	var rows []descendant
+	query := `
+WITH RECURSIVE down (id, depth) AS (
+	SELECT id, 1 FROM tasks WHERE parent_id = ? AND ` + condition + `
+	UNION ALL
+	SELECT t.id, down.depth + 1 FROM tasks t JOIN down ON t.parent_id = down.id WHERE t.` + condition + ` AND down.depth < ?
+)
+SELECT id, depth FROM down ORDER BY depth, id`
+	values := append(append(append([]interface{}{id}, args...), args...), hierarchyGuard)
+	err := tx.Raw(query, values...).Scan(&rows).Error
+	return rows, err
+}
+
+func (r *TaskGormRepo) GetAncestorIDs(id uint) ([]uint, error) {
+	ids, err := ancestorIDs(r.db, id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *TaskGormRepo) GetSubtasks(id uint) ([]utils.Task, error) {
+	tasks := []utils.Task{}
+
+	result := r.db.Where("parent_id = ?", id).Order("id").Preload("Labels", r.viewerLabels).Find(&tasks)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return tasks, nil
+}
+
+// SetParent moves the task under parentID (nil for top level). The parent can't be the task or one of its
+// subtasks and the deepest subtask of the task must stay within maxDepth levels under the top level task.
+func (r *TaskGormRepo) SetParent(id uint, parentID *uint, maxDepth int, authorID *uint) (*utils.Task, error) {
+	task := new(utils.Task)
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", hierarchyLock).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(task, id).Error; err != nil {
+			return err
+		}
+		before := task.ParentID
+
+		if parentID != nil {
+			parent := new(utils.Task)
+			if err := tx.Select("id", "project_id").First(parent, *parentID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrParentNotFound
+			} else if err != nil {
+				return err
+			}
+			if parent.ProjectID != task.ProjectID {
+				return utils.ErrProjectMismatch
+			}
+			ancestors, err := ancestorIDs(tx, *parentID)
+			if err != nil {
+				return err
+			}
+			if *parentID == id || slices.Contains(ancestors, id) {
+				return utils.ErrTaskCycle
+			}
+
+			below, err := descendants(tx, id, nil)
+			if err != nil {
+				return err
+			}
+			height := 0
+			if len(below) > 0 {
+				height = below[len(below)-1].Depth
+			}
+			// the parent has len(ancestors) levels above it, the task goes one under it
+			if len(ancestors)+1+height > maxDepth {
+				return utils.ErrMaxDepth
+			}
+		}
+
+		task.ParentID = parentID
+		task.Version++
+		if err := tx.Model(task).Select("parent_id", "version").Updates(task).Error; err != nil {
+			return err
+		}
+		// the progress of both parents changes
+		for _, p := range []*uint{before, parentID} {
+			if p != nil {
+				if err := touchTask(tx, *p); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+			}
+		}
+
+		changes := utils.Diff(map[string]*uint{"parent_id": before}, map[string]*uint{"parent_id": parentID})
+		return addTaskRevision(tx, task.ID, utils.RevisionMove, authorID, task.Fields(), changes)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrTaskCycle && err != utils.ErrMaxDepth && err != utils.ErrParentNotFound && err != utils.ErrProjectMismatch {
+			log.Println(err)
+		}
+		return nil, err
+	}
+
+	return r.GetTaskById(int(id))
+}
+
+// GetOpenDescendants returns every subtask, at any depth, that is not done or cancelled, parents before their subtasks.
+// Inside a transaction the rows stay locked until it ends.
+func (r *TaskGormRepo) GetOpenDescendants(id uint) ([]utils.Task, error) {
+	below, err := descendants(r.db, id, nil)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if len(below) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, len(below))
+	for i, d := range below {
+		ids[i] = d.ID
+	}
+
+	var found []utils.Task
+	result := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ? AND status NOT IN ?", ids, utils.ClosedStatuses).Find(&found)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	// in the order of descendants, by depth
+	byID := make(map[uint]utils.Task, len(found))
+	for _, task := range found {
+		byID[task.ID] = task
+	}
+	tasks := make([]utils.Task, 0, len(found))
+	for _, id := range ids {
+		if task, ok := byID[id]; ok {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+// RestoreTask undoes the soft delete of the task and of the subtasks that were deleted with it.
+// The task can't be restored while its parent is deleted.
+func (r *TaskGormRepo) RestoreTask(id uint, deletedAfter time.Time, authorID *uint) (*utils.Task, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var task utils.Task
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&task, id).Error; err != nil {
+			return err
+		}
+		if !task.DeletedAt.Valid {
+			return nil
+		}
+		// its attachments may be purged already
+		if task.DeletedAt.Time.Before(deletedAfter) {
+			return utils.ErrRestoreExpired
+		}
+		if task.ParentID != nil {
+			if err := tx.Select("id").First(&utils.Task{}, *task.ParentID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.ErrParentDeleted
+			} else if err != nil {
+				return err
+			}
+		}
+
+		// subtasks deleted with the task share its deleted_at, the ones deleted before stay deleted
+		below, err := descendants(tx, id, &task.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		ids := []uint{task.ID}
+		for _, d := range below {
+			ids = append(ids, d.ID)
+		}
+		if err := tx.Unscoped().Model(&utils.Task{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+
+		var restored []utils.Task
+		if err := tx.Where("id IN ?", ids).Find(&restored).Error; err != nil {
+			return err
+		}
+		for _, t := range restored {
+			if err := addTaskRevision(tx, t.ID, utils.RevisionRestore, authorID, t.Fields(), nil); err != nil {
+				return err
+			}
+		}
+		if task.ParentID != nil {
+			return touchTask(tx, *task.ParentID)
+		}
+		return nil
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrParentDeleted {
+			log.Println(err)
+		}
+		return nil, err
+	}
+
+	return r.GetTaskById(int(id))
+}
+
+// GetTaskProgress counts the subtasks and checklist items of all the tasks with two grouped queries
+func (r *TaskGormRepo) GetTaskProgress(ids []uint) (map[uint]utils.TaskProgress, error) {
+	progress := make(map[uint]utils.TaskProgress, len(ids))
+	if len(ids) == 0 {
+		return progress, nil
+	}
+
+	type count struct {
+		ID    uint
+		Done  int
+		Total int
+	}
+
+	var subtasks []count
+	err := r.db.Model(&utils.Task{}).
+		Select("parent_id AS id, COUNT(*) FILTER (WHERE status = ?) AS done, COUNT(*) AS total", utils.StatusDone).
+		Where("parent_id IN ? AND status <> ?", ids, utils.StatusCancelled).
+		Group("parent_id").
+		Scan(&subtasks).Error
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var checklist []count
+	err = r.db.Model(&utils.ChecklistItem{}).
+		Select("task_id AS id, COUNT(*) FILTER (WHERE done) AS done, COUNT(*) AS total").
+		Where("task_id IN ?", ids).
+		Group("task_id").
+		Scan(&checklist).Error
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	for _, c := range subtasks {
+		p := progress[c.ID]
+		p.SubtasksDone, p.SubtasksTotal = c.Done, c.Total
+		progress[c.ID] = p
+	}
+	for _, c := range checklist {
+		p := progress[c.ID]
+		p.ChecklistDone, p.ChecklistTotal = c.Done, c.Total
+		progress[c.ID] = p
+	}
+	for id, p := range progress {
+		p.Sum()
+		progress[id] = p
+	}
+
+	return progress, nil
+}
@@ -1,27 +1,102 @@
 package repo
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Peeranut-Kit/go_backend_test/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Secondary port
 type TaskRepositoryInterface interface {
-	GetTasks() ([]utils.Task, error)
+	// ForViewer binds the repository to the user whose labels the loaded tasks come with
+	ForViewer(userID uint) TaskRepositoryInterface
+	GetTasks(filter utils.TaskFilter) ([]utils.Task, error)
 	CreateTask(task *utils.Task) (*utils.Task, error)
 	GetTaskById(id int) (*utils.Task, error)
-	UpdateTask(id int, task *utils.Task) (*utils.Task, error)
-	DeleteTask(id int) error
-
+	// authorID is the user making the change, nil for the system. Every mutation writes a revision.
+	// A non zero task.Version / version must be the current one or utils.ErrVersionMismatch is returned.
+	UpdateTask(id int, task *utils.Task, authorID *uint) (*utils.Task, error)
+	UpdateTaskFields(id int, fields utils.TaskFields, version int, authorID *uint) (*utils.Task, error)
+	DeleteTask(id int, version int, authorID *uint) error
+
+	GetTaskRevisions(taskID int) ([]utils.TaskRevision, error)
+	GetRevisionFields(taskID int, revision int) (*utils.TaskFields, error)
+	// RevertTask restores the fields of a revision, which is recorded as a new revision
+	RevertTask(taskID int, fields utils.TaskFields, version int, authorID *uint) (*utils.Task, error)
+
+	// Subtasks, see subtask.go. Deleting a task deletes its subtasks too.
+	GetAncestorIDs(id uint) ([]uint, error)
+	GetSubtasks(id uint) ([]utils.Task, error)
+	// SetParent returns utils.ErrProjectMismatch when the parent is in another project
+	SetParent(id uint, parentID *uint, maxDepth int, authorID *uint) (*utils.Task, error)
+	GetOpenDescendants(id uint) ([]utils.Task, error)
+	// RestoreTask returns utils.ErrRestoreExpired for tasks deleted before deletedAfter
+	RestoreTask(id uint, deletedAfter time.Time, authorID *uint) (*utils.Task, error)
+	GetTaskProgress(ids []uint) (map[uint]utils.TaskProgress, error)
+
+	// Dependencies, see dependency.go. Deleted and closed blockers don't block anymore.
+	GetBlockers(id uint) ([]utils.Task, error)
+	GetDependents(id uint) ([]utils.Task, error)
+	GetOpenBlockerIDs(id uint) ([]uint, error)
+	AddDependency(id uint, blockedByID uint) error
+	RemoveDependency(id uint, blockedByID uint) error
+	// GetOpenTaskGraph returns the open tasks assigned to the user and the open blockers of each of them
+	GetOpenTaskGraph(userID uint) ([]utils.Task, map[uint][]uint, error)
+
+	// SetProject moves a top level task with its subtasks to another project, see project.go
+	SetProject(id uint, projectID uint, authorID *uint) (*utils.Task, error)
+
+	// Assignee and watchers, see assignee.go
+	SetAssignee(id uint, assigneeID *uint, authorID *uint) (*utils.Task, error)
+	GetWatchers(taskID uint) ([]utils.TaskWatcher, error)
+	AddWatcher(taskID uint, userID uint) error
+	RemoveWatcher(taskID uint, userID uint) error
+
+	// Recurring tasks, see recurrence.go. An empty recurrence stops it.
+	SetRecurrence(id uint, recurrence string, timezone string, scheduledAt *time.Time, authorID *uint) (*utils.Task, error)
+	HasNextOccurrence(id uint) (bool, error)
+	// CopyOccurrenceDetails gives the next occurrence the labels and the checklist of the previous one
+	CopyOccurrenceDetails(fromID uint, toID uint) error
+
+	// Bulk writes, see bulk.go. Transaction runs fn with a repository bound to one transaction,
+	// Webhooks writes the event deliveries in it.
+	Transaction(fn func(tx TaskRepositoryInterface) error) error
+	Webhooks() WebhookRepositoryInterface
+	CreateTasks(tasks []*utils.Task) error
+
+	// Export and import, see transfer.go. StreamTasks calls fn for each task without loading all of them.
+	StreamTasks(filter utils.TaskFilter, fn func(task *utils.Task) error) error
+	GetTaskIDsByExternalID(externalIDs map[uint][]string) (map[uint]map[string]uint, error)
+	// GetTaskListStats counts the tasks of filter and finds their last change, see calendar.go
+	GetTaskListStats(filter utils.TaskFilter) (*utils.TaskListStats, error)
+
+	// SearchTasks is the full text search over title and description, see search.go
+	SearchTasks(filter utils.TaskFilter, q string, offset int, limit int) ([]utils.TaskSearchResult, int64, error)
+
+	// GetOldFinishedTasks skips the tasks that still have open subtasks
 	GetOldFinishedTasks() ([]utils.Task, error)
+	CountTasksByUser(userID uint) (*utils.TaskCounts, error)
+
+	// GetDueReminders returns the unsent reminders of open tasks whose time has passed, with their task
+	GetDueReminders(now time.Time) ([]utils.TaskReminder, error)
+	// ClaimReminder marks the reminder as sent, false when another instance got it first
+	ClaimReminder(id uint) (bool, error)
+	// ReleaseReminder undoes a claim so the reminder is retried
+	ReleaseReminder(id uint) error
 }
 
 // Secondary adapter
 type TaskGormRepo struct {
 	db *gorm.DB
+	// tasks are loaded with the labels of this user, see ForViewer
+	viewerID uint
 }
 
 // Initiate secondary adapter
@@ -29,7 +104,26 @@ func NewTaskGormRepo(db *gorm.DB) TaskRepositoryInterface {
 	return &TaskGormRepo{db: db}
 }
 
-func (r *TaskGormRepo) GetTasks() ([]utils.Task, error) {
+// ForViewer returns the repository that loads tasks with the labels of userID. Labels are private to their owner,
+// the repository of NewTaskGormRepo loads none.
+func (r *TaskGormRepo) ForViewer(userID uint) TaskRepositoryInterface {
+	return &TaskGormRepo{db: r.db, viewerID: userID}
+}
+
+// viewerLabels is the condition of Preload("Labels")
+func (r *TaskGormRepo) viewerLabels(db *gorm.DB) *gorm.DB {
+	return db.Where("user_id = ?", r.viewerID)
+}
+
+// MigrateTaskStatus gives the completed tasks from before statuses the done status, it runs after AutoMigrate
+// added the column. Completed always follows the status afterwards so running it again changes nothing.
+func MigrateTaskStatus(db *gorm.DB) error {
+	return db.Model(&utils.Task{}).Unscoped().
+		Where("completed AND status <> ?", utils.StatusDone).
+		UpdateColumn("status", utils.StatusDone).Error
+}
+
+func (r *TaskGormRepo) GetTasks(filter utils.TaskFilter) ([]utils.Task, error) {
 	/*ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -57,7 +151,12 @@ func (r *TaskGormRepo) GetTasks() ([]utils.Task, error) {
 
 	var tasks []utils.Task
 
-	result := r.db.Find(&tasks)
+	query := r.filterTasks(r.db, filter)
+	if order := taskOrder(filter.Sort); order != "" {
+		query = query.Order(order)
+	}
+	// one query for the labels of the whole page, not one per task
+	result := query.Order("id").Preload("Labels", r.viewerLabels).Find(&tasks)
 
 	if result.Error != nil {
 		log.Println(result.Error)
@@ -67,6 +166,58 @@ func (r *TaskGormRepo) GetTasks() ([]utils.Task, error) {
 	return tasks, nil
 }
 
+// filterTasks adds the conditions of filter to query, Sort is left to the caller
+func (r *TaskGormRepo) filterTasks(query *gorm.DB, filter utils.TaskFilter) *gorm.DB {
+	if filter.MemberID != 0 {
+		query = query.Where("project_id IN (SELECT project_id FROM project_members WHERE user_id = ?)", filter.MemberID)
+	}
+	if filter.ProjectID != nil {
+		query = query.Where("project_id = ?", *filter.ProjectID)
+	}
+	if filter.AssigneeID != nil {
+		query = query.Where("assignee_id = ?", *filter.AssigneeID)
+	} else if filter.Unassigned {
+		query = query.Where("assignee_id IS NULL")
+	}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if filter.TopLevel {
+		query = query.Where("parent_id IS NULL")
+	} else if filter.ParentID != nil {
+		query = query.Where("parent_id = ?", *filter.ParentID)
+	}
+	if len(filter.Priorities) > 0 {
+		query = query.Where("priority IN ?", filter.Priorities)
+	}
+	if filter.Completed != nil {
+		query = query.Where("completed = ?", *filter.Completed)
+	}
+	if filter.DueBefore != nil {
+		query = query.Where("due_at < ?", *filter.DueBefore)
+	}
+	if filter.DueAfter != nil {
+		query = query.Where("due_at >= ?", *filter.DueAfter)
+	}
+	if filter.HasDue {
+		query = query.Where("due_at IS NOT NULL")
+	}
+	if filter.Overdue {
+		query = query.Where("status NOT IN ? AND due_at < ?", utils.ClosedStatuses, time.Now())
+	}
+	if len(filter.Labels) > 0 {
+		labeled := r.db.Table("task_labels").Select("task_labels.task_id").
+			Joins("JOIN labels ON labels.id = task_labels.label_id").
+			Where("labels.user_id = ? AND labels.name IN ?", filter.LabelOwnerID, filter.Labels)
+		if filter.LabelMatchAll {
+			labeled = labeled.Group("task_labels.task_id").Having("COUNT(DISTINCT labels.name) = ?", len(filter.Labels))
+		}
+		query = query.Where("id IN (?)", labeled)
+	}
+
+	return query
+}
+
 func (r *TaskGormRepo) CreateTask(task *utils.Task) (*utils.Task, error) {
 	/*ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -87,11 +238,29 @@ func (r *TaskGormRepo) CreateTask(task *utils.Task) (*utils.Task, error) {
 		return nil, err
 	}*/
 
-	result := r.db.Create(task)
+	task.Version = 1
+	task.Labels = []utils.Label{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(task).Error; err != nil {
+			return err
+		}
+
+		if err := syncTaskReminders(tx, task); err != nil {
+			return err
+		}
+		if task.ParentID != nil {
+			if err := touchTask(tx, *task.ParentID); err != nil {
+				return err
+			}
+		}
+
+		author := uint(task.UserID)
+		return addTaskRevision(tx, task.ID, utils.RevisionCreate, &author, task.Fields(), utils.Snapshot(task.Fields()))
+	})
 
-	if result.Error != nil {
-		log.Println(result.Error)
-		return nil, result.Error
+	if err != nil {
+		log.Println(err)
+		return nil, err
 	}
 
 	return task, nil
@@ -121,9 +290,11 @@ func (r *TaskGormRepo) GetTaskById(id int) (*utils.Task, error) {
 
 	var task utils.Task
 
-	result := r.db.First(&task, id)
+	result := r.db.Preload("Labels", r.viewerLabels).First(&task, id)
 
-	if result.Error != nil {
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
 		log.Println(result.Error)
 		return nil, result.Error
 	}
@@ -131,7 +302,7 @@ func (r *TaskGormRepo) GetTaskById(id int) (*utils.Task, error) {
 	return &task, nil
 }
 
-func (r *TaskGormRepo) UpdateTask(id int, task *utils.Task) (*utils.Task, error) {
+func (r *TaskGormRepo) UpdateTask(id int, task *utils.Task, authorID *uint) (*utils.Task, error) {
 	/*ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -155,21 +326,81 @@ func (r *TaskGormRepo) UpdateTask(id int, task *utils.Task) (*utils.Task, error)
 
 	return &updatedTask, nil*/
 
-	task.ID = uint(id)
-	// Update columns that are in the object -> createdAt GONE
-	// result := postgres.db.Save(task)
-	// Update multiple columns
-	result := r.db.Model(&task).Updates(task)
+	return r.updateTask(id, task, nil, utils.RevisionUpdate, authorID)
+}
 
-	if result.Error != nil {
-		log.Println(result.Error)
-		return nil, result.Error
+// UpdateTaskFields writes every field of TaskFields, zero values and nil included. version works like task.Version of UpdateTask.
+func (r *TaskGormRepo) UpdateTaskFields(id int, fields utils.TaskFields, version int, authorID *uint) (*utils.Task, error) {
+	task := &utils.Task{Version: version}
+	task.ApplyFields(fields)
+	return r.updateTask(id, task, utils.TaskFieldColumns, utils.RevisionUpdate, authorID)
+}
+
+// updateTask writes the non zero fields of task, or the columns when they are given, and records the revision with action
+func (r *TaskGormRepo) updateTask(id int, task *utils.Task, columns []string, action string, authorID *uint) (*utils.Task, error) {
+	updatedTask := new(utils.Task)
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// lock the row so concurrent updates get consecutive revisions
+		before := new(utils.Task)
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(before, id).Error; err != nil {
+			return err
+		}
+		if task.Version != 0 && task.Version != before.Version {
+			return utils.ErrVersionMismatch
+		}
+
+		task.ID = uint(id)
+		task.Version = before.Version + 1
+		// Update columns that are in the object -> createdAt GONE
+		// result := postgres.db.Save(task)
+		// Update multiple columns (non zero fields only)
+		query := tx.Model(before).Omit(clause.Associations)
+		if columns != nil {
+			query = query.Select("version", columns)
+		}
+		if err := query.Updates(task).Error; err != nil {
+			return err
+		}
+		// Updates skips false, completed follows the status
+		if task.Status != "" && columns == nil {
+			if err := tx.Model(before).Update("completed", task.Status == utils.StatusDone).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Preload("Labels", r.viewerLabels).First(updatedTask, id).Error; err != nil {
+			return err
+		}
+
+		if remindersChanged(before, updatedTask) {
+			if err := syncTaskReminders(tx, updatedTask); err != nil {
+				return err
+			}
+		}
+		// the progress of the parent counts done subtasks
+		if updatedTask.ParentID != nil && before.Status != updatedTask.Status {
+			if err := touchTask(tx, *updatedTask.ParentID); err != nil {
+				return err
+			}
+		}
+
+		return addTaskRevision(tx, updatedTask.ID, action, authorID, updatedTask.Fields(), utils.Diff(before.Fields(), updatedTask.Fields()))
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrVersionMismatch {
+			log.Println(err)
+		}
+		return nil, err
 	}
 
-	return task, nil
+	return updatedTask, nil
 }
 
-func (r *TaskGormRepo) DeleteTask(id int) error {
+func (r *TaskGormRepo) DeleteTask(id int, version int, authorID *uint) error {
 	/*ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -185,16 +416,61 @@ func (r *TaskGormRepo) DeleteTask(id int) error {
 
 	return nil*/
 
-	var task utils.Task
-
-	// Soft Delete: just set delete_at to current timestamp (has this ability if the struct has gorm.Model attribute)
-	result := r.db.Delete(&task, id)
-	// Hard Delete: delete permanently
-	// db.Unscoped().Delete(&task) : Unscoped() is used for finding soft deleted records
-
-	if result.Error != nil {
-		log.Println(result.Error)
-		return result.Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var task utils.Task
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&task, id).Error; err != nil {
+			return err
+		}
+		if version != 0 && version != task.Version {
+			return utils.ErrVersionMismatch
+		}
+
+		// lists the subtasks before the task is gone
+		below, err := descendants(tx, task.ID, nil)
+		if err != nil {
+			return err
+		}
+
+		// Soft Delete: just set delete_at to current timestamp (has this ability if the struct has gorm.Model attribute)
+		if err := tx.Delete(&task).Error; err != nil {
+			return err
+		}
+		// Hard Delete: delete permanently
+		// db.Unscoped().Delete(&task) : Unscoped() is used for finding soft deleted records
+
+		if err := addTaskRevision(tx, task.ID, utils.RevisionDelete, authorID, task.Fields(), nil); err != nil {
+			return err
+		}
+
+		// subtasks get the same deleted_at, RestoreTask uses it to find them
+		for _, d := range below {
+			var child utils.Task
+			if err := tx.First(&child, d.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&child).UpdateColumn("deleted_at", task.DeletedAt).Error; err != nil {
+				return err
+			}
+			if err := addTaskRevision(tx, child.ID, utils.RevisionDelete, authorID, child.Fields(), nil); err != nil {
+				return err
+			}
+		}
+
+		if task.ParentID != nil {
+			if err := touchTask(tx, *task.ParentID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return utils.ErrNotFound
+	} else if err != nil {
+		if err != utils.ErrVersionMismatch {
+			log.Println(err)
+		}
+		return err
 	}
 
 	return nil
@@ -230,7 +506,16 @@ func (r *TaskGormRepo) GetOldFinishedTasks() ([]utils.Task, error) {
 	var tasks []utils.Task
 
 	weekAgo := time.Now().AddDate(0, 0, -7)
-	result := r.db.Where("completed = ? AND created_at < ?", true, weekAgo).Find(&tasks)
+	result := r.db.Where("completed = ? AND created_at < ?", true, weekAgo).
+		Where(`NOT EXISTS (
+	WITH RECURSIVE down (id, status, depth) AS (
+		SELECT c.id, c.status, 1 FROM tasks c WHERE c.parent_id = tasks.id AND c.deleted_at IS NULL
+		UNION ALL
+		SELECT t.id, t.status, down.depth + 1 FROM tasks t JOIN down ON t.parent_id = down.id WHERE t.deleted_at IS NULL AND down.depth < ?
+	)
+	SELECT 1 FROM down WHERE status NOT IN ?
+)`, hierarchyGuard, utils.ClosedStatuses).
+		Find(&tasks)
 
 	if result.Error != nil {
 		log.Println(result.Error)
@@ -239,3 +524,178 @@ func (r *TaskGormRepo) GetOldFinishedTasks() ([]utils.Task, error) {
 
 	return tasks, nil
 }
+
+func (r *TaskGormRepo) CountTasksByUser(userID uint) (*utils.TaskCounts, error) {
+	counts := new(utils.TaskCounts)
+
+	result := r.db.Model(&utils.Task{}).
+		Select("COUNT(*) AS total, COUNT(*) FILTER (WHERE completed) AS completed").
+		Where("user_id = ?", userID).
+		Scan(counts)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	counts.Open = counts.Total - counts.Completed
+	return counts, nil
+}
+
+// addTaskRevision appends the next revision of the task inside the transaction of the mutation
+func addTaskRevision(tx *gorm.DB, taskID uint, action string, authorID *uint, fields utils.TaskFields, changes utils.JSONB) error {
+	var last int
+	if err := tx.Model(&utils.TaskRevision{}).Where("task_id = ?", taskID).Select("COALESCE(MAX(revision), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&utils.TaskRevision{
+		TaskID:   taskID,
+		Revision: last + 1,
+		Action:   action,
+		AuthorID: authorID,
+		Snapshot: utils.Snapshot(fields),
+		Changes:  changes,
+	}).Error
+}
+
+func (r *TaskGormRepo) GetTaskRevisions(taskID int) ([]utils.TaskRevision, error) {
+	var revisions []utils.TaskRevision
+
+	result := r.db.Where("task_id = ?", taskID).Order("revision").Find(&revisions)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return revisions, nil
+}
+
+// GetRevisionFields returns the snapshot of the revision, utils.ErrRevisionNotFound when the task has no such revision
+func (r *TaskGormRepo) GetRevisionFields(taskID int, revision int) (*utils.TaskFields, error) {
+	var target utils.TaskRevision
+	result := r.db.Where("task_id = ? AND revision = ?", taskID, revision).First(&target)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrRevisionNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	fields := new(utils.TaskFields)
+	if err := json.Unmarshal(target.Snapshot, fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// RevertTask writes the fields of a revision like UpdateTaskFields, the change is recorded as a revert
+func (r *TaskGormRepo) RevertTask(taskID int, fields utils.TaskFields, version int, authorID *uint) (*utils.Task, error) {
+	task := &utils.Task{Version: version}
+	task.ApplyFields(fields)
+	return r.updateTask(taskID, task, utils.TaskFieldColumns, utils.RevisionRevert, authorID)
+}
+
+// taskOrder turns a ?sort= value into an ORDER BY, tasks without due date come last
+func taskOrder(sort string) string {
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+
+	switch sort {
+	case "due_at":
+		return "due_at " + direction + " NULLS LAST"
+	case "priority":
+		return "CASE priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 WHEN 'urgent' THEN 4 END " + direction
+	case "title", "created_at":
+		return sort + " " + direction
+	default:
+		return ""
+	}
+}
+
+func remindersChanged(before, after *utils.Task) bool {
+	if (before.DueAt == nil) != (after.DueAt == nil) || (before.DueAt != nil && !before.DueAt.Equal(*after.DueAt)) {
+		return true
+	}
+	return !slices.Equal(before.ReminderOffsets, after.ReminderOffsets)
+}
+
+// syncTaskReminders replaces the unsent reminders of the task by the ones of its offsets.
+// Reminders whose time already passed are not created, sent ones are kept as a record.
+func syncTaskReminders(tx *gorm.DB, task *utils.Task) error {
+	if err := tx.Where("task_id = ? AND sent_at IS NULL", task.ID).Delete(&utils.TaskReminder{}).Error; err != nil {
+		return err
+	}
+	if task.DueAt == nil {
+		return nil
+	}
+
+	reminders := taskReminders(task, time.Now())
+	if len(reminders) == 0 {
+		return nil
+	}
+
+	return tx.Omit(clause.Associations).Create(&reminders).Error
+}
+
+// taskReminders are the reminders of the offsets of the task that are still to come
+func taskReminders(task *utils.Task, now time.Time) []utils.TaskReminder {
+	var reminders []utils.TaskReminder
+	if task.DueAt == nil {
+		return reminders
+	}
+	for _, offset := range task.ReminderOffsets {
+		remindAt := task.DueAt.Add(-time.Duration(offset) * time.Minute)
+		if remindAt.Before(now) {
+			continue
+		}
+		reminders = append(reminders, utils.TaskReminder{TaskID: task.ID, Offset: offset, RemindAt: remindAt})
+	}
+	return reminders
+}
+
+func (r *TaskGormRepo) GetDueReminders(now time.Time) ([]utils.TaskReminder, error) {
+	var reminders []utils.TaskReminder
+
+	result := r.db.
+		Joins("JOIN tasks ON tasks.id = task_reminders.task_id AND tasks.deleted_at IS NULL").
+		Where("tasks.status NOT IN ?", utils.ClosedStatuses).
+		Where("task_reminders.sent_at IS NULL AND task_reminders.remind_at <= ?", now).
+		Preload("Task").
+		Order("task_reminders.remind_at").
+		Find(&reminders)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return reminders, nil
+}
+
+func (r *TaskGormRepo) ClaimReminder(id uint) (bool, error) {
+	result := r.db.Model(&utils.TaskReminder{}).Where("id = ? AND sent_at IS NULL", id).Update("sent_at", time.Now())
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (r *TaskGormRepo) ReleaseReminder(id uint) error {
+	result := r.db.Model(&utils.TaskReminder{}).Where("id = ?", id).Update("sent_at", nil)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
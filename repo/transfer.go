@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"log"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+)
+
+// MigrateTaskExternalID makes external_id unique in a project, deleted tasks don't count so they can be imported again
+func MigrateTaskExternalID(db *gorm.DB) error {
+	return db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_tasks_project_external_id ON tasks (project_id, external_id)
+		WHERE external_id IS NOT NULL AND deleted_at IS NULL`).Error
+}
+
+// StreamTasks calls fn with every task matching filter in id order, one row at a time so a large export
+// isn't held in memory. Labels aren't loaded. It stops at the first error of fn.
+func (r *TaskGormRepo) StreamTasks(filter utils.TaskFilter, fn func(task *utils.Task) error) error {
+	rows, err := r.filterTasks(r.db.Model(&utils.Task{}), filter).Order("id").Rows()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		task := new(utils.Task)
+		if err := r.db.ScanRows(rows, task); err != nil {
+			log.Println(err)
+			return err
+		}
+		if err := fn(task); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetTaskIDsByExternalID takes the external ids by project and returns the ids of the tasks that have them,
+// by project and external id, in one query. Missing ones aren't in the map.
+func (r *TaskGormRepo) GetTaskIDsByExternalID(externalIDs map[uint][]string) (map[uint]map[string]uint, error) {
+	ids := map[uint]map[string]uint{}
+	var pairs [][]interface{}
+	for projectID, projectExternalIDs := range externalIDs {
+		for _, externalID := range projectExternalIDs {
+			pairs = append(pairs, []interface{}{projectID, externalID})
+		}
+	}
+	if len(pairs) == 0 {
+		return ids, nil
+	}
+
+	var tasks []utils.Task
+	result := r.db.Select("id", "project_id", "external_id").Where("(project_id, external_id) IN ?", pairs).Find(&tasks)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	for _, task := range tasks {
+		if ids[task.ProjectID] == nil {
+			ids[task.ProjectID] = map[string]uint{}
+		}
+		ids[task.ProjectID][*task.ExternalID] = task.ID
+	}
+	return ids, nil
+}
@@ -1,7 +1,11 @@
 package repo
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/Peeranut-Kit/go_backend_test/utils"
 	"gorm.io/gorm"
@@ -11,6 +15,19 @@ import (
 type UserRepositoryInterface interface {
 	CreateUser(user *utils.User) error
 	GetUserFromEmail(user *utils.User) (*utils.User, error)
+	GetUserByID(id uint) (*utils.User, error)
+	SetEmailVerified(id uint, verifiedAt time.Time) error
+	UpdatePassword(id uint, hashedPassword string) error
+	UpdateUser(user *utils.User) (*utils.User, error)
+	// ListUsers returns a page of users whose email or name contains search, and the total count
+	ListUsers(search string, offset int, limit int) ([]utils.User, int64, error)
+	// DeleteUser anonymizes and soft deletes the user, deletes their labels, memberships and personal project with its tasks.
+	// Tasks they made in shared projects stay, the shared projects they owned go to their oldest other member.
+	DeleteUser(id uint) error
+	// GetUserByCalendarToken finds the user of the calendar feed by the hash of its token
+	GetUserByCalendarToken(tokenHash string) (*utils.User, error)
+	// SetCalendarToken replaces the hash of the calendar token, nil turns the feed off
+	SetCalendarToken(id uint, tokenHash *string) error
 }
 
 // Secondary adapter
@@ -38,10 +55,173 @@ func (r *UserGormRepo) GetUserFromEmail(user *utils.User) (*utils.User, error) {
 	selectedUser := new(utils.User)
 	result := r.db.Where("email = ?", user.Email).First(selectedUser)
 
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return selectedUser, nil
+}
+
+func (r *UserGormRepo) GetUserByID(id uint) (*utils.User, error) {
+	selectedUser := new(utils.User)
+	result := r.db.First(selectedUser, id)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return selectedUser, nil
+}
+
+func (r *UserGormRepo) SetEmailVerified(id uint, verifiedAt time.Time) error {
+	result := r.db.Model(&utils.User{}).Where("id = ?", id).Update("email_verified_at", verifiedAt)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *UserGormRepo) UpdatePassword(id uint, hashedPassword string) error {
+	result := r.db.Model(&utils.User{}).Where("id = ?", id).Update("password", hashedPassword)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *UserGormRepo) UpdateUser(user *utils.User) (*utils.User, error) {
+	// Save writes every column, the caller passes a user read with GetUserByID
+	result := r.db.Save(user)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return user, nil
+}
+
+func (r *UserGormRepo) DeleteUser(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// anonymize first, the soft deleted row stays in the table and would keep the email taken
+		result := tx.Model(&utils.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"email":         fmt.Sprintf("deleted-%d@deleted.invalid", id),
+			"name":          "Deleted User",
+			"password":      "",
+			"pending_email": "",
+			"token_version": gorm.Expr("token_version + 1"),
+			// the calendar feed goes with the account
+			"calendar_token_hash": nil,
+		})
+		if result.Error != nil {
+			log.Println(result.Error)
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return utils.ErrNotFound
+		}
+
+		if err := deleteUserProjects(tx, id); err != nil {
+			log.Println(err)
+			return err
+		}
+
+		// label names are personal data too, they are removed from every task
+		if err := tx.Exec("DELETE FROM task_labels WHERE label_id IN (SELECT id FROM labels WHERE user_id = ?)", id).Error; err != nil {
+			log.Println(err)
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&utils.Label{}).Error; err != nil {
+			log.Println(err)
+			return err
+		}
+
+		// webhooks stop with the account, their delivery log holds task data of it
+		if err := deleteUserWebhooks(tx, id); err != nil {
+			log.Println(err)
+			return err
+		}
+
+		if err := tx.Delete(&utils.User{}, id).Error; err != nil {
+			log.Println(err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// likeEscaper makes % and _ of a search match themselves, backslash is the default LIKE escape of Postgres
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// ListUsers matches search anywhere in the email or name
+func (r *UserGormRepo) ListUsers(search string, offset int, limit int) ([]utils.User, int64, error) {
+	var users []utils.User
+	var total int64
+
+	query := r.db.Model(&utils.User{})
+	if search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(search)) + "%"
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(name) LIKE ?", pattern, pattern)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	result := query.Order("id").Offset(offset).Limit(limit).Find(&users)
+
 	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, 0, result.Error
+	}
+
+	return users, total, nil
+}
+
+func (r *UserGormRepo) GetUserByCalendarToken(tokenHash string) (*utils.User, error) {
+	selectedUser := new(utils.User)
+	result := r.db.Where("calendar_token_hash = ?", tokenHash).First(selectedUser)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
 		log.Println(result.Error)
 		return nil, result.Error
 	}
 
 	return selectedUser, nil
-}
\ No newline at end of file
+}
+
+func (r *UserGormRepo) SetCalendarToken(id uint, tokenHash *string) error {
+	result := r.db.Model(&utils.User{}).Where("id = ?", id).Update("calendar_token_hash", tokenHash)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+)
+
+// Secondary port
+type UserTokenRepositoryInterface interface {
+	CreateUserToken(token *utils.UserToken) error
+	// FindUserToken returns an unused, unexpired token without spending it, utils.ErrInvalidToken otherwise
+	FindUserToken(purpose string, tokenHash string) (*utils.UserToken, error)
+	// ConsumeUserToken marks an unused, unexpired token as used and returns it, utils.ErrInvalidToken otherwise
+	ConsumeUserToken(purpose string, tokenHash string) (*utils.UserToken, error)
+	// DeleteUserTokens removes every token of the user for the purpose, so only the latest email works
+	DeleteUserTokens(userID uint, purpose string) error
+}
+
+// Secondary adapter
+type UserTokenGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewUserTokenGormRepo(db *gorm.DB) UserTokenRepositoryInterface {
+	return &UserTokenGormRepo{db: db}
+}
+
+func (r *UserTokenGormRepo) CreateUserToken(token *utils.UserToken) error {
+	result := r.db.Create(token)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *UserTokenGormRepo) FindUserToken(purpose string, tokenHash string) (*utils.UserToken, error) {
+	token := new(utils.UserToken)
+	result := r.db.Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, tokenHash, time.Now()).First(token)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrInvalidToken
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return token, nil
+}
+
+func (r *UserTokenGormRepo) ConsumeUserToken(purpose string, tokenHash string) (*utils.UserToken, error) {
+	now := time.Now()
+
+	// the conditional update is atomic, two requests with the same token cannot both succeed
+	result := r.db.Model(&utils.UserToken{}).
+		Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, tokenHash, now).
+		Update("used_at", now)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, utils.ErrInvalidToken
+	}
+
+	token := new(utils.UserToken)
+	result = r.db.Where("token_hash = ?", tokenHash).First(token)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return token, nil
+}
+
+func (r *UserTokenGormRepo) DeleteUserTokens(userID uint, purpose string) error {
+	result := r.db.Where("user_id = ? AND purpose = ?", userID, purpose).Delete(&utils.UserToken{})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
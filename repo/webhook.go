@@ -0,0 +1,249 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Secondary port, the webhook methods are scoped to the webhooks of userID
+type WebhookRepositoryInterface interface {
+	GetWebhooks(userID uint) ([]utils.Webhook, error)
+	GetWebhook(userID uint, id uint) (*utils.Webhook, error)
+	CreateWebhook(webhook *utils.Webhook) error
+	UpdateWebhook(webhook *utils.Webhook) error
+	// DeleteWebhook deletes its deliveries too
+	DeleteWebhook(userID uint, id uint) error
+
+	// GetSubscribers are the active webhooks for event on a task of the project, their owners have to be members of it
+	GetSubscribers(projectID uint, event string) ([]utils.Webhook, error)
+	// CreateDeliveries fills the IDs of the deliveries
+	CreateDeliveries(deliveries []utils.WebhookDelivery) error
+	// GetDueDeliveries are the pending deliveries of active webhooks to send at now with their webhook, oldest first
+	GetDueDeliveries(now time.Time, limit int) ([]utils.WebhookDelivery, error)
+	// ClaimDelivery moves the next attempt of the delivery to until, false when another worker claimed it first
+	ClaimDelivery(delivery *utils.WebhookDelivery, until time.Time) (bool, error)
+	// SaveAttempt writes the outcome of an attempt of the delivery
+	SaveAttempt(delivery *utils.WebhookDelivery) error
+	GetDeliveries(filter utils.WebhookDeliveryFilter) ([]utils.WebhookDelivery, int64, error)
+	// DeleteDeliveriesBefore deletes the delivered and failed deliveries created before t, pending ones are kept
+	DeleteDeliveriesBefore(t time.Time) (int64, error)
+}
+
+// Secondary adapter
+type WebhookGormRepo struct {
+	db *gorm.DB
+}
+
+// Initiate secondary adapter
+func NewWebhookGormRepo(db *gorm.DB) WebhookRepositoryInterface {
+	return &WebhookGormRepo{db: db}
+}
+
+func (r *WebhookGormRepo) GetWebhooks(userID uint) ([]utils.Webhook, error) {
+	webhooks := []utils.Webhook{}
+
+	result := r.db.Where("user_id = ?", userID).Order("id").Find(&webhooks)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return webhooks, nil
+}
+
+func (r *WebhookGormRepo) GetWebhook(userID uint, id uint) (*utils.Webhook, error) {
+	webhook := new(utils.Webhook)
+
+	result := r.db.Where("user_id = ?", userID).First(webhook, id)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, utils.ErrNotFound
+	} else if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return webhook, nil
+}
+
+func (r *WebhookGormRepo) CreateWebhook(webhook *utils.Webhook) error {
+	result := r.db.Create(webhook)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *WebhookGormRepo) UpdateWebhook(webhook *utils.Webhook) error {
+	// Select writes the zero values too, e.g. active false or the project back to nil
+	result := r.db.Model(webhook).Select("project_id", "url", "events", "active").Updates(webhook)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *WebhookGormRepo) DeleteWebhook(userID uint, id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// the deliveries first, they reference the webhook
+		if err := tx.Where("webhook_id IN (?)", tx.Model(&utils.Webhook{}).Select("id").Where("id = ? AND user_id = ?", id, userID)).
+			Delete(&utils.WebhookDelivery{}).Error; err != nil {
+			log.Println(err)
+			return err
+		}
+
+		result := tx.Where("user_id = ?", userID).Delete(&utils.Webhook{}, id)
+		if result.Error != nil {
+			log.Println(result.Error)
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return utils.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// deleteUserWebhooks deletes the webhooks of the user and their deliveries, in the transaction deleting the user
+func deleteUserWebhooks(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("webhook_id IN (?)", tx.Model(&utils.Webhook{}).Select("id").Where("user_id = ?", userID)).
+		Delete(&utils.WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&utils.Webhook{}).Error
+}
+
+func (r *WebhookGormRepo) GetSubscribers(projectID uint, event string) ([]utils.Webhook, error) {
+	var webhooks []utils.Webhook
+
+	// events is a jsonb array, @> tells if it holds the event
+	events, _ := json.Marshal([]string{event})
+	result := r.db.
+		Joins("JOIN project_members ON project_members.user_id = webhooks.user_id AND project_members.project_id = ?", projectID).
+		Joins("JOIN users ON users.id = webhooks.user_id AND users.deleted_at IS NULL AND users.disabled_at IS NULL").
+		Where("webhooks.active AND (webhooks.project_id IS NULL OR webhooks.project_id = ?)", projectID).
+		Where("webhooks.events IS NULL OR webhooks.events @> ?::jsonb", string(events)).
+		Find(&webhooks)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return webhooks, nil
+}
+
+func (r *WebhookGormRepo) CreateDeliveries(deliveries []utils.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	result := r.db.Omit(clause.Associations).Create(&deliveries)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *WebhookGormRepo) GetDueDeliveries(now time.Time, limit int) ([]utils.WebhookDelivery, error) {
+	var deliveries []utils.WebhookDelivery
+
+	result := r.db.
+		Joins("JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id AND webhooks.active").
+		Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ?", utils.DeliveryPending, now).
+		Preload("Webhook").
+		Order("webhook_deliveries.next_attempt_at").
+		Limit(limit).
+		Find(&deliveries)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, result.Error
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDelivery only updates the row when nobody moved its next attempt since it was read
+func (r *WebhookGormRepo) ClaimDelivery(delivery *utils.WebhookDelivery, until time.Time) (bool, error) {
+	result := r.db.Model(&utils.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, utils.DeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", until)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		delivery.NextAttemptAt = until
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (r *WebhookGormRepo) SaveAttempt(delivery *utils.WebhookDelivery) error {
+	result := r.db.Model(delivery).
+		Select("status", "attempts", "next_attempt_at", "response_status", "response_body", "error", "duration_ms", "delivered_at").
+		Updates(delivery)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return result.Error
+	}
+
+	return nil
+}
+
+func (r *WebhookGormRepo) GetDeliveries(filter utils.WebhookDeliveryFilter) ([]utils.WebhookDelivery, int64, error) {
+	var deliveries []utils.WebhookDelivery
+	var total int64
+
+	query := r.db.Model(&utils.WebhookDelivery{}).Where("webhook_id = ?", filter.WebhookID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	result := query.Order("created_at DESC, id DESC").Offset(filter.Offset).Limit(filter.Limit).Find(&deliveries)
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return nil, 0, result.Error
+	}
+
+	return deliveries, total, nil
+}
+
+func (r *WebhookGormRepo) DeleteDeliveriesBefore(t time.Time) (int64, error) {
+	result := r.db.Where("created_at < ? AND status IN ?", t, []string{utils.DeliveryDelivered, utils.DeliveryFailed}).Delete(&utils.WebhookDelivery{})
+
+	if result.Error != nil {
+		log.Println(result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
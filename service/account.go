@@ -0,0 +1,292 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// AccountService issues and redeems the email verification and password reset tokens
+type AccountService struct {
+	userRepo  repo.UserRepositoryInterface
+	tokenRepo repo.UserTokenRepositoryInterface
+	mailer    Mailer
+	passwords *PasswordService
+	// BaseURL is put in front of the links in the emails, e.g. https://tasks.example.com
+	BaseURL string
+}
+
+func NewAccountService(userRepo repo.UserRepositoryInterface, tokenRepo repo.UserTokenRepositoryInterface, mailer Mailer, passwords *PasswordService) *AccountService {
+	return &AccountService{userRepo: userRepo, tokenRepo: tokenRepo, mailer: mailer, passwords: passwords, BaseURL: appBaseURL()}
+}
+
+// NewToken returns a random url safe token and the hash that is stored in the database
+func NewToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken replaces the previous tokens of the purpose with a new one and returns the plain token
+func (s *AccountService) issueToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	if err := s.tokenRepo.DeleteUserTokens(userID, purpose); err != nil {
+		return "", err
+	}
+
+	token, hash, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.tokenRepo.CreateUserToken(&utils.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// SendVerification emails a verification link to the user
+func (s *AccountService) SendVerification(user *utils.User) error {
+	token, err := s.issueToken(user.ID, utils.TokenPurposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to confirm your email:\n\n%s/verify-email?token=%s\n\nor send this token to POST /verify-email:\n\n%s\n\nThe token expires in %s.",
+			user.Name, s.BaseURL, url.QueryEscape(token), token, verifyEmailTTL),
+	})
+}
+
+// ResendVerification sends a new verification link if the email belongs to an unverified user.
+// Unknown and already verified emails are ignored so the caller can't tell them apart.
+func (s *AccountService) ResendVerification(email string) error {
+	user, err := s.userRepo.GetUserFromEmail(&utils.User{Email: email})
+	if err == utils.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.SendVerification(user)
+}
+
+// VerifyEmail redeems a token of the registration email or of an email change
+func (s *AccountService) VerifyEmail(token string) error {
+	userToken, err := s.tokenRepo.ConsumeUserToken(utils.TokenPurposeVerifyEmail, HashToken(token))
+	if err == utils.ErrInvalidToken {
+		return s.confirmEmailChange(token)
+	} else if err != nil {
+		return err
+	}
+
+	return s.userRepo.SetEmailVerified(userToken.UserID, time.Now())
+}
+
+// RequestEmailChange keeps the new address as pending and emails a verification link to it,
+// the email of the account only changes when the link is opened
+func (s *AccountService) RequestEmailChange(user *utils.User, email string) error {
+	if _, err := s.userRepo.GetUserFromEmail(&utils.User{Email: email}); err == nil {
+		return utils.ErrEmailTaken
+	} else if err != utils.ErrNotFound {
+		return err
+	}
+
+	user.PendingEmail = email
+	if _, err := s.userRepo.UpdateUser(user); err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(user.ID, utils.TokenPurposeChangeEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Email{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen this link to confirm this address for your account:\n\n%s/verify-email?token=%s\n\nor send this token to POST /verify-email:\n\n%s\n\nThe token expires in %s.",
+			user.Name, s.BaseURL, url.QueryEscape(token), token, verifyEmailTTL),
+	})
+}
+
+func (s *AccountService) confirmEmailChange(token string) error {
+	userToken, err := s.tokenRepo.ConsumeUserToken(utils.TokenPurposeChangeEmail, HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByID(userToken.UserID)
+	if err != nil {
+		return err
+	}
+	if user.PendingEmail == "" {
+		return utils.ErrInvalidToken
+	}
+	// someone may have registered the address since the change was requested
+	if _, err := s.userRepo.GetUserFromEmail(&utils.User{Email: user.PendingEmail}); err == nil {
+		return utils.ErrEmailTaken
+	} else if err != utils.ErrNotFound {
+		return err
+	}
+
+	now := time.Now()
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	user.EmailVerifiedAt = &now
+	_, err = s.userRepo.UpdateUser(user)
+	return err
+}
+
+// CheckPassword returns utils.ErrInvalidCredentials when password is not the one of the user
+func (s *AccountService) CheckPassword(user *utils.User, password string) error {
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return utils.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// ChangePassword replaces the password and bumps the token version, which revokes every JWT of the user.
+// The caller issues a new JWT for the current session.
+func (s *AccountService) ChangePassword(user *utils.User, currentPassword, newPassword string) error {
+	if err := s.CheckPassword(user, currentPassword); err != nil {
+		return err
+	}
+	if err := s.passwords.Validate(newPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hashedPassword
+	user.TokenVersion++
+	_, err = s.userRepo.UpdateUser(user)
+	return err
+}
+
+// DeleteAccount soft deletes the user and their tasks after checking the password
+func (s *AccountService) DeleteAccount(user *utils.User, password string) error {
+	if err := s.CheckPassword(user, password); err != nil {
+		return err
+	}
+	return s.userRepo.DeleteUser(user.ID)
+}
+
+// ForgotPassword emails a reset link if the email belongs to a user, unknown emails are ignored
+func (s *AccountService) ForgotPassword(email string) error {
+	user, err := s.userRepo.GetUserFromEmail(&utils.User{Email: email})
+	if err == utils.ErrNotFound {
+		log.Println("Password reset requested for unknown email")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return s.sendPasswordReset(user)
+}
+
+// ForcePasswordReset is used by admins: the current password stops working, every session is revoked
+// and the user gets a password reset email
+func (s *AccountService) ForcePasswordReset(user *utils.User) error {
+	// an empty hash never matches, CompareHashAndPassword fails on it
+	user.Password = ""
+	user.TokenVersion++
+	if _, err := s.userRepo.UpdateUser(user); err != nil {
+		return err
+	}
+
+	return s.sendPasswordReset(user)
+}
+
+func (s *AccountService) sendPasswordReset(user *utils.User) error {
+	token, err := s.issueToken(user.ID, utils.TokenPurposeResetPassword, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your password. Open this link to choose a new one:\n\n%s/password/reset?token=%s\n\nor send this token with your new password to POST /password/reset:\n\n%s\n\nThe token expires in %s. If it wasn't you, ignore this email.",
+			user.Name, s.BaseURL, url.QueryEscape(token), token, resetPasswordTTL),
+	})
+}
+
+// ResetPassword sets the new password and revokes every JWT of the user, it returns the user.
+// Receiving the email also proves the address, so the user is verified as well.
+// The token is only spent when the new password passes the policy.
+func (s *AccountService) ResetPassword(token string, password string) (*utils.User, error) {
+	userToken, err := s.tokenRepo.FindUserToken(utils.TokenPurposeResetPassword, HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetUserByID(userToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.passwords.Validate(password, user.Email, user.Name); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.tokenRepo.ConsumeUserToken(utils.TokenPurposeResetPassword, HashToken(token)); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// sessions of whoever knew the old password are revoked
+	user.Password = hashedPassword
+	user.TokenVersion++
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if _, err := s.userRepo.UpdateUser(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenRepo.DeleteUserTokens(userToken.UserID, utils.TokenPurposeResetPassword); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+const (
+	EventTaskAssigned   = "task.assigned"
+	EventTaskUnassigned = "task.unassigned"
+)
+
+// Assign sets the assignee of the task, nil unassigns it. The handler checks that the assignee is an editor of the project.
+// The new and the previous assignee and the watchers are notified, except the user making the change.
+func (s *TaskService) Assign(current *utils.Task, assigneeID *uint, authorID *uint) (*utils.Task, error) {
+	if sameUser(current.AssigneeID, assigneeID) {
+		return current, nil
+	}
+
+	updated, err := s.change(current, authorID, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.SetAssignee(current.ID, assigneeID, authorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.notifyAssignment(updated, current.AssigneeID, authorID)
+
+	return updated, nil
+}
+
+func (s *TaskService) GetWatchers(taskID uint) ([]utils.TaskWatcher, error) {
+	return s.repo.GetWatchers(taskID)
+}
+
+func (s *TaskService) Watch(taskID uint, userID uint) error {
+	return s.repo.AddWatcher(taskID, userID)
+}
+
+func (s *TaskService) Unwatch(taskID uint, userID uint) error {
+	return s.repo.RemoveWatcher(taskID, userID)
+}
+
+// notifyAssignment sends the notifications in the background, a slow webhook doesn't hold the request
+func (s *TaskService) notifyAssignment(task *utils.Task, previousID *uint, actorID *uint) {
+	now := time.Now()
+	data := map[string]interface{}{"assignee_id": task.AssigneeID, "previous_assignee_id": previousID}
+
+	var notifications []Notification
+	notified := map[uint]bool{}
+	if actorID != nil {
+		notified[*actorID] = true
+	}
+	add := func(userID uint, event string, message string) {
+		if notified[userID] {
+			return
+		}
+		notified[userID] = true
+		notifications = append(notifications, Notification{
+			Event: event, UserID: userID, TaskID: task.ID, Message: message, Data: data, CreatedAt: now,
+		})
+	}
+
+	if task.AssigneeID != nil {
+		add(*task.AssigneeID, EventTaskAssigned, fmt.Sprintf("%q was assigned to you", task.Title))
+	}
+	if previousID != nil {
+		add(*previousID, EventTaskUnassigned, fmt.Sprintf("%q is no longer assigned to you", task.Title))
+	}
+
+	watchers, err := s.repo.GetWatchers(task.ID)
+	if err != nil {
+		log.Printf("Error loading watchers of task %d: %v\n", task.ID, err)
+	}
+	message := fmt.Sprintf("%q was unassigned", task.Title)
+	if task.AssigneeID != nil {
+		message = fmt.Sprintf("%q was reassigned", task.Title)
+	}
+	for _, watcher := range watchers {
+		add(watcher.UserID, EventTaskAssigned, message)
+	}
+
+	if len(notifications) == 0 {
+		return
+	}
+	go func() {
+		for _, n := range notifications {
+			if err := s.notifier.Notify(n); err != nil {
+				log.Printf("Error notifying user %d about task %d: %v\n", n.UserID, n.TaskID, err)
+			}
+		}
+	}()
+}
+
+func sameUser(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
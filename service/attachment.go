@@ -0,0 +1,263 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// attachments removed per query by PurgeDeletedTasks
+const purgeBatchSize = 100
+
+type AttachmentConfig struct {
+	// largest file accepted, in bytes
+	MaxSize int64
+	// media types accepted, compared with the type sniffed from the content and not with the one sent by the client
+	Types []string
+	// how long a signed download link works
+	URLTTL time.Duration
+	// key of the download link signatures
+	Secret []byte
+}
+
+func DefaultAttachmentConfig() AttachmentConfig {
+	return AttachmentConfig{
+		MaxSize: 10 << 20,
+		Types: []string{
+			"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain", "application/zip",
+		},
+		URLTTL: 15 * time.Minute,
+	}
+}
+
+// AttachmentConfigFromEnv reads ATTACHMENT_MAX_SIZE (bytes), ATTACHMENT_TYPES (comma separated media types),
+// ATTACHMENT_URL_TTL and ATTACHMENT_URL_SECRET (JWT_SECRET when missing), missing values keep the default
+func AttachmentConfigFromEnv() AttachmentConfig {
+	config := DefaultAttachmentConfig()
+	envInt("ATTACHMENT_MAX_SIZE", &config.MaxSize)
+	if types := os.Getenv("ATTACHMENT_TYPES"); types != "" {
+		config.Types = nil
+		for _, t := range strings.Split(types, ",") {
+			config.Types = append(config.Types, strings.ToLower(strings.TrimSpace(t)))
+		}
+	}
+	envDuration("ATTACHMENT_URL_TTL", &config.URLTTL)
+	config.Secret = []byte(os.Getenv("ATTACHMENT_URL_SECRET"))
+	if len(config.Secret) == 0 {
+		config.Secret = []byte(os.Getenv("JWT_SECRET"))
+	}
+	return config
+}
+
+// AttachmentService keeps the attachment records and their blobs in step. The blob is written before
+// the record and removed after it, a failure in between leaves an unused blob rather than a broken record.
+type AttachmentService struct {
+	repo   repo.AttachmentRepositoryInterface
+	store  BlobStore
+	config AttachmentConfig
+	// BaseURL is put in front of the download links
+	BaseURL string
+	now     func() time.Time
+}
+
+func NewAttachmentService(repo repo.AttachmentRepositoryInterface, store BlobStore, config AttachmentConfig) *AttachmentService {
+	return &AttachmentService{repo: repo, store: store, config: config, BaseURL: appBaseURL(), now: time.Now}
+}
+
+func (s *AttachmentService) MaxSize() int64 {
+	return s.config.MaxSize
+}
+
+func (s *AttachmentService) GetAttachments(taskID uint) ([]utils.Attachment, error) {
+	attachments, err := s.repo.GetAttachments(taskID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range attachments {
+		s.sign(&attachments[i])
+	}
+	return attachments, nil
+}
+
+func (s *AttachmentService) GetAttachment(taskID uint, id uint) (*utils.Attachment, error) {
+	attachment, err := s.repo.GetAttachment(taskID, id)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(attachment)
+	return attachment, nil
+}
+
+// Upload sniffs the media type from the first 512 bytes, size is the one of the multipart part.
+// It returns utils.ErrAttachmentTooLarge or utils.ErrAttachmentType for files that are refused.
+func (s *AttachmentService) Upload(taskID uint, uploaderID uint, fileName string, size int64, content io.Reader) (*utils.Attachment, error) {
+	if size > s.config.MaxSize {
+		return nil, utils.ErrAttachmentTooLarge
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if !s.allowed(contentType) {
+		return nil, fmt.Errorf("%w (%s)", utils.ErrAttachmentType, contentType)
+	}
+
+	key, err := blobKey(taskID)
+	if err != nil {
+		return nil, err
+	}
+	// the part may be longer than announced, never store more than MaxSize
+	body := io.LimitReader(io.MultiReader(bytes.NewReader(head), content), s.config.MaxSize)
+	if err := s.store.Put(key, body, size, contentType); err != nil {
+		log.Println("Error storing blob:", err)
+		return nil, err
+	}
+
+	attachment := &utils.Attachment{
+		TaskID:      taskID,
+		UploaderID:  uploaderID,
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType,
+		Size:        size,
+		BlobKey:     key,
+	}
+	if err := s.repo.CreateAttachment(attachment); err != nil {
+		s.deleteBlob(key)
+		return nil, err
+	}
+	s.sign(attachment)
+
+	return attachment, nil
+}
+
+func (s *AttachmentService) DeleteAttachment(attachment *utils.Attachment) error {
+	if err := s.repo.DeleteAttachment(attachment.TaskID, attachment.ID); err != nil {
+		return err
+	}
+	s.deleteBlob(attachment.BlobKey)
+	return nil
+}
+
+// Open checks the signature of a download link and returns the attachment with its content.
+// Links that are expired, tampered with or of a deleted attachment all get utils.ErrNotFound.
+func (s *AttachmentService) Open(id uint, expires int64, signature string) (*utils.Attachment, io.ReadCloser, error) {
+	if s.now().Unix() > expires {
+		return nil, nil, utils.ErrNotFound
+	}
+	attachment, err := s.repo.GetAttachmentByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(attachment, expires))) {
+		return nil, nil, utils.ErrNotFound
+	}
+
+	content, err := s.store.Get(attachment.BlobKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+// PurgeDeletedTasks removes the attachments of the tasks deleted before deletedBefore, they can't be restored
+// anymore. It returns how many were removed.
+func (s *AttachmentService) PurgeDeletedTasks(deletedBefore time.Time) (int, error) {
+	purged := 0
+	for {
+		attachments, err := s.repo.GetPurgeableAttachments(deletedBefore, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(attachments) == 0 {
+			return purged, nil
+		}
+
+		ids := make([]uint, 0, len(attachments))
+		for _, attachment := range attachments {
+			ids = append(ids, attachment.ID)
+		}
+		if err := s.repo.DeleteAttachments(ids); err != nil {
+			return purged, err
+		}
+		for _, attachment := range attachments {
+			s.deleteBlob(attachment.BlobKey)
+		}
+		purged += len(attachments)
+	}
+}
+
+func (s *AttachmentService) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range s.config.Types {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *AttachmentService) sign(attachment *utils.Attachment) {
+	expires := s.now().Add(s.config.URLTTL).Unix()
+	attachment.DownloadURL = fmt.Sprintf("%s/attachments/%d/download?expires=%d&signature=%s",
+		s.BaseURL, attachment.ID, expires, s.signature(attachment, expires))
+}
+
+// signature covers the blob key too, a link never opens another file that reuses the id
+func (s *AttachmentService) signature(attachment *utils.Attachment, expires int64) string {
+	mac := hmac.New(sha256.New, s.config.Secret)
+	fmt.Fprintf(mac, "%d:%s:%d", attachment.ID, attachment.BlobKey, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AttachmentService) deleteBlob(key string) {
+	if err := s.store.Delete(key); err != nil {
+		log.Printf("Error deleting blob %s: %v\n", key, err)
+	}
+}
+
+func blobKey(taskID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tasks/%d/%s", taskID, hex.EncodeToString(b)), nil
+}
+
+// cleanFileName keeps the base name only, without path or control characters
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
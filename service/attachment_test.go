@@ -0,0 +1,139 @@
+package service
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// fakeAttachmentRepo keeps the attachments by id, the methods the tests don't need panic
+type fakeAttachmentRepo struct {
+	repo.AttachmentRepositoryInterface
+	attachments map[uint]*utils.Attachment
+}
+
+func (r *fakeAttachmentRepo) GetAttachment(taskID uint, id uint) (*utils.Attachment, error) {
+	attachment, ok := r.attachments[id]
+	if !ok || attachment.TaskID != taskID {
+		return nil, utils.ErrNotFound
+	}
+	copied := *attachment
+	return &copied, nil
+}
+
+func (r *fakeAttachmentRepo) GetAttachmentByID(id uint) (*utils.Attachment, error) {
+	attachment, ok := r.attachments[id]
+	if !ok {
+		return nil, utils.ErrNotFound
+	}
+	copied := *attachment
+	return &copied, nil
+}
+
+// downloadLink reads the id, expires and signature of a download URL like the handler does
+func downloadLink(t *testing.T, downloadURL string) (uint, int64, string) {
+	t.Helper()
+	link, err := url.Parse(downloadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := strconv.ParseUint(strings.Split(link.Path, "/")[2], 10, 64)
+	if err != nil {
+		t.Fatalf("no id in %s", downloadURL)
+	}
+	expires, err := strconv.ParseInt(link.Query().Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("no expires in %s", downloadURL)
+	}
+	return uint(id), expires, link.Query().Get("signature")
+}
+
+func TestAttachmentDownloadLink(t *testing.T) {
+	store, err := NewFSBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range map[string]string{"tasks/1/a": "first", "tasks/1/b": "second"} {
+		if err := store.Put(key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attachments := &fakeAttachmentRepo{attachments: map[uint]*utils.Attachment{
+		1: {ID: 1, TaskID: 1, BlobKey: "tasks/1/a"},
+		2: {ID: 2, TaskID: 1, BlobKey: "tasks/1/b"},
+	}}
+	config := DefaultAttachmentConfig()
+	config.Secret = []byte("secret")
+	now := newClock()
+	s := NewAttachmentService(attachments, store, config)
+	s.BaseURL = "https://tasks.example.com"
+	s.now = now.Now
+
+	attachment, err := s.GetAttachment(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(attachment.DownloadURL, "https://tasks.example.com/attachments/1/download?") {
+		t.Fatalf("DownloadURL = %s", attachment.DownloadURL)
+	}
+	id, expires, signature := downloadLink(t, attachment.DownloadURL)
+	if want := now.Now().Add(config.URLTTL).Unix(); expires != want {
+		t.Errorf("expires = %d, want %d", expires, want)
+	}
+
+	opened, content, err := s.Open(id, expires, signature)
+	if err != nil {
+		t.Fatalf("Open of a fresh link = %v", err)
+	}
+	body, _ := io.ReadAll(content)
+	content.Close()
+	if opened.ID != 1 || string(body) != "first" {
+		t.Errorf("Open = attachment %d with %q, want 1 with first", opened.ID, body)
+	}
+
+	tests := []struct {
+		name      string
+		id        uint
+		expires   int64
+		signature string
+		advance   time.Duration
+	}{
+		{"another attachment", 2, expires, signature, 0},
+		{"a later expiry", id, expires + 3600, signature, 0},
+		{"a changed signature", id, expires, strings.Repeat("0", len(signature)), 0},
+		{"no signature", id, expires, "", 0},
+		{"an expired link", id, expires, signature, config.URLTTL + time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now.Advance(tt.advance)
+			defer now.Advance(-tt.advance)
+			if _, content, err := s.Open(tt.id, tt.expires, tt.signature); err != utils.ErrNotFound {
+				if content != nil {
+					content.Close()
+				}
+				t.Errorf("Open = %v, want ErrNotFound", err)
+			}
+		})
+	}
+
+	// the last second of the link still works
+	now.Advance(config.URLTTL)
+	if _, content, err := s.Open(id, expires, signature); err != nil {
+		t.Errorf("Open at the expiry = %v", err)
+	} else {
+		content.Close()
+	}
+
+	// the blob key is signed too, a new attachment reusing the id doesn't open with the old link
+	attachments.attachments[1].BlobKey = "tasks/1/b"
+	if _, _, err := s.Open(id, expires, signature); err != utils.ErrNotFound {
+		t.Errorf("Open after the blob changed = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"log"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// Auditor writes every entry to all sinks. A failing sink is logged and doesn't fail the request.
+type Auditor struct {
+	sinks []repo.AuditSink
+}
+
+func NewAuditor(sinks ...repo.AuditSink) *Auditor {
+	return &Auditor{sinks: sinks}
+}
+
+func (a *Auditor) Record(entry *utils.AuditEntry) {
+	if a == nil {
+		return
+	}
+	for _, sink := range a.sinks {
+		// each sink gets its own copy, the gorm sink sets ID and CreatedAt
+		e := *entry
+		if err := sink.WriteAudit(&e); err != nil {
+			log.Printf("Error writing audit entry %s %s/%s: %v\n", entry.Action, entry.TargetType, entry.TargetID, err)
+		}
+	}
+}
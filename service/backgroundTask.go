@@ -4,22 +4,30 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
 )
 
-func BackgroundTask(r repo.TaskRepositoryInterface) {
+// BackgroundTask also purges the attachments of the tasks deleted longer than restoreWindow ago
+func BackgroundTask(r repo.TaskRepositoryInterface, attachments *AttachmentService, auditor *Auditor, events *EventDispatcher, restoreWindow time.Duration) {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
 	// Run a loop to handle each tick
 	for range ticker.C {
-		cleanupOldTasks(r)
+		cleanupOldTasks(r, auditor, events)
+		if purged, err := attachments.PurgeDeletedTasks(time.Now().Add(-restoreWindow)); err != nil {
+			log.Println("Error purging attachments of deleted tasks:", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d attachments of deleted tasks\n", purged)
+		}
 	}
 }
 
-func cleanupOldTasks(r repo.TaskRepositoryInterface) {
+func cleanupOldTasks(r repo.TaskRepositoryInterface, auditor *Auditor, events *EventDispatcher) {
 	// delete completed tasks older than 7 days
 	tasks, err := r.GetOldFinishedTasks()
 	if err != nil {
@@ -45,11 +53,27 @@ func cleanupOldTasks(r repo.TaskRepositoryInterface) {
 		}
 		logFile.Write(taskByte)
 
-		// delete the task from database
-		err = r.DeleteTask(int(task.ID))
-		if err != nil {
+		// delete the task from database, unless it was edited since it was listed, with its task.deleted event
+		err = r.Transaction(func(tx repo.TaskRepositoryInterface) error {
+			if err := tx.DeleteTask(int(task.ID), task.Version, nil); err != nil {
+				return err
+			}
+			return events.Record(tx.Webhooks(), &task, nil, nil)
+		})
+		if err == utils.ErrVersionMismatch || err == utils.ErrNotFound {
+			continue
+		} else if err != nil {
 			log.Println("Error deleting task:", err)
 			return
 		}
+
+		// no actor, the system purged it
+		auditor.Record(&utils.AuditEntry{
+			Action:     utils.AuditTaskPurge,
+			TargetType: "task",
+			TargetID:   strconv.FormatUint(uint64(task.ID), 10),
+			Changes:    utils.Snapshot(task),
+		})
+		events.Wake()
 	}
 }
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// BlobStore keeps the content of the attachments, keys are chosen by the attachment service.
+// Get returns utils.ErrNotFound for a missing blob, Delete of a missing blob is not an error.
+type BlobStore interface {
+	Put(key string, content io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// FSBlobStore keeps the blobs as files under Dir, for local development and single instance deployments
+type FSBlobStore struct {
+	Dir string
+}
+
+func NewFSBlobStore(dir string) (*FSBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FSBlobStore{Dir: dir}, nil
+}
+
+func (s *FSBlobStore) path(key string) (string, error) {
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.Dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return path, nil
+}
+
+// Put writes to a temporary file first, readers never see a half written blob
+func (s *FSBlobStore) Put(key string, content io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FSBlobStore) Get(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, utils.ErrNotFound
+	}
+	return file, err
+}
+
+func (s *FSBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// S3BlobStore keeps the blobs in a bucket of S3 or of a compatible server (MinIO, R2...).
+// Requests use path style URLs (Endpoint/Bucket/key) and are signed with AWS Signature Version 4.
+type S3BlobStore struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+func NewS3BlobStore(endpoint, region, bucket, accessKey, secretKey string) *S3BlobStore {
+	return &S3BlobStore{
+		Endpoint:  strings.TrimSuffix(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		now:       time.Now,
+	}
+}
+
+func (s *S3BlobStore) Put(key string, content io.Reader, size int64, contentType string) error {
+	req, err := s.request(http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.failed(resp)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(key string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, utils.ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s.failed(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3BlobStore) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.failed(resp)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) request(method string, key string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, s.Endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawPath = strings.TrimSuffix(req.URL.Path, "/") + s.canonicalURI(key)
+	req.URL.Path, err = url.PathUnescape(req.URL.RawPath)
+	return req, err
+}
+
+func (s *S3BlobStore) failed(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, body)
+}
+
+// canonicalURI escapes every segment of /bucket/key the way the signature expects
+func (s *S3BlobStore) canonicalURI(key string) string {
+	segments := strings.Split(s.Bucket+"/"+key, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// uriEncode escapes everything but the unreserved characters of RFC 3986, as the signature requires
+func uriEncode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// do signs the request with the headers it was given, the payload is not hashed (UNSIGNED-PAYLOAD) so uploads stream
+func (s *S3BlobStore) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, "UNSIGNED-PAYLOAD")
+	return s.client.Do(req)
+}
+
+// sign adds the Authorization header of AWS Signature Version 4, it covers the host and every header set so far
+func (s *S3BlobStore) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	names := []string{"host"}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewBlobStoreFromEnv picks the store with BLOB_STORE: fs (default, files under BLOB_DIR, default "uploads")
+// or s3 with S3_ENDPOINT, S3_REGION (default us-east-1), S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "s3":
+		endpoint, bucket := os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET")
+		if endpoint == "" || bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required with BLOB_STORE=s3")
+		}
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		return NewS3BlobStore(endpoint, region, bucket, os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY")), nil
+	case "", "fs":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewFSBlobStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q", os.Getenv("BLOB_STORE"))
+	}
+}
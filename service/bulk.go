@@ -0,0 +1,180 @@
+package service
+
+import (
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// BulkMaxOperationsFromEnv reads BULK_MAX_OPERATIONS, the most operations of one POST /tasks/bulk (default 100)
+func BulkMaxOperationsFromEnv() int {
+	max := int64(100)
+	envInt("BULK_MAX_OPERATIONS", &max)
+	if max < 1 {
+		max = 1
+	}
+	return int(max)
+}
+
+// BulkOutcome of one operation, Before is the task as it was before an update or delete
+type BulkOutcome struct {
+	Before *utils.Task
+	Task   *utils.Task
+	Err    error
+}
+
+// Bulk runs operations the handler already validated and authorized. Creates go first, in one batched
+// insert, then updates and deletes in their order. Atomic runs everything in one transaction and stops
+// at the first error, which is returned too. Otherwise every operation gets its own outcome.
+func (s *TaskService) Bulk(ops []utils.BulkOperation, atomic bool, authorID *uint) ([]BulkOutcome, error) {
+	outcomes := make([]BulkOutcome, len(ops))
+
+	if atomic {
+		err := s.transaction(func(tx *TaskService) error {
+			return tx.runBulk(ops, outcomes, true, authorID)
+		})
+		if err != nil {
+			// nothing was written, only the failed operation keeps its error
+			for i := range outcomes {
+				if outcomes[i].Err == nil {
+					outcomes[i] = BulkOutcome{}
+				}
+			}
+			return outcomes, err
+		}
+	} else {
+		s.runBulk(ops, outcomes, false, authorID)
+	}
+
+	// after the commit, nobody hears about a task that was rolled back
+	for i, op := range ops {
+		if op.Op == utils.BulkCreate && outcomes[i].Err == nil && outcomes[i].Task.AssigneeID != nil {
+			author := uint(outcomes[i].Task.UserID)
+			s.notifyAssignment(outcomes[i].Task, nil, &author)
+		}
+	}
+
+	return outcomes, nil
+}
+
+// runBulk fills outcomes, with stop it returns the first error
+func (s *TaskService) runBulk(ops []utils.BulkOperation, outcomes []BulkOutcome, stop bool, authorID *uint) error {
+	var newTasks []*utils.Task
+	for _, op := range ops {
+		if op.Op == utils.BulkCreate {
+			newTasks = append(newTasks, op.Task)
+		}
+	}
+	taken, err := s.takenExternalIDs(newTasks)
+	if err != nil {
+		for i, op := range ops {
+			if op.Op == utils.BulkCreate {
+				outcomes[i].Err = err
+			}
+		}
+		if stop {
+			return err
+		}
+	}
+
+	var creates []int
+	for i, op := range ops {
+		if op.Op != utils.BulkCreate || outcomes[i].Err != nil {
+			continue
+		}
+		if err := s.prepareNewTask(op.Task, taken); err != nil {
+			outcomes[i].Err = err
+			if stop {
+				return err
+			}
+			continue
+		}
+		creates = append(creates, i)
+	}
+	if err := s.createBatch(ops, creates, outcomes, stop); err != nil {
+		return err
+	}
+
+	for i, op := range ops {
+		if op.Op == utils.BulkCreate {
+			continue
+		}
+		outcomes[i] = s.runBulkOperation(op, authorID)
+		if stop && outcomes[i].Err != nil {
+			return outcomes[i].Err
+		}
+	}
+	return nil
+}
+
+// createBatch inserts the tasks of ops[indexes] together with their events. When the batch fails outside
+// a transaction the tasks are inserted one by one, so only the ones at fault fail.
+func (s *TaskService) createBatch(ops []utils.BulkOperation, indexes []int, outcomes []BulkOutcome, stop bool) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	tasks := make([]*utils.Task, len(indexes))
+	for n, i := range indexes {
+		tasks[n] = ops[i].Task
+	}
+
+	err := s.transaction(func(tx *TaskService) error {
+		if err := tx.repo.CreateTasks(tasks); err != nil {
+			return err
+		}
+		if err := tx.withProgress(tasks...); err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			author := uint(task.UserID)
+			if err := tx.recordEvent(nil, task, &author); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		for _, i := range indexes {
+			outcomes[i].Task = ops[i].Task
+		}
+		return nil
+	}
+	if stop {
+		for _, i := range indexes {
+			outcomes[i].Err = err
+		}
+		return err
+	}
+
+	for _, i := range indexes {
+		ops[i].Task.ID = 0
+		var created *utils.Task
+		err := s.transaction(func(tx *TaskService) error {
+			var err error
+			if created, err = tx.withProgressOne(tx.repo.CreateTask(ops[i].Task)); err != nil {
+				return err
+			}
+			author := uint(created.UserID)
+			return tx.recordEvent(nil, created, &author)
+		})
+		if err != nil {
+			created = nil
+		}
+		outcomes[i] = BulkOutcome{Task: created, Err: err}
+	}
+	return nil
+}
+
+func (s *TaskService) runBulkOperation(op utils.BulkOperation, authorID *uint) BulkOutcome {
+	current, err := s.repo.GetTaskById(int(op.ID))
+	if err != nil {
+		return BulkOutcome{Err: err}
+	}
+
+	switch op.Op {
+	case utils.BulkUpdate:
+		op.Task.Version = op.Version
+		updated, err := s.UpdateTask(current, op.Task, authorID, op.Force)
+		return BulkOutcome{Before: current, Task: updated, Err: err}
+	default:
+		return BulkOutcome{Before: current, Err: s.DeleteTask(current, op.Version, authorID)}
+	}
+}
@@ -0,0 +1,8 @@
+package service
+
+import "github.com/Peeranut-Kit/go_backend_test/utils"
+
+// GetTaskListStats tells if the tasks of filter changed, for the ETag of the calendar feed
+func (s *TaskService) GetTaskListStats(filter utils.TaskFilter) (*utils.TaskListStats, error) {
+	return s.repo.GetTaskListStats(filter)
+}
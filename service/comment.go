@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+const EventCommentMention = "comment.mention"
+
+// CommentService writes the comments of tasks and notifies the members mentioned in them.
+// The handler checks that the user can see the task, mentions of users outside its project are ignored.
+type CommentService struct {
+	repo     repo.CommentRepositoryInterface
+	projects repo.ProjectRepositoryInterface
+	notifier Notifier
+}
+
+func NewCommentService(repo repo.CommentRepositoryInterface, projects repo.ProjectRepositoryInterface, notifier Notifier) *CommentService {
+	return &CommentService{repo: repo, projects: projects, notifier: notifier}
+}
+
+func (s *CommentService) GetComments(taskID uint, offset int, limit int) ([]utils.Comment, int64, error) {
+	return s.repo.GetComments(taskID, offset, limit)
+}
+
+func (s *CommentService) GetComment(taskID uint, id uint) (*utils.Comment, error) {
+	return s.repo.GetComment(taskID, id)
+}
+
+func (s *CommentService) CreateComment(task *utils.Task, authorID uint, body string) (*utils.Comment, error) {
+	comment := &utils.Comment{TaskID: task.ID, AuthorID: authorID, Body: body}
+	if err := s.repo.CreateComment(comment); err != nil {
+		return nil, err
+	}
+	s.notifyMentions(task, comment, nil)
+
+	return comment, nil
+}
+
+// UpdateComment only notifies the users mentioned for the first time
+func (s *CommentService) UpdateComment(task *utils.Task, comment *utils.Comment, body string) (*utils.Comment, error) {
+	before := utils.Mentions(comment.Body)
+
+	comment.Body = body
+	if err := s.repo.UpdateComment(comment); err != nil {
+		return nil, err
+	}
+	s.notifyMentions(task, comment, before)
+
+	return comment, nil
+}
+
+func (s *CommentService) DeleteComment(taskID uint, id uint) error {
+	return s.repo.DeleteComment(taskID, id)
+}
+
+// notifyMentions sends the notifications in the background, skipping the author and the emails in already
+func (s *CommentService) notifyMentions(task *utils.Task, comment *utils.Comment, already []string) {
+	emails := utils.Mentions(comment.Body)
+	if len(emails) == 0 {
+		return
+	}
+	skip := map[string]bool{}
+	for _, email := range already {
+		skip[email] = true
+	}
+
+	members, err := s.projects.GetMembers(task.ProjectID)
+	if err != nil {
+		log.Printf("Error loading members of project %d: %v\n", task.ProjectID, err)
+		return
+	}
+	byEmail := map[string]uint{}
+	for _, member := range members {
+		byEmail[strings.ToLower(member.Email)] = member.UserID
+	}
+
+	now := time.Now()
+	var notifications []Notification
+	for _, email := range emails {
+		userID, ok := byEmail[email]
+		if !ok || skip[email] || userID == comment.AuthorID {
+			continue
+		}
+		notifications = append(notifications, Notification{
+			Event:     EventCommentMention,
+			UserID:    userID,
+			TaskID:    task.ID,
+			Message:   fmt.Sprintf("%s mentioned you on %q", comment.AuthorName, task.Title),
+			Data:      map[string]interface{}{"comment_id": comment.ID, "body": comment.Body},
+			CreatedAt: now,
+		})
+	}
+
+	if len(notifications) == 0 {
+		return
+	}
+	go func() {
+		for _, n := range notifications {
+			if err := s.notifier.Notify(n); err != nil {
+				log.Printf("Error notifying user %d about comment %d: %v\n", n.UserID, comment.ID, err)
+			}
+		}
+	}()
+}
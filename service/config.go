@@ -0,0 +1,48 @@
+package service
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// env helpers keep the default in target when the variable is missing or invalid
+
+func envInt(key string, target *int64) {
+	if value, exist := os.LookupEnv(key); exist {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			*target = i
+		} else {
+			log.Printf("Invalid %s: %v\n", key, err)
+		}
+	}
+}
+
+func envDuration(key string, target *time.Duration) {
+	if value, exist := os.LookupEnv(key); exist {
+		if d, err := time.ParseDuration(value); err == nil {
+			*target = d
+		} else {
+			log.Printf("Invalid %s: %v\n", key, err)
+		}
+	}
+}
+
+func envBool(key string, target *bool) {
+	if value, exist := os.LookupEnv(key); exist {
+		if b, err := strconv.ParseBool(value); err == nil {
+			*target = b
+		} else {
+			log.Printf("Invalid %s: %v\n", key, err)
+		}
+	}
+}
+
+// appBaseURL reads APP_BASE_URL, the links in emails start with it
+func appBaseURL() string {
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		return baseURL
+	}
+	return "http://localhost:" + os.Getenv("PORT")
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// GetBlockers lists the tasks the task waits on, closed ones included. utils.ErrNotFound when the task doesn't exist.
+func (s *TaskService) GetBlockers(id int) ([]utils.Task, error) {
+	if _, err := s.repo.GetTaskById(id); err != nil {
+		return nil, err
+	}
+	tasks, err := s.repo.GetBlockers(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	return s.withProgressList(tasks)
+}
+
+// GetDependents lists the tasks waiting on the task
+func (s *TaskService) GetDependents(id int) ([]utils.Task, error) {
+	if _, err := s.repo.GetTaskById(id); err != nil {
+		return nil, err
+	}
+	tasks, err := s.repo.GetDependents(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	return s.withProgressList(tasks)
+}
+
+// AddDependency returns the task with its new version
+func (s *TaskService) AddDependency(id int, blockedByID uint) (*utils.Task, error) {
+	if err := s.repo.AddDependency(uint(id), blockedByID); err != nil {
+		return nil, err
+	}
+	return s.GetTask(id)
+}
+
+func (s *TaskService) RemoveDependency(id int, blockedByID uint) (*utils.Task, error) {
+	if err := s.repo.RemoveDependency(uint(id), blockedByID); err != nil {
+		return nil, err
+	}
+	return s.GetTask(id)
+}
+
+// NextTasks orders the open tasks assigned to the user so that every task comes after the tasks of the user
+// blocking it, tasks that can be started at the same time go by priority, due date and id.
+// Tasks waiting on someone else's open task come last. readyOnly keeps the tasks without open blockers.
+func (s *TaskService) NextTasks(userID uint, readyOnly bool, limit int) ([]utils.Task, error) {
+	tasks, blockers, err := s.repo.GetOpenTaskGraph(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*utils.Task, len(tasks))
+	for i := range tasks {
+		byID[tasks[i].ID] = &tasks[i]
+	}
+
+	// Kahn's algorithm, a blocker outside the list never gets done here so it keeps its task waiting
+	waiting := make(map[uint]int, len(tasks))
+	unblocks := map[uint][]uint{}
+	for id, ids := range blockers {
+		waiting[id] = len(ids)
+		for _, blockerID := range ids {
+			unblocks[blockerID] = append(unblocks[blockerID], id)
+		}
+	}
+
+	var ready []*utils.Task
+	for i := range tasks {
+		if waiting[tasks[i].ID] == 0 {
+			ready = append(ready, &tasks[i])
+		}
+	}
+
+	ordered := make([]utils.Task, 0, len(tasks))
+	done := map[uint]bool{}
+	for len(ready) > 0 && (readyOnly || len(ordered) < limit) {
+		sort.Slice(ready, func(i, j int) bool { return workBefore(ready[i], ready[j]) })
+		next := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, *next)
+		done[next.ID] = true
+
+		if readyOnly {
+			continue
+		}
+		for _, id := range unblocks[next.ID] {
+			waiting[id]--
+			if waiting[id] == 0 && byID[id] != nil {
+				ready = append(ready, byID[id])
+			}
+		}
+	}
+
+	if !readyOnly {
+		var rest []*utils.Task
+		for i := range tasks {
+			if !done[tasks[i].ID] {
+				rest = append(rest, &tasks[i])
+			}
+		}
+		sort.Slice(rest, func(i, j int) bool { return workBefore(rest[i], rest[j]) })
+		for _, task := range rest {
+			ordered = append(ordered, *task)
+		}
+	}
+
+	if len(ordered) > limit {
+		ordered = ordered[:limit]
+	}
+	return s.withProgressList(ordered)
+}
+
+// workBefore is the order of tasks that are free to start: higher priority, then sooner due date (none last), then older
+func workBefore(a, b *utils.Task) bool {
+	pa, pb := priorityRank(a.Priority), priorityRank(b.Priority)
+	if pa != pb {
+		return pa > pb
+	}
+	if (a.DueAt == nil) != (b.DueAt == nil) {
+		return a.DueAt != nil
+	}
+	if a.DueAt != nil && !a.DueAt.Equal(*b.DueAt) {
+		return a.DueAt.Before(*b.DueAt)
+	}
+	return a.ID < b.ID
+}
+
+func priorityRank(priority string) int {
+	for i, p := range utils.Priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return 0
+}
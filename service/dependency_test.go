@@ -0,0 +1,112 @@
+package service
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+func TestNextTasks(t *testing.T) {
+	me, someoneElse := ptr(uint(1)), ptr(uint(2))
+	soon := time.Date(2026, 10, 2, 9, 0, 0, 0, time.UTC)
+	later := soon.Add(24 * time.Hour)
+	task := func(id uint, priority string, dueAt *time.Time, assignee *uint) utils.Task {
+		return utils.Task{Model: model(id), Status: utils.StatusTodo, Priority: priority, DueAt: dueAt, AssigneeID: assignee}
+	}
+
+	tests := []struct {
+		name      string
+		tasks     []utils.Task
+		blockers  map[uint][]uint
+		readyOnly bool
+		limit     int
+		want      []uint
+	}{
+		{"priority, then due date with none last, then id", []utils.Task{
+			task(1, utils.PriorityLow, &soon, me),
+			task(2, utils.PriorityHigh, &later, me),
+			task(3, utils.PriorityHigh, &soon, me),
+			task(4, utils.PriorityHigh, nil, me),
+			task(5, utils.PriorityUrgent, nil, me),
+			task(6, utils.PriorityHigh, nil, me),
+		}, nil, false, 10, []uint{5, 3, 2, 4, 6, 1}},
+		{"a blocker goes first whatever its priority", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityLow, nil, me),
+			task(3, utils.PriorityMedium, nil, me),
+		}, map[uint][]uint{1: {2}}, false, 10, []uint{3, 2, 1}},
+		{"chains are kept in order", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityHigh, nil, me),
+			task(3, utils.PriorityLow, nil, me),
+		}, map[uint][]uint{1: {2}, 2: {3}}, false, 10, []uint{3, 2, 1}},
+		{"a task waits on all its blockers", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityLow, nil, me),
+			task(3, utils.PriorityMedium, nil, me),
+			task(4, utils.PriorityLow, nil, me),
+		}, map[uint][]uint{1: {2, 3}}, false, 10, []uint{3, 2, 1, 4}},
+		{"waiting on someone else's task comes last", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityLow, nil, me),
+			task(3, utils.PriorityMedium, nil, me),
+			task(9, utils.PriorityLow, nil, someoneElse),
+		}, map[uint][]uint{1: {9}, 3: {1}}, false, 10, []uint{2, 1, 3}},
+		{"closed blockers don't count", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityLow, nil, me),
+			{Model: model(9), Status: utils.StatusDone, AssigneeID: someoneElse},
+		}, map[uint][]uint{1: {9}}, false, 10, []uint{1, 2}},
+		{"ready only keeps the tasks without open blockers", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityLow, nil, me),
+			task(3, utils.PriorityMedium, nil, me),
+			task(9, utils.PriorityLow, nil, someoneElse),
+		}, map[uint][]uint{1: {2}, 3: {9}}, true, 10, []uint{2}},
+		{"limit cuts the ordered list", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityLow, nil, me),
+			task(3, utils.PriorityMedium, nil, me),
+			task(4, utils.PriorityHigh, nil, me),
+		}, map[uint][]uint{1: {2}}, false, 2, []uint{4, 3}},
+		{"limit cuts the waiting tasks too", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityLow, nil, me),
+			task(9, utils.PriorityLow, nil, someoneElse),
+		}, map[uint][]uint{1: {9}, 2: {9}}, false, 1, []uint{1}},
+		{"limit with ready only", []utils.Task{
+			task(1, utils.PriorityUrgent, nil, me),
+			task(2, utils.PriorityLow, nil, me),
+			task(3, utils.PriorityMedium, nil, me),
+		}, nil, true, 2, []uint{1, 3}},
+		{"other users' tasks aren't listed", []utils.Task{
+			task(1, utils.PriorityLow, nil, me),
+			task(2, utils.PriorityUrgent, nil, someoneElse),
+			task(3, utils.PriorityUrgent, nil, nil),
+		}, nil, false, 10, []uint{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeTaskRepo(tt.tasks...)
+			r.blockers = tt.blockers
+			if r.blockers == nil {
+				r.blockers = map[uint][]uint{}
+			}
+			s := NewTaskService(r, DefaultWorkflow(), 3, nil, nil)
+
+			tasks, err := s.NextTasks(*me, tt.readyOnly, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint
+			for _, task := range tasks {
+				got = append(got, task.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("NextTasks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
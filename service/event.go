@@ -0,0 +1,86 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// EventDispatcher turns task changes into webhook events. Each one is written to the outbox as a delivery
+// per subscribed webhook, in the transaction of the change, and sent by the WebhookDeliveryJob.
+type EventDispatcher struct {
+	webhooks *WebhookService
+}
+
+func NewEventDispatcher(webhooks *WebhookService) *EventDispatcher {
+	return &EventDispatcher{webhooks: webhooks}
+}
+
+// Record writes the event of the change with webhooks, the repository of the transaction that makes the change,
+// so the deliveries commit or roll back with it: task.created when before is nil, task.deleted when after is nil,
+// task.completed when the task was closed as done and task.updated otherwise. Wake the delivery job after the commit.
+func (d *EventDispatcher) Record(webhooks repo.WebhookRepositoryInterface, before, after *utils.Task, actorID *uint) error {
+	if d == nil {
+		return nil
+	}
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		return d.dispatch(webhooks, utils.EventTaskCreated, after, nil, actorID)
+	case after == nil:
+		return d.dispatch(webhooks, utils.EventTaskDeleted, before, nil, actorID)
+	case after.Completed && !before.Completed:
+		return d.dispatch(webhooks, utils.EventTaskCompleted, after, utils.Diff(before, after), actorID)
+	default:
+		return d.dispatch(webhooks, utils.EventTaskUpdated, after, utils.Diff(before, after), actorID)
+	}
+}
+
+// Wake makes the delivery job send the recorded deliveries now
+func (d *EventDispatcher) Wake() {
+	if d != nil {
+		d.webhooks.Wake()
+	}
+}
+
+func (d *EventDispatcher) dispatch(webhooks repo.WebhookRepositoryInterface, event string, task *utils.Task, changes utils.JSONB, actorID *uint) error {
+	subscribers, err := webhooks.GetSubscribers(task.ProjectID, event)
+	if err != nil {
+		return fmt.Errorf("%s of task %d: %w", event, task.ID, err)
+	}
+	if len(subscribers) == 0 {
+		return nil
+	}
+
+	// labels are private to their owner, the subscriber may be someone else
+	shared := *task
+	shared.Labels = []utils.Label{}
+	task = &shared
+
+	eventID, err := newEventID()
+	if err != nil {
+		return fmt.Errorf("%s of task %d: %w", event, task.ID, err)
+	}
+	payload := utils.WebhookPayload{
+		ID:        eventID,
+		Event:     event,
+		CreatedAt: time.Now(),
+		ActorID:   actorID,
+		Data:      utils.WebhookData{Task: utils.Snapshot(task), Changes: changes},
+	}
+	deliveries := make([]utils.WebhookDelivery, 0, len(subscribers))
+	for _, webhook := range subscribers {
+		delivery, err := newDelivery(webhook.ID, payload)
+		if err != nil {
+			return fmt.Errorf("%s of task %d: %w", event, task.ID, err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	if err := webhooks.CreateDeliveries(deliveries); err != nil {
+		return fmt.Errorf("%s of task %d: %w", event, task.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+)
+
+// IdempotencyTTLFromEnv is how long the response of an Idempotency-Key is replayed, IDEMPOTENCY_TTL (default 24h)
+func IdempotencyTTLFromEnv() time.Duration {
+	ttl := 24 * time.Hour
+	envDuration("IDEMPOTENCY_TTL", &ttl)
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return ttl
+}
+
+// IdempotencyCleanupJob deletes the expired idempotency records every hour
+func IdempotencyCleanupJob(r repo.IdempotencyRepositoryInterface) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := r.DeleteExpired(time.Now())
+		if err != nil {
+			log.Println("Error deleting expired idempotency keys:", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("Deleted %d expired idempotency keys\n", deleted)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+type LoginGuardConfig struct {
+	// requests allowed per IP in IPWindow, counts every login request
+	IPLimit  int64
+	IPWindow time.Duration
+	// failures allowed per account (email) in AccountWindow before it is locked
+	MaxFailures   int64
+	AccountWindow time.Duration
+	// first lockout lasts LockoutBase, every following lockout doubles it up to LockoutMax
+	LockoutBase time.Duration
+	LockoutMax  time.Duration
+}
+
+func DefaultLoginGuardConfig() LoginGuardConfig {
+	return LoginGuardConfig{
+		IPLimit:       20,
+		IPWindow:      time.Minute,
+		MaxFailures:   5,
+		AccountWindow: 24 * time.Hour,
+		LockoutBase:   time.Minute,
+		LockoutMax:    time.Hour,
+	}
+}
+
+// LoginGuardConfigFromEnv reads LOGIN_IP_LIMIT, LOGIN_IP_WINDOW, LOGIN_MAX_FAILURES, LOGIN_ACCOUNT_WINDOW,
+// LOGIN_LOCKOUT_BASE and LOGIN_LOCKOUT_MAX (durations like "15m"), missing values keep the default
+func LoginGuardConfigFromEnv() LoginGuardConfig {
+	config := DefaultLoginGuardConfig()
+	envInt("LOGIN_IP_LIMIT", &config.IPLimit)
+	envDuration("LOGIN_IP_WINDOW", &config.IPWindow)
+	envInt("LOGIN_MAX_FAILURES", &config.MaxFailures)
+	envDuration("LOGIN_ACCOUNT_WINDOW", &config.AccountWindow)
+	envDuration("LOGIN_LOCKOUT_BASE", &config.LockoutBase)
+	envDuration("LOGIN_LOCKOUT_MAX", &config.LockoutMax)
+	return config
+}
+
+// LoginGuard rate limits login per IP and per account and locks accounts after repeated failures.
+// Accounts are keyed by the submitted email whether the user exists or not, so the responses don't tell them apart.
+type LoginGuard struct {
+	store    repo.RateLimitStoreInterface
+	attempts repo.LoginAttemptRepositoryInterface
+	config   LoginGuardConfig
+	now      func() time.Time
+}
+
+func NewLoginGuard(store repo.RateLimitStoreInterface, attempts repo.LoginAttemptRepositoryInterface, config LoginGuardConfig) *LoginGuard {
+	return &LoginGuard{store: store, attempts: attempts, config: config, now: time.Now}
+}
+
+func ipKey(ip string) string { return "login:ip:" + ip }
+
+func failKey(email string) string { return "login:fail:" + normalizeEmail(email) }
+
+func lockKey(email string) string { return "login:lock:" + normalizeEmail(email) }
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Allow counts the request against the IP limit and checks the account lock.
+// It returns utils.ErrTooManyRequests or utils.ErrAccountLocked with the time the client may retry.
+func (g *LoginGuard) Allow(ip, email string) (time.Time, error) {
+	count, err := g.store.Incr(ipKey(ip), g.config.IPWindow)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if count > g.config.IPLimit {
+		ttl, err := g.store.TTL(ipKey(ip))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return g.now().Add(ttl), utils.ErrTooManyRequests
+	}
+
+	ttl, err := g.store.TTL(lockKey(email))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ttl > 0 {
+		return g.now().Add(ttl), utils.ErrAccountLocked
+	}
+
+	return time.Time{}, nil
+}
+
+// Fail records a failed login and locks the account every MaxFailures failures.
+// It returns the recorded attempt, nil when it couldn't be written, and the unlock time when this failure caused a lockout.
+func (g *LoginGuard) Fail(ip, email, userAgent, reason string) (*utils.LoginAttempt, time.Time, error) {
+	attempt := g.record(ip, email, userAgent, false, reason)
+
+	failures, err := g.store.Incr(failKey(email), g.config.AccountWindow)
+	if err != nil {
+		return attempt, time.Time{}, err
+	}
+	if g.config.MaxFailures <= 0 || failures%g.config.MaxFailures != 0 {
+		return attempt, time.Time{}, nil
+	}
+
+	// 1st lockout = base, 2nd = 2 * base, 3rd = 4 * base ...
+	lockout := g.config.LockoutBase
+	for i := int64(1); i < failures/g.config.MaxFailures && lockout < g.config.LockoutMax; i++ {
+		lockout *= 2
+	}
+	if lockout > g.config.LockoutMax {
+		lockout = g.config.LockoutMax
+	}
+
+	if err := g.store.Set(lockKey(email), failures, lockout); err != nil {
+		return attempt, time.Time{}, err
+	}
+	log.Printf("Account %s locked for %s after %d failed logins\n", normalizeEmail(email), lockout, failures)
+
+	return attempt, g.now().Add(lockout), utils.ErrAccountLocked
+}
+
+// Success resets the failure counter of the account
+func (g *LoginGuard) Success(ip, email, userAgent string) error {
+	g.record(ip, email, userAgent, true, "")
+	return g.store.Del(failKey(email))
+}
+
+// Unlock removes the lock and failure counter of the account
+func (g *LoginGuard) Unlock(email string) error {
+	if err := g.store.Del(lockKey(email)); err != nil {
+		return err
+	}
+	return g.store.Del(failKey(email))
+}
+
+// record writes the audit record, a failing audit write must not block the login
+func (g *LoginGuard) record(ip, email, userAgent string, success bool, reason string) *utils.LoginAttempt {
+	if g.attempts == nil {
+		return nil
+	}
+	attempt := &utils.LoginAttempt{
+		Email:     normalizeEmail(email),
+		IP:        ip,
+		UserAgent: userAgent,
+		Success:   success,
+		Reason:    reason,
+	}
+	if err := g.attempts.CreateLoginAttempt(attempt); err != nil {
+		log.Println("Error recording login attempt:", err)
+		return nil
+	}
+	return attempt
+}
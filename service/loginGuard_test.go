@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// clock is the time of a test, the guard and its store read it
+type clock struct{ now time.Time }
+
+func newClock() *clock {
+	return &clock{now: time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLoginGuard(c *clock, config LoginGuardConfig) *LoginGuard {
+	g := NewLoginGuard(repo.NewMemoryRateLimitStoreWithClock(c.Now), nil, config)
+	g.now = c.Now
+	return g
+}
+
+func TestLoginGuardLockoutEscalates(t *testing.T) {
+	c := newClock()
+	g := newTestLoginGuard(c, LoginGuardConfig{IPLimit: 1000, IPWindow: time.Minute, MaxFailures: 3, AccountWindow: 24 * time.Hour, LockoutBase: time.Minute, LockoutMax: 5 * time.Minute})
+
+	// every MaxFailures failures lock the account twice as long as the last time, up to LockoutMax
+	for _, lockout := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		for i := 1; i <= 3; i++ {
+			_, unlockAt, err := g.Fail("198.51.100.1", "ann@example.com", "test", "bad password")
+			if i < 3 {
+				if err != nil || !unlockAt.IsZero() {
+					t.Fatalf("failure %d locked the account: %v %v", i, unlockAt, err)
+				}
+				continue
+			}
+			if !errors.Is(err, utils.ErrAccountLocked) || !unlockAt.Equal(c.now.Add(lockout)) {
+				t.Fatalf("failure %d: unlock at %v (%v), want %v", i, unlockAt, err, c.now.Add(lockout))
+			}
+		}
+
+		retryAt, err := g.Allow("198.51.100.1", "ann@example.com")
+		if !errors.Is(err, utils.ErrAccountLocked) || !retryAt.Equal(c.now.Add(lockout)) {
+			t.Fatalf("Allow while locked = %v (%v), want %v", retryAt, err, c.now.Add(lockout))
+		}
+		c.Advance(lockout - time.Second)
+		if _, err := g.Allow("198.51.100.1", "ann@example.com"); !errors.Is(err, utils.ErrAccountLocked) {
+			t.Fatalf("Allow a second before the unlock = %v, want locked", err)
+		}
+		c.Advance(time.Second)
+		if _, err := g.Allow("198.51.100.1", "ann@example.com"); err != nil {
+			t.Fatalf("Allow at the unlock time = %v, want nil", err)
+		}
+	}
+}
+
+func TestLoginGuardCounters(t *testing.T) {
+	config := LoginGuardConfig{IPLimit: 3, IPWindow: time.Minute, MaxFailures: 3, AccountWindow: time.Hour, LockoutBase: time.Minute, LockoutMax: time.Hour}
+	type step struct {
+		ip, email string
+		fail      bool // records a failure instead of a success
+	}
+	tests := []struct {
+		name    string
+		steps   []step
+		advance time.Duration // before the last Allow
+		ip      string
+		email   string
+		want    error
+	}{
+		{"the account counter spans IPs", []step{
+			{"198.51.100.1", "ann@example.com", true}, {"198.51.100.2", "ann@example.com", true}, {"198.51.100.3", "ann@example.com", true},
+		}, 0, "198.51.100.4", "ann@example.com", utils.ErrAccountLocked},
+		{"the email is normalized", []step{
+			{"198.51.100.1", "Ann@Example.com", true}, {"198.51.100.2", " ann@example.com", true}, {"198.51.100.3", "ANN@EXAMPLE.COM ", true},
+		}, 0, "198.51.100.4", "ann@example.com", utils.ErrAccountLocked},
+		{"other accounts aren't locked", []step{
+			{"198.51.100.1", "ann@example.com", true}, {"198.51.100.2", "ann@example.com", true}, {"198.51.100.3", "ann@example.com", true},
+		}, 0, "198.51.100.4", "bob@example.com", nil},
+		{"a success resets the failures", []step{
+			{"198.51.100.1", "ann@example.com", true}, {"198.51.100.2", "ann@example.com", true}, {"198.51.100.3", "ann@example.com", false},
+			{"198.51.100.4", "ann@example.com", true}, {"198.51.100.5", "ann@example.com", true},
+		}, 0, "198.51.100.6", "ann@example.com", nil},
+		{"failures expire with the account window", []step{
+			{"198.51.100.1", "ann@example.com", true}, {"198.51.100.2", "ann@example.com", true},
+		}, time.Hour, "198.51.100.3", "ann@example.com", nil},
+		{"the IP limit counts every request", []step{
+			{"198.51.100.1", "ann@example.com", false}, {"198.51.100.1", "bob@example.com", false}, {"198.51.100.1", "carl@example.com", false},
+		}, 0, "198.51.100.1", "dora@example.com", utils.ErrTooManyRequests},
+		{"other IPs aren't limited", []step{
+			{"198.51.100.1", "ann@example.com", false}, {"198.51.100.1", "bob@example.com", false}, {"198.51.100.1", "carl@example.com", false},
+		}, 0, "198.51.100.2", "dora@example.com", nil},
+		{"the IP limit resets after its window", []step{
+			{"198.51.100.1", "ann@example.com", false}, {"198.51.100.1", "bob@example.com", false}, {"198.51.100.1", "carl@example.com", false},
+		}, time.Minute, "198.51.100.1", "dora@example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClock()
+			g := newTestLoginGuard(c, config)
+			for _, s := range tt.steps {
+				if _, err := g.Allow(s.ip, s.email); err != nil {
+					t.Fatalf("Allow(%s, %s) = %v", s.ip, s.email, err)
+				}
+				if s.fail {
+					g.Fail(s.ip, s.email, "test", "bad password")
+				} else if err := g.Success(s.ip, s.email, "test"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c.Advance(tt.advance)
+
+			retryAt, err := g.Allow(tt.ip, tt.email)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Allow(%s, %s) = %v, want %v", tt.ip, tt.email, err, tt.want)
+			}
+			if tt.want == utils.ErrTooManyRequests && !retryAt.Equal(c.now.Add(config.IPWindow)) {
+				t.Errorf("retry at %v, want the end of the IP window %v", retryAt, c.now.Add(config.IPWindow))
+			}
+		})
+	}
+}
+
+func TestLoginGuardUnlock(t *testing.T) {
+	c := newClock()
+	g := newTestLoginGuard(c, LoginGuardConfig{IPLimit: 100, IPWindow: time.Minute, MaxFailures: 2, AccountWindow: time.Hour, LockoutBase: time.Hour, LockoutMax: time.Hour})
+	g.Fail("198.51.100.1", "ann@example.com", "test", "bad password")
+	g.Fail("198.51.100.1", "ann@example.com", "test", "bad password")
+	if _, err := g.Allow("198.51.100.1", "ann@example.com"); !errors.Is(err, utils.ErrAccountLocked) {
+		t.Fatalf("Allow = %v, want locked", err)
+	}
+
+	if err := g.Unlock("ANN@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Allow("198.51.100.1", "ann@example.com"); err != nil {
+		t.Fatalf("Allow after Unlock = %v, want nil", err)
+	}
+	// the failures were reset too, one more doesn't lock again
+	if _, _, err := g.Fail("198.51.100.1", "ann@example.com", "test", "bad password"); err != nil {
+		t.Errorf("first failure after Unlock = %v, want nil", err)
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const EventTaskReminder = "task.reminder"
+
+// Notification is an event for a user, e.g. the reminder of a task
+type Notification struct {
+	Event     string      `json:"event"`
+	UserID    uint        `json:"user_id"`
+	TaskID    uint        `json:"task_id,omitempty"`
+	Message   string      `json:"message"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Notifier delivers notifications to users, or to whatever forwards them (chat, push)
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// LogNotifier only logs the notifications, used for local development
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(n Notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	log.Printf("Notification: %s\n", b)
+	return nil
+}
+
+// WebhookNotifier POSTs every notification as JSON to URL. When Secret is set the body is signed
+// with HMAC-SHA256 in the X-Signature header ("sha256=<hex>").
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url, secret string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Secret: secret, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", res.Status)
+	}
+	return nil
+}
+
+// NewNotifierFromEnv picks the notifier by NOTIFIER: "webhook" (NOTIFY_WEBHOOK_URL, NOTIFY_WEBHOOK_SECRET)
+// or "log" which is the default
+func NewNotifierFromEnv() (Notifier, error) {
+	switch os.Getenv("NOTIFIER") {
+	case "webhook":
+		url := os.Getenv("NOTIFY_WEBHOOK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL is required with NOTIFIER=webhook")
+		}
+		return NewWebhookNotifier(url, os.Getenv("NOTIFY_WEBHOOK_SECRET")), nil
+	case "", "log":
+		return LogNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown NOTIFIER %q", os.Getenv("NOTIFIER"))
+	}
+}
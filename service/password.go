@@ -0,0 +1,225 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt only looks at the first 72 bytes, longer passwords are rejected instead of silently truncated
+const bcryptMaxBytes = 72
+
+type PasswordPolicy struct {
+	MinLength     int64
+	MaxLength     int64 // in bytes, never more than 72
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:    8,
+		MaxLength:    bcryptMaxBytes,
+		RequireUpper: false,
+		RequireLower: true,
+		RequireDigit: true,
+	}
+}
+
+// PasswordPolicyFromEnv reads PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_REQUIRE_UPPER,
+// PASSWORD_REQUIRE_LOWER, PASSWORD_REQUIRE_DIGIT and PASSWORD_REQUIRE_SYMBOL
+func PasswordPolicyFromEnv() PasswordPolicy {
+	policy := DefaultPasswordPolicy()
+	envInt("PASSWORD_MIN_LENGTH", &policy.MinLength)
+	envInt("PASSWORD_MAX_LENGTH", &policy.MaxLength)
+	envBool("PASSWORD_REQUIRE_UPPER", &policy.RequireUpper)
+	envBool("PASSWORD_REQUIRE_LOWER", &policy.RequireLower)
+	envBool("PASSWORD_REQUIRE_DIGIT", &policy.RequireDigit)
+	envBool("PASSWORD_REQUIRE_SYMBOL", &policy.RequireSymbol)
+	if policy.MaxLength <= 0 || policy.MaxLength > bcryptMaxBytes {
+		policy.MaxLength = bcryptMaxBytes
+	}
+	return policy
+}
+
+// Check returns an error wrapping utils.ErrWeakPassword that tells which rule failed
+func (p PasswordPolicy) Check(password, email, name string) error {
+	if int64(len([]rune(password))) < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", utils.ErrWeakPassword, p.MinLength)
+	}
+	if int64(len(password)) > p.MaxLength {
+		return fmt.Errorf("%w: must be at most %d bytes", utils.ErrWeakPassword, p.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		return fmt.Errorf("%w: must contain an uppercase letter", utils.ErrWeakPassword)
+	}
+	if p.RequireLower && !lower {
+		return fmt.Errorf("%w: must contain a lowercase letter", utils.ErrWeakPassword)
+	}
+	if p.RequireDigit && !digit {
+		return fmt.Errorf("%w: must contain a digit", utils.ErrWeakPassword)
+	}
+	if p.RequireSymbol && !symbol {
+		return fmt.Errorf("%w: must contain a symbol", utils.ErrWeakPassword)
+	}
+
+	lowered := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if email != "" && (lowered == strings.ToLower(email) || lowered == localPart) {
+		return fmt.Errorf("%w: must not be your email", utils.ErrWeakPassword)
+	}
+	if name != "" && (lowered == strings.ToLower(name) || lowered == strings.ToLower(strings.ReplaceAll(name, " ", ""))) {
+		return fmt.Errorf("%w: must not be your name", utils.ErrWeakPassword)
+	}
+
+	return nil
+}
+
+// BreachedPasswordChecker works like the Have I Been Pwned range API: the caller only reveals
+// the first 5 hex characters of the SHA-1 and gets every breached suffix with that prefix
+type BreachedPasswordChecker interface {
+	Range(prefix string) ([]string, error)
+}
+
+// HashList is an offline BreachedPasswordChecker over a list of uppercase SHA-1 hashes,
+// one per line with an optional ":count" like the HIBP downloads
+type HashList struct {
+	ranges map[string][]string
+}
+
+//go:embed breached_passwords.txt
+var bundledBreachedPasswords []byte
+
+// NewBundledHashList loads the list shipped with the binary, BREACHED_PASSWORDS_FILE replaces it with a bigger one
+func NewBundledHashList() (*HashList, error) {
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return NewHashList(file)
+	}
+	return NewHashList(bytes.NewReader(bundledBreachedPasswords))
+}
+
+func NewHashList(r io.Reader) (*HashList, error) {
+	list := &HashList{ranges: map[string][]string{}}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+		hash = strings.ToUpper(hash)
+		list.ranges[hash[:5]] = append(list.ranges[hash[:5]], hash[5:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (l *HashList) Range(prefix string) ([]string, error) {
+	return l.ranges[strings.ToUpper(prefix)], nil
+}
+
+// PasswordService applies the policy and hashes passwords with the configured bcrypt cost
+type PasswordService struct {
+	Policy   PasswordPolicy
+	Breached BreachedPasswordChecker // nil disables the breached check
+	Cost     int
+}
+
+func NewPasswordService(policy PasswordPolicy, breached BreachedPasswordChecker, cost int) *PasswordService {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &PasswordService{Policy: policy, Breached: breached, Cost: cost}
+}
+
+// NewPasswordServiceFromEnv reads the policy, BCRYPT_COST and PASSWORD_CHECK_BREACHED (default true)
+func NewPasswordServiceFromEnv() (*PasswordService, error) {
+	cost := int64(bcrypt.DefaultCost)
+	envInt("BCRYPT_COST", &cost)
+
+	checkBreached := true
+	envBool("PASSWORD_CHECK_BREACHED", &checkBreached)
+
+	var breached BreachedPasswordChecker
+	if checkBreached {
+		list, err := NewBundledHashList()
+		if err != nil {
+			return nil, err
+		}
+		breached = list
+	}
+
+	return NewPasswordService(PasswordPolicyFromEnv(), breached, int(cost)), nil
+}
+
+// Validate checks the policy then the breached list, email and name are the ones of the account
+func (s *PasswordService) Validate(password, email, name string) error {
+	if err := s.Policy.Check(password, email, name); err != nil {
+		return err
+	}
+	if s.Breached == nil {
+		return nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := s.Breached.Range(hash[:5])
+	if err != nil {
+		return err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[5:] {
+			return utils.ErrBreachedPassword
+		}
+	}
+
+	return nil
+}
+
+func (s *PasswordService) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// NeedsRehash reports whether the hash was made with a lower cost than the configured one
+func (s *PasswordService) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err == nil && cost < s.Cost
+}
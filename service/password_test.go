@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: bcryptMaxBytes, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		userName string
+		wantRule string // in the error, empty when the password passes
+	}{
+		{"valid", "Tr0ub4dor&3", "ann@example.com", "Ann Lee", ""},
+		{"too short", "Ab1!xyz", "", "", "at least 8 characters"},
+		{"length counts characters, not bytes", "Äb1!ÿÿÿÿ", "", "", ""},
+		{"72 bytes", "Ab1!" + strings.Repeat("x", 68), "", "", ""},
+		// bcrypt would ignore everything after the 72nd byte
+		{"73 bytes", "Ab1!" + strings.Repeat("x", 69), "", "", "at most 72 bytes"},
+		{"multi-byte runes over 72 bytes", "Ab1!" + strings.Repeat("é", 35), "", "", "at most 72 bytes"},
+		{"no uppercase", "tr0ub4dor&3", "", "", "uppercase"},
+		{"no lowercase", "TR0UB4DOR&3", "", "", "lowercase"},
+		{"no digit", "Troubador&x", "", "", "digit"},
+		{"no symbol", "Tr0ub4dor33", "", "", "symbol"},
+		{"a space is a symbol", "Tr0ub4dor 3", "", "", ""},
+		{"the email", "Ann.Lee1@example.com", "ann.lee1@example.com", "", "email"},
+		{"the local part of the email", "Ann.Lee1!", "ann.lee1!@example.com", "", "email"},
+		{"the name", "Ann Lee 1!", "", "ann lee 1!", "name"},
+		{"the name without spaces", "AnnLee1!", "", "Ann Lee1!", "name"},
+		{"containing the name is allowed", "AnnLee1!-and-more", "", "Ann Lee1!", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, tt.email, tt.userName)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("Check() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, utils.ErrWeakPassword) || !strings.Contains(err.Error(), tt.wantRule) {
+				t.Fatalf("Check() = %v, want a weak password error about %q", err, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyFromEnvCapsMaxLength(t *testing.T) {
+	t.Setenv("PASSWORD_MAX_LENGTH", "100")
+	if got := PasswordPolicyFromEnv().MaxLength; got != bcryptMaxBytes {
+		t.Errorf("MaxLength = %d, want %d", got, bcryptMaxBytes)
+	}
+}
+
+func TestPasswordServiceValidateBreached(t *testing.T) {
+	list, err := NewBundledHashList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewPasswordService(PasswordPolicy{MinLength: 6, MaxLength: bcryptMaxBytes}, list, bcrypt.MinCost)
+
+	for password, want := range map[string]error{
+		"password":             utils.ErrBreachedPassword,
+		"qwerty123":            utils.ErrBreachedPassword,
+		"correct horse staple": nil,
+	} {
+		if err := s.Validate(password, "", ""); !errors.Is(err, want) {
+			t.Errorf("Validate(%q) = %v, want %v", password, err, want)
+		}
+	}
+
+	// without a list only the policy is checked
+	s.Breached = nil
+	if err := s.Validate("password", "", ""); err != nil {
+		t.Errorf("Validate without a list = %v, want nil", err)
+	}
+}
+
+func TestHashListRange(t *testing.T) {
+	list, err := NewHashList(strings.NewReader("5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8:3861493\nnot a hash\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := list.Range("5baa6"); len(got) != 1 || got[0] != "1E4C9B93F3F0682250B6CF8331B7EE68FD8" {
+		t.Errorf("Range(5baa6) = %v, want the uppercase suffix without the count", got)
+	}
+}
+
+func TestPasswordServiceNeedsRehash(t *testing.T) {
+	hash, err := NewPasswordService(DefaultPasswordPolicy(), nil, bcrypt.MinCost+1).Hash("Tr0ub4dor&3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cost, want := range map[int]bool{
+		bcrypt.MinCost:     false, // lowered, the stronger hash is kept
+		bcrypt.MinCost + 1: false,
+		bcrypt.MinCost + 2: true,
+	} {
+		if got := NewPasswordService(DefaultPasswordPolicy(), nil, cost).NeedsRehash(hash); got != want {
+			t.Errorf("NeedsRehash() with cost %d = %v, want %v", cost, got, want)
+		}
+	}
+	if NewPasswordService(DefaultPasswordPolicy(), nil, bcrypt.MinCost+2).NeedsRehash("not a bcrypt hash") {
+		t.Error("NeedsRehash of an invalid hash = true, want false")
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// ProjectService checks the roles of the project members and sends the invitations.
+// Users that are not members get utils.ErrNotFound so they can't tell which projects exist.
+type ProjectService struct {
+	repo   repo.ProjectRepositoryInterface
+	mailer Mailer
+	events *EventDispatcher
+	// BaseURL is put in front of the links in the emails
+	BaseURL string
+}
+
+func NewProjectService(repo repo.ProjectRepositoryInterface, mailer Mailer, events *EventDispatcher) *ProjectService {
+	return &ProjectService{repo: repo, mailer: mailer, events: events, BaseURL: appBaseURL()}
+}
+
+// Authorize returns the role of the user, utils.ErrForbidden when it is below need
+func (s *ProjectService) Authorize(projectID uint, userID uint, need string) (string, error) {
+	role, err := s.repo.GetRole(projectID, userID)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		return "", utils.ErrNotFound
+	}
+	if utils.ProjectRoleRank(role) < utils.ProjectRoleRank(need) {
+		return role, utils.ErrForbidden
+	}
+	return role, nil
+}
+
+// AuthorizeTask is Authorize on the project of the task, deleted tasks included
+func (s *ProjectService) AuthorizeTask(taskID uint, userID uint, need string) (string, error) {
+	projectID, err := s.repo.GetTaskProjectID(taskID)
+	if err != nil {
+		return "", err
+	}
+	return s.Authorize(projectID, userID, need)
+}
+
+// GetTaskProjectID returns utils.ErrNotFound for tasks that never existed
+func (s *ProjectService) GetTaskProjectID(taskID uint) (uint, error) {
+	return s.repo.GetTaskProjectID(taskID)
+}
+
+func (s *ProjectService) PersonalProject(userID uint) (*utils.Project, error) {
+	return s.repo.GetPersonalProject(userID)
+}
+
+// GetProjects lists the projects of the user, the personal project first
+func (s *ProjectService) GetProjects(userID uint) ([]utils.Project, error) {
+	// users registered after the migration get their personal project here
+	if _, err := s.repo.GetPersonalProject(userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetProjects(userID)
+}
+
+// GetProject needs the viewer role
+func (s *ProjectService) GetProject(id uint, userID uint) (*utils.Project, error) {
+	role, err := s.Authorize(id, userID, utils.ProjectRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	project, err := s.repo.GetProject(id)
+	if err != nil {
+		return nil, err
+	}
+	project.Role = role
+	return project, nil
+}
+
+func (s *ProjectService) CreateProject(project *utils.Project) error {
+	project.Personal = false
+	return s.repo.CreateProject(project)
+}
+
+func (s *ProjectService) UpdateProject(project *utils.Project) error {
+	return s.repo.UpdateProject(project)
+}
+
+// DeleteProject deletes the tasks of the project like DeleteTask, with a revision and a task.deleted event each.
+// The events are written before the members are removed, the webhooks of the members still subscribe to them.
+func (s *ProjectService) DeleteProject(project *utils.Project, authorID *uint) error {
+	if project.Personal {
+		return utils.ErrPersonalProject
+	}
+	err := s.repo.Transaction(func(tx repo.ProjectRepositoryInterface) error {
+		tasks, err := tx.DeleteProjectTasks(project.ID, authorID)
+		if err != nil {
+			return err
+		}
+		for i := range tasks {
+			if err := s.events.Record(tx.Webhooks(), &tasks[i], nil, authorID); err != nil {
+				return err
+			}
+		}
+		return tx.DeleteProject(project.ID)
+	})
+	if err != nil {
+		return err
+	}
+	s.events.Wake()
+	return nil
+}
+
+func (s *ProjectService) GetMembers(projectID uint) ([]utils.ProjectMember, error) {
+	return s.repo.GetMembers(projectID)
+}
+
+func (s *ProjectService) SetMemberRole(projectID uint, userID uint, role string) error {
+	return s.repo.SetMemberRole(projectID, userID, role)
+}
+
+func (s *ProjectService) RemoveMember(projectID uint, userID uint) error {
+	return s.repo.RemoveMember(projectID, userID)
+}
+
+// Invite sends an invitation email to email, personal projects can't be shared
+func (s *ProjectService) Invite(project *utils.Project, inviter *utils.User, email string, role string) (*utils.ProjectInvitation, error) {
+	if project.Personal {
+		return nil, utils.ErrPersonalProject
+	}
+
+	members, err := s.repo.GetMembers(project.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if strings.EqualFold(member.Email, email) {
+			return nil, utils.ErrAlreadyMember
+		}
+	}
+
+	invitation := &utils.ProjectInvitation{
+		ProjectID:   project.ID,
+		Email:       email,
+		Role:        role,
+		InvitedByID: inviter.ID,
+		ExpiresAt:   time.Now().Add(invitationTTL),
+	}
+	if err := s.repo.CreateInvitation(invitation); err != nil {
+		return nil, err
+	}
+
+	err = s.mailer.Send(Email{
+		To:      email,
+		Subject: fmt.Sprintf("%s invited you to %s", inviter.Name, project.Name),
+		Body: fmt.Sprintf("Hi,\n\n%s invited you to the project %q as %s. Log in with this email and answer the invitation:\n\n%s/invitations\n\nThe invitation expires in %s.",
+			inviter.Name, project.Name, role, s.BaseURL, invitationTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (s *ProjectService) GetInvitations(projectID uint) ([]utils.ProjectInvitation, error) {
+	return s.repo.GetInvitations(projectID, time.Now())
+}
+
+func (s *ProjectService) RevokeInvitation(projectID uint, id uint) error {
+	return s.repo.DeleteInvitation(projectID, id)
+}
+
+// MyInvitations lists the pending invitations sent to the email of the user, once it is verified
+func (s *ProjectService) MyInvitations(user *utils.User) ([]utils.ProjectInvitation, error) {
+	if user.EmailVerifiedAt == nil {
+		return nil, utils.ErrEmailUnverified
+	}
+	return s.repo.GetInvitationsForEmail(user.Email, time.Now())
+}
+
+// invitationFor returns utils.ErrNotFound when the invitation was sent to someone else
+func (s *ProjectService) invitationFor(id uint, user *utils.User) (*utils.ProjectInvitation, error) {
+	if user.EmailVerifiedAt == nil {
+		return nil, utils.ErrEmailUnverified
+	}
+	invitation, err := s.repo.GetInvitation(id)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return nil, utils.ErrNotFound
+	}
+	return invitation, nil
+}
+
+func (s *ProjectService) AcceptInvitation(id uint, user *utils.User) (*utils.ProjectInvitation, error) {
+	invitation, err := s.invitationFor(id, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.AcceptInvitation(id, user.ID, time.Now()); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (s *ProjectService) DeclineInvitation(id uint, user *utils.User) (*utils.ProjectInvitation, error) {
+	invitation, err := s.invitationFor(id, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeclineInvitation(id, time.Now()); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
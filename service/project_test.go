@@ -0,0 +1,98 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// fakeProjectRepo knows the roles of the members and the projects of the tasks, the methods the tests
+// don't need panic
+type fakeProjectRepo struct {
+	repo.ProjectRepositoryInterface
+	// roles by project then user
+	roles        map[uint]map[uint]string
+	taskProjects map[uint]uint
+}
+
+func (r *fakeProjectRepo) GetRole(projectID uint, userID uint) (string, error) {
+	return r.roles[projectID][userID], nil
+}
+
+func (r *fakeProjectRepo) GetTaskProjectID(taskID uint) (uint, error) {
+	projectID, ok := r.taskProjects[taskID]
+	if !ok {
+		return 0, utils.ErrNotFound
+	}
+	return projectID, nil
+}
+
+func (r *fakeProjectRepo) GetProject(id uint) (*utils.Project, error) {
+	if _, ok := r.roles[id]; !ok {
+		return nil, utils.ErrNotFound
+	}
+	return &utils.Project{ID: id, Name: "Launch"}, nil
+}
+
+const (
+	ownerID uint = iota + 1
+	editorID
+	viewerID
+	strangerID
+)
+
+func newTestProjectService() *ProjectService {
+	return NewProjectService(&fakeProjectRepo{
+		roles: map[uint]map[uint]string{
+			1: {ownerID: utils.ProjectRoleOwner, editorID: utils.ProjectRoleEditor, viewerID: utils.ProjectRoleViewer},
+		},
+		taskProjects: map[uint]uint{10: 1},
+	}, nil, nil)
+}
+
+func TestProjectAuthorize(t *testing.T) {
+	s := newTestProjectService()
+	tests := []struct {
+		name     string
+		user     uint
+		need     string
+		wantRole string
+		wantErr  error
+	}{
+		{"viewer reads", viewerID, utils.ProjectRoleViewer, utils.ProjectRoleViewer, nil},
+		{"viewer writes", viewerID, utils.ProjectRoleEditor, utils.ProjectRoleViewer, utils.ErrForbidden},
+		{"viewer manages", viewerID, utils.ProjectRoleOwner, utils.ProjectRoleViewer, utils.ErrForbidden},
+		{"editor writes", editorID, utils.ProjectRoleEditor, utils.ProjectRoleEditor, nil},
+		{"editor manages", editorID, utils.ProjectRoleOwner, utils.ProjectRoleEditor, utils.ErrForbidden},
+		{"owner manages", ownerID, utils.ProjectRoleOwner, utils.ProjectRoleOwner, nil},
+		// the project stays hidden from the users outside it
+		{"stranger reads", strangerID, utils.ProjectRoleViewer, "", utils.ErrNotFound},
+		{"stranger writes", strangerID, utils.ProjectRoleEditor, "", utils.ErrNotFound},
+	}
+	for _, tt := range tests {
+		role, err := s.Authorize(1, tt.user, tt.need)
+		if role != tt.wantRole || err != tt.wantErr {
+			t.Errorf("%s: Authorize = %q, %v, want %q, %v", tt.name, role, err, tt.wantRole, tt.wantErr)
+		}
+		role, err = s.AuthorizeTask(10, tt.user, tt.need)
+		if role != tt.wantRole || err != tt.wantErr {
+			t.Errorf("%s: AuthorizeTask = %q, %v, want %q, %v", tt.name, role, err, tt.wantRole, tt.wantErr)
+		}
+	}
+
+	if _, err := s.AuthorizeTask(11, ownerID, utils.ProjectRoleViewer); err != utils.ErrNotFound {
+		t.Errorf("AuthorizeTask of a missing task = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetProjectNeedsMembership(t *testing.T) {
+	s := newTestProjectService()
+	project, err := s.GetProject(1, viewerID)
+	if err != nil || project.Role != utils.ProjectRoleViewer {
+		t.Fatalf("GetProject by a viewer = %+v, %v", project, err)
+	}
+	if project, err := s.GetProject(1, strangerID); err != utils.ErrNotFound {
+		t.Errorf("GetProject by a stranger = %+v, %v, want ErrNotFound", project, err)
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// SetRecurrence makes the task recur, it is the first occurrence at its due date. The handler checked the rule.
+func (s *TaskService) SetRecurrence(current *utils.Task, recurrence string, timezone string, authorID *uint) (*utils.Task, error) {
+	if current.DueAt == nil {
+		return nil, utils.ErrRecurrenceNeedsDue
+	}
+	// a new rule of an occurrence goes on from the time the old rule scheduled it at
+	scheduledAt := current.ScheduledAt
+	if scheduledAt == nil {
+		scheduledAt = current.DueAt
+	}
+	return s.change(current, authorID, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.SetRecurrence(current.ID, recurrence, timezone, scheduledAt, authorID)
+	})
+}
+
+// StopRecurrence keeps closing the task from creating a next occurrence, the ones created already stay
+func (s *TaskService) StopRecurrence(current *utils.Task, authorID *uint) (*utils.Task, error) {
+	if current.Recurrence == "" {
+		return current, nil
+	}
+	return s.change(current, authorID, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.SetRecurrence(current.ID, "", "", current.ScheduledAt, authorID)
+	})
+}
+
+// nextOccurrence creates the occurrence after task, closed as done or skipped as cancelled. It is a copy
+// of the task due when the rule schedules it, counted from when the task was scheduled rather than from
+// its due date, so moving one occurrence doesn't move the others. It gets the labels and the unchecked
+// checklist of the task. Nothing is created when the task doesn't recur, the rule ended or the task has a
+// next occurrence already (e.g. it was reopened and closed again).
+func (s *TaskService) nextOccurrence(task *utils.Task) (*utils.Task, error) {
+	if task.Recurrence == "" {
+		return nil, nil
+	}
+	rule, loc, err := utils.ParseRecurrence(task.Recurrence, task.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Count != 0 && task.Occurrence >= rule.Count {
+		return nil, nil
+	}
+	anchor := task.ScheduledAt
+	if anchor == nil {
+		anchor = task.DueAt
+	}
+	if anchor == nil {
+		return nil, nil
+	}
+	at, ok := rule.Next(*anchor, loc)
+	if !ok {
+		return nil, nil
+	}
+	exists, err := s.repo.HasNextOccurrence(task.ID)
+	if err != nil || exists {
+		return nil, err
+	}
+
+	previousID := task.ID
+	next := &utils.Task{
+		Title:                task.Title,
+		Description:          task.Description,
+		Priority:             task.Priority,
+		ReminderOffsets:      task.ReminderOffsets,
+		UserID:               task.UserID,
+		AssigneeID:           task.AssigneeID,
+		ProjectID:            task.ProjectID,
+		ParentID:             task.ParentID,
+		DueAt:                &at,
+		Recurrence:           task.Recurrence,
+		Timezone:             task.Timezone,
+		ScheduledAt:          &at,
+		Occurrence:           task.Occurrence + 1,
+		PreviousOccurrenceID: &previousID,
+	}
+	if err := s.prepareNewTask(next, nil); err != nil {
+		return nil, err
+	}
+	created, err := s.repo.CreateTask(next)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CopyOccurrenceDetails(task.ID, created.ID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTaskById(int(created.ID))
+}
+
+// createNextOccurrence runs nextOccurrence for the closed task and records the event of the new occurrence.
+// update runs it in its transaction and notifies the assignee after the commit.
+func (s *TaskService) createNextOccurrence(task *utils.Task, authorID *uint) (*utils.Task, error) {
+	next, err := s.nextOccurrence(task)
+	if err != nil {
+		return nil, fmt.Errorf("next occurrence of task %d: %w", task.ID, err)
+	}
+	if next == nil {
+		return nil, nil
+	}
+	return next, s.recordEvent(nil, next, authorID)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+)
+
+// ReminderIntervalFromEnv is how often the reminder job looks for due reminders, REMINDER_INTERVAL (default 1m)
+func ReminderIntervalFromEnv() time.Duration {
+	interval := time.Minute
+	envDuration("REMINDER_INTERVAL", &interval)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return interval
+}
+
+func ReminderJob(r repo.TaskRepositoryInterface, notifier Notifier, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sendReminders(r, notifier, time.Now())
+	}
+}
+
+// sendReminders claims each due reminder before notifying so running several instances doesn't send it twice,
+// a failed notification releases the claim and is retried on the next tick
+func sendReminders(r repo.TaskRepositoryInterface, notifier Notifier, now time.Time) {
+	reminders, err := r.GetDueReminders(now)
+	if err != nil {
+		log.Println("Error fetching due reminders:", err)
+		return
+	}
+
+	for _, reminder := range reminders {
+		claimed, err := r.ClaimReminder(reminder.ID)
+		if err != nil || !claimed {
+			continue
+		}
+
+		task := reminder.Task
+		// the assignee is the one who has to finish it, the author otherwise
+		userID := uint(task.UserID)
+		if task.AssigneeID != nil {
+			userID = *task.AssigneeID
+		}
+		n := Notification{
+			Event:   EventTaskReminder,
+			UserID:  userID,
+			TaskID:  task.ID,
+			Message: fmt.Sprintf("%q is due %s", task.Title, task.DueAt.Format(time.RFC3339)),
+			Data: map[string]interface{}{
+				"due_at":    task.DueAt,
+				"priority":  task.Priority,
+				"remind_at": reminder.RemindAt,
+				"offset":    reminder.Offset,
+			},
+			CreatedAt: now,
+		}
+		if err := notifier.Notify(n); err != nil {
+			log.Printf("Error sending reminder %d of task %d: %v\n", reminder.ID, task.ID, err)
+			// released reminders are sent again on the next run, one that can't be released is lost
+			if err := r.ReleaseReminder(reminder.ID); err != nil {
+				log.Printf("Error releasing reminder %d of task %d, it won't be retried: %v\n", reminder.ID, task.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,537 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// TaskService holds the task rules that are not storage: the status workflow, the completed flag
+// derived from the status, subtask depth, cascades and progress. HttpTaskHandler goes through it instead of the repository.
+type TaskService struct {
+	repo     repo.TaskRepositoryInterface
+	workflow *Workflow
+	// levels of subtasks allowed under a top level task
+	maxDepth int
+	// tells assignees and watchers about assignments
+	notifier Notifier
+	// records the webhook events of the changes in their transaction, see transaction
+	events *EventDispatcher
+	// RestoreWindow is how long a deleted task can be restored, the background job purges its attachments after it
+	RestoreWindow time.Duration
+}
+
+func NewTaskService(repo repo.TaskRepositoryInterface, workflow *Workflow, maxDepth int, notifier Notifier, events *EventDispatcher) *TaskService {
+	return &TaskService{repo: repo, workflow: workflow, maxDepth: maxDepth, notifier: notifier, events: events, RestoreWindow: restoreWindowFromEnv()}
+}
+
+// ForViewer returns the service for requests of userID, the tasks it returns carry the labels of that user
+func (s *TaskService) ForViewer(userID uint) *TaskService {
+	bound := *s
+	bound.repo = s.repo.ForViewer(userID)
+	return &bound
+}
+
+// SubtaskMaxDepthFromEnv reads SUBTASK_MAX_DEPTH, default 3 levels of subtasks
+func SubtaskMaxDepthFromEnv() int {
+	depth := int64(3)
+	envInt("SUBTASK_MAX_DEPTH", &depth)
+	if depth < 1 {
+		depth = 1
+	}
+	return int(depth)
+}
+
+// restoreWindowFromEnv reads TASK_RESTORE_WINDOW, default 30 days
+func restoreWindowFromEnv() time.Duration {
+	window := 30 * 24 * time.Hour
+	envDuration("TASK_RESTORE_WINDOW", &window)
+	return window
+}
+
+// transaction runs fn with a copy of the service bound to one transaction. The webhook events fn records
+// commit with the changes and the delivery job is woken after the commit.
+func (s *TaskService) transaction(fn func(tx *TaskService) error) error {
+	err := s.repo.Transaction(func(r repo.TaskRepositoryInterface) error {
+		tx := *s
+		tx.repo = r
+		return fn(&tx)
+	})
+	if err == nil {
+		s.events.Wake()
+	}
+	return err
+}
+
+// recordEvent writes the webhook event of the change with the repository of the service, inside transaction
+// so a change is never committed without its event. before is nil for a new task and after for a deleted one.
+func (s *TaskService) recordEvent(before, after *utils.Task, authorID *uint) error {
+	if s.events == nil {
+		return nil
+	}
+	return s.events.Record(s.repo.Webhooks(), before, after, authorID)
+}
+
+// withProgress fills the progress of the tasks with one repository call
+func (s *TaskService) withProgress(tasks ...*utils.Task) error {
+	ids := make([]uint, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+
+	progress, err := s.repo.GetTaskProgress(ids)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		p := progress[task.ID]
+		task.Progress = &p
+	}
+	return nil
+}
+
+func (s *TaskService) withProgressList(tasks []utils.Task) ([]utils.Task, error) {
+	pointers := make([]*utils.Task, len(tasks))
+	for i := range tasks {
+		pointers[i] = &tasks[i]
+	}
+	if err := s.withProgress(pointers...); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (s *TaskService) withProgressOne(task *utils.Task, err error) (*utils.Task, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := s.withProgress(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (s *TaskService) GetTasks(filter utils.TaskFilter) ([]utils.Task, error) {
+	tasks, err := s.repo.GetTasks(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.withProgressList(tasks)
+}
+
+// SearchTasks returns a page of the tasks matching q, with their progress
+func (s *TaskService) SearchTasks(filter utils.TaskFilter, q string, offset int, limit int) ([]utils.TaskSearchResult, int64, error) {
+	results, total, err := s.repo.SearchTasks(filter, q, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	tasks := make([]*utils.Task, len(results))
+	for i := range results {
+		tasks[i] = &results[i].Task
+	}
+	if err := s.withProgress(tasks...); err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+func (s *TaskService) GetTask(id int) (*utils.Task, error) {
+	return s.withProgressOne(s.repo.GetTaskById(id))
+}
+
+// GetSubtasks lists the direct subtasks, utils.ErrNotFound when the task doesn't exist
+func (s *TaskService) GetSubtasks(id int) ([]utils.Task, error) {
+	if _, err := s.repo.GetTaskById(id); err != nil {
+		return nil, err
+	}
+	tasks, err := s.repo.GetSubtasks(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	return s.withProgressList(tasks)
+}
+
+// CreateTask starts the task as todo, or done for clients that only send completed.
+// A subtask has to be in the project of its parent.
+func (s *TaskService) CreateTask(task *utils.Task) (*utils.Task, error) {
+	author := uint(task.UserID)
+	var created *utils.Task
+	err := s.transaction(func(tx *TaskService) error {
+		taken, err := tx.takenExternalIDs([]*utils.Task{task})
+		if err != nil {
+			return err
+		}
+		if err := tx.prepareNewTask(task, taken); err != nil {
+			return err
+		}
+		if created, err = tx.withProgressOne(tx.repo.CreateTask(task)); err != nil {
+			return err
+		}
+		return tx.recordEvent(nil, created, &author)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if created.AssigneeID != nil {
+		s.notifyAssignment(created, nil, &author)
+	}
+	return created, nil
+}
+
+// takenExternalIDs finds the tasks that have the external ids of the new tasks already, by project and external id.
+// An empty external id is cleared.
+func (s *TaskService) takenExternalIDs(tasks []*utils.Task) (map[uint]map[string]uint, error) {
+	externalIDs := map[uint][]string{}
+	for _, task := range tasks {
+		if task.ExternalID != nil && *task.ExternalID == "" {
+			task.ExternalID = nil
+		}
+		if task.ExternalID != nil {
+			externalIDs[task.ProjectID] = append(externalIDs[task.ProjectID], *task.ExternalID)
+		}
+	}
+	return s.repo.GetTaskIDsByExternalID(externalIDs)
+}
+
+// prepareNewTask sets the status and the schedule of a new task and checks its parent and, with the result
+// of takenExternalIDs, its external id
+func (s *TaskService) prepareNewTask(task *utils.Task, taken map[uint]map[string]uint) error {
+	if task.Status == "" {
+		task.Status = utils.StatusTodo
+		if task.Completed {
+			task.Status = utils.StatusDone
+		}
+	}
+	task.Completed = task.Status == utils.StatusDone
+
+	if task.Recurrence != "" {
+		if task.DueAt == nil {
+			return utils.ErrRecurrenceNeedsDue
+		}
+		if task.ScheduledAt == nil {
+			task.ScheduledAt = task.DueAt
+		}
+	}
+	if task.Occurrence == 0 {
+		task.Occurrence = 1
+	}
+
+	if task.ExternalID != nil {
+		if _, ok := taken[task.ProjectID][*task.ExternalID]; ok {
+			return utils.ErrExternalIDTaken
+		}
+	}
+
+	if task.ParentID != nil {
+		parent, err := s.repo.GetTaskById(int(*task.ParentID))
+		if err == utils.ErrNotFound {
+			return utils.ErrParentNotFound
+		} else if err != nil {
+			return err
+		}
+		if parent.ProjectID != task.ProjectID {
+			return utils.ErrProjectMismatch
+		}
+		ancestors, err := s.repo.GetAncestorIDs(*task.ParentID)
+		if err != nil {
+			return err
+		}
+		if len(ancestors)+1 > s.maxDepth {
+			return utils.ErrMaxDepth
+		}
+	}
+	return nil
+}
+
+// UpdateTask applies the non empty fields of changes to current. A status change, or completed from
+// older clients (true closes the task as done, false reopens it as todo), has to be allowed by the workflow from the current status.
+// Closing a task (done or cancelled) closes its open subtasks with the same status.
+// A task with open blockers can't be done unless force is set.
+func (s *TaskService) UpdateTask(current *utils.Task, changes *utils.Task, authorID *uint, force bool) (*utils.Task, error) {
+	// moves go through MoveTask and MoveToProject, assignments through Assign, the external id never changes
+	changes.ParentID = nil
+	changes.ProjectID = 0
+	changes.AssigneeID = nil
+	changes.ExternalID = nil
+	// recurrences go through SetRecurrence, the rest of the series is kept by the service
+	changes.Recurrence, changes.Timezone, changes.ScheduledAt = "", "", nil
+	changes.Occurrence, changes.PreviousOccurrenceID = 0, nil
+
+	if changes.Status == "" && changes.Completed {
+		changes.Status = utils.StatusDone
+	} else if changes.Status == "" && changes.CompletedSent() && current.Status == utils.StatusDone {
+		// completed=false reopens the task
+		changes.Status = utils.StatusTodo
+	}
+	if err := s.checkStatusChange(current, changes, force); err != nil {
+		return nil, err
+	}
+	// without a status the task keeps its completed flag, the repository skips false
+	changes.Completed = changes.Status == utils.StatusDone
+
+	return s.update(current, authorID, force, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.UpdateTask(int(current.ID), changes, authorID)
+	})
+}
+
+// PatchTask replaces the editable fields of current with fields, so a patch can clear due_at or the reminders.
+// The status is checked like in UpdateTask.
+func (s *TaskService) PatchTask(current *utils.Task, fields utils.TaskFields, version int, authorID *uint, force bool) (*utils.Task, error) {
+	changes := &utils.Task{Version: version}
+	changes.ApplyFields(fields)
+	if err := s.checkStatusChange(current, changes, force); err != nil {
+		return nil, err
+	}
+
+	return s.update(current, authorID, force, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.UpdateTaskFields(int(current.ID), changes.Fields(), changes.Version, authorID)
+	})
+}
+
+// checkStatusChange checks a change of the status against the workflow and the open blockers.
+// It pins changes.Version to the version the check was made against.
+func (s *TaskService) checkStatusChange(current *utils.Task, changes *utils.Task, force bool) error {
+	if changes.Status != "" && changes.Status != current.Status {
+		if err := s.workflow.Check(current.Status, changes.Status); err != nil {
+			return err
+		}
+		if changes.Status == utils.StatusDone && !force {
+			open, err := s.repo.GetOpenBlockerIDs(current.ID)
+			if err != nil {
+				return err
+			}
+			if len(open) > 0 {
+				return fmt.Errorf("%w (open: %v)", utils.ErrTaskBlocked, open)
+			}
+		}
+		// the transition was checked against this version, a concurrent change fails with ErrVersionMismatch
+		if changes.Version == 0 {
+			changes.Version = current.Version
+		}
+	}
+	return nil
+}
+
+// taskChange is a task before and after a change the service made on its own, e.g. a subtask closed with its parent
+type taskChange struct {
+	before *utils.Task
+	after  *utils.Task
+	next   *utils.Task // the next occurrence of after, if it recurs
+}
+
+// update runs write and, when it closed the task (done or cancelled), closes the open subtasks with the same
+// status and creates the next occurrences of the closed tasks that recur, all with their events in the same
+// transaction. A subtask that can't be closed fails the whole update.
+func (s *TaskService) update(current *utils.Task, authorID *uint, force bool, write func(tx repo.TaskRepositoryInterface) (*utils.Task, error)) (*utils.Task, error) {
+	var updated *utils.Task
+	var closed []taskChange
+	err := s.transaction(func(tx *TaskService) error {
+		var err error
+		if updated, err = write(tx.repo); err != nil {
+			return err
+		}
+		closing := updated.Status != current.Status && slices.Contains(utils.ClosedStatuses, updated.Status)
+		if closing {
+			if closed, err = tx.closeSubtasks(updated, authorID, force); err != nil {
+				return err
+			}
+		}
+		if len(closed) > 0 {
+			if updated, err = tx.repo.GetTaskById(int(updated.ID)); err != nil {
+				return err
+			}
+		}
+		if updated, err = tx.withProgressOne(updated, nil); err != nil {
+			return err
+		}
+		if err := tx.recordEvent(current, updated, authorID); err != nil {
+			return err
+		}
+		if !closing {
+			return nil
+		}
+
+		// done and cancelled (skipped) occurrences both go on to the next one, with the update or not at all
+		if updated.NextOccurrence, err = tx.createNextOccurrence(updated, authorID); err != nil {
+			return err
+		}
+		for i := range closed {
+			if err := tx.recordEvent(closed[i].before, closed[i].after, authorID); err != nil {
+				return err
+			}
+			if closed[i].next, err = tx.createNextOccurrence(closed[i].after, authorID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	next := []*utils.Task{updated.NextOccurrence}
+	for _, change := range closed {
+		next = append(next, change.next)
+	}
+	for _, task := range next {
+		if task != nil && task.AssigneeID != nil {
+			s.notifyAssignment(task, nil, authorID)
+		}
+	}
+	return updated, nil
+}
+
+// closeSubtasks gives the status of the closed task to its open subtasks at any depth. Each of them has to be
+// allowed by the workflow and, to be done, must not have open blockers besides the subtasks closed with it
+// unless force is set.
+func (s *TaskService) closeSubtasks(task *utils.Task, authorID *uint, force bool) ([]taskChange, error) {
+	open, err := s.repo.GetOpenDescendants(task.ID)
+	if err != nil {
+		return nil, err
+	}
+	closing := make(map[uint]bool, len(open))
+	for _, subtask := range open {
+		closing[subtask.ID] = true
+	}
+
+	closed := make([]taskChange, 0, len(open))
+	for i := range open {
+		subtask := &open[i]
+		if err := s.workflow.Check(subtask.Status, task.Status); err != nil {
+			return nil, fmt.Errorf("subtask %d: %w", subtask.ID, err)
+		}
+		if task.Status == utils.StatusDone && !force {
+			blockers, err := s.repo.GetOpenBlockerIDs(subtask.ID)
+			if err != nil {
+				return nil, err
+			}
+			blockers = slices.DeleteFunc(blockers, func(id uint) bool { return closing[id] })
+			if len(blockers) > 0 {
+				return nil, fmt.Errorf("subtask %d: %w (open: %v)", subtask.ID, utils.ErrTaskBlocked, blockers)
+			}
+		}
+
+		changes := &utils.Task{Status: task.Status, Completed: task.Status == utils.StatusDone, Version: subtask.Version}
+		updated, err := s.repo.UpdateTask(int(subtask.ID), changes, authorID)
+		if err != nil {
+			return nil, err
+		}
+		closed = append(closed, taskChange{before: subtask, after: updated})
+	}
+
+	// closing a subtask bumps the version of its parent, the closed parents are read again for their ETag
+	parents := make(map[uint]bool, len(closed))
+	for _, change := range closed {
+		parents[*change.after.ParentID] = true
+	}
+	for i, change := range closed {
+		if !parents[change.after.ID] {
+			continue
+		}
+		if closed[i].after, err = s.repo.GetTaskById(int(change.after.ID)); err != nil {
+			return nil, err
+		}
+	}
+	return closed, nil
+}
+
+// MoveTask makes the task a subtask of parentID, or a top level task when it is nil
+func (s *TaskService) MoveTask(current *utils.Task, parentID *uint, authorID *uint) (*utils.Task, error) {
+	return s.change(current, authorID, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.SetParent(current.ID, parentID, s.maxDepth, authorID)
+	})
+}
+
+// MoveToProject moves a top level task and its subtasks to another project
+func (s *TaskService) MoveToProject(current *utils.Task, projectID uint, authorID *uint) (*utils.Task, error) {
+	return s.change(current, authorID, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.SetProject(current.ID, projectID, authorID)
+	})
+}
+
+// RestoreTask undoes a delete, with the subtasks that were deleted with the task.
+// Receivers dropped the task on task.deleted, it comes back as a new one.
+func (s *TaskService) RestoreTask(id int, authorID *uint) (*utils.Task, error) {
+	return s.change(nil, authorID, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.RestoreTask(uint(id), time.Now().Add(-s.RestoreWindow), authorID)
+	})
+}
+
+// change runs write, a change without cascades, and records its event in the same transaction.
+// before is the task as the event tells it was, nil tells it as a new task.
+func (s *TaskService) change(before *utils.Task, authorID *uint, write func(tx repo.TaskRepositoryInterface) (*utils.Task, error)) (*utils.Task, error) {
+	var updated *utils.Task
+	err := s.transaction(func(tx *TaskService) error {
+		var err error
+		if updated, err = tx.withProgressOne(write(tx.repo)); err != nil {
+			return err
+		}
+		return tx.recordEvent(before, updated, authorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Transition moves the task to status, moving to the current status changes nothing.
+// version is the expected version like in UpdateTask, 0 for any.
+func (s *TaskService) Transition(current *utils.Task, status string, version int, authorID *uint, force bool) (*utils.Task, error) {
+	if status == current.Status {
+		return current, nil
+	}
+	return s.UpdateTask(current, &utils.Task{Status: status, Version: version}, authorID, force)
+}
+
+func (s *TaskService) AllowedTransitions(task *utils.Task) []string {
+	return s.workflow.Allowed(task.Status)
+}
+
+// DeleteTask deletes current and its subtasks unless the task changed since version, 0 for any
+func (s *TaskService) DeleteTask(current *utils.Task, version int, authorID *uint) error {
+	return s.transaction(func(tx *TaskService) error {
+		if err := tx.repo.DeleteTask(int(current.ID), version, authorID); err != nil {
+			return err
+		}
+		return tx.recordEvent(current, nil, authorID)
+	})
+}
+
+// GetTaskHistory returns utils.ErrNotFound when the task never existed, deleted tasks keep their history
+func (s *TaskService) GetTaskHistory(id int) ([]utils.TaskRevision, error) {
+	revisions, err := s.repo.GetTaskRevisions(id)
+	if err != nil {
+		return nil, err
+	}
+	// tasks created before revisions existed have none
+	if len(revisions) == 0 {
+		if _, err := s.repo.GetTaskById(id); err != nil {
+			return nil, err
+		}
+		revisions = []utils.TaskRevision{}
+	}
+	return revisions, nil
+}
+
+// RevertTask restores the fields of a revision. A different status has to be allowed by the workflow like in UpdateTask.
+func (s *TaskService) RevertTask(current *utils.Task, revision int, authorID *uint, force bool) (*utils.Task, error) {
+	fields, err := s.repo.GetRevisionFields(int(current.ID), revision)
+	if err != nil {
+		return nil, err
+	}
+
+	// going back to another status is a transition like any other
+	changes := &utils.Task{}
+	changes.ApplyFields(*fields)
+	if err := s.checkStatusChange(current, changes, force); err != nil {
+		return nil, err
+	}
+
+	return s.update(current, authorID, force, func(tx repo.TaskRepositoryInterface) (*utils.Task, error) {
+		return tx.RevertTask(int(current.ID), changes.Fields(), changes.Version, authorID)
+	})
+}
@@ -0,0 +1,479 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+	"gorm.io/gorm"
+)
+
+// fakeTaskRepo keeps tasks in a map. The methods the tests don't need panic through the nil interface.
+type fakeTaskRepo struct {
+	repo.TaskRepositoryInterface
+	tasks    map[uint]*utils.Task
+	blockers map[uint][]uint
+	nextID   uint
+	copied   map[uint]uint // the occurrence details copied, to the task from the previous one
+	copyErr  error
+	webhooks repo.WebhookRepositoryInterface
+	// CreateTask and CreateTasks refuse tasks with this title, like a failing constraint
+	rejectTitle string
+}
+
+func newFakeTaskRepo(tasks ...utils.Task) *fakeTaskRepo {
+	r := &fakeTaskRepo{tasks: map[uint]*utils.Task{}, blockers: map[uint][]uint{}, copied: map[uint]uint{}}
+	for _, task := range tasks {
+		task := task
+		if task.Version == 0 {
+			task.Version = 1
+		}
+		r.tasks[task.ID] = &task
+		r.nextID = max(r.nextID, task.ID)
+	}
+	return r
+}
+
+func (r *fakeTaskRepo) ForViewer(userID uint) repo.TaskRepositoryInterface { return r }
+
+// Transaction doesn't roll back, the tests check the error
+func (r *fakeTaskRepo) Transaction(fn func(tx repo.TaskRepositoryInterface) error) error {
+	return fn(r)
+}
+
+func (r *fakeTaskRepo) Webhooks() repo.WebhookRepositoryInterface { return r.webhooks }
+
+func (r *fakeTaskRepo) GetTaskById(id int) (*utils.Task, error) {
+	task, ok := r.tasks[uint(id)]
+	if !ok {
+		return nil, utils.ErrNotFound
+	}
+	copied := *task
+	return &copied, nil
+}
+
+func (r *fakeTaskRepo) UpdateTask(id int, changes *utils.Task, authorID *uint) (*utils.Task, error) {
+	task, ok := r.tasks[uint(id)]
+	if !ok {
+		return nil, utils.ErrNotFound
+	}
+	if changes.Version != 0 && changes.Version != task.Version {
+		return nil, utils.ErrVersionMismatch
+	}
+	if changes.Title != "" {
+		task.Title = changes.Title
+	}
+	if changes.Status != "" {
+		task.Status = changes.Status
+		task.Completed = changes.Status == utils.StatusDone
+	}
+	task.Version++
+	if task.ParentID != nil {
+		r.tasks[*task.ParentID].Version++
+	}
+	return r.GetTaskById(id)
+}
+
+func (r *fakeTaskRepo) CreateTask(task *utils.Task) (*utils.Task, error) {
+	if r.rejectTitle != "" && task.Title == r.rejectTitle {
+		return nil, errRejected
+	}
+	r.nextID++
+	created := *task
+	created.ID = r.nextID
+	created.Version = 1
+	r.tasks[created.ID] = &created
+	return r.GetTaskById(int(created.ID))
+}
+
+// CreateTasks creates all the tasks or none
+func (r *fakeTaskRepo) CreateTasks(tasks []*utils.Task) error {
+	for _, task := range tasks {
+		if r.rejectTitle != "" && task.Title == r.rejectTitle {
+			return errRejected
+		}
+	}
+	for _, task := range tasks {
+		created, _ := r.CreateTask(task)
+		*task = *created
+	}
+	return nil
+}
+
+func (r *fakeTaskRepo) DeleteTask(id int, version int, authorID *uint) error {
+	task, ok := r.tasks[uint(id)]
+	if !ok {
+		return utils.ErrNotFound
+	}
+	if version != 0 && version != task.Version {
+		return utils.ErrVersionMismatch
+	}
+	delete(r.tasks, uint(id))
+	return nil
+}
+
+func (r *fakeTaskRepo) GetTaskIDsByExternalID(externalIDs map[uint][]string) (map[uint]map[string]uint, error) {
+	taken := map[uint]map[string]uint{}
+	for _, task := range r.tasks {
+		if task.ExternalID != nil && slices.Contains(externalIDs[task.ProjectID], *task.ExternalID) {
+			if taken[task.ProjectID] == nil {
+				taken[task.ProjectID] = map[string]uint{}
+			}
+			taken[task.ProjectID][*task.ExternalID] = task.ID
+		}
+	}
+	return taken, nil
+}
+
+func (r *fakeTaskRepo) GetAncestorIDs(id uint) ([]uint, error) {
+	var ancestors []uint
+	for parentID := r.tasks[id].ParentID; parentID != nil; parentID = r.tasks[*parentID].ParentID {
+		ancestors = append(ancestors, *parentID)
+	}
+	return ancestors, nil
+}
+
+func (r *fakeTaskRepo) HasNextOccurrence(id uint) (bool, error) {
+	for _, task := range r.tasks {
+		if task.PreviousOccurrenceID != nil && *task.PreviousOccurrenceID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeTaskRepo) CopyOccurrenceDetails(fromID uint, toID uint) error {
+	if r.copyErr != nil {
+		return r.copyErr
+	}
+	r.copied[toID] = fromID
+	return nil
+}
+
+func (r *fakeTaskRepo) GetOpenDescendants(id uint) ([]utils.Task, error) {
+	var open []utils.Task
+	parents := []uint{id}
+	for len(parents) > 0 {
+		var next []uint
+		for _, taskID := range sortedIDs(r.tasks) {
+			task := r.tasks[taskID]
+			if task.ParentID == nil || !slices.Contains(parents, *task.ParentID) {
+				continue
+			}
+			next = append(next, task.ID)
+			if !slices.Contains(utils.ClosedStatuses, task.Status) {
+				open = append(open, *task)
+			}
+		}
+		parents = next
+	}
+	return open, nil
+}
+
+func (r *fakeTaskRepo) GetOpenBlockerIDs(id uint) ([]uint, error) {
+	var open []uint
+	for _, blockerID := range r.blockers[id] {
+		if !slices.Contains(utils.ClosedStatuses, r.tasks[blockerID].Status) {
+			open = append(open, blockerID)
+		}
+	}
+	return open, nil
+}
+
+// GetOpenTaskGraph returns the open tasks assigned to the user with their open blockers, assigned or not
+func (r *fakeTaskRepo) GetOpenTaskGraph(userID uint) ([]utils.Task, map[uint][]uint, error) {
+	var tasks []utils.Task
+	graph := map[uint][]uint{}
+	for _, id := range sortedIDs(r.tasks) {
+		task := r.tasks[id]
+		if task.AssigneeID == nil || *task.AssigneeID != userID || slices.Contains(utils.ClosedStatuses, task.Status) {
+			continue
+		}
+		tasks = append(tasks, *task)
+		if open, _ := r.GetOpenBlockerIDs(id); len(open) > 0 {
+			graph[id] = open
+		}
+	}
+	return tasks, graph, nil
+}
+
+func (r *fakeTaskRepo) GetTaskProgress(ids []uint) (map[uint]utils.TaskProgress, error) {
+	return map[uint]utils.TaskProgress{}, nil
+}
+
+// SearchTasks ignores the filter, every task of the fake is visible
+func (r *fakeTaskRepo) SearchTasks(filter utils.TaskFilter, q string, offset int, limit int) ([]utils.TaskSearchResult, int64, error) {
+	tasks := make([]utils.Task, 0, len(r.tasks))
+	for _, id := range sortedIDs(r.tasks) {
+		tasks = append(tasks, *r.tasks[id])
+	}
+	results, total := repo.SearchTasksInMemory(tasks, q, offset, limit)
+	return results, total, nil
+}
+
+var errRejected = errors.New("rejected by the database")
+
+func sortedIDs(tasks map[uint]*utils.Task) []uint {
+	ids := make([]uint, 0, len(tasks))
+	for id := range tasks {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func model(id uint) gorm.Model {
+	return gorm.Model{ID: id}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestUpdateTaskClosesSubtasks(t *testing.T) {
+	r := newFakeTaskRepo(
+		utils.Task{Model: model(1), Status: utils.StatusInProgress},
+		utils.Task{Model: model(2), Status: utils.StatusTodo, ParentID: ptr(uint(1))},
+		utils.Task{Model: model(3), Status: utils.StatusInProgress, ParentID: ptr(uint(2))},
+		utils.Task{Model: model(4), Status: utils.StatusCancelled, ParentID: ptr(uint(1))},
+	)
+	// a subtask waiting on its sibling is closed with it
+	r.blockers[2] = []uint{3}
+	s := NewTaskService(r, DefaultWorkflow(), 3, nil, nil)
+
+	current, _ := r.GetTaskById(1)
+	updated, err := s.UpdateTask(current, &utils.Task{Status: utils.StatusDone}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[uint]string{2: utils.StatusDone, 3: utils.StatusDone, 4: utils.StatusCancelled} {
+		if got := r.tasks[id].Status; got != want {
+			t.Errorf("subtask %d is %s, want %s", id, got, want)
+		}
+	}
+	if updated.Version != r.tasks[1].Version {
+		t.Errorf("returned version %d, stored %d", updated.Version, r.tasks[1].Version)
+	}
+}
+
+func TestUpdateTaskFailsWhenASubtaskCantBeClosed(t *testing.T) {
+	tests := []struct {
+		name     string
+		subtask  utils.Task
+		blockers []uint
+		force    bool
+		want     error
+	}{
+		{"the workflow doesn't allow it", utils.Task{Model: model(2), Status: utils.StatusBlocked, ParentID: ptr(uint(1))}, nil, false, utils.ErrInvalidTransition},
+		{"open blocker outside the subtasks", utils.Task{Model: model(2), Status: utils.StatusTodo, ParentID: ptr(uint(1))}, []uint{9}, false, utils.ErrTaskBlocked},
+		{"force skips the blockers", utils.Task{Model: model(2), Status: utils.StatusTodo, ParentID: ptr(uint(1))}, []uint{9}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeTaskRepo(utils.Task{Model: model(1), Status: utils.StatusTodo}, tt.subtask, utils.Task{Model: model(9), Status: utils.StatusTodo})
+			r.blockers[2] = tt.blockers
+			s := NewTaskService(r, DefaultWorkflow(), 3, nil, nil)
+
+			current, _ := r.GetTaskById(1)
+			_, err := s.UpdateTask(current, &utils.Task{Status: utils.StatusDone}, nil, tt.force)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("UpdateTask() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateTaskCreatesNextOccurrences(t *testing.T) {
+	dueAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	r := newFakeTaskRepo(
+		utils.Task{Model: model(1), Status: utils.StatusTodo, DueAt: &dueAt, ScheduledAt: &dueAt, Recurrence: "FREQ=WEEKLY", Occurrence: 1},
+		utils.Task{Model: model(2), Status: utils.StatusTodo, ParentID: ptr(uint(1)), DueAt: &dueAt, ScheduledAt: &dueAt, Recurrence: "FREQ=DAILY", Occurrence: 1},
+	)
+	s := NewTaskService(r, DefaultWorkflow(), 3, nil, nil)
+
+	current, _ := r.GetTaskById(1)
+	updated, err := s.UpdateTask(current, &utils.Task{Status: utils.StatusDone}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := updated.NextOccurrence
+	if next == nil || next.PreviousOccurrenceID == nil || *next.PreviousOccurrenceID != 1 {
+		t.Fatalf("next occurrence = %+v, want one after task 1", next)
+	}
+	if want := dueAt.AddDate(0, 0, 7); !next.DueAt.Equal(want) || next.Occurrence != 2 || next.Status != utils.StatusTodo {
+		t.Errorf("next occurrence is due %v (occurrence %d, %s), want %v (occurrence 2, todo)", next.DueAt, next.Occurrence, next.Status, want)
+	}
+	if r.copied[next.ID] != 1 {
+		t.Errorf("the details of task 1 weren't copied to %d", next.ID)
+	}
+
+	// the subtask closed with its parent goes on too
+	subtaskNext, _ := r.HasNextOccurrence(2)
+	if !subtaskNext {
+		t.Error("the closed subtask has no next occurrence")
+	}
+}
+
+func TestUpdateTaskFailsWhenTheNextOccurrenceCantBeCreated(t *testing.T) {
+	dueAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	r := newFakeTaskRepo(utils.Task{Model: model(1), Status: utils.StatusTodo, DueAt: &dueAt, Recurrence: "FREQ=DAILY", Occurrence: 1})
+	r.copyErr = errors.New("copy failed")
+	s := NewTaskService(r, DefaultWorkflow(), 3, nil, nil)
+
+	current, _ := r.GetTaskById(1)
+	if _, err := s.UpdateTask(current, &utils.Task{Status: utils.StatusDone}, nil, false); !errors.Is(err, r.copyErr) {
+		t.Fatalf("UpdateTask() error = %v, want %v", err, r.copyErr)
+	}
+}
+
+func TestSearchTasks(t *testing.T) {
+	r := newFakeTaskRepo(
+		utils.Task{Model: model(1), Title: "Write the release notes", Description: "list the fixes"},
+		utils.Task{Model: model(2), Title: "Fix login", Description: "the release broke the <form> of the login page"},
+		utils.Task{Model: model(3), Title: "Plan the release party", Description: "book a room"},
+		utils.Task{Model: model(4), Title: "Book flights"},
+	)
+	s := NewTaskService(r, DefaultWorkflow(), 3, nil, nil)
+
+	ids := func(results []utils.TaskSearchResult) []uint {
+		var ids []uint
+		for _, result := range results {
+			ids = append(ids, result.Task.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		q    string
+		want []uint
+	}{
+		// title matches first, then the newest
+		{"release", []uint{3, 1, 2}},
+		{"Release -party", []uint{1, 2}},
+		{`"release notes"`, []uint{1}},
+		{`"notes release"`, nil},
+		{"release login", []uint{2}},
+		{"flights or room", []uint{4, 3}},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		results, total, err := s.SearchTasks(utils.TaskFilter{}, tt.q, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(results); !slices.Equal(got, tt.want) || total != int64(len(tt.want)) {
+			t.Errorf("SearchTasks(%q) = %v (total %d), want %v", tt.q, got, total, tt.want)
+		}
+	}
+
+	results, total, _ := s.SearchTasks(utils.TaskFilter{}, "release", 1, 1)
+	if got := ids(results); !slices.Equal(got, []uint{1}) || total != 3 {
+		t.Errorf("second page = %v (total %d), want [1] (total 3)", got, total)
+	}
+
+	results, _, _ = s.SearchTasks(utils.TaskFilter{}, "login", 0, 10)
+	want := utils.TaskSearchResult{
+		TitleSnippet:       "Fix <mark>login</mark>",
+		DescriptionSnippet: "the release broke the &lt;form&gt; of the <mark>login</mark> page",
+	}
+	if len(results) != 1 || results[0].TitleSnippet != want.TitleSnippet || results[0].DescriptionSnippet != want.DescriptionSnippet {
+		t.Errorf("snippets = %+v, want %q and %q", results, want.TitleSnippet, want.DescriptionSnippet)
+	}
+}
+
+func TestBulkAtomic(t *testing.T) {
+	r := newFakeTaskRepo(
+		utils.Task{Model: model(1), Title: "one", Status: utils.StatusTodo},
+		utils.Task{Model: model(2), Title: "two", Status: utils.StatusTodo, Version: 4},
+		utils.Task{Model: model(3), Title: "three", Status: utils.StatusTodo},
+	)
+	s := NewTaskService(r, DefaultWorkflow(), 3, nil, nil)
+
+	ops := []utils.BulkOperation{
+		{Op: utils.BulkUpdate, ID: 1, Task: &utils.Task{Title: "renamed"}},
+		{Op: utils.BulkCreate, Task: &utils.Task{Title: "new"}},
+		// stale version
+		{Op: utils.BulkUpdate, ID: 2, Version: 3, Task: &utils.Task{Title: "renamed"}},
+		{Op: utils.BulkDelete, ID: 3},
+	}
+	outcomes, err := s.Bulk(ops, true, nil)
+	if !errors.Is(err, utils.ErrVersionMismatch) {
+		t.Fatalf("Bulk() error = %v, want %v", err, utils.ErrVersionMismatch)
+	}
+	for i, outcome := range outcomes {
+		if i == 2 {
+			if !errors.Is(outcome.Err, utils.ErrVersionMismatch) {
+				t.Errorf("outcome of the failed operation = %v, want %v", outcome.Err, utils.ErrVersionMismatch)
+			}
+			continue
+		}
+		// the earlier operations were rolled back, the later ones never ran
+		if outcome != (BulkOutcome{}) {
+			t.Errorf("outcome %d = %+v, want it cleared", i, outcome)
+		}
+	}
+
+	// a failing batch insert fails the request before any update
+	r.rejectTitle = "bad"
+	outcomes, err = s.Bulk([]utils.BulkOperation{
+		{Op: utils.BulkCreate, Task: &utils.Task{Title: "good"}},
+		{Op: utils.BulkCreate, Task: &utils.Task{Title: "bad"}},
+		{Op: utils.BulkDelete, ID: 3},
+	}, true, nil)
+	if !errors.Is(err, errRejected) || outcomes[2] != (BulkOutcome{}) {
+		t.Fatalf("Bulk() = %+v, %v, want %v and the delete not run", outcomes, err, errRejected)
+	}
+	if _, ok := r.tasks[3]; !ok {
+		t.Error("task 3 was deleted by a failed atomic request")
+	}
+}
+
+func TestBulkBestEffort(t *testing.T) {
+	r := newFakeTaskRepo(
+		utils.Task{Model: model(1), Title: "one", Status: utils.StatusTodo},
+		utils.Task{Model: model(2), Title: "two", Status: utils.StatusTodo, Version: 4},
+		utils.Task{Model: model(3), Title: "three", Status: utils.StatusTodo},
+		utils.Task{Model: model(4), Title: "four", Status: utils.StatusTodo, ExternalID: ptr("ext-4")},
+	)
+	r.rejectTitle = "bad"
+	s := NewTaskService(r, DefaultWorkflow(), 3, nil, nil)
+
+	ops := []utils.BulkOperation{
+		{Op: utils.BulkCreate, Task: &utils.Task{Title: "good"}},
+		{Op: utils.BulkUpdate, ID: 2, Version: 3, Task: &utils.Task{Title: "renamed"}},
+		// the batch insert fails on it, the tasks are then inserted one by one
+		{Op: utils.BulkCreate, Task: &utils.Task{Title: "bad"}},
+		{Op: utils.BulkCreate, Task: &utils.Task{Title: "also good"}},
+		{Op: utils.BulkCreate, Task: &utils.Task{Title: "taken", ExternalID: ptr("ext-4")}},
+		{Op: utils.BulkUpdate, ID: 1, Task: &utils.Task{Title: "renamed"}},
+		{Op: utils.BulkDelete, ID: 3},
+		{Op: utils.BulkDelete, ID: 99},
+	}
+	outcomes, err := s.Bulk(ops, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantErrs := []error{nil, utils.ErrVersionMismatch, errRejected, nil, utils.ErrExternalIDTaken, nil, nil, utils.ErrNotFound}
+	for i, want := range wantErrs {
+		if !errors.Is(outcomes[i].Err, want) {
+			t.Errorf("outcome %d error = %v, want %v", i, outcomes[i].Err, want)
+		}
+	}
+	for _, i := range []int{0, 3} {
+		if task := outcomes[i].Task; task == nil || r.tasks[task.ID] == nil || r.tasks[task.ID].Title != ops[i].Task.Title {
+			t.Errorf("outcome %d = %+v, want the created task", i, outcomes[i])
+		}
+	}
+	if outcomes[2].Task != nil {
+		t.Errorf("the rejected task was returned: %+v", outcomes[2].Task)
+	}
+	if r.tasks[1].Title != "renamed" || r.tasks[2].Title != "two" || r.tasks[3] != nil {
+		t.Errorf("tasks after the request: 1 %q, 2 %q, 3 %v", r.tasks[1].Title, r.tasks[2].Title, r.tasks[3])
+	}
+	if outcomes[6].Before == nil || outcomes[6].Before.ID != 3 {
+		t.Errorf("the delete outcome = %+v, want the task before it", outcomes[6])
+	}
+}
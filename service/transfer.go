@@ -0,0 +1,68 @@
+package service
+
+import (
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// ImportMaxRowsFromEnv reads IMPORT_MAX_ROWS, the most rows of one POST /tasks/import (default 1000)
+func ImportMaxRowsFromEnv() int {
+	max := int64(1000)
+	envInt("IMPORT_MAX_ROWS", &max)
+	if max < 1 {
+		max = 1
+	}
+	return int(max)
+}
+
+// StreamTasks calls fn with every task matching filter, see TaskRepositoryInterface.StreamTasks
+func (s *TaskService) StreamTasks(filter utils.TaskFilter, fn func(task *utils.Task) error) error {
+	return s.repo.StreamTasks(filter, fn)
+}
+
+// ImportOutcome of one imported task. Existing is the id of the task of the project that already has
+// its external_id, the task was skipped then.
+type ImportOutcome struct {
+	Task     *utils.Task
+	Existing uint
+	Err      error
+}
+
+// ImportTasks creates the tasks the handler already validated and authorized, except those whose external_id
+// is used in their project already. Each task succeeds or fails on its own like in a best_effort bulk request.
+// A dry run only looks for the existing external ids.
+func (s *TaskService) ImportTasks(tasks []*utils.Task, dryRun bool) ([]ImportOutcome, error) {
+	existing, err := s.takenExternalIDs(tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]ImportOutcome, len(tasks))
+	var ops []utils.BulkOperation
+	var indexes []int
+	for i, task := range tasks {
+		if task.ExternalID != nil {
+			if id, ok := existing[task.ProjectID][*task.ExternalID]; ok {
+				outcomes[i].Existing = id
+				continue
+			}
+		}
+		if dryRun {
+			outcomes[i].Task = task
+			continue
+		}
+		ops = append(ops, utils.BulkOperation{Op: utils.BulkCreate, Task: task})
+		indexes = append(indexes, i)
+	}
+	if len(ops) == 0 {
+		return outcomes, nil
+	}
+
+	created, err := s.Bulk(ops, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	for n, outcome := range created {
+		outcomes[indexes[n]].Task, outcomes[indexes[n]].Err = outcome.Task, outcome.Err
+	}
+	return outcomes, nil
+}
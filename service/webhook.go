@@ -0,0 +1,396 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// WebhookConfig of the delivery job, see WebhookConfigFromEnv
+type WebhookConfig struct {
+	// a delivery is failed after this many attempts
+	MaxAttempts int
+	// wait before the second attempt, doubled after every attempt up to RetryMax
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	Timeout   time.Duration
+	// how often the job looks for due retries, new events wake it up right away
+	PollInterval time.Duration
+	// deliveries older than this are deleted from the log
+	Retention time.Duration
+	// loopback and private addresses are refused unless allowed, e.g. for a receiver on the same machine
+	AllowPrivate bool
+}
+
+// WebhookConfigFromEnv reads WEBHOOK_MAX_ATTEMPTS (default 8), WEBHOOK_RETRY_BASE (30s), WEBHOOK_RETRY_MAX (1h),
+// WEBHOOK_TIMEOUT (10s), WEBHOOK_POLL_INTERVAL (10s), WEBHOOK_RETENTION (720h) and WEBHOOK_ALLOW_PRIVATE (false)
+func WebhookConfigFromEnv() WebhookConfig {
+	maxAttempts := int64(8)
+	envInt("WEBHOOK_MAX_ATTEMPTS", &maxAttempts)
+	config := WebhookConfig{
+		MaxAttempts:  int(maxAttempts),
+		RetryBase:    30 * time.Second,
+		RetryMax:     time.Hour,
+		Timeout:      10 * time.Second,
+		PollInterval: 10 * time.Second,
+		Retention:    30 * 24 * time.Hour,
+	}
+	envDuration("WEBHOOK_RETRY_BASE", &config.RetryBase)
+	envDuration("WEBHOOK_RETRY_MAX", &config.RetryMax)
+	envDuration("WEBHOOK_TIMEOUT", &config.Timeout)
+	envDuration("WEBHOOK_POLL_INTERVAL", &config.PollInterval)
+	envDuration("WEBHOOK_RETENTION", &config.Retention)
+	envBool("WEBHOOK_ALLOW_PRIVATE", &config.AllowPrivate)
+
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 8
+	}
+	if config.RetryBase <= 0 {
+		config.RetryBase = 30 * time.Second
+	}
+	if config.RetryMax < config.RetryBase {
+		config.RetryMax = config.RetryBase
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 10 * time.Second
+	}
+	return config
+}
+
+var errPrivateAddress = errors.New("webhooks can't be sent to loopback or private addresses")
+
+// WebhookSender POSTs deliveries signed with the secret of their webhook:
+// X-Signature is "sha256=" and the hex HMAC-SHA256 of X-Webhook-Timestamp, "." and the body
+type WebhookSender struct {
+	client *http.Client
+}
+
+func NewWebhookSender(timeout time.Duration, allowPrivate bool) *WebhookSender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// checked on the resolved address, so a public name pointing to a private address is refused too
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &WebhookSender{client: &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// a redirect answers the delivery, it isn't followed
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// SignWebhook is the X-Signature of a payload, receivers compute the same to check it
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// the start of the response body kept in the delivery log
+const maxResponseBody = 1024
+
+// Send makes one attempt of the delivery, it fails on anything but a 2xx answer
+func (s *WebhookSender) Send(webhook *utils.Webhook, delivery *utils.WebhookDelivery) (status int, body string, err error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go_backend_test-webhooks")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Id", delivery.EventID)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Signature", SignWebhook(webhook.Secret, timestamp, delivery.Payload))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, string(b), fmt.Errorf("webhook answered %s", res.Status)
+	}
+	return res.StatusCode, string(b), nil
+}
+
+// WebhookService manages the webhooks of users and sends their deliveries from the outbox
+type WebhookService struct {
+	repo   repo.WebhookRepositoryInterface
+	sender *WebhookSender
+	config WebhookConfig
+	// wakes the delivery job when events were dispatched
+	wake chan struct{}
+}
+
+func NewWebhookService(r repo.WebhookRepositoryInterface, config WebhookConfig) *WebhookService {
+	return &WebhookService{
+		repo:   r,
+		sender: NewWebhookSender(config.Timeout, config.AllowPrivate),
+		config: config,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (s *WebhookService) GetWebhooks(userID uint) ([]utils.Webhook, error) {
+	return s.repo.GetWebhooks(userID)
+}
+
+func (s *WebhookService) GetWebhook(userID uint, id uint) (*utils.Webhook, error) {
+	return s.repo.GetWebhook(userID, id)
+}
+
+// CreateWebhook generates the secret of the webhook, it is returned only this once
+func (s *WebhookService) CreateWebhook(webhook *utils.Webhook) (string, error) {
+	secret, _, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	webhook.Secret = "whsec_" + secret
+	if err := s.repo.CreateWebhook(webhook); err != nil {
+		return "", err
+	}
+	return webhook.Secret, nil
+}
+
+func (s *WebhookService) UpdateWebhook(webhook *utils.Webhook) error {
+	if err := s.repo.UpdateWebhook(webhook); err != nil {
+		return err
+	}
+	// deliveries held while it was inactive go out now
+	if webhook.Active {
+		s.Wake()
+	}
+	return nil
+}
+
+func (s *WebhookService) DeleteWebhook(webhook *utils.Webhook) error {
+	return s.repo.DeleteWebhook(webhook.UserID, webhook.ID)
+}
+
+func (s *WebhookService) GetDeliveries(filter utils.WebhookDeliveryFilter) ([]utils.WebhookDelivery, int64, error) {
+	return s.repo.GetDeliveries(filter)
+}
+
+// Test sends a ping to the webhook right away, inactive ones too. It is attempted once and logged like the events.
+func (s *WebhookService) Test(webhook *utils.Webhook, actorID *uint) (*utils.WebhookDelivery, error) {
+	eventID, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := newDelivery(webhook.ID, utils.WebhookPayload{ID: eventID, Event: utils.EventPing, CreatedAt: time.Now(), ActorID: actorID})
+	if err != nil {
+		return nil, err
+	}
+	// claimed from the start, the delivery job leaves it alone
+	delivery.NextAttemptAt = time.Now().Add(s.lease())
+	deliveries := []utils.WebhookDelivery{*delivery}
+	if err := s.repo.CreateDeliveries(deliveries); err != nil {
+		return nil, err
+	}
+	delivery = &deliveries[0]
+
+	s.attempt(webhook, delivery)
+	if delivery.Status == utils.DeliveryPending {
+		delivery.Status = utils.DeliveryFailed
+	}
+	if err := s.repo.SaveAttempt(delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Wake makes the delivery job look for due deliveries now instead of at its next tick
+func (s *WebhookService) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// lease is how long a claimed delivery is left to its worker before another one may send it again
+func (s *WebhookService) lease() time.Duration {
+	return s.config.Timeout + time.Minute
+}
+
+// retryDelay is the wait after the attempt-th failed attempt
+func (s *WebhookService) retryDelay(attempt int) time.Duration {
+	delay := s.config.RetryBase
+	for i := 1; i < attempt && delay < s.config.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > s.config.RetryMax {
+		delay = s.config.RetryMax
+	}
+	return delay
+}
+
+// attempt sends the delivery once and records the outcome on it, a failed one is scheduled for a retry
+// until the last attempt. The caller saves it.
+func (s *WebhookService) attempt(webhook *utils.Webhook, delivery *utils.WebhookDelivery) {
+	start := time.Now()
+	status, body, err := s.sender.Send(webhook, delivery)
+	now := time.Now()
+
+	delivery.Attempts++
+	delivery.DurationMs = now.Sub(start).Milliseconds()
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	delivery.Error = ""
+	if err == nil {
+		delivery.Status = utils.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.Error = err.Error()
+	if delivery.Attempts >= s.config.MaxAttempts {
+		delivery.Status = utils.DeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = now.Add(s.retryDelay(delivery.Attempts))
+}
+
+// the most deliveries read at once, and sent at the same time
+const (
+	deliveryBatch   = 100
+	deliveryWorkers = 4
+)
+
+// WebhookDeliveryJob sends the due deliveries every poll interval and when woken up, and deletes the old ones every hour
+func WebhookDeliveryJob(s *WebhookService) {
+	poll := time.NewTicker(s.config.PollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-poll.C:
+		case <-s.wake:
+		case <-cleanup.C:
+			s.deleteOldDeliveries()
+			continue
+		}
+		s.sendDue()
+	}
+}
+
+// sendDue claims each due delivery before sending it, so running several instances doesn't send it twice.
+// A worker that dies while sending leaves the claim to expire and the delivery is sent again.
+func (s *WebhookService) sendDue() {
+	for {
+		deliveries, err := s.repo.GetDueDeliveries(time.Now(), deliveryBatch)
+		if err != nil {
+			log.Println("Error fetching due webhook deliveries:", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		workers := make(chan struct{}, deliveryWorkers)
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			claimed, err := s.repo.ClaimDelivery(delivery, time.Now().Add(s.lease()))
+			if err != nil || !claimed {
+				continue
+			}
+
+			wg.Add(1)
+			workers <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-workers }()
+
+				s.attempt(&delivery.Webhook, delivery)
+				if delivery.Error != "" {
+					log.Printf("Error delivering webhook %d delivery %d (attempt %d): %s\n", delivery.WebhookID, delivery.ID, delivery.Attempts, delivery.Error)
+				}
+				if err := s.repo.SaveAttempt(delivery); err != nil {
+					log.Printf("Error saving webhook delivery %d: %v\n", delivery.ID, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(deliveries) < deliveryBatch {
+			return
+		}
+	}
+}
+
+func (s *WebhookService) deleteOldDeliveries() {
+	if s.config.Retention <= 0 {
+		return
+	}
+	deleted, err := s.repo.DeleteDeliveriesBefore(time.Now().Add(-s.config.Retention))
+	if err != nil {
+		log.Println("Error deleting old webhook deliveries:", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d old webhook deliveries\n", deleted)
+	}
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "evt_" + hex.EncodeToString(b), nil
+}
+
+// newDelivery is the pending delivery of the payload to the webhook, due now
+func newDelivery(webhookID uint, payload utils.WebhookPayload) (*utils.WebhookDelivery, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.WebhookDelivery{
+		WebhookID:     webhookID,
+		EventID:       payload.ID,
+		Event:         payload.Event,
+		Payload:       body,
+		Status:        utils.DeliveryPending,
+		NextAttemptAt: payload.CreatedAt,
+	}, nil
+}
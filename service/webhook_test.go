@@ -0,0 +1,276 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Peeranut-Kit/go_backend_test/repo"
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// fakeWebhookRepo keeps the webhooks and the outbox in memory. The methods the tests don't need panic through the nil interface.
+type fakeWebhookRepo struct {
+	repo.WebhookRepositoryInterface
+	mu         sync.Mutex
+	webhooks   []utils.Webhook
+	deliveries []utils.WebhookDelivery
+}
+
+func (r *fakeWebhookRepo) GetSubscribers(projectID uint, event string) ([]utils.Webhook, error) {
+	var subscribers []utils.Webhook
+	for _, webhook := range r.webhooks {
+		if webhook.Active && (webhook.ProjectID == nil || *webhook.ProjectID == projectID) {
+			subscribers = append(subscribers, webhook)
+		}
+	}
+	return subscribers, nil
+}
+
+func (r *fakeWebhookRepo) CreateDeliveries(deliveries []utils.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range deliveries {
+		deliveries[i].ID = uint(len(r.deliveries) + 1)
+		r.deliveries = append(r.deliveries, deliveries[i])
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepo) GetDueDeliveries(now time.Time, limit int) ([]utils.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []utils.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.Status == utils.DeliveryPending && !delivery.NextAttemptAt.After(now) && len(due) < limit {
+			for _, webhook := range r.webhooks {
+				if webhook.ID == delivery.WebhookID && webhook.Active {
+					delivery.Webhook = webhook
+					due = append(due, delivery)
+				}
+			}
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeWebhookRepo) ClaimDelivery(delivery *utils.WebhookDelivery, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := &r.deliveries[delivery.ID-1]
+	if stored.Status != utils.DeliveryPending || !stored.NextAttemptAt.Equal(delivery.NextAttemptAt) {
+		return false, nil
+	}
+	stored.NextAttemptAt, delivery.NextAttemptAt = until, until
+	return true, nil
+}
+
+func (r *fakeWebhookRepo) SaveAttempt(delivery *utils.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saved := *delivery
+	saved.Webhook = utils.Webhook{}
+	r.deliveries[delivery.ID-1] = saved
+	return nil
+}
+
+// receiver is a local webhook endpoint that answers with statuses in turn, the last one from then on
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.requests = append(rcv.requests, receivedRequest{header: req.Header.Clone(), body: body})
+		status := rcv.statuses[0]
+		if len(rcv.statuses) > 1 {
+			rcv.statuses = rcv.statuses[1:]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("received"))
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) received() []receivedRequest {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]receivedRequest(nil), rcv.requests...)
+}
+
+// testWebhookService sends to rcv, which listens on loopback, and retries after a few milliseconds
+func testWebhookService(rcv *receiver, maxAttempts int) (*WebhookService, *fakeWebhookRepo) {
+	r := &fakeWebhookRepo{webhooks: []utils.Webhook{{ID: 1, UserID: 1, URL: rcv.URL, Secret: "whsec_test", Active: true}}}
+	return NewWebhookService(r, WebhookConfig{
+		MaxAttempts:  maxAttempts,
+		RetryBase:    time.Millisecond,
+		RetryMax:     2 * time.Millisecond,
+		Timeout:      5 * time.Second,
+		AllowPrivate: true,
+	}), r
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	rcv := newReceiver(t, http.StatusOK)
+	webhooks, outbox := testWebhookService(rcv, 3)
+
+	tasks := newFakeTaskRepo(utils.Task{Model: model(1), Title: "Ship it", Status: utils.StatusInProgress})
+	tasks.webhooks = outbox
+	s := NewTaskService(tasks, DefaultWorkflow(), 3, nil, NewEventDispatcher(webhooks))
+
+	current, _ := tasks.GetTaskById(1)
+	if _, err := s.UpdateTask(current, &utils.Task{Status: utils.StatusDone}, ptr(uint(7)), false); err != nil {
+		t.Fatal(err)
+	}
+	// the delivery is in the outbox before anything is sent
+	if len(outbox.deliveries) != 1 || outbox.deliveries[0].Event != utils.EventTaskCompleted {
+		t.Fatalf("outbox = %+v, want one task.completed delivery", outbox.deliveries)
+	}
+
+	webhooks.sendDue()
+	requests := rcv.received()
+	if len(requests) != 1 {
+		t.Fatalf("received %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+	if got := req.header.Get("X-Webhook-Event"); got != utils.EventTaskCompleted {
+		t.Errorf("X-Webhook-Event = %q, want %q", got, utils.EventTaskCompleted)
+	}
+	if got := req.header.Get("X-Webhook-Id"); got != outbox.deliveries[0].EventID {
+		t.Errorf("X-Webhook-Id = %q, want %q", got, outbox.deliveries[0].EventID)
+	}
+
+	// receivers check the signature like this, without the helper of the service
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte(req.header.Get("X-Webhook-Timestamp") + "."))
+	mac.Write(req.body)
+	if got, want := req.header.Get("X-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("X-Signature = %q, want %q", got, want)
+	}
+
+	var payload struct {
+		utils.WebhookPayload
+		Data struct {
+			Task    utils.Task     `json:"task"`
+			Changes map[string]any `json:"changes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != utils.EventTaskCompleted || payload.ActorID == nil || *payload.ActorID != 7 || payload.Data.Task.ID != 1 || payload.Data.Task.Status != utils.StatusDone {
+		t.Errorf("payload = %s", req.body)
+	}
+	if _, ok := payload.Data.Changes["status"]; !ok {
+		t.Errorf("changes = %v, want the status", payload.Data.Changes)
+	}
+
+	delivery := outbox.deliveries[0]
+	if delivery.Status != utils.DeliveryDelivered || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusOK || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want delivered at the first attempt", delivery)
+	}
+}
+
+// sendUntilSettled runs the delivery job until the delivery isn't pending any more or tries runs out
+func sendUntilSettled(webhooks *WebhookService, outbox *fakeWebhookRepo, tries int) utils.WebhookDelivery {
+	for i := 0; i < tries; i++ {
+		webhooks.sendDue()
+		outbox.mu.Lock()
+		delivery := outbox.deliveries[0]
+		outbox.mu.Unlock()
+		if delivery.Status != utils.DeliveryPending {
+			return delivery
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+	return outbox.deliveries[0]
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxAttempts  int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"delivered after two failures", []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent}, 5, utils.DeliveryDelivered, 3},
+		{"failed after the last attempt", []int{http.StatusInternalServerError}, 3, utils.DeliveryFailed, 3},
+		{"a redirect isn't followed", []int{http.StatusFound}, 1, utils.DeliveryFailed, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := newReceiver(t, tt.statuses...)
+			webhooks, outbox := testWebhookService(rcv, tt.maxAttempts)
+			if err := NewEventDispatcher(webhooks).Record(outbox, nil, &utils.Task{Model: model(1)}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			delivery := sendUntilSettled(webhooks, outbox, 20)
+			if delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts {
+				t.Fatalf("delivery is %s after %d attempts, want %s after %d", delivery.Status, delivery.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if tt.wantStatus == utils.DeliveryFailed && delivery.Error == "" {
+				t.Error("the failed delivery has no error")
+			}
+
+			// a settled delivery isn't sent again, and every attempt carries the same event id
+			webhooks.sendDue()
+			requests := rcv.received()
+			if len(requests) != tt.wantAttempts {
+				t.Errorf("received %d requests, want %d", len(requests), tt.wantAttempts)
+			}
+			for _, req := range requests {
+				if got := req.header.Get("X-Webhook-Id"); got != delivery.EventID {
+					t.Errorf("X-Webhook-Id = %q, want %q", got, delivery.EventID)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	s := &WebhookService{config: WebhookConfig{RetryBase: 30 * time.Second, RetryMax: time.Hour}}
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 7: 32 * time.Minute, 8: time.Hour, 20: time.Hour} {
+		if got := s.retryDelay(attempt); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestWebhookSenderRefusesPrivateAddresses(t *testing.T) {
+	rcv := newReceiver(t, http.StatusOK)
+	sender := NewWebhookSender(time.Second, false)
+
+	webhook := &utils.Webhook{URL: rcv.URL, Secret: "whsec_test"}
+	_, _, err := sender.Send(webhook, &utils.WebhookDelivery{ID: 1, Event: utils.EventPing, Payload: utils.JSONB(`{}`)})
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("Send() error = %v, want %v", err, errPrivateAddress)
+	}
+	if requests := rcv.received(); len(requests) != 0 {
+		t.Errorf("received %d requests, want none", len(requests))
+	}
+}
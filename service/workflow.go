@@ -0,0 +1,72 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Peeranut-Kit/go_backend_test/utils"
+)
+
+// Workflow is the state machine of task statuses, a status can only move to the ones listed for it
+type Workflow struct {
+	transitions map[string][]string
+}
+
+func DefaultWorkflow() *Workflow {
+	return &Workflow{transitions: map[string][]string{
+		utils.StatusTodo:       {utils.StatusInProgress, utils.StatusBlocked, utils.StatusDone, utils.StatusCancelled},
+		utils.StatusInProgress: {utils.StatusTodo, utils.StatusBlocked, utils.StatusDone, utils.StatusCancelled},
+		utils.StatusBlocked:    {utils.StatusTodo, utils.StatusInProgress, utils.StatusCancelled},
+		utils.StatusDone:       {utils.StatusTodo, utils.StatusInProgress},
+		utils.StatusCancelled:  {utils.StatusTodo},
+	}}
+}
+
+// NewWorkflow checks that every status of the transitions exists
+func NewWorkflow(transitions map[string][]string) (*Workflow, error) {
+	for from, targets := range transitions {
+		if !utils.ValidStatus(from) {
+			return nil, fmt.Errorf("unknown status %q", from)
+		}
+		for _, to := range targets {
+			if !utils.ValidStatus(to) {
+				return nil, fmt.Errorf("unknown status %q", to)
+			}
+		}
+	}
+	return &Workflow{transitions: transitions}, nil
+}
+
+// WorkflowFromEnv reads TASK_TRANSITIONS, a JSON object from status to the statuses it can move to,
+// e.g. {"todo":["in_progress"],"in_progress":["done"]}. Without it DefaultWorkflow is used.
+func WorkflowFromEnv() (*Workflow, error) {
+	value := os.Getenv("TASK_TRANSITIONS")
+	if value == "" {
+		return DefaultWorkflow(), nil
+	}
+
+	var transitions map[string][]string
+	if err := json.Unmarshal([]byte(value), &transitions); err != nil {
+		return nil, fmt.Errorf("invalid TASK_TRANSITIONS: %w", err)
+	}
+	return NewWorkflow(transitions)
+}
+
+func (w *Workflow) Allowed(from string) []string {
+	return w.transitions[from]
+}
+
+// Check returns an error wrapping utils.ErrInvalidTransition that lists the allowed statuses
+func (w *Workflow) Check(from, to string) error {
+	if slices.Contains(w.transitions[from], to) {
+		return nil
+	}
+	allowed := "none"
+	if len(w.transitions[from]) > 0 {
+		allowed = strings.Join(w.transitions[from], ", ")
+	}
+	return fmt.Errorf("%w: %s can't move to %s, allowed: %s", utils.ErrInvalidTransition, from, to, allowed)
+}
@@ -0,0 +1,18 @@
+package utils
+
+import "time"
+
+// AssignRequest of PUT /tasks/:id/assignee
+type AssignRequest struct {
+	AssigneeID uint `json:"assignee_id" validate:"required"`
+}
+
+// TaskWatcher is notified of the assignment changes of a task, users watch and unwatch themselves
+type TaskWatcher struct {
+	TaskID    uint      `gorm:"primaryKey;autoIncrement:false" json:"task_id"`
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false;index" json:"user_id"`
+	User      User      `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	// filled from User for the watcher list
+	Name string `gorm:"-" json:"name"`
+}
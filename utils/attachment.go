@@ -0,0 +1,17 @@
+package utils
+
+import "time"
+
+// Attachment is a file uploaded to a task, its content is in the blob store under BlobKey
+type Attachment struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TaskID      uint      `gorm:"index;not null" json:"task_id"`
+	UploaderID  uint      `gorm:"not null" json:"uploader_id"`
+	FileName    string    `gorm:"not null" json:"file_name"`
+	ContentType string    `gorm:"not null" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	BlobKey     string    `gorm:"uniqueIndex;not null" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	// signed link that works without a token until it expires, filled by the handler
+	DownloadURL string `gorm:"-" json:"download_url"`
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// AuditEntry is one append only record of the audit log
+type AuditEntry struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	// nil for anonymous actions such as a failed login
+	ActorID *uint `gorm:"index" json:"actor_id"`
+	// admin acting with an impersonation token
+	ImpersonatorID *uint  `json:"impersonator_id,omitempty"`
+	Action         string `gorm:"index" json:"action"`
+	TargetType     string `gorm:"index:idx_audit_target" json:"target_type"`
+	TargetID       string `gorm:"index:idx_audit_target" json:"target_id"`
+	// {"field": {"before": x, "after": y}} for updates, the whole object for creates and deletes
+	Changes   JSONB     `gorm:"type:jsonb" json:"changes"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	RequestID string    `gorm:"index" json:"request_id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+const (
+	AuditUserRegister       = "user.register"
+	AuditUserLogin          = "user.login"
+	AuditUserLoginFailed    = "user.login_failed"
+	AuditUserUpdate         = "user.update"
+	AuditUserPasswordChange = "user.password_change"
+	AuditUserPasswordReset  = "user.password_reset"
+	AuditUserEmailChange    = "user.email_change"
+	AuditUserDelete         = "user.delete"
+	AuditUserDisable        = "user.disable"
+	AuditUserEnable         = "user.enable"
+	AuditUserForceReset     = "user.force_password_reset"
+	AuditUserImpersonate    = "user.impersonate"
+	AuditUserCalendarToken  = "user.calendar_token"
+	AuditTaskCreate         = "task.create"
+	AuditTaskUpdate         = "task.update"
+	AuditTaskDelete         = "task.delete"
+	AuditTaskRevert         = "task.revert"
+	AuditTaskTransition     = "task.transition"
+	AuditTaskPurge          = "task.purge"
+	AuditTaskRestore        = "task.restore"
+	AuditTaskMove           = "task.move"
+	AuditTaskLabel          = "task.label"
+	AuditTaskUnlabel        = "task.unlabel"
+	AuditTaskDepend         = "task.depend"
+	AuditTaskUndepend       = "task.undepend"
+	AuditTaskAssign         = "task.assign"
+	AuditTaskUnassign       = "task.unassign"
+	AuditTaskWatch          = "task.watch"
+	AuditTaskUnwatch        = "task.unwatch"
+	AuditTaskProject        = "task.project"
+	AuditTaskRecurrence     = "task.recurrence"
+	AuditProjectCreate      = "project.create"
+	AuditProjectUpdate      = "project.update"
+	AuditProjectDelete      = "project.delete"
+	AuditProjectInvite      = "project.invite"
+	AuditProjectUninvite    = "project.uninvite"
+	AuditProjectJoin        = "project.join"
+	AuditProjectDecline     = "project.decline"
+	AuditProjectMemberRole  = "project.member_role"
+	AuditProjectMemberLeave = "project.member_remove"
+	AuditLabelCreate        = "label.create"
+	AuditLabelUpdate        = "label.update"
+	AuditLabelDelete        = "label.delete"
+	AuditChecklistCreate    = "checklist.create"
+	AuditChecklistUpdate    = "checklist.update"
+	AuditChecklistDelete    = "checklist.delete"
+	AuditCommentCreate      = "comment.create"
+	AuditCommentUpdate      = "comment.update"
+	AuditCommentDelete      = "comment.delete"
+	AuditAttachmentCreate   = "attachment.create"
+	AuditAttachmentDelete   = "attachment.delete"
+	AuditWebhookCreate      = "webhook.create"
+	AuditWebhookUpdate      = "webhook.update"
+	AuditWebhookDelete      = "webhook.delete"
+)
+
+// AuditFilter of GET /audit, zero values don't filter
+type AuditFilter struct {
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	From       time.Time
+	To         time.Time
+	Offset     int
+	Limit      int
+}
+
+type AuditEntryList struct {
+	Entries  []AuditEntry `json:"entries"`
+	Total    int64        `json:"total"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
+
+// personalFields are anonymized when the account is deleted. The audit log is append only, so entries about
+// users only tell that these fields changed, never their values.
+var personalFields = []string{"email", "name", "pending_email"}
+
+// RedactPersonal replaces the values of the personal fields of a Snapshot or a Diff with "redacted"
+func RedactPersonal(changes JSONB) JSONB {
+	if len(changes) == 0 {
+		return changes
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(changes, &fields); err != nil {
+		log.Println("Error redacting audit changes:", err)
+		return nil
+	}
+	for _, field := range personalFields {
+		if _, ok := fields[field]; ok {
+			fields[field] = "redacted"
+		}
+	}
+	b, _ := json.Marshal(fields)
+	return b
+}
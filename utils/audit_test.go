@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRedactPersonal(t *testing.T) {
+	profile := UserProfile{ID: 3, Email: "ann@example.com", Name: "Ann", CreatedAt: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)}
+	renamed := profile
+	renamed.Name = "Anne"
+
+	tests := []struct {
+		name    string
+		changes JSONB
+		want    map[string]interface{}
+	}{
+		{"snapshot", Snapshot(profile), map[string]interface{}{
+			"id": 3.0, "email": "redacted", "name": "redacted", "email_verified_at": nil,
+			"created_at": "2026-01-02T00:00:00Z",
+		}},
+		{"diff", Diff(profile, renamed), map[string]interface{}{"name": "redacted"}},
+		{"pending email", Diff(map[string]string{"pending_email": ""}, map[string]string{"pending_email": "new@example.com"}), map[string]interface{}{"pending_email": "redacted"}},
+		{"other fields are kept", Snapshot(map[string]interface{}{"expires_at": "2026-01-02T00:00:00Z"}), map[string]interface{}{"expires_at": "2026-01-02T00:00:00Z"}},
+	}
+	for _, tt := range tests {
+		var got map[string]interface{}
+		if err := json.Unmarshal(RedactPersonal(tt.changes), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: RedactPersonal() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := RedactPersonal(nil); got != nil {
+		t.Errorf("RedactPersonal(nil) = %s, want nil", got)
+	}
+}
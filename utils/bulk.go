@@ -0,0 +1,49 @@
+package utils
+
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+const (
+	// BulkAtomic applies every operation or none
+	BulkAtomic = "atomic"
+	// BulkBestEffort applies the operations that succeed and reports the others
+	BulkBestEffort = "best_effort"
+)
+
+// BulkRequest of POST /tasks/bulk, mode is atomic by default
+type BulkRequest struct {
+	Mode       string          `json:"mode"`
+	Operations []BulkOperation `json:"operations"`
+}
+
+// BulkOperation creates Task, updates task ID with the non empty fields of Task or deletes task ID.
+// Version works like If-Match for update and delete, 0 doesn't check it.
+type BulkOperation struct {
+	Op      string `json:"op"`
+	ID      uint   `json:"id,omitempty"`
+	Version int    `json:"version,omitempty"`
+	Force   bool   `json:"force,omitempty"`
+	Task    *Task  `json:"task,omitempty"`
+}
+
+// BulkResult is the outcome of the operation at Index, Status is the one the single request would get
+type BulkResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	ID     uint   `json:"id,omitempty"`
+	Task   *Task  `json:"task,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Mode string `json:"mode"`
+	// false when an atomic request was rolled back
+	Applied   bool         `json:"applied"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
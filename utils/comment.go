@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Comment on a task. Body is Markdown as written by the author, BodyHTML is rendered from it on every read.
+type Comment struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	TaskID uint `gorm:"index;not null" json:"task_id"`
+	// the author stays after the user is deleted, shown as "Deleted User"
+	AuthorID   uint   `gorm:"index;not null" json:"author_id"`
+	AuthorName string `gorm:"->;-:migration" json:"author_name"`
+	Body       string `gorm:"not null" json:"body"`
+	BodyHTML   string `gorm:"-" json:"body_html"`
+	// nil until the body is edited
+	EditedAt  *time.Time `json:"edited_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (c *Comment) AfterFind(tx *gorm.DB) error {
+	c.BodyHTML = RenderMarkdown(c.Body)
+	return nil
+}
+
+func (c *Comment) AfterSave(tx *gorm.DB) error {
+	c.BodyHTML = RenderMarkdown(c.Body)
+	return nil
+}
+
+// MaxCommentLength is the limit of a comment body in bytes
+const MaxCommentLength = 10000
+
+type CommentRequest struct {
+	Body string `json:"body" validate:"required,max=10000"`
+}
+
+// CommentList is a page of GET /tasks/:id/comments, oldest first
+type CommentList struct {
+	Comments []Comment `json:"comments"`
+	Total    int64     `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+}
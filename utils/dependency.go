@@ -0,0 +1,14 @@
+package utils
+
+import "time"
+
+// TaskDependency says that TaskID can't be done while BlockedByID is open
+type TaskDependency struct {
+	TaskID      uint      `gorm:"primaryKey;autoIncrement:false" json:"task_id"`
+	BlockedByID uint      `gorm:"primaryKey;autoIncrement:false;index" json:"blocked_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type DependencyRequest struct {
+	BlockedByID uint `json:"blocked_by_id" validate:"required"`
+}
@@ -0,0 +1,94 @@
+package utils
+
+import "time"
+
+// Request bodies that are not a model
+
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type TokenRequest struct {
+	Token string `json:"token" form:"token" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" form:"token" validate:"required"`
+	Password string `json:"password" form:"password" validate:"required"`
+}
+
+type UpdateProfileRequest struct {
+	Name *string `json:"name" validate:"omitempty,fullname"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// Response bodies
+
+// UserProfile is the user without the password hash
+type UserProfile struct {
+	ID              uint       `json:"id"`
+	Email           string     `json:"email"`
+	Name            string     `json:"name"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PendingEmail    string     `json:"pending_email,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func NewUserProfile(user *User) UserProfile {
+	return UserProfile{
+		ID:              user.ID,
+		Email:           user.Email,
+		Name:            user.Name,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		PendingEmail:    user.PendingEmail,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}
+}
+
+// AdminUser is what admins see of a user
+type AdminUser struct {
+	UserProfile
+	IsAdmin    bool       `json:"is_admin"`
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+func NewAdminUser(user *User) AdminUser {
+	return AdminUser{
+		UserProfile: NewUserProfile(user),
+		IsAdmin:     user.IsAdmin,
+		DisabledAt:  user.DisabledAt,
+	}
+}
+
+type TaskCounts struct {
+	Total     int64 `json:"total"`
+	Completed int64 `json:"completed"`
+	Open      int64 `json:"open"`
+}
+
+type AdminUserDetail struct {
+	AdminUser
+	Tasks TaskCounts `json:"tasks"`
+}
+
+type AdminUserList struct {
+	Users    []AdminUser `json:"users"`
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+}
@@ -2,4 +2,56 @@ package utils
 
 import "errors"
 
-var ErrNotFound = errors.New("index not found")
\ No newline at end of file
+var ErrNotFound = errors.New("index not found")
+
+var ErrInvalidCredentials = errors.New("invalid email or password")
+var ErrTooManyRequests = errors.New("too many login attempts, try again later")
+var ErrAccountLocked = errors.New("account is temporarily locked, try again later")
+
+var ErrInvalidToken = errors.New("token is invalid, expired or already used")
+
+var ErrWeakPassword = errors.New("password does not meet the password policy")
+var ErrBreachedPassword = errors.New("password has appeared in a data breach, choose another one")
+
+var ErrEmailTaken = errors.New("email is already used by another account")
+
+var ErrUserDisabled = errors.New("account is disabled")
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+var ErrInvalidTransition = errors.New("status transition is not allowed")
+
+var ErrLabelExists = errors.New("you already have a label with this name")
+
+var ErrTaskCycle = errors.New("a task can't be a subtask of itself or of its subtasks")
+var ErrMaxDepth = errors.New("subtasks are nested too deep")
+var ErrParentNotFound = errors.New("parent task not found")
+var ErrParentDeleted = errors.New("the parent task is deleted, restore it first")
+var ErrRestoreExpired = errors.New("the task was deleted too long ago to be restored")
+
+var ErrDependencyCycle = errors.New("the dependency would make a cycle")
+var ErrBlockerNotFound = errors.New("blocking task not found")
+var ErrTaskBlocked = errors.New("task is blocked by open tasks, finish them first or use force=true")
+
+var ErrForbidden = errors.New("your role in the project doesn't allow this")
+var ErrLastOwner = errors.New("a project needs at least one owner")
+var ErrPersonalProject = errors.New("personal projects can't be shared or deleted")
+var ErrAlreadyMember = errors.New("the user is already a member of the project")
+var ErrEmailUnverified = errors.New("verify your email to answer invitations")
+var ErrInvitationClosed = errors.New("invitation was already answered or has expired")
+var ErrProjectMismatch = errors.New("tasks must be in the same project")
+var ErrSubtaskProject = errors.New("subtasks move with their parent, move the top level task")
+
+var ErrAssigneeNotEditor = errors.New("the assignee must be an editor of the project of the task")
+
+var ErrAttachmentTooLarge = errors.New("the file is larger than the attachment limit")
+var ErrAttachmentType = errors.New("this type of file can't be attached")
+
+var ErrExternalIDTaken = errors.New("another task of the project has this external_id")
+
+var ErrRecurrenceNeedsDue = errors.New("a recurring task needs a due date")
+
+var ErrVersionMismatch = errors.New("task was modified by someone else, fetch it again")
+
+var ErrIdempotencyInFlight = errors.New("a request with this Idempotency-Key is still being processed, retry later")
+var ErrIdempotencyMismatch = errors.New("Idempotency-Key was already used with a different request")
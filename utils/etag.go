@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TaskETag is the strong entity tag of a task version, e.g. "3"
+func TaskETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ParseTaskETag returns the version of a tag made by TaskETag. If-Match compares strongly (RFC 9110),
+// so weak W/ tags are refused.
+func ParseTaskETag(tag string) (int, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar builds an RFC 5545 iCalendar document of tasks, lines end with CRLF and are folded at 75 octets
+type Calendar struct {
+	buf bytes.Buffer
+	// right side of the UIDs, e.g. the host of the feed
+	domain string
+}
+
+func NewCalendar(name string, domain string) *Calendar {
+	c := &Calendar{domain: domain}
+	c.line("BEGIN", "VCALENDAR")
+	c.line("VERSION", "2.0")
+	c.line("PRODID", "-//go_backend_test//Task Management System//EN")
+	c.line("CALSCALE", "GREGORIAN")
+	c.line("METHOD", "PUBLISH")
+	c.line("X-WR-CALNAME", icalText(name))
+	return c
+}
+
+// icalStatuses maps the task statuses to the STATUS of a VTODO, blocked tasks still need action
+var icalStatuses = map[string]string{
+	StatusTodo:       "NEEDS-ACTION",
+	StatusInProgress: "IN-PROCESS",
+	StatusBlocked:    "NEEDS-ACTION",
+	StatusDone:       "COMPLETED",
+	StatusCancelled:  "CANCELLED",
+}
+
+// icalPriorities maps the task priorities to PRIORITY, 1 is the highest
+var icalPriorities = map[string]int{
+	PriorityUrgent: 1,
+	PriorityHigh:   3,
+	PriorityMedium: 5,
+	PriorityLow:    9,
+}
+
+// AddTodo adds the task as a VTODO. The DTSTAMP is the last change of the task so the document
+// only changes with the tasks, tasks don't keep their completion time so COMPLETED is the last change too.
+func (c *Calendar) AddTodo(task *Task) {
+	c.line("BEGIN", "VTODO")
+	c.line("UID", fmt.Sprintf("task-%d@%s", task.ID, c.domain))
+	c.taskProperties(task)
+	if task.DueAt != nil {
+		c.line("DUE", icalTime(*task.DueAt))
+	}
+	c.line("STATUS", icalStatuses[task.Status])
+	if task.Status == StatusDone {
+		c.line("COMPLETED", icalTime(task.UpdatedAt))
+		c.line("PERCENT-COMPLETE", "100")
+	}
+	if priority, ok := icalPriorities[task.Priority]; ok {
+		c.line("PRIORITY", fmt.Sprint(priority))
+	}
+	c.line("END", "VTODO")
+}
+
+// AddEvent adds the due date of the task as a VEVENT for calendars that don't show VTODO. It has no
+// DTEND so it takes no time, and it doesn't make anyone busy.
+func (c *Calendar) AddEvent(task *Task) {
+	if task.DueAt == nil {
+		return
+	}
+	c.line("BEGIN", "VEVENT")
+	c.line("UID", fmt.Sprintf("task-%d-due@%s", task.ID, c.domain))
+	c.taskProperties(task)
+	c.line("DTSTART", icalTime(*task.DueAt))
+	c.line("TRANSP", "TRANSPARENT")
+	if task.Status == StatusCancelled {
+		c.line("STATUS", "CANCELLED")
+	} else {
+		c.line("STATUS", "CONFIRMED")
+	}
+	c.line("END", "VEVENT")
+}
+
+func (c *Calendar) taskProperties(task *Task) {
+	c.line("DTSTAMP", icalTime(task.UpdatedAt))
+	c.line("CREATED", icalTime(task.CreatedAt))
+	c.line("LAST-MODIFIED", icalTime(task.UpdatedAt))
+	c.line("SEQUENCE", fmt.Sprint(task.Version-1))
+	c.line("SUMMARY", icalText(task.Title))
+	if task.Description != "" {
+		c.line("DESCRIPTION", icalText(task.Description))
+	}
+}
+
+// Bytes ends the calendar and returns the document, nothing can be added afterwards
+func (c *Calendar) Bytes() []byte {
+	c.line("END", "VCALENDAR")
+	return c.buf.Bytes()
+}
+
+// line writes a content line folded at 75 octets, continuation lines start with a space.
+// Folds never split a UTF-8 character.
+func (c *Calendar) line(name string, value string) {
+	line := name + ":" + value
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		c.buf.WriteString(line[:cut])
+		c.buf.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space counts
+		limit = 74
+	}
+	c.buf.WriteString(line)
+	c.buf.WriteString("\r\n")
+}
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icalText escapes a TEXT value
+func icalText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCalendarFoldsLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+	}{
+		{"ascii", strings.Repeat("abcdefghij", 20)},
+		// 3 bytes each, 75 is no multiple of the rune length after "SUMMARY:"
+		{"multi-byte", strings.Repeat("ทดสอบ", 30)},
+		{"mixed", "x" + strings.Repeat("é漢🙂", 40)},
+		{"short", "Pay rent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCalendar("Tasks", "example.com")
+			c.AddTodo(&Task{Title: tt.title, Status: StatusTodo, Version: 1})
+			doc := string(c.Bytes())
+			if !strings.HasSuffix(doc, "END:VCALENDAR\r\n") {
+				t.Fatalf("document doesn't end with a CRLF terminated END:VCALENDAR")
+			}
+
+			for _, line := range strings.Split(strings.TrimSuffix(doc, "\r\n"), "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("line of %d octets: %q", len(line), line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("fold splits a character: %q", line)
+				}
+			}
+
+			// unfolding gives the property back
+			unfolded := strings.ReplaceAll(doc, "\r\n ", "")
+			if !strings.Contains(unfolded, "\r\nSUMMARY:"+tt.title+"\r\n") {
+				t.Errorf("unfolded document has no SUMMARY:%s", tt.title)
+			}
+		})
+	}
+}
+
+func TestIcalText(t *testing.T) {
+	for in, want := range map[string]string{
+		`C:\temp`:            `C:\\temp`,
+		"milk; eggs, bread":  `milk\; eggs\, bread`,
+		"line 1\nline 2":     `line 1\nline 2`,
+		"line 1\r\nline 2":   `line 1\nline 2`,
+		"line 1\rline 2":     `line 1\nline 2`,
+		`\;`:                 `\\\;`,
+		"no special chars: ": "no special chars: ",
+	} {
+		if got := icalText(in); got != want {
+			t.Errorf("icalText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCalendarTodo(t *testing.T) {
+	due := time.Date(2026, 10, 2, 9, 30, 0, 0, time.FixedZone("ICT", 7*60*60))
+	task := &Task{Title: "Call, then write", Description: "a;b", Status: StatusDone, Priority: PriorityUrgent, DueAt: &due, Version: 3}
+	task.ID = 5
+	task.UpdatedAt = time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+
+	c := NewCalendar("Ann's tasks, all", "example.com")
+	c.AddTodo(task)
+	doc := string(c.Bytes())
+	for _, line := range []string{
+		`X-WR-CALNAME:Ann's tasks\, all`,
+		"UID:task-5@example.com",
+		`SUMMARY:Call\, then write`,
+		`DESCRIPTION:a\;b`,
+		"DUE:20261002T023000Z",
+		"STATUS:COMPLETED",
+		"COMPLETED:20261001T080000Z",
+		"PRIORITY:1",
+		"SEQUENCE:2",
+	} {
+		if !strings.Contains(doc, "\r\n"+line+"\r\n") {
+			t.Errorf("document has no line %q:\n%s", line, doc)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+	"time"
+)
+
+// IdempotencyRecord is the stored response of a POST sent with an Idempotency-Key header.
+// Keys are per client (Scope is a hash of its credentials, or of the IP and route of an anonymous request),
+// a record without CompletedAt is still in flight.
+type IdempotencyRecord struct {
+	Scope       string `gorm:"primaryKey"`
+	Key         string `gorm:"primaryKey"`
+	RequestHash string `gorm:"not null"`
+	Status      int
+	Body        []byte
+	ContentType string
+	ETag        string
+	Location    string
+	CompletedAt *time.Time
+	ExpiresAt   time.Time `gorm:"index;not null"`
+	CreatedAt   time.Time
+}
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key accepted
+const MaxIdempotencyKeyLength = 255
+
+// IdempotentPath tells if Idempotency-Key is honoured on a POST route. Responses carrying tokens or secrets
+// (login, impersonation, webhook secrets, calendar feed tokens) are never stored, admin actions are idempotent
+// by themselves.
+func IdempotentPath(path string) bool {
+	switch path {
+	case "/login", "/webhooks", "/me/calendar", "/admin":
+		return false
+	}
+	return !strings.HasPrefix(path, "/admin/")
+}
@@ -0,0 +1,19 @@
+package utils
+
+import "testing"
+
+func TestIdempotentPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/tasks":                true,
+		"/tasks/3/comments":     true,
+		"/webhooks/3/test":      true,
+		"/login":                false,
+		"/webhooks":             false,
+		"/me/calendar":          false,
+		"/admin/users/3/enable": false,
+	} {
+		if got := IdempotentPath(path); got != want {
+			t.Errorf("IdempotentPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
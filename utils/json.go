@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// JSONB is raw JSON stored in a jsonb column, it is written to API responses as is
+type JSONB []byte
+
+func (j JSONB) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j *JSONB) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append(JSONB(nil), v...)
+	case string:
+		*j = JSONB(v)
+	default:
+		return errors.New("unsupported type for JSONB")
+	}
+	return nil
+}
+
+func (j JSONB) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+func (j *JSONB) UnmarshalJSON(data []byte) error {
+	*j = append(JSONB(nil), data...)
+	return nil
+}
+
+// fields never written to the audit log and task revisions
+var redactedFields = map[string]bool{"password": true, "Password": true, "token": true}
+
+// Snapshot is the JSON of the object without redacted fields, used as Changes of creates and deletes
+func Snapshot(v interface{}) JSONB {
+	fields, err := toFields(v)
+	if err != nil {
+		log.Println("Error taking snapshot:", err)
+		return nil
+	}
+	b, _ := json.Marshal(fields)
+	return b
+}
+
+// Diff returns {"field": {"before": x, "after": y}} of the JSON fields that differ
+func Diff(before, after interface{}) JSONB {
+	beforeFields, err := toFields(before)
+	if err != nil {
+		log.Println("Error diffing:", err)
+		return nil
+	}
+	afterFields, err := toFields(after)
+	if err != nil {
+		log.Println("Error diffing:", err)
+		return nil
+	}
+
+	changes := map[string]map[string]interface{}{}
+	for key, value := range afterFields {
+		if !reflect.DeepEqual(beforeFields[key], value) {
+			changes[key] = map[string]interface{}{"before": beforeFields[key], "after": value}
+		}
+	}
+	for key, value := range beforeFields {
+		if _, ok := afterFields[key]; !ok {
+			changes[key] = map[string]interface{}{"before": value, "after": nil}
+		}
+	}
+
+	b, _ := json.Marshal(changes)
+	return b
+}
+
+// toFields turns a struct into its JSON fields, skipping timestamps that change on every write and redacted fields
+func toFields(v interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if v == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	for key := range fields {
+		if redactedFields[key] || key == "UpdatedAt" || key == "updated_at" || strings.EqualFold(key, "User") {
+			delete(fields, key)
+		}
+	}
+	return fields, nil
+}
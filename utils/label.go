@@ -0,0 +1,25 @@
+package utils
+
+import "time"
+
+// Label belongs to a user, names are unique per user. Tasks and labels are joined by the task_labels table.
+type Label struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_label_user_name;not null" json:"-"`
+	Name      string    `gorm:"uniqueIndex:idx_label_user_name;not null" json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// DefaultLabelColor is used when a label is created without a color
+const DefaultLabelColor = "#808080"
+
+type LabelRequest struct {
+	Name  string `json:"name" validate:"required,max=50"`
+	Color string `json:"color" validate:"omitempty,hexcolor"`
+}
+
+type AttachLabelsRequest struct {
+	LabelIDs []uint `json:"label_ids" validate:"required,min=1"`
+}
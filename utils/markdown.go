@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// RenderMarkdown renders the small Markdown subset of comments: paragraphs, headings, "-" lists, ``` code blocks,
+// `code`, **bold**, *italic*, [links](https://...) and @mentions. The source is HTML escaped before anything
+// else, so raw HTML is shown as text and the output can be inserted in a page as is.
+func RenderMarkdown(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph []string
+	inList := false
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if inList {
+			out.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flushParagraph()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, html.EscapeString(lines[i]))
+			}
+			out.WriteString("<pre><code>" + strings.Join(code, "\n") + "</code></pre>\n")
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case headingPattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			flushParagraph()
+			if !inList {
+				out.WriteString("<ul>\n")
+				inList = true
+			}
+			out.WriteString("<li>" + renderInline(strings.TrimSpace(trimmed[2:])) + "</li>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, renderInline(trimmed))
+		}
+	}
+	flushParagraph()
+	closeList()
+
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.+)$`)
+	codePattern    = regexp.MustCompile("`([^`]+)`")
+	linkPattern    = regexp.MustCompile(`\[([^\]]+)\]\(((?:https?://|mailto:)[^\s()]+)\)`)
+	boldPattern    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicPattern  = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	// @ followed by the email address of the user, e.g. @jane@example.com
+	mentionPattern = regexp.MustCompile(`(^|[^\w.@])@([A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+)`)
+)
+
+// renderInline formats one line, code spans are left as they are
+func renderInline(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range codePattern.FindAllStringIndex(text, -1) {
+		out.WriteString(formatText(text[last:loc[0]]))
+		out.WriteString("<code>" + html.EscapeString(text[loc[0]+1:loc[1]-1]) + "</code>")
+		last = loc[1]
+	}
+	out.WriteString(formatText(text[last:]))
+	return out.String()
+}
+
+// formatText renders the links of a line, their URLs are written as they are and only the text around them
+// and the link texts get the other formats
+func formatText(text string) string {
+	text = html.EscapeString(text)
+
+	var out strings.Builder
+	last := 0
+	for _, m := range linkPattern.FindAllStringSubmatchIndex(text, -1) {
+		out.WriteString(formatEmphasis(text[last:m[0]]))
+		out.WriteString(`<a href="` + text[m[4]:m[5]] + `" rel="nofollow noopener" target="_blank">` + formatEmphasis(text[m[2]:m[3]]) + "</a>")
+		last = m[1]
+	}
+	out.WriteString(formatEmphasis(text[last:]))
+	return out.String()
+}
+
+func formatEmphasis(text string) string {
+	text = boldPattern.ReplaceAllString(text, "<strong>$1</strong>")
+	text = italicPattern.ReplaceAllString(text, "<em>$1</em>")
+	text = mentionPattern.ReplaceAllString(text, `$1<span class="mention">@$2</span>`)
+	return text
+}
+
+// Mentions returns the lower cased email addresses mentioned in a comment body, without duplicates.
+// Like in the rendered body, an address in the URL of a link is no mention.
+func Mentions(body string) []string {
+	emails := []string{}
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(linkPattern.ReplaceAllString(body, "[$1]"), -1) {
+		email := strings.ToLower(m[2])
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRenderMarkdownLinks(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{
+			"see [the **docs**](https://example.com/a*b*c/__x__)",
+			`<p>see <a href="https://example.com/a*b*c/__x__" rel="nofollow noopener" target="_blank">the <strong>docs</strong></a></p>`,
+		},
+		{
+			"[profile](https://example.com/@jane@example.com) and *more*",
+			`<p><a href="https://example.com/@jane@example.com" rel="nofollow noopener" target="_blank">profile</a> and <em>more</em></p>`,
+		},
+		{
+			"ask @jane@example.com",
+			`<p>ask <span class="mention">@jane@example.com</span></p>`,
+		},
+		{
+			`[x](javascript:alert(1)) <b>`,
+			`<p>[x](javascript:alert(1)) &lt;b&gt;</p>`,
+		},
+	}
+	for _, tt := range tests {
+		if got := RenderMarkdown(tt.src); got != tt.want {
+			t.Errorf("RenderMarkdown(%q)\n got %s\nwant %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestMentionsSkipsLinkURLs(t *testing.T) {
+	got := Mentions("[profile](https://example.com/@jane@example.com) cc @Bob@Example.com, @bob@example.com")
+	if want := []string{"bob@example.com"}; !slices.Equal(got, want) {
+		t.Errorf("Mentions() = %v, want %v", got, want)
+	}
+}
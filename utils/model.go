@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -19,12 +20,86 @@ type Model struct {
 type Task struct {
 	//ID          int       `json:"id"`
 	gorm.Model
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Completed   bool      `json:"completed"`
-	CreatedAt   time.Time `json:"created_at"`
-	UserID      int
-	User        User
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Status      string `gorm:"not null;default:todo;index" json:"status"`
+	// derived from Status (true when done), kept for clients from before statuses
+	Completed bool      `json:"completed"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int
+	User      User
+	// nil when nobody is assigned, only changed with PUT and DELETE /tasks/:id/assignee
+	AssigneeID *uint `gorm:"index" json:"assignee_id"`
+	// nil when the task has no deadline
+	DueAt    *time.Time `gorm:"index" json:"due_at"`
+	Priority string     `gorm:"not null;default:medium;index" json:"priority"`
+	// minutes before DueAt at which a reminder is sent, e.g. [1440, 60]
+	ReminderOffsets IntList `gorm:"type:jsonb" json:"reminder_offsets"`
+	// labels of any user, attached with POST /tasks/:id/labels. Writes of the task never touch them.
+	Labels []Label `gorm:"many2many:task_labels;" json:"labels"`
+	// project the task is shared in, only changed with PUT /tasks/:id/project
+	ProjectID uint `gorm:"index" json:"project_id"`
+	// nil for top level tasks, only changed with PUT /tasks/:id/parent
+	ParentID *uint `gorm:"index" json:"parent_id"`
+	// computed by the task service, nil when not loaded
+	Progress *TaskProgress `gorm:"-" json:"progress"`
+	// bumped by the repository on every change, sent to clients as the ETag
+	Version int    `gorm:"not null;default:1" json:"version"`
+	ETag    string `gorm:"-" json:"etag"`
+	// id of the task in the system it was imported from, unique in the project. Only set on create.
+	ExternalID *string `json:"external_id"`
+	// RRULE of a recurring task, closing it creates the next occurrence. Only set on create and with
+	// PUT and DELETE /tasks/:id/recurrence, see rrule.go.
+	Recurrence string `json:"recurrence"`
+	// IANA time zone the rule is evaluated in, UTC when empty
+	Timezone string `json:"timezone"`
+	// when the rule scheduled this occurrence, moving DueAt of one occurrence doesn't move the next ones
+	ScheduledAt *time.Time `json:"scheduled_at"`
+	// number of the occurrence in its series, from 1, for COUNT
+	Occurrence int `gorm:"not null;default:1" json:"occurrence"`
+	// the occurrence this one was created from, each occurrence has at most one next
+	PreviousOccurrenceID *uint `gorm:"uniqueIndex" json:"previous_occurrence_id"`
+	// set by the task service on the response that closed the occurrence
+	NextOccurrence *Task `gorm:"-" json:"next_occurrence,omitempty"`
+	// the request body had completed, see CompletedSent
+	completedSent bool
+}
+
+// UnmarshalJSON notes whether completed was sent, a body with completed=false reopens a done task
+func (t *Task) UnmarshalJSON(data []byte) error {
+	type task Task
+	body := struct {
+		*task
+		Completed *bool `json:"completed"`
+	}{task: (*task)(t)}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	t.completedSent = body.Completed != nil
+	if body.Completed != nil {
+		t.Completed = *body.Completed
+	}
+	return nil
+}
+
+// CompletedSent is true when the task was decoded from a body that had completed
+func (t *Task) CompletedSent() bool {
+	return t.completedSent
+}
+
+// ETag is filled after every read so list items carry it too.
+// It runs after the preloads, tasks without labels get an empty list instead of null.
+func (t *Task) AfterFind(tx *gorm.DB) error {
+	t.ETag = TaskETag(t.Version)
+	if t.Labels == nil {
+		t.Labels = []Label{}
+	}
+	return nil
+}
+
+func (t *Task) AfterSave(tx *gorm.DB) error {
+	t.ETag = TaskETag(t.Version)
+	return nil
 }
 
 // Now GORM knows UserID is foreign key by struct and stuctID!
@@ -35,9 +110,48 @@ type User struct {
 	Email    string `gorm:"unique" json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 	Name     string `json:"name" validate:"required,fullname"`
+	// nil until the user opens the link of the verification email
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// new address waiting for verification, Email is only replaced once it is verified
+	PendingEmail string `json:"-"`
+	// bumped to revoke every JWT issued before, compared with the token_version claim
+	TokenVersion int  `json:"-"`
+	IsAdmin      bool `json:"-"`
+	// disabled users can't log in and their tokens are rejected
+	DisabledAt *time.Time `json:"-"`
+	// SHA-256 of the token of the calendar feed URL, nil when the feed is off
+	CalendarTokenHash *string `gorm:"uniqueIndex" json:"-"`
   //Age      int    `json:"age" validate:"required,numeric,min=1"`
 }
 
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+	TokenPurposeChangeEmail   = "change_email"
+)
+
+// UserToken is a single use token sent by email. Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	Purpose   string `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// LoginAttempt is the audit record of a login, Email is what the client sent so it may not belong to any user
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"index" json:"email"`
+	IP        string    `gorm:"index" json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 /* example
 type Book struct {
   gorm.Model
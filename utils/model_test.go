@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTaskCompletedSent(t *testing.T) {
+	tests := []struct {
+		body          string
+		completed     bool
+		completedSent bool
+	}{
+		{`{"title": "a"}`, false, false},
+		{`{"completed": false}`, false, true},
+		{`{"completed": true, "title": "a"}`, true, true},
+	}
+	for _, tt := range tests {
+		task := new(Task)
+		if err := json.Unmarshal([]byte(tt.body), task); err != nil {
+			t.Fatal(err)
+		}
+		if task.Completed != tt.completed || task.CompletedSent() != tt.completedSent {
+			t.Errorf("%s: completed %v, sent %v", tt.body, task.Completed, task.CompletedSent())
+		}
+	}
+
+	task := new(Task)
+	if err := json.Unmarshal([]byte(`{"title": "a", "due_at": "2026-01-02T15:00:00Z", "reminder_offsets": [60]}`), task); err != nil {
+		t.Fatal(err)
+	}
+	if task.Title != "a" || task.DueAt == nil || len(task.ReminderOffsets) != 1 {
+		t.Errorf("the other fields were not decoded: %+v", task)
+	}
+}
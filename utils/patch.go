@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ApplyPatch applies a JSON merge patch (RFC 7396) to the fields. Keys that are not a field are ignored like on PUT,
+// null clears due_at, reminder_offsets, title and description. completed only counts without status:
+// true closes the task as done and false reopens a done task as todo.
+func (f *TaskFields) ApplyPatch(patch map[string]json.RawMessage) error {
+	for key, value := range patch {
+		null := string(value) == "null"
+		var err error
+		switch key {
+		case "title":
+			f.Title = ""
+			if !null {
+				err = json.Unmarshal(value, &f.Title)
+			}
+		case "description":
+			f.Description = ""
+			if !null {
+				err = json.Unmarshal(value, &f.Description)
+			}
+		case "status":
+			err = unmarshalNotNull(value, &f.Status)
+		case "priority":
+			err = unmarshalNotNull(value, &f.Priority)
+		case "due_at":
+			f.DueAt = nil
+			if !null {
+				dueAt := new(time.Time)
+				if err = json.Unmarshal(value, dueAt); err == nil {
+					f.DueAt = dueAt
+				}
+			}
+		case "reminder_offsets":
+			f.ReminderOffsets = nil
+			if !null {
+				err = json.Unmarshal(value, &f.ReminderOffsets)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	if value, ok := patch["completed"]; ok {
+		var completed bool
+		if err := unmarshalNotNull(value, &completed); err != nil {
+			return fmt.Errorf("completed: %w", err)
+		}
+		if _, ok := patch["status"]; !ok {
+			if completed {
+				f.Status = StatusDone
+			} else if f.Status == StatusDone {
+				f.Status = StatusTodo
+			}
+		}
+	}
+	f.Completed = f.Status == StatusDone
+	return nil
+}
+
+func unmarshalNotNull(value json.RawMessage, v any) error {
+	if string(value) == "null" {
+		return fmt.Errorf("can't be null")
+	}
+	return json.Unmarshal(value, v)
+}
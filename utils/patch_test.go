@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestApplyPatch(t *testing.T) {
+	due := time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)
+	current := TaskFields{Title: "Report", Status: StatusDone, Completed: true, DueAt: &due, Priority: PriorityHigh, ReminderOffsets: IntList{60}}
+
+	tests := []struct {
+		name    string
+		patch   string
+		check   func(f TaskFields) bool
+		wantErr bool
+	}{
+		{"null clears due_at", `{"due_at": null}`, func(f TaskFields) bool { return f.DueAt == nil && f.Title == "Report" }, false},
+		{"null clears reminders", `{"reminder_offsets": null}`, func(f TaskFields) bool { return f.ReminderOffsets == nil && f.DueAt != nil }, false},
+		{"missing keys are kept", `{"title": "Final report"}`, func(f TaskFields) bool { return f.Title == "Final report" && f.Priority == PriorityHigh }, false},
+		{"completed false reopens", `{"completed": false}`, func(f TaskFields) bool { return f.Status == StatusTodo && !f.Completed }, false},
+		{"status wins over completed", `{"completed": false, "status": "cancelled"}`, func(f TaskFields) bool { return f.Status == StatusCancelled && !f.Completed }, false},
+		{"unknown keys are ignored", `{"project_id": 7}`, func(f TaskFields) bool { return f.Title == "Report" && f.Status == StatusDone }, false},
+		{"status can't be null", `{"status": null}`, nil, true},
+		{"wrong type", `{"due_at": 5}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+			f := current
+			err := f.ApplyPatch(patch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.check(f) {
+				t.Errorf("ApplyPatch(%s) = %+v", tt.patch, f)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package utils
+
+import "time"
+
+const (
+	ProjectRoleOwner  = "owner"
+	ProjectRoleEditor = "editor"
+	ProjectRoleViewer = "viewer"
+)
+
+// ProjectRoles in ascending order, a role can do everything the roles before it can
+var ProjectRoles = []string{ProjectRoleViewer, ProjectRoleEditor, ProjectRoleOwner}
+
+func ValidProjectRole(role string) bool {
+	return ProjectRoleRank(role) >= 0
+}
+
+// ProjectRoleRank is the index of the role in ProjectRoles, -1 for unknown roles
+func ProjectRoleRank(role string) int {
+	for i, r := range ProjectRoles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Project groups tasks shared by its members. Every user gets a personal project, it can't be shared or deleted.
+type Project struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null" json:"name"`
+	Description string    `json:"description"`
+	Personal    bool      `gorm:"not null;default:false" json:"personal"`
+	OwnerID     uint      `gorm:"index;not null" json:"owner_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// role of the current user, filled by the project repository
+	Role string `gorm:"->;-:migration" json:"role,omitempty"`
+}
+
+type ProjectMember struct {
+	ProjectID uint      `gorm:"primaryKey;autoIncrement:false" json:"project_id"`
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false;index" json:"user_id"`
+	User      User      `json:"-"`
+	Role      string    `gorm:"not null" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	// filled from User for the member list
+	Name  string `gorm:"-" json:"name"`
+	Email string `gorm:"-" json:"email"`
+}
+
+// ProjectInvitation is addressed to an email, the user with that email accepts or declines it once logged in
+type ProjectInvitation struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ProjectID   uint       `gorm:"index;not null" json:"project_id"`
+	Project     Project    `json:"-"`
+	Email       string     `gorm:"index;not null" json:"email"`
+	Role        string     `gorm:"not null" json:"role"`
+	InvitedByID uint       `json:"invited_by_id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	DeclinedAt  *time.Time `json:"declined_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// filled for the invitee
+	ProjectName string `gorm:"-" json:"project_name,omitempty"`
+}
+
+type ProjectRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type MemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+// MoveProjectRequest of PUT /tasks/:id/project
+type MoveProjectRequest struct {
+	ProjectID uint `json:"project_id" validate:"required"`
+}
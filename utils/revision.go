@@ -0,0 +1,74 @@
+package utils
+
+import "time"
+
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRevert  = "revert"
+	RevisionRestore = "restore"
+	RevisionMove    = "move"
+)
+
+// TaskRevision is written by the task repository on every mutation of a task.
+// Snapshot holds the TaskFields after the mutation (before it for a delete), so reverting to
+// a revision restores its snapshot.
+type TaskRevision struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	TaskID   uint   `gorm:"uniqueIndex:idx_task_revision" json:"task_id"`
+	Revision int    `gorm:"uniqueIndex:idx_task_revision" json:"revision"`
+	Action   string `json:"action"`
+	// nil when the system changed the task (cleanup job)
+	AuthorID  *uint     `json:"author_id"`
+	Snapshot  JSONB     `gorm:"type:jsonb" json:"snapshot"`
+	Changes   JSONB     `gorm:"type:jsonb" json:"changes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TaskFields are the user editable fields of a task, the ones kept in revisions
+type TaskFields struct {
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	Completed       bool       `json:"completed"`
+	Status          string     `json:"status"`
+	DueAt           *time.Time `json:"due_at"`
+	Priority        string     `json:"priority"`
+	ReminderOffsets IntList    `json:"reminder_offsets"`
+}
+
+// TaskFieldColumns are the columns of TaskFields, used to write all of them including zero values
+var TaskFieldColumns = []string{"title", "description", "completed", "status", "due_at", "priority", "reminder_offsets"}
+
+func (t *Task) Fields() TaskFields {
+	return TaskFields{
+		Title:           t.Title,
+		Description:     t.Description,
+		Completed:       t.Completed,
+		Status:          t.Status,
+		DueAt:           t.DueAt,
+		Priority:        t.Priority,
+		ReminderOffsets: t.ReminderOffsets,
+	}
+}
+
+func (t *Task) ApplyFields(f TaskFields) {
+	t.Title = f.Title
+	t.Description = f.Description
+	// revisions older than statuses only have completed
+	t.Status = f.Status
+	if t.Status == "" {
+		t.Status = StatusTodo
+		if f.Completed {
+			t.Status = StatusDone
+		}
+	}
+	t.Completed = t.Status == StatusDone
+	t.DueAt = f.DueAt
+	t.Priority = f.Priority
+	// revisions older than priorities don't have one
+	if t.Priority == "" {
+		t.Priority = PriorityMedium
+	}
+	t.ReminderOffsets = f.ReminderOffsets
+}
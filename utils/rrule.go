@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// MaxRecurrenceInterval is the largest INTERVAL of a rule
+const MaxRecurrenceInterval = 1000
+
+// periods Next looks through before giving up, e.g. a monthly rule on the 31st with BYDAY that never matches
+const maxRecurrencePeriods = 5000
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// RRuleDay is a BYDAY entry, N is the nth weekday of the month (negative from the end), 0 for every one
+type RRuleDay struct {
+	N   int
+	Day time.Weekday
+}
+
+// RRule is the subset of the RFC 5545 recurrence rule tasks support: FREQ=DAILY, WEEKLY or MONTHLY with
+// INTERVAL, BYDAY (with an ordinal like 1MO or -1FR for MONTHLY), and UNTIL or COUNT.
+type RRule struct {
+	Freq     string
+	Interval int
+	ByDay    []RRuleDay
+	Until    *time.Time
+	Count    int
+}
+
+// ParseRRule parses a rule like FREQ=WEEKLY;BYDAY=MO,WE, a leading RRULE: is allowed. A date only UNTIL
+// is the end of that day in loc.
+func ParseRRule(s string, loc *time.Location) (*RRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	rule := &RRule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid recurrence part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s is repeated in the recurrence", name)
+		}
+		seen[name] = true
+
+		switch name {
+		case "FREQ":
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly {
+				return nil, errors.New("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+			rule.Freq = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > MaxRecurrenceInterval {
+				return nil, fmt.Errorf("INTERVAL must be from 1 to %d", MaxRecurrenceInterval)
+			}
+			rule.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return nil, errors.New("COUNT must be a positive number")
+			}
+			rule.Count = count
+		case "UNTIL":
+			until, err := parseRRuleUntil(value, loc)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				entry, err := parseRRuleDay(day)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, entry)
+			}
+		case "WKST":
+			// weeks always start on Monday
+			if value != "MO" {
+				return nil, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("%s is not supported, use FREQ, INTERVAL, BYDAY, UNTIL and COUNT", name)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if rule.Count != 0 && rule.Until != nil {
+		return nil, errors.New("use either UNTIL or COUNT")
+	}
+	for _, entry := range rule.ByDay {
+		if entry.N != 0 && rule.Freq != FreqMonthly {
+			return nil, errors.New("BYDAY ordinals like 1MO are only for FREQ=MONTHLY")
+		}
+	}
+	// the days of a week in their order, the week starts on Monday
+	slices.SortFunc(rule.ByDay, func(a, b RRuleDay) int {
+		return weekdayIndex(a.Day) - weekdayIndex(b.Day)
+	})
+	return rule, nil
+}
+
+func parseRRuleDay(s string) (RRuleDay, error) {
+	if len(s) < 2 {
+		return RRuleDay{}, fmt.Errorf("invalid BYDAY %q", s)
+	}
+	day, ok := rruleWeekdays[s[len(s)-2:]]
+	if !ok {
+		return RRuleDay{}, fmt.Errorf("invalid BYDAY %q", s)
+	}
+	entry := RRuleDay{Day: day}
+	if ordinal := s[:len(s)-2]; ordinal != "" {
+		n, err := strconv.Atoi(ordinal)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return RRuleDay{}, fmt.Errorf("invalid BYDAY %q", s)
+		}
+		entry.N = n
+	}
+	return entry, nil
+}
+
+func parseRRuleUntil(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", s, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", s, loc); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, errors.New("UNTIL must be a date like 20261231 or a time like 20261231T170000Z")
+}
+
+// weekdayIndex counts from Monday
+func weekdayIndex(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// Next is the first occurrence after anchor, which is an occurrence of the rule itself. The periods
+// (days, weeks, months) are counted from the one of the anchor, so any occurrence can be the anchor.
+// Occurrences keep the wall clock time of the anchor in loc, 9:00 stays 9:00 across daylight saving time.
+// COUNT is left to the caller, false when UNTIL is reached.
+func (r *RRule) Next(anchor time.Time, loc *time.Location) (time.Time, bool) {
+	a := anchor.In(loc)
+	hour, min, sec := a.Clock()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, loc)
+	}
+
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		var candidates []time.Time
+		switch r.Freq {
+		case FreqDaily:
+			day := at(a.Year(), a.Month(), a.Day()+period*r.Interval)
+			if len(r.ByDay) == 0 || r.hasWeekday(day.Weekday()) {
+				candidates = append(candidates, day)
+			}
+		case FreqWeekly:
+			monday := a.Day() - weekdayIndex(a.Weekday()) + period*7*r.Interval
+			if len(r.ByDay) == 0 {
+				candidates = append(candidates, at(a.Year(), a.Month(), monday+weekdayIndex(a.Weekday())))
+			}
+			for _, entry := range r.ByDay {
+				candidates = append(candidates, at(a.Year(), a.Month(), monday+weekdayIndex(entry.Day)))
+			}
+		case FreqMonthly:
+			first := time.Date(a.Year(), a.Month()+time.Month(period*r.Interval), 1, 0, 0, 0, 0, loc)
+			days := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, loc).Day()
+			for day := 1; day <= days; day++ {
+				// without BYDAY the day of the month of the anchor, months too short for it are skipped
+				if (len(r.ByDay) == 0 && day == a.Day()) || r.matchesMonthDay(first.AddDate(0, 0, day-1).Weekday(), day, days) {
+					candidates = append(candidates, at(first.Year(), first.Month(), day))
+				}
+			}
+		}
+
+		for _, candidate := range candidates {
+			if !candidate.After(anchor) {
+				continue
+			}
+			if r.Until != nil && candidate.After(*r.Until) {
+				return time.Time{}, false
+			}
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *RRule) hasWeekday(day time.Weekday) bool {
+	for _, entry := range r.ByDay {
+		if entry.Day == day {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthDay tells if day, a weekday of a month of days days, is in BYDAY
+func (r *RRule) matchesMonthDay(weekday time.Weekday, day int, days int) bool {
+	nth := (day-1)/7 + 1
+	nthFromEnd := -((days-day)/7 + 1)
+	for _, entry := range r.ByDay {
+		if entry.Day == weekday && (entry.N == 0 || entry.N == nth || entry.N == nthFromEnd) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecurrenceRequest of PUT /tasks/:id/recurrence
+type RecurrenceRequest struct {
+	Recurrence string `json:"recurrence" validate:"required"`
+	Timezone   string `json:"timezone"`
+}
+
+// ParseTimezone reads the time zone of a task, an empty time zone is UTC
+func ParseTimezone(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+	// Local would be the zone of the server
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "Local" {
+		return nil, fmt.Errorf("unknown timezone %q, use an IANA name like Asia/Bangkok", timezone)
+	}
+	return loc, nil
+}
+
+// ParseRecurrence reads the rule and the time zone of a task, an empty time zone is UTC
+func ParseRecurrence(recurrence string, timezone string) (*RRule, *time.Location, error) {
+	loc, err := ParseTimezone(timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	rule, err := ParseRRule(recurrence, loc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rule, loc, nil
+}
@@ -0,0 +1,20 @@
+package utils
+
+// TaskSearchResult is a task matching a search, the snippets are HTML with the matching words in <mark> tags
+type TaskSearchResult struct {
+	Task               Task    `json:"task"`
+	Rank               float64 `json:"rank"`
+	TitleSnippet       string  `json:"title_snippet"`
+	DescriptionSnippet string  `json:"description_snippet"`
+}
+
+// TaskSearchList is a page of GET /tasks/search, best match first
+type TaskSearchList struct {
+	Results  []TaskSearchResult `json:"results"`
+	Total    int64              `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+}
+
+// MaxSearchLength is the limit of the q parameter of GET /tasks/search
+const MaxSearchLength = 200
@@ -0,0 +1,45 @@
+package utils
+
+import "time"
+
+// ChecklistItem is a step of a task that is too small to be a subtask
+type ChecklistItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TaskID    uint      `gorm:"index;not null" json:"task_id"`
+	Title     string    `gorm:"not null" json:"title"`
+	Done      bool      `json:"done"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ChecklistItemRequest struct {
+	Title    *string `json:"title" validate:"omitempty,min=1,max=200"`
+	Done     *bool   `json:"done"`
+	Position *int    `json:"position" validate:"omitempty,min=0"`
+}
+
+// MoveTaskRequest of PUT /tasks/:id/parent, a null parent_id makes the task top level
+type MoveTaskRequest struct {
+	ParentID *uint `json:"parent_id"`
+}
+
+// TaskProgress counts the direct subtasks (cancelled ones left out) and checklist items of a task
+type TaskProgress struct {
+	SubtasksDone   int `json:"subtasks_done"`
+	SubtasksTotal  int `json:"subtasks_total"`
+	ChecklistDone  int `json:"checklist_done"`
+	ChecklistTotal int `json:"checklist_total"`
+	Done           int `json:"done"`
+	Total          int `json:"total"`
+	Percent        int `json:"percent"`
+}
+
+func (p *TaskProgress) Sum() {
+	p.Done = p.SubtasksDone + p.ChecklistDone
+	p.Total = p.SubtasksTotal + p.ChecklistTotal
+	p.Percent = 0
+	if p.Total > 0 {
+		p.Percent = p.Done * 100 / p.Total
+	}
+}
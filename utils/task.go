@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusBlocked    = "blocked"
+	StatusDone       = "done"
+	StatusCancelled  = "cancelled"
+)
+
+// Statuses of a task, which ones can follow each other is decided by the workflow of the task service
+var Statuses = []string{StatusTodo, StatusInProgress, StatusBlocked, StatusDone, StatusCancelled}
+
+func ValidStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ClosedStatuses are the statuses of tasks nobody has to work on anymore, they never are overdue or reminded
+var ClosedStatuses = []string{StatusDone, StatusCancelled}
+
+// Priorities in ascending order, the index is used for sorting
+var Priorities = []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+func ValidPriority(priority string) bool {
+	for _, p := range Priorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
+// max number of reminders of a task and how long before the due date they can be
+const (
+	MaxReminders      = 10
+	MaxReminderOffset = 30 * 24 * 60
+)
+
+// IntList is a list of ints stored in a jsonb column
+type IntList []int
+
+func (l IntList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal([]int(l))
+	return string(b), err
+}
+
+func (l *IntList) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]int)(l))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]int)(l))
+	default:
+		return errors.New("unsupported type for IntList")
+	}
+}
+
+// TaskFilter is built from the query of GET /tasks, zero values don't filter
+type TaskFilter struct {
+	Statuses []string
+	// MemberID only lists the tasks of the projects the user is a member of
+	MemberID  uint
+	ProjectID *uint
+	// AssigneeID lists the tasks assigned to the user, Unassigned the ones without assignee
+	AssigneeID *uint
+	Unassigned bool
+	// TopLevel lists the tasks without parent, ParentID the subtasks of a task
+	TopLevel   bool
+	ParentID   *uint
+	Priorities []string
+	// label names of LabelOwnerID, tasks need any of them or all of them with LabelMatchAll
+	Labels        []string
+	LabelMatchAll bool
+	LabelOwnerID  uint
+	Completed     *bool
+	DueBefore     *time.Time
+	DueAfter      *time.Time
+	// only tasks with a due date
+	HasDue bool
+	// not closed and due before now
+	Overdue bool
+	// one of TaskSorts, "-" prefix for descending
+	Sort string
+}
+
+// TaskListStats are enough to tell if a list of tasks changed without reading it, deleting a task
+// changes Count, any other change LastModified
+type TaskListStats struct {
+	Count        int64
+	LastModified time.Time
+	// Versions adds up the versions of the tasks, labels and dependencies bump them without touching updated_at
+	Versions int64
+	// Projects lists the projects of the MemberID of the filter, joining or leaving one changes the list
+	// without changing the tasks
+	Projects string
+}
+
+// TaskSorts are the accepted ?sort= values without the "-" prefix
+var TaskSorts = []string{"created_at", "due_at", "priority", "title"}
+
+type TransitionRequest struct {
+	Status string `json:"status" validate:"required"`
+}
+
+// TaskReminder is created by the task repository for every reminder offset of a task with a due date.
+// SentAt is set by the reminder job once the notification went out.
+type TaskReminder struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TaskID    uint       `gorm:"index" json:"task_id"`
+	Task      Task       `json:"-"`
+	Offset    int        `json:"offset"` // minutes before the due date
+	RemindAt  time.Time  `gorm:"index" json:"remind_at"`
+	SentAt    *time.Time `json:"sent_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
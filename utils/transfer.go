@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formats of GET /tasks/export and POST /tasks/import
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// MaxExternalIDLength is the longest external_id of a task
+const MaxExternalIDLength = 255
+
+// TaskRecord is a task as exported and imported. The CSV columns are the json names, see TaskColumns.
+type TaskRecord struct {
+	ID              uint       `json:"id,omitempty"`
+	ExternalID      string     `json:"external_id"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	Status          string     `json:"status"`
+	Priority        string     `json:"priority"`
+	DueAt           *time.Time `json:"due_at"`
+	AssigneeID      *uint      `json:"assignee_id"`
+	ProjectID       uint       `json:"project_id,omitempty"`
+	ParentID        *uint      `json:"parent_id,omitempty"`
+	ReminderOffsets []int      `json:"reminder_offsets"`
+	Recurrence      string     `json:"recurrence"`
+	Timezone        string     `json:"timezone"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
+
+// TaskColumns is the header of an exported CSV. Imports ignore id, parent_id, created_at and updated_at,
+// so an export can be imported again.
+var TaskColumns = []string{"id", "external_id", "title", "description", "status", "priority", "due_at", "assignee_id", "project_id", "parent_id", "reminder_offsets", "recurrence", "timezone", "created_at", "updated_at"}
+
+func NewTaskRecord(t *Task) TaskRecord {
+	record := TaskRecord{
+		ID:              t.ID,
+		Title:           t.Title,
+		Description:     t.Description,
+		Status:          t.Status,
+		Priority:        t.Priority,
+		DueAt:           t.DueAt,
+		AssigneeID:      t.AssigneeID,
+		ProjectID:       t.ProjectID,
+		ParentID:        t.ParentID,
+		ReminderOffsets: t.ReminderOffsets,
+		Recurrence:      t.Recurrence,
+		Timezone:        t.Timezone,
+		CreatedAt:       &t.CreatedAt,
+		UpdatedAt:       &t.UpdatedAt,
+	}
+	if t.ExternalID != nil {
+		record.ExternalID = *t.ExternalID
+	}
+	if record.ReminderOffsets == nil {
+		record.ReminderOffsets = []int{}
+	}
+	return record
+}
+
+// Task is the new task of an imported record, the read only fields are left out
+func (r TaskRecord) Task() *Task {
+	task := &Task{
+		Title:           r.Title,
+		Description:     r.Description,
+		Status:          r.Status,
+		Priority:        r.Priority,
+		DueAt:           r.DueAt,
+		AssigneeID:      r.AssigneeID,
+		ProjectID:       r.ProjectID,
+		ReminderOffsets: r.ReminderOffsets,
+		Recurrence:      r.Recurrence,
+		Timezone:        r.Timezone,
+	}
+	if r.ExternalID != "" {
+		externalID := r.ExternalID
+		task.ExternalID = &externalID
+	}
+	return task
+}
+
+// CSV is the row of the record in the order of TaskColumns, times are RFC3339 and reminder offsets comma separated.
+// The text cells are escaped with csvText.
+func (r TaskRecord) CSV() []string {
+	offsets := make([]string, len(r.ReminderOffsets))
+	for i, offset := range r.ReminderOffsets {
+		offsets[i] = strconv.Itoa(offset)
+	}
+	return []string{
+		strconv.FormatUint(uint64(r.ID), 10),
+		csvText(r.ExternalID),
+		csvText(r.Title),
+		csvText(r.Description),
+		r.Status,
+		r.Priority,
+		csvTime(r.DueAt),
+		csvID(r.AssigneeID),
+		strconv.FormatUint(uint64(r.ProjectID), 10),
+		csvID(r.ParentID),
+		strings.Join(offsets, ","),
+		r.Recurrence,
+		r.Timezone,
+		csvTime(r.CreatedAt),
+		csvTime(r.UpdatedAt),
+	}
+}
+
+// ParseTaskCSV reads a row under header, the header has to be checked with CheckTaskHeader first.
+// Empty cells keep the zero value.
+func ParseTaskCSV(header []string, row []string) (TaskRecord, error) {
+	var record TaskRecord
+	for i, column := range header {
+		if i >= len(row) {
+			break
+		}
+		value := strings.TrimSpace(row[i])
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch column {
+		case "external_id":
+			record.ExternalID = csvUnescape(value)
+		case "title":
+			record.Title = csvUnescape(value)
+		case "description":
+			record.Description = csvUnescape(row[i])
+		case "status":
+			record.Status = value
+		case "priority":
+			record.Priority = value
+		case "due_at":
+			var t time.Time
+			if t, err = time.Parse(time.RFC3339, value); err == nil {
+				record.DueAt = &t
+			}
+		case "assignee_id":
+			var id uint64
+			if id, err = strconv.ParseUint(value, 10, 0); err == nil {
+				assigneeID := uint(id)
+				record.AssigneeID = &assigneeID
+			}
+		case "project_id":
+			var id uint64
+			if id, err = strconv.ParseUint(value, 10, 0); err == nil {
+				record.ProjectID = uint(id)
+			}
+		case "recurrence":
+			record.Recurrence = value
+		case "timezone":
+			record.Timezone = value
+		case "reminder_offsets":
+			for _, part := range strings.Split(value, ",") {
+				var offset int
+				if offset, err = strconv.Atoi(strings.TrimSpace(part)); err != nil {
+					break
+				}
+				record.ReminderOffsets = append(record.ReminderOffsets, offset)
+			}
+		}
+		if err != nil {
+			return record, fmt.Errorf("invalid %s %q", column, value)
+		}
+	}
+	return record, nil
+}
+
+// CheckTaskHeader refuses unknown and repeated columns, title is required
+func CheckTaskHeader(header []string) error {
+	seen := map[string]bool{}
+	for _, column := range header {
+		if !slices.Contains(TaskColumns, column) {
+			return fmt.Errorf("unknown column %q, columns are %s", column, strings.Join(TaskColumns, ", "))
+		}
+		if seen[column] {
+			return fmt.Errorf("column %q is repeated", column)
+		}
+		seen[column] = true
+	}
+	if !seen["title"] {
+		return fmt.Errorf("the title column is required")
+	}
+	return nil
+}
+
+// csvFormulaStarts are the first characters that make spreadsheets read a cell as a formula
+const csvFormulaStarts = "=+-@\t\r"
+
+// csvText puts a ' in front of text that would be read as a formula when the export is opened in a spreadsheet
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaStarts, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvUnescape undoes csvText, an export is imported again as it was
+func csvUnescape(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaStarts, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func csvID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+const (
+	ImportCreated = "created"
+	ImportSkipped = "skipped"
+	ImportValid   = "valid" // dry run
+	ImportFailed  = "failed"
+)
+
+// ImportRowResult is the outcome of one row, Row is the line of the CSV (the header is line 1)
+// or the position of the item in JSON, from 1
+type ImportRowResult struct {
+	Row        int    `json:"row"`
+	ExternalID string `json:"external_id,omitempty"`
+	Result     string `json:"result"`
+	// the created task, or the existing one with the same external_id for skipped rows
+	ID    uint   `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Skipped int               `json:"skipped"`
+	Valid   int               `json:"valid"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
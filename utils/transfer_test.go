@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestTaskCSVEscapesFormulas(t *testing.T) {
+	record := TaskRecord{ExternalID: "-12", Title: "=HYPERLINK(\"http://evil\")", Description: "@SUM(A1)", ReminderOffsets: []int{}}
+
+	row := record.CSV()
+	for i, want := range map[int]string{1: "'-12", 2: "'=HYPERLINK(\"http://evil\")", 3: "'@SUM(A1)"} {
+		if row[i] != want {
+			t.Errorf("%s cell = %q, want %q", TaskColumns[i], row[i], want)
+		}
+	}
+
+	parsed, err := ParseTaskCSV(TaskColumns, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.ExternalID != record.ExternalID || parsed.Title != record.Title || parsed.Description != record.Description {
+		t.Errorf("imported %+v, want the exported %+v", parsed, record)
+	}
+
+	// a ' that doesn't escape a formula is kept
+	if got := csvUnescape("'quoted'"); got != "'quoted'" {
+		t.Errorf("csvUnescape = %q", got)
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Events sent to webhooks, a task closed as done is task.completed instead of task.updated
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskCompleted = "task.completed"
+	EventTaskDeleted   = "task.deleted"
+	// only sent by POST /webhooks/:id/test
+	EventPing = "ping"
+)
+
+var WebhookEvents = []string{EventTaskCreated, EventTaskUpdated, EventTaskCompleted, EventTaskDeleted}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// gave up after the last attempt
+	DeliveryFailed = "failed"
+)
+
+// StringList is a list of strings stored in a jsonb column
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal([]string(l))
+	return string(b), err
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]string)(l))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]string)(l))
+	default:
+		return errors.New("unsupported type for StringList")
+	}
+}
+
+// Webhook is a subscription of a user to the task events of a project, or of all the projects they are a member of
+type Webhook struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"not null;index" json:"user_id"`
+	// nil for every project of the user
+	ProjectID *uint  `gorm:"index" json:"project_id"`
+	URL       string `gorm:"not null" json:"url"`
+	// signs the payloads, only shown in the response that created the webhook
+	Secret string `gorm:"not null" json:"-"`
+	// nil for all events
+	Events StringList `gorm:"type:jsonb" json:"events"`
+	// inactive webhooks keep their pending deliveries until they are active again
+	Active    bool      `gorm:"not null;default:true" json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookRequest struct {
+	URL       string   `json:"url" validate:"required,url,max=2048"`
+	ProjectID *uint    `json:"project_id"`
+	Events    []string `json:"events" validate:"omitempty,dive,oneof=task.created task.updated task.completed task.deleted"`
+	// true when left out
+	Active *bool `json:"active"`
+}
+
+// WebhookDelivery is one event for one webhook. Pending deliveries are the outbox the delivery job sends
+// from, the sent ones are the delivery log of GET /webhooks/:id/deliveries.
+type WebhookDelivery struct {
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	WebhookID uint    `gorm:"not null;index" json:"webhook_id"`
+	Webhook   Webhook `json:"-"`
+	// the same in the deliveries of one event to several webhooks, receivers dedupe on it
+	EventID string `gorm:"not null" json:"event_id"`
+	Event   string `gorm:"not null" json:"event"`
+	Payload JSONB  `gorm:"type:jsonb" json:"payload"`
+	Status  string `gorm:"not null;default:pending;index:idx_webhook_delivery_due,priority:1" json:"status"`
+	// attempts made so far, the last one is described by the response and error fields
+	Attempts int `gorm:"not null;default:0" json:"attempts"`
+	// when a pending delivery is sent next, pushed forward while a worker is sending it
+	NextAttemptAt  time.Time  `gorm:"index:idx_webhook_delivery_due,priority:2" json:"next_attempt_at"`
+	ResponseStatus int        `json:"response_status"`
+	ResponseBody   string     `json:"response_body"`
+	Error          string     `json:"error"`
+	DurationMs     int64      `json:"duration_ms"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// WebhookPayload is the body POSTed to the webhook
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	ActorID   *uint       `json:"actor_id"`
+	Data      WebhookData `json:"data"`
+}
+
+type WebhookData struct {
+	// the task after the change, before it for task.deleted
+	Task JSONB `json:"task,omitempty"`
+	// {"field": {"before": x, "after": y}} of task.updated and task.completed
+	Changes JSONB `json:"changes,omitempty"`
+}
+
+// WebhookDeliveryFilter of GET /webhooks/:id/deliveries, an empty Status doesn't filter
+type WebhookDeliveryFilter struct {
+	WebhookID uint
+	Status    string
+	Offset    int
+	Limit     int
+}
+
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      int64             `json:"total"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+}